@@ -0,0 +1,123 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This binary rewrites the legacy networks annotations of multus 3.x, whose
+// "ips" and "default-route" are single strings, to lists
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+func main() {
+	annotation := pflag.StringP("annotation", "", "", "normalize the given networks annotation and print it, instead of scanning the pods")
+	kubeconfig := pflag.StringP("kubeconfig", "", "", "specify kubernetes config, in-cluster config if not set")
+	namespace := pflag.StringP("namespace", "n", metav1.NamespaceAll, "namespace of the pods to scan, all namespaces if not set")
+	annotationPrefix := pflag.StringP("annotation-prefix", "", types.DefaultAnnotationPrefix, "prefix of the networks annotation key")
+	patch := pflag.BoolP("patch", "", false, "patch the pods with the normalized annotation, instead of only printing it")
+	helpFlag := pflag.BoolP("help", "h", false, "show help message and quit")
+
+	pflag.Parse()
+	if *helpFlag {
+		pflag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *annotation != "" {
+		normalized, _, err := types.NormalizeNetworkSelectionElements(*annotation)
+		if err != nil {
+			klog.Fatalf("invalid annotation: %v", err)
+		}
+		fmt.Println(normalized)
+		return
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		klog.Fatalf("cannot get kubernetes config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		klog.Fatalf("cannot create kubernetes client: %v", err)
+	}
+
+	migrated, err := migratePods(context.Background(), client, *namespace, types.AnnotationKey(*annotationPrefix, types.NetworksAnnotation), *patch, os.Stdout)
+	if err != nil {
+		klog.Fatalf("failed to migrate the pods: %v", err)
+	}
+	if *patch {
+		klog.Infof("%d pods patched", migrated)
+	} else {
+		klog.Infof("%d pods to patch, run with --patch to patch them", migrated)
+	}
+}
+
+// migratePods prints, and patches if patch is set, the pods of namespace
+// whose networks annotation, of key annotationKey, has legacy forms. It
+// returns the number of these pods. Pods with an invalid annotation are
+// reported and skipped.
+func migratePods(ctx context.Context, client kubernetes.Interface, namespace, annotationKey string, patch bool, out io.Writer) (int, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the pods: %v", err)
+	}
+
+	migrated := 0
+	for _, pod := range pods.Items {
+		annotation, ok := pod.Annotations[annotationKey]
+		if !ok {
+			continue
+		}
+		normalized, changed, err := types.NormalizeNetworkSelectionElements(annotation)
+		if err != nil {
+			fmt.Fprintf(out, "%s/%s: skipped, invalid annotation: %v\n", pod.Namespace, pod.Name, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		fmt.Fprintf(out, "%s/%s: %s -> %s\n", pod.Namespace, pod.Name, annotation, normalized)
+		migrated++
+		if !patch {
+			continue
+		}
+
+		data, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{annotationKey: normalized},
+			},
+		})
+		if err != nil {
+			return migrated, err
+		}
+		if _, err := client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, k8stypes.MergePatchType, data, metav1.PatchOptions{}); err != nil {
+			return migrated, fmt.Errorf("failed to patch pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	return migrated, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// disable dot-imports only for testing
+//revive:disable:dot-imports
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:golint
+	. "github.com/onsi/gomega"    //nolint:golint
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAnnotationMigrator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "annotation_migrator")
+}
+
+const networksKey = "k8s.v1.cni.cncf.io/networks"
+
+func newPod(namespace, name, networks string) *v1.Pod {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	if networks != "" {
+		pod.Annotations = map[string]string{networksKey: networks}
+	}
+	return pod
+}
+
+var _ = Describe("annotation_migrator", func() {
+	var client *fake.Clientset
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset(
+			newPod("test", "legacy-ips", `[{"name": "net1", "ips": "10.1.1.4/24"}]`),
+			newPod("test", "legacy-route", `[{"name": "net1", "ips": ["10.1.1.5/24"], "default-route": "10.1.1.1"}]`),
+			newPod("test", "lists", `[{"name": "net1", "ips": ["10.1.1.6/24"]}]`),
+			newPod("test", "comma-delimited", `net1,net2`),
+			newPod("test", "invalid", `[{"name": "net1", "ips": "10.1.1.400"}]`),
+			newPod("test", "no-networks", ""),
+			newPod("other", "legacy-ips", `[{"name": "net1", "ips": "10.2.1.4"}]`),
+		)
+	})
+
+	networks := func(namespace, name string) string {
+		pod, err := client.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return pod.Annotations[networksKey]
+	}
+
+	It("prints the legacy annotations without patching the pods", func() {
+		out := &bytes.Buffer{}
+		migrated, err := migratePods(context.TODO(), client, "test", networksKey, false, out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(Equal(2))
+		Expect(out.String()).To(ContainSubstring(`test/legacy-ips: [{"name": "net1", "ips": "10.1.1.4/24"}] -> [{"ips":["10.1.1.4/24"],"name":"net1"}]`))
+		Expect(out.String()).To(ContainSubstring("test/legacy-route: "))
+		Expect(out.String()).To(ContainSubstring(`test/invalid: skipped, invalid annotation: failed to parse IP address "10.1.1.400"`))
+		Expect(out.String()).NotTo(ContainSubstring("other/"))
+		Expect(networks("test", "legacy-ips")).To(Equal(`[{"name": "net1", "ips": "10.1.1.4/24"}]`))
+	})
+
+	It("patches the pods with the normalized annotations", func() {
+		migrated, err := migratePods(context.TODO(), client, metav1.NamespaceAll, networksKey, true, &bytes.Buffer{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(Equal(3))
+		Expect(networks("test", "legacy-ips")).To(MatchJSON(`[{"name": "net1", "ips": ["10.1.1.4/24"]}]`))
+		Expect(networks("test", "legacy-route")).To(MatchJSON(`[{"name": "net1", "ips": ["10.1.1.5/24"], "default-route": ["10.1.1.1"]}]`))
+		Expect(networks("other", "legacy-ips")).To(MatchJSON(`[{"name": "net1", "ips": ["10.2.1.4"]}]`))
+		// the other pods are left alone
+		Expect(networks("test", "lists")).To(Equal(`[{"name": "net1", "ips": ["10.1.1.6/24"]}]`))
+		Expect(networks("test", "comma-delimited")).To(Equal("net1,net2"))
+		Expect(networks("test", "invalid")).To(Equal(`[{"name": "net1", "ips": "10.1.1.400"}]`))
+		Expect(networks("test", "no-networks")).To(BeEmpty())
+	})
+})
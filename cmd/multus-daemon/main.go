@@ -36,8 +36,10 @@ import (
 	srv "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/api"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/tracing"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -48,6 +50,9 @@ func main() {
 	version := flag.Bool("version", false, "Show version")
 
 	configFilePath := flag.String("config", srv.DefaultMultusDaemonConfigFile, "Specify the path to the multus-daemon configuration")
+	reconcileOrphans := flag.Bool("reconcile-orphans", false, "Remove the cache of containers whose network namespace is gone at startup")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration, with defaults applied and secrets redacted, and exit")
+	validateOnly := flag.Bool("validate-only", false, "Validate the configuration, and the one generated with multusConfigFile=auto, and exit")
 
 	flag.Parse()
 
@@ -70,8 +75,40 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *printConfig {
+		effectiveConfig, err := srv.EffectiveDaemonConfig(daemonConf, multusConf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get the effective configuration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(effectiveConfig))
+		os.Exit(0)
+	}
+
+	if *validateOnly {
+		if err := validateConfig(multusConf); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("configuration is valid")
+		os.Exit(0)
+	}
+
 	logging.Verbosef("multus-daemon started")
 
+	if daemonConf.Tracing != nil && daemonConf.Tracing.Endpoint != "" {
+		shutdownTracing, err := tracing.Setup(ctx, daemonConf.Tracing.Endpoint, daemonConf.Tracing.Insecure)
+		if err != nil {
+			_ = logging.Errorf("failed to set up tracing, CNI operations are not traced: %v", err)
+		} else {
+			defer func() {
+				if err := shutdownTracing(context.Background()); err != nil {
+					_ = logging.Errorf("failed to flush the traces: %v", err)
+				}
+			}()
+		}
+	}
+
 	if multusConf.ReadinessIndicatorFile != "" {
 		// Check readinessindicator file before daemon launch
 		logging.Verbosef("Readiness Indicator file check")
@@ -82,6 +119,17 @@ func main() {
 		logging.Verbosef("Readiness Indicator file check done!")
 	}
 
+	cniDir := multusConf.CniDir
+	if cniDir == "" {
+		cniDir = types.GetDefaultNetConf().CNIDir
+	}
+	orphans, err := srv.ReconcileOrphans(cniDir, *reconcileOrphans)
+	if err != nil {
+		_ = logging.Errorf("failed to reconcile the cache of gone containers: %v", err)
+	} else if len(orphans) > 0 {
+		logging.Verbosef("found the cache of %d gone containers in %s (removed: %t)", len(orphans), cniDir, *reconcileOrphans)
+	}
+
 	var configManager *config.Manager
 	var ignoreReadinessIndicator bool
 	if multusConf.MultusConfigFile == "auto" {
@@ -95,6 +143,9 @@ func main() {
 			_ = logging.Errorf("failed to create the configuration manager for the primary CNI plugin: %v", err)
 			os.Exit(2)
 		}
+		if err := configManager.RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+			_ = logging.Errorf("failed to register the config generation metrics: %v", err)
+		}
 		// ConfigManager watches the readiness indicator file (if configured)
 		// and exits the daemon when that is removed. The CNIServer does
 		// not need to re-do that check every CNI operation
@@ -105,7 +156,7 @@ func main() {
 		}
 	}
 
-	if err := startMultusDaemon(ctx, daemonConf, ignoreReadinessIndicator); err != nil {
+	if err := startMultusDaemon(ctx, daemonConf, configManager, ignoreReadinessIndicator); err != nil {
 		logging.Panicf("failed start the multus thick-plugin listener: %v", err)
 		os.Exit(3)
 	}
@@ -127,6 +178,14 @@ func main() {
 		}
 	}()
 
+	logLevelCh := make(chan os.Signal, 1)
+	signal.Notify(logLevelCh, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range logLevelCh {
+			handleLogLevelSignal(sig)
+		}
+	}()
+
 	var wg sync.WaitGroup
 	if configManager != nil {
 		if err := configManager.Start(ctx, &wg); err != nil {
@@ -139,7 +198,57 @@ func main() {
 	logging.Verbosef("multus daemon is exited")
 }
 
-func startMultusDaemon(ctx context.Context, daemonConfig *srv.ControllerNetConf, ignoreReadinessIndicator bool) error {
+// validateConfig checks the multus configuration the daemon would write, i.e.
+// the one generated from the primary CNI configuration with
+// multusConfigFile=auto, or the user provided one otherwise
+func validateConfig(multusConf *config.MultusConf) error {
+	var netConf []byte
+	if multusConf.MultusConfigFile == "auto" {
+		if multusConf.CNIVersion == "" {
+			return fmt.Errorf("the CNI version is a mandatory parameter when the '-multus-config-file=auto' option is used")
+		}
+		generatedConfig, err := config.ValidateConfig(*multusConf)
+		if err != nil {
+			return fmt.Errorf("failed to generate the multus configuration: %v", err)
+		}
+		netConf = []byte(generatedConfig)
+	} else {
+		var err error
+		if netConf, err = os.ReadFile(multusConf.MultusConfigFile); err != nil {
+			return fmt.Errorf("failed to read the multus configuration: %v", err)
+		}
+	}
+	if _, err := types.LoadNetConf(netConf); err != nil {
+		return fmt.Errorf("invalid multus configuration: %v", err)
+	}
+	return nil
+}
+
+// metricsAddress returns the address of the metric exporter, if any
+func metricsAddress(daemonConfig *srv.ControllerNetConf) string {
+	if daemonConfig.MetricsAddress != "" {
+		return daemonConfig.MetricsAddress
+	}
+	if daemonConfig.MetricsPort != nil {
+		return fmt.Sprintf(":%d", *daemonConfig.MetricsPort)
+	}
+	return ""
+}
+
+// handleLogLevelSignal raises the log level by one on SIGUSR1, e.g. to capture
+// verbose logs during an incident, and restores the configured one on SIGUSR2
+func handleLogLevelSignal(sig os.Signal) {
+	switch sig {
+	case syscall.SIGUSR1:
+		level := logging.RaiseLogLevel()
+		logging.Verbosef("caught %v, log level raised to %s", sig, level)
+	case syscall.SIGUSR2:
+		level := logging.ResetLogLevel()
+		logging.Verbosef("caught %v, log level reset to %s", sig, level)
+	}
+}
+
+func startMultusDaemon(ctx context.Context, daemonConfig *srv.ControllerNetConf, configManager *config.Manager, ignoreReadinessIndicator bool) error {
 	if user, err := user.Current(); err != nil || user.Uid != "0" {
 		return fmt.Errorf("failed to run multus-daemon with root: %v, now running in uid: %s", err, user.Uid)
 	}
@@ -152,12 +261,15 @@ func startMultusDaemon(ctx context.Context, daemonConfig *srv.ControllerNetConf,
 	if err != nil {
 		return fmt.Errorf("failed to create the server: %v", err)
 	}
+	if configManager != nil {
+		server.SetConfigManager(configManager)
+	}
 
-	if daemonConfig.MetricsPort != nil {
+	if metricsAddress := metricsAddress(daemonConfig); metricsAddress != "" {
+		http.Handle("/metrics", promhttp.Handler())
 		go utilwait.UntilWithContext(ctx, func(_ context.Context) {
-			http.Handle("/metrics", promhttp.Handler())
-			logging.Debugf("metrics port: %d", *daemonConfig.MetricsPort)
-			logging.Debugf("metrics: %s", http.ListenAndServe(fmt.Sprintf(":%d", *daemonConfig.MetricsPort), nil))
+			logging.Debugf("metrics address: %s", metricsAddress)
+			logging.Debugf("metrics: %s", http.ListenAndServe(metricsAddress, nil))
 		}, 0)
 	}
 
@@ -168,6 +280,14 @@ func startMultusDaemon(ctx context.Context, daemonConfig *srv.ControllerNetConf,
 
 	server.Start(ctx, l)
 
+	if daemonConfig.EnableGRPC {
+		grpcListener, err := srv.GetListener(api.GRPCSocketPath(daemonConfig.SocketDir))
+		if err != nil {
+			return fmt.Errorf("failed to start the gRPC CNI server using socket %s. Reason: %+v", api.GRPCSocketPath(daemonConfig.SocketDir), err)
+		}
+		server.StartGRPC(ctx, grpcListener)
+	}
+
 	go func() {
 		<-ctx.Done()
 		server.Shutdown(context.Background())
@@ -0,0 +1,99 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// disable dot-imports only for testing
+//revive:disable:dot-imports
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:golint
+	. "github.com/onsi/gomega"    //nolint:golint
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
+)
+
+func TestMultusDaemon(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "multus-daemon")
+}
+
+var _ = Describe("multus-daemon", func() {
+	AfterEach(func() {
+		logging.ResetLogLevel()
+	})
+
+	It("raises the log level on SIGUSR1 and resets it on SIGUSR2", func() {
+		logging.SetLogLevel("verbose")
+
+		handleLogLevelSignal(syscall.SIGUSR1)
+		Expect(logging.GetLoggingLevel()).To(Equal(logging.DebugLevel))
+		handleLogLevelSignal(syscall.SIGUSR1)
+		Expect(logging.GetLoggingLevel()).To(Equal(logging.DebugLevel))
+
+		// a request reloading the configured level does not undo the raise
+		logging.SetLogLevel("verbose")
+		Expect(logging.GetLoggingLevel()).To(Equal(logging.DebugLevel))
+
+		handleLogLevelSignal(syscall.SIGUSR2)
+		Expect(logging.GetLoggingLevel()).To(Equal(logging.VerboseLevel))
+	})
+
+	DescribeTable("validates the configuration generated from the master config", func(masterConfig, expectedErr string) {
+		confDir := GinkgoT().TempDir()
+		masterPath := filepath.Join(confDir, "10-mycni.conf")
+		Expect(os.WriteFile(masterPath, []byte(masterConfig), 0600)).To(Succeed())
+
+		err := validateConfig(&config.MultusConf{
+			CNIVersion:          "0.4.0",
+			CniConfigDir:        confDir,
+			MultusConfigFile:    "auto",
+			MultusAutoconfigDir: confDir,
+			Type:                "multus-shim",
+		})
+		if expectedErr == "" {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		}
+
+		// nothing is persisted, and the master config is left alone
+		Expect(filepath.Join(confDir, "00-multus.conf")).NotTo(BeAnExistingFile())
+		Expect(os.ReadFile(masterPath)).To(BeEquivalentTo(masterConfig))
+	},
+		Entry("valid master config", `{"cniVersion": "0.4.0", "name": "mycni", "type": "mycni"}`, ""),
+		Entry("invalid JSON", `{"cniVersion": "0.4.0",`, "failed to unmarshall primary CNI config"),
+		Entry("incompatible cniVersion", `{"cniVersion": "0.3.1", "name": "mycni", "type": "mycni"}`, "delegate cni version is 0.3.1 while top level cni version is 0.4.0"),
+	)
+
+	It("fails the validation without a master config", func() {
+		confDir := GinkgoT().TempDir()
+		err := validateConfig(&config.MultusConf{CNIVersion: "0.4.0", MultusConfigFile: "auto", MultusAutoconfigDir: confDir})
+		Expect(err).To(MatchError(ContainSubstring("could not find a plugin configuration")))
+	})
+
+	It("validates a user provided configuration", func() {
+		confPath := filepath.Join(GinkgoT().TempDir(), "00-multus.conf")
+		Expect(os.WriteFile(confPath, []byte(`{"cniVersion": "0.4.0", "name": "multus", "type": "multus", "clusterNetwork": "mycni"}`), 0600)).To(Succeed())
+		Expect(validateConfig(&config.MultusConf{MultusConfigFile: confPath})).To(Succeed())
+
+		Expect(os.WriteFile(confPath, []byte(`{"cniVersion": "0.4.0", "name": "multus", "type": "multus"}`), 0600)).To(Succeed())
+		Expect(validateConfig(&config.MultusConf{MultusConfigFile: confPath})).To(MatchError(ContainSubstring("at least one delegate/clusterNetwork must be specified")))
+	})
+})
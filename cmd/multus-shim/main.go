@@ -38,11 +38,25 @@ func main() {
 	flag.BoolVar(&versionOpt, "version", false, "Show application version")
 	flag.BoolVar(&versionOpt, "v", false, "Show application version")
 
+	// add daemon connectivity check flags
+	checkDaemon := flag.Bool("check-daemon", false, "Ask multus-daemon for its version over its socket and exit")
+	daemonSocketDir := flag.String("daemon-socket-dir", "", "Directory of the multus-daemon sockets for --check-daemon (default /run/multus/)")
+	daemonTransport := flag.String("daemon-transport", api.TransportHTTP, "API of multus-daemon for --check-daemon: http or grpc")
+
 	flag.Parse()
 	if versionOpt {
 		fmt.Printf("multus-shim: %s\n", multus.PrintVersionString())
 		return
 	}
+	if *checkDaemon {
+		version, err := api.CheckDaemon(*daemonSocketDir, *daemonTransport)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "multus-daemon is not reachable: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("multus-daemon: %s\n", version)
+		return
+	}
 
 	skel.PluginMainFuncs(
 		skel.CNIFuncs{
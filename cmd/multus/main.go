@@ -19,15 +19,52 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/skel"
 	cniversion "github.com/containernetworking/cni/pkg/version"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
 )
 
+// debugSummaryEnv enables, when "true", the summary of the delegates of an
+// ADD and of their results on stderr, for debugging
+const debugSummaryEnv = "MULTUS_DEBUG_SUMMARY"
+
+// cniFuncs returns the CNI commands of multus, printing the ADD result to
+// stdout and the debug summary, if enabled, to stderr
+func cniFuncs(exec invoke.Exec, stdout, stderr io.Writer) skel.CNIFuncs {
+	return skel.CNIFuncs{
+		Add: func(args *skel.CmdArgs) error {
+			ctx := context.Background()
+			if os.Getenv(debugSummaryEnv) == "true" {
+				ctx = multus.WithDelegateSummary(ctx, stderr)
+			}
+			result, err := multus.CmdAddContext(ctx, args, exec, nil)
+			if err != nil {
+				return err
+			}
+			return result.PrintTo(stdout)
+		},
+		Del: func(args *skel.CmdArgs) error {
+			return multus.CmdDel(args, exec, nil)
+		},
+		Check: func(args *skel.CmdArgs) error {
+			return multus.CmdCheck(args, exec, nil)
+		},
+		GC: func(args *skel.CmdArgs) error {
+			return multus.CmdGC(args, exec, nil)
+		},
+		Status: func(args *skel.CmdArgs) error {
+			return multus.CmdStatus(args, exec, nil)
+		},
+	}
+}
+
 func main() {
 
 	// Init command line flags to clear vendored packages' one, especially in init()
@@ -43,27 +80,6 @@ func main() {
 		return
 	}
 
-	skel.PluginMainFuncs(
-		skel.CNIFuncs{
-			Add: func(args *skel.CmdArgs) error {
-				result, err := multus.CmdAdd(args, nil, nil)
-				if err != nil {
-					return err
-				}
-				return result.Print()
-			},
-			Del: func(args *skel.CmdArgs) error {
-				return multus.CmdDel(args, nil, nil)
-			},
-			Check: func(args *skel.CmdArgs) error {
-				return multus.CmdCheck(args, nil, nil)
-			},
-			GC: func(args *skel.CmdArgs) error {
-				return multus.CmdGC(args, nil, nil)
-			},
-			Status: func(args *skel.CmdArgs) error {
-				return multus.CmdStatus(args, nil, nil)
-			},
-		},
+	skel.PluginMainFuncs(cniFuncs(nil, os.Stdout, os.Stderr),
 		cniversion.All, "meta-plugin that delegates to other CNI plugins")
 }
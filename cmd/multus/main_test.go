@@ -0,0 +1,139 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// disable dot-imports only for testing
+//revive:disable:dot-imports
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	cniversion "github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:golint
+	. "github.com/onsi/gomega"    //nolint:golint
+)
+
+func TestMultus(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "multus")
+}
+
+// resultExec returns, to the ADD of each interface, its result
+type resultExec struct {
+	cniversion.PluginDecoder
+	results map[string]string
+}
+
+func (e *resultExec) ExecPlugin(_ context.Context, _ string, _ []byte, environ []string) ([]byte, error) {
+	var command, ifName string
+	for _, env := range environ {
+		if value, ok := strings.CutPrefix(env, "CNI_COMMAND="); ok {
+			command = value
+		}
+		if value, ok := strings.CutPrefix(env, "CNI_IFNAME="); ok {
+			ifName = value
+		}
+	}
+	if command != "ADD" {
+		return nil, nil
+	}
+	return []byte(e.results[ifName]), nil
+}
+
+func (e *resultExec) FindInPath(plugin string, paths []string) (string, error) {
+	return filepath.Join(paths[0], plugin), nil
+}
+
+var _ = Describe("multus thin plugin", func() {
+	var (
+		testNS ns.NetNS
+		tmpDir string
+		args   *skel.CmdArgs
+		exec   *resultExec
+	)
+
+	BeforeEach(func() {
+		var err error
+		testNS, err = testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		tmpDir, err = os.MkdirTemp("", "multus_tmp")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Setenv("CNI_PATH", "/some/path")).To(Succeed())
+
+		args = &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": %q,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    },{
+	        "name": "other1",
+	        "cniVersion": "1.0.0",
+	        "type": "other-plugin"
+	    }],
+	    "cniVersion": "1.0.0"
+	}`, tmpDir)),
+		}
+		exec = &resultExec{results: map[string]string{
+			"eth0": `{"cniVersion": "1.0.0", "ips": [{"address": "1.1.1.2/24"}]}`,
+			"net1": `{"cniVersion": "1.0.0", "ips": [{"address": "1.1.1.5/24"}]}`,
+		}}
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv(debugSummaryEnv)).To(Succeed())
+		Expect(os.Unsetenv("CNI_PATH")).To(Succeed())
+		Expect(testNS.Close()).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("summarizes the delegates of an ADD on stderr with MULTUS_DEBUG_SUMMARY", func() {
+		Expect(os.Setenv(debugSummaryEnv, "true")).To(Succeed())
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		Expect(cniFuncs(exec, stdout, stderr).Add(args)).To(Succeed())
+
+		Expect(stderr.String()).To(Equal(`multus: ADD of container 123456789, delegates in order:
+  1. weave1 on eth0
+  2. other1 on net1
+multus: result of weave1 on eth0: {"cniVersion":"1.0.0","ips":[{"address":"1.1.1.2/24"}]}
+multus: result of other1 on net1: {"cniVersion":"1.0.0","ips":[{"address":"1.1.1.5/24"}]}
+`))
+		// stdout only has the result of the ADD
+		Expect(stdout.String()).To(MatchJSON(`{"cniVersion": "1.0.0", "ips": [{"address": "1.1.1.2/24"}]}`))
+	})
+
+	It("writes nothing to stderr by default", func() {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		Expect(cniFuncs(exec, stdout, stderr).Add(args)).To(Succeed())
+
+		Expect(stderr.String()).To(BeEmpty())
+		Expect(stdout.String()).To(MatchJSON(`{"cniVersion": "1.0.0", "ips": [{"address": "1.1.1.2/24"}]}`))
+	})
+})
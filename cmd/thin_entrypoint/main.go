@@ -59,6 +59,17 @@ type Options struct {
 	ForceCNIVersion          bool
 	SkipTLSVerify            bool
 	SkipMultusConfWatch      bool
+	OneShot                  bool
+	ConfigFormat             string
+}
+
+// configState is what the watch loop needs to detect changes of the
+// generated configuration
+type configState struct {
+	masterConfigFilePath string
+	masterConfigHash     []byte
+	caHash               []byte
+	saTokenHash          []byte
 }
 
 const (
@@ -92,6 +103,8 @@ func (o *Options) addFlags() {
 	fs.StringVar(&o.ReadinessIndicatorFile, "readiness-indicator-file", "", "readiness indicator file (used only with --multus-conf-file=auto)")
 	fs.StringVar(&o.AdditionalBinDir, "additional-bin-dir", "", "adds binDir option to configuration (used only with --multus-conf-file=auto)")
 	fs.BoolVar(&o.SkipTLSVerify, "skip-tls-verify", false, "skip TLS verify")
+	fs.StringVar(&o.ConfigFormat, "config-format", "", "format the generated multus config as sorted-key JSON, 'pretty' or 'compact' (used only with --multus-conf-file=auto)")
+	fs.BoolVar(&o.OneShot, "oneshot", false, "generate the kubeconfig and multus config, then exit (e.g. as an init container)")
 	fs.BoolVar(&o.ForceCNIVersion, "force-cni-version", false, "force cni version to '--cni-version' (only for e2e-kind testing)")
 	fs.MarkHidden("force-cni-version")
 	fs.MarkHidden("skip-tls-verify")
@@ -399,7 +412,10 @@ func (o *Options) createMultusConfig(prevMasterConfigFileHash []byte) (string, [
 		if !ok {
 			return "", nil, fmt.Errorf("cannot get 'plugins' field in master CNI config file %q: %v", masterConfigPath, err)
 		}
-		masterPlugins := masterPluginsElem.([]interface{})
+		masterPlugins, ok := masterPluginsElem.([]interface{})
+		if !ok || len(masterPlugins) == 0 {
+			return "", nil, fmt.Errorf("'plugins' field in master CNI config file %q must be a non-empty list", masterConfigPath)
+		}
 		for _, v := range masterPlugins {
 			pluginFields := v.(map[string]interface{})
 			capabilitiesElem, ok := pluginFields["capabilities"]
@@ -526,9 +542,21 @@ func (o *Options) createMultusConfig(prevMasterConfigFileHash []byte) (string, [
 		"MultusKubeConfigFileHost":     o.MultusKubeConfigFileHost, // be fixed?
 		"MasterPluginJSON":             string(masterPluginByte),
 	}
-	if err = templateMultusConfig.Execute(fp, templateData); err != nil {
+	var multusConfig bytes.Buffer
+	if err = templateMultusConfig.Execute(&multusConfig, templateData); err != nil {
 		return "", nil, fmt.Errorf("cannot create multus cni config: %v", err)
 	}
+	multusConfigBytes, err := cmdutils.FormatConfig(multusConfig.Bytes(), o.ConfigFormat)
+	if err != nil {
+		fp.Close()
+		os.Remove(tempFileName)
+		return "", nil, fmt.Errorf("cannot format multus cni config: %v", err)
+	}
+	if _, err := fp.Write(multusConfigBytes); err != nil {
+		fp.Close()
+		os.Remove(tempFileName)
+		return "", nil, fmt.Errorf("cannot write multus cni config: %v", err)
+	}
 
 	if err := fp.Sync(); err != nil {
 		os.Remove(tempFileName)
@@ -555,6 +583,48 @@ func (o *Options) createMultusConfig(prevMasterConfigFileHash []byte) (string, [
 	return masterConfigPath, masterConfigFileHash, nil
 }
 
+// generateConfig copies the multus binary, then creates the kubeconfig and
+// the multus config, either copied from --multus-conf-file or generated
+func (o *Options) generateConfig() (*configState, error) {
+	if err := o.verifyFileExists(); err != nil {
+		return nil, err
+	}
+
+	// copy multus binary
+	if !o.SkipMultusBinaryCopy {
+		if err := cmdutils.CopyFileAtomic(o.MultusBinFile, o.CNIBinDir, "_multus", "multus"); err != nil {
+			return nil, fmt.Errorf("failed at multus copy: %v", err)
+		}
+	}
+
+	state := &configState{}
+	var err error
+	state.caHash, state.saTokenHash, err = o.createKubeConfig(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multus kubeconfig: %v", err)
+	}
+
+	// copy user specified multus conf to CNI conf directory
+	if o.MultusConfFile != "auto" {
+		confFileName := filepath.Base(o.MultusConfFile)
+		tempConfFileName := fmt.Sprintf("%s.temp", confFileName)
+		if err = cmdutils.CopyFileAtomic(o.MultusConfFile, o.CNIConfDir, tempConfFileName, confFileName); err != nil {
+			return nil, fmt.Errorf("failed at copy multus conf file: %v", err)
+		}
+		fmt.Printf("multus config file %s is copied.\n", o.MultusConfFile)
+		return state, nil
+	}
+
+	// auto generate multus config
+	fmt.Printf("kubeconfig file is created.\n")
+	state.masterConfigFilePath, state.masterConfigHash, err = o.createMultusConfig(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multus config: %v", err)
+	}
+	fmt.Printf("multus config file is created.\n")
+	return state, nil
+}
+
 func main() {
 	opt := Options{}
 	opt.addFlags()
@@ -566,51 +636,20 @@ func main() {
 		os.Exit(1)
 	}
 
-	err := opt.verifyFileExists()
+	state, err := opt.generateConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return
-	}
-
-	// copy multus binary
-	if !opt.SkipMultusBinaryCopy {
-		// Copy
-		if err = cmdutils.CopyFileAtomic(opt.MultusBinFile, opt.CNIBinDir, "_multus", "multus"); err != nil {
-			fmt.Fprintf(os.Stderr, "failed at multus copy: %v\n", err)
-			return
+		if opt.OneShot {
+			os.Exit(1)
 		}
+		return
 	}
-
-	var masterConfigHash, caHash, saTokenHash []byte
-	var masterConfigFilePath string
-	// copy user specified multus conf to CNI conf directory
-	if opt.MultusConfFile != "auto" {
-		caHash, saTokenHash, err = opt.createKubeConfig(nil, nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to create multus kubeconfig: %v\n", err)
-			return
-		}
-		confFileName := filepath.Base(opt.MultusConfFile)
-		tempConfFileName := fmt.Sprintf("%s.temp", confFileName)
-		if err = cmdutils.CopyFileAtomic(opt.MultusConfFile, opt.CNIConfDir, tempConfFileName, confFileName); err != nil {
-			fmt.Fprintf(os.Stderr, "failed at copy multus conf file: %v\n", err)
-			return
-		}
-		fmt.Printf("multus config file %s is copied.\n", opt.MultusConfFile)
-	} else { // auto generate multus config
-		caHash, saTokenHash, err = opt.createKubeConfig(nil, nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to create multus kubeconfig: %v\n", err)
-			return
-		}
-		fmt.Printf("kubeconfig file is created.\n")
-		masterConfigFilePath, masterConfigHash, err = opt.createMultusConfig(nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to create multus config: %v\n", err)
-			return
-		}
-		fmt.Printf("multus config file is created.\n")
+	if opt.OneShot {
+		fmt.Printf("oneshot mode, exiting.\n")
+		return
 	}
+	masterConfigFilePath, masterConfigHash := state.masterConfigFilePath, state.masterConfigHash
+	caHash, saTokenHash := state.caHash, state.saTokenHash
 
 	ctx := signals.SetupSignalHandler()
 
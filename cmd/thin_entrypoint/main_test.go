@@ -155,6 +155,59 @@ var _ = Describe("thin entrypoint testing", func() {
 		Expect(os.RemoveAll(tmpDir)).To(Succeed())
 	})
 
+	It("Run createMultusConfig(), configFormat, conf", func() {
+		// create directory and files
+		tmpDir, err := os.MkdirTemp("", "multus_thin_entrypoint_tmp")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+
+		multusAutoConfigDir := fmt.Sprintf("%s/auto_conf", tmpDir)
+		cniConfDir := fmt.Sprintf("%s/cni_conf", tmpDir)
+
+		Expect(os.Mkdir(multusAutoConfigDir, 0755)).To(Succeed())
+		Expect(os.Mkdir(cniConfDir, 0755)).To(Succeed())
+
+		// create master CNI config
+		masterCNIConfig := `
+		{
+			"cniVersion": "0.3.1",
+			"name": "test1",
+			"capabilities": { "portMappings": true, "bandwidth": true },
+			"type": "cnitesttype"
+		}`
+		Expect(os.WriteFile(fmt.Sprintf("%s/10-testcni.conf", multusAutoConfigDir), []byte(masterCNIConfig), 0755)).To(Succeed())
+
+		generate := func(configFormat string) string {
+			_, _, err := (&Options{
+				MultusAutoconfigDir:      multusAutoConfigDir,
+				CNIConfDir:               cniConfDir,
+				MultusKubeConfigFileHost: "/etc/foobar_kubeconfig",
+				ConfigFormat:             configFormat,
+			}).createMultusConfig(nil)
+			Expect(err).NotTo(HaveOccurred())
+			conf, err := os.ReadFile(fmt.Sprintf("%s/00-multus.conf", cniConfDir))
+			Expect(err).NotTo(HaveOccurred())
+			return string(conf)
+		}
+
+		expectedResult := `{"capabilities":{"bandwidth":true,"portMappings":true},"cniVersion":"0.3.1","delegates":[{"capabilities":{"bandwidth":true,"portMappings":true},"cniVersion":"0.3.1","name":"test1","type":"cnitesttype"}],"kubeconfig":"/etc/foobar_kubeconfig","logToStderr":false,"name":"multus-cni-network","type":"multus"}` + "\n"
+		Expect(generate("compact")).To(Equal(expectedResult))
+		// identical inputs produce byte-identical configs
+		Expect(generate("compact")).To(Equal(expectedResult))
+
+		pretty := generate("pretty")
+		Expect(pretty).To(HavePrefix("{\n    \"capabilities\": {\n        \"bandwidth\": true,\n"))
+		Expect(generate("pretty")).To(Equal(pretty))
+		Expect(pretty).To(MatchJSON(expectedResult))
+
+		_, _, err = (&Options{
+			MultusAutoconfigDir: multusAutoConfigDir,
+			CNIConfDir:          cniConfDir,
+			ConfigFormat:        "yaml",
+		}).createMultusConfig(nil)
+		Expect(err).To(MatchError(`cannot format multus cni config: unknown config format "yaml", must be "pretty" or "compact"`))
+	})
+
 	It("Run createMultusConfig(), capabilities, conf", func() {
 		// create directory and files
 		tmpDir, err := os.MkdirTemp("", "multus_thin_entrypoint_tmp")
@@ -318,6 +371,39 @@ var _ = Describe("thin entrypoint testing", func() {
 		Expect(os.RemoveAll(tmpDir)).To(Succeed())
 	})
 
+	It("Run createMultusConfig(), empty plugins, conflist", func() {
+		// create directory and files
+		tmpDir, err := os.MkdirTemp("", "multus_thin_entrypoint_tmp")
+		Expect(err).NotTo(HaveOccurred())
+
+		multusAutoConfigDir := fmt.Sprintf("%s/auto_conf", tmpDir)
+		cniConfDir := fmt.Sprintf("%s/cni_conf", tmpDir)
+
+		Expect(os.Mkdir(multusAutoConfigDir, 0755)).To(Succeed())
+		Expect(os.Mkdir(cniConfDir, 0755)).To(Succeed())
+
+		// create master CNI config
+		masterCNIConfig := `
+		{
+			"cniVersion": "1.0.0",
+			"name": "test1",
+			"plugins": []
+		}`
+		Expect(os.WriteFile(fmt.Sprintf("%s/10-testcni.conflist", multusAutoConfigDir), []byte(masterCNIConfig), 0755)).To(Succeed())
+
+		_, _, err = (&Options{
+			MultusAutoconfigDir:      multusAutoConfigDir,
+			CNIConfDir:               cniConfDir,
+			MultusKubeConfigFileHost: "/etc/foobar_kubeconfig",
+		}).createMultusConfig(nil)
+		Expect(err).To(MatchError(ContainSubstring("must be a non-empty list")))
+
+		_, err = os.Stat(fmt.Sprintf("%s/00-multus.conflist", cniConfDir))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
 	It("Run createMultusConfig(), capabilities, conflist", func() {
 		// create directory and files
 		tmpDir, err := os.MkdirTemp("", "multus_thin_entrypoint_tmp")
@@ -541,4 +627,55 @@ var _ = Describe("thin entrypoint testing", func() {
 		Expect(os.RemoveAll(tmpDir)).To(Succeed())
 	})
 
+	Context("generateConfig() for --oneshot", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			tmpDir = GinkgoT().TempDir()
+			for _, dir := range []string{"cni_conf", "cni_bin", "var/run/secrets/kubernetes.io/serviceaccount"} {
+				Expect(os.MkdirAll(filepath.Join(tmpDir, dir), 0755)).To(Succeed())
+			}
+			Expect(os.WriteFile(filepath.Join(tmpDir, "multus_bin"), []byte("multus"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(tmpDir, serviceAccountCAFile), []byte("dummy-ca-content"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(tmpDir, serviceAccountTokenFile), []byte("dummy-token-content"), 0644)).To(Succeed())
+		})
+
+		generateConfig := func() (*configState, error) {
+			options := &Options{
+				CNIBinDir:                "/cni_bin",
+				CNIConfDir:               "/cni_conf",
+				MultusConfFile:           "auto",
+				MultusBinFile:            "/multus_bin",
+				MultusCNIConfDir:         "/cni_conf",
+				MultusAutoconfigDir:      "/cni_conf",
+				MultusKubeConfigFileHost: "/etc/cni/net.d/multus.d/multus.kubeconfig",
+			}
+			back, err := chrootTestHelper(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			state, err := options.generateConfig()
+			Expect(back()).To(Succeed())
+			return state, err
+		}
+
+		It("writes the binary, the kubeconfig and the multus config", func() {
+			masterCNIConfig := `{"cniVersion": "0.3.1", "name": "test1", "type": "cnitesttype"}`
+			Expect(os.WriteFile(filepath.Join(tmpDir, "cni_conf", "10-testcni.conf"), []byte(masterCNIConfig), 0644)).To(Succeed())
+
+			state, err := generateConfig()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.masterConfigFilePath).To(Equal("/cni_conf/10-testcni.conf"))
+
+			Expect(filepath.Join(tmpDir, "cni_bin", "multus")).To(BeARegularFile())
+			Expect(filepath.Join(tmpDir, "cni_conf", "multus.d", "multus.kubeconfig")).To(BeARegularFile())
+			conf, err := os.ReadFile(filepath.Join(tmpDir, "cni_conf", "00-multus.conf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(conf)).To(ContainSubstring(`"name":"test1"`))
+		})
+
+		It("fails without a master CNI config", func() {
+			_, err := generateConfig()
+			Expect(err).To(MatchError(ContainSubstring("failed to create multus config")))
+			Expect(filepath.Join(tmpDir, "cni_conf", "00-multus.conf")).NotTo(BeAnExistingFile())
+		})
+	})
 })
@@ -102,9 +102,19 @@ func (cp *checkpoint) GetPodResourceMap(pod *v1.Pod) (map[string]*types.Resource
 				entry = &types.ResourceInfo{}
 				resourceMap[pod.ResourceName] = entry
 			}
-			for _, v := range pod.DeviceIDs {
+			for numaNode, v := range pod.DeviceIDs {
 				// already exists; append to it
 				entry.DeviceIDs = append(entry.DeviceIDs, v...)
+				// the devices without NUMA affinity are under -1
+				if numaNode < 0 {
+					continue
+				}
+				if entry.NUMANodes == nil {
+					entry.NUMANodes = map[string]int64{}
+				}
+				for _, deviceID := range v {
+					entry.NUMANodes[deviceID] = numaNode
+				}
 			}
 		}
 	}
@@ -67,6 +67,16 @@ var _ = BeforeSuite(func() {
 					]
 				},
 				"AllocResp": "CikKC3NyaW92X25ldF9BEhogMDAwMDowMzowMi4zIDAwMDA6MDM6MDIuMA=="
+			},
+			{
+				"PodUID": "a9b1c6f2-bb3b-11e8-89df-408d5c537d23",
+				"ContainerName": "appcntr1",
+				"ResourceName": "intel.com/sriov_net_B",
+				"DeviceIDs": {"1": [
+					"0000:03:06.3"
+					]
+				},
+				"AllocResp": ""
 			}
 			],
 			"RegisteredDevices": {
@@ -139,6 +149,25 @@ var _ = Describe("Kubelet checkpoint data read operations", func() {
 		It("should have \"0000:03:02.0\" in deviceIDs[1]", func() {
 			Expect(resourceInfo.DeviceIDs[1]).To(BeEquivalentTo("0000:03:02.0"))
 		})
+
+		It("should not have a NUMA node for the devices without affinity", func() {
+			Expect(resourceInfo.NUMANodes).To(BeEmpty())
+		})
+
+		It("should have the NUMA node of the devices with affinity", func() {
+			fakePod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "fakePod",
+					Namespace: "podNamespace",
+					UID:       k8sTypes.UID("a9b1c6f2-bb3b-11e8-89df-408d5c537d23"),
+				},
+			}
+			rmap, err := cp.GetPodResourceMap(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rmap).To(HaveKey("intel.com/sriov_net_B"))
+			Expect(rmap["intel.com/sriov_net_B"].DeviceIDs).To(Equal([]string{"0000:03:06.3"}))
+			Expect(rmap["intel.com/sriov_net_B"].NUMANodes).To(Equal(map[string]int64{"0000:03:06.3": 1}))
+		})
 	})
 
 	Context("Using faulty or incompatible information", func() {
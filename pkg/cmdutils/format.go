@@ -0,0 +1,69 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// ConfigFormatPretty formats a generated config as indented JSON
+	ConfigFormatPretty = "pretty"
+	// ConfigFormatCompact formats a generated config as single line JSON
+	ConfigFormatCompact = "compact"
+)
+
+// ValidateConfigFormat fails unless format is empty, for the unformatted
+// output of the generator, or a known config format
+func ValidateConfigFormat(format string) error {
+	switch format {
+	case "", ConfigFormatPretty, ConfigFormatCompact:
+		return nil
+	}
+	return fmt.Errorf("unknown config format %q, must be %q or %q", format, ConfigFormatPretty, ConfigFormatCompact)
+}
+
+// FormatConfig re-encodes a generated JSON config in the given format, with
+// the keys of all objects sorted and numbers kept as written, so that
+// identical configs are byte-identical. An empty format leaves config as is.
+func FormatConfig(config []byte, format string) ([]byte, error) {
+	if err := ValidateConfigFormat(format); err != nil {
+		return nil, err
+	}
+	if format == "" {
+		return config, nil
+	}
+
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(config))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("cannot parse the generated config: %v", err)
+	}
+
+	// maps are encoded with sorted keys
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if format == ConfigFormatPretty {
+		encoder.SetIndent("", "    ")
+	}
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdutils
+
+// disable dot-imports only for testing
+//revive:disable:dot-imports
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("config formatting", func() {
+	const config = `{"type": "multus", "cniVersion": "0.3.1",
+  "delegates": [{"type": "flannel", "name": "cbr0", "mtu": 1450.0, "url": "http://a?b&c"}]}`
+
+	DescribeTable("formats configs with sorted keys", func(format string, expected string) {
+		formatted, err := FormatConfig([]byte(config), format)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(formatted)).To(Equal(expected))
+	},
+		Entry("compact", ConfigFormatCompact,
+			`{"cniVersion":"0.3.1","delegates":[{"mtu":1450.0,"name":"cbr0","type":"flannel","url":"http://a?b&c"}],"type":"multus"}`+"\n"),
+		Entry("pretty", ConfigFormatPretty, `{
+    "cniVersion": "0.3.1",
+    "delegates": [
+        {
+            "mtu": 1450.0,
+            "name": "cbr0",
+            "type": "flannel",
+            "url": "http://a?b&c"
+        }
+    ],
+    "type": "multus"
+}
+`),
+		Entry("unformatted", "", config),
+	)
+
+	It("formats identical configs identically", func() {
+		reordered := `{"delegates": [{"url": "http://a?b&c", "mtu": 1450.0, "name": "cbr0", "type": "flannel"}],
+  "cniVersion": "0.3.1", "type": "multus"}`
+		for _, format := range []string{ConfigFormatCompact, ConfigFormatPretty} {
+			formatted, err := FormatConfig([]byte(config), format)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(FormatConfig([]byte(reordered), format)).To(Equal(formatted))
+		}
+	})
+
+	It("rejects unknown formats", func() {
+		_, err := FormatConfig([]byte(config), "yaml")
+		Expect(err).To(MatchError(`unknown config format "yaml", must be "pretty" or "compact"`))
+	})
+})
@@ -0,0 +1,107 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sclient
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8snet "k8s.io/apimachinery/pkg/util/net"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+)
+
+// apiRequestRetryInterval is the delay between the attempts of an API request
+var apiRequestRetryInterval = 250 * time.Millisecond
+
+// WithAPIRequestPolicy returns a copy of the client whose pod, net-attach-def
+// and pod status requests each time out after timeout, if positive, and are
+// retried up to retries times while they fail with a transient error
+func (c *ClientInfo) WithAPIRequestPolicy(timeout time.Duration, retries int) *ClientInfo {
+	if c == nil {
+		return nil
+	}
+	client := *c
+	client.requestTimeout = timeout
+	client.requestRetries = retries
+	return &client
+}
+
+// apiRequest runs the request f with the timeout and retries of the client
+func apiRequest[T any](c *ClientInfo, what string, f func(ctx context.Context) (T, error)) (T, error) {
+	var timeout time.Duration
+	var retries int
+	if c != nil {
+		timeout, retries = c.requestTimeout, c.requestRetries
+	}
+	var result T
+	var err error
+	for attempt := 0; ; attempt++ {
+		result, err = apiRequestAttempt(timeout, f)
+		if err == nil || attempt >= retries || !isAPIRequestRetriable(err) {
+			return result, err
+		}
+		logging.Verbosef("warning: retrying %s (%d/%d) after a transient error: %v", what, attempt+1, retries, err)
+		time.Sleep(apiRequestRetryInterval)
+	}
+}
+
+// apiRequestAttempt runs f, giving up after timeout, if positive, even if f
+// does not honor the cancellation of its context
+func apiRequestAttempt[T any](timeout time.Duration, f func(ctx context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return f(context.TODO())
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), timeout)
+	defer cancel()
+
+	type response struct {
+		result T
+		err    error
+	}
+	done := make(chan response, 1)
+	go func() {
+		result, err := f(ctx)
+		done <- response{result, err}
+	}()
+	select {
+	case resp := <-done:
+		return resp.result, resp.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("API request timed out after %v: %w", timeout, ctx.Err())
+	}
+}
+
+// isAPIRequestRetriable reports whether the API request failed with a
+// transient error
+func isAPIRequestRetriable(err error) bool {
+	for _, f := range []func(error) bool{
+		errors.IsServiceUnavailable, errors.IsInternalError, errors.IsServerTimeout, errors.IsTimeout,
+		errors.IsTooManyRequests, k8snet.IsConnectionReset, k8snet.IsConnectionRefused, isDeadlineExceeded,
+	} {
+		if f(err) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDeadlineExceeded(err error) bool {
+	return goerrors.Is(err, context.DeadlineExceeded)
+}
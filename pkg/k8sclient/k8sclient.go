@@ -21,17 +21,22 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"regexp"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
 	"strings"
-	"syscall"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 
 	"github.com/containernetworking/cni/libcni"
 	"github.com/containernetworking/cni/pkg/skel"
@@ -39,7 +44,6 @@ import (
 	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	netclient "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned"
 	netlister "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/listers/k8s.cni.cncf.io/v1"
-	netutils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/kubeletclient"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
@@ -47,8 +51,38 @@ import (
 
 const (
 	resourceNameAnnot      = "k8s.v1.cni.cncf.io/resourceName"
+	cniArgsAnnot           = "k8s.v1.cni.cncf.io/cniArgs"
+	postAddProbeAnnot      = "k8s.v1.cni.cncf.io/postAddProbe"
+	configSecretRefAnnot   = "k8s.v1.cni.cncf.io/configSecretRef"
+	descriptionAnnot       = "k8s.v1.cni.cncf.io/description"
+	retryPolicyAnnot       = "k8s.v1.cni.cncf.io/retryPolicy"
 	defaultNetAnnot        = "v1.multus-cni.io/default-network"
-	networkAttachmentAnnot = "k8s.v1.cni.cncf.io/networks"
+	networkAttachmentAnnot = types.DefaultAnnotationPrefix + "/" + types.NetworksAnnotation
+
+	// defaultNetAltAnnot is the same as defaultNetAnnot, under the prefix
+	// of the network attachment annotations
+	defaultNetAltAnnot = types.DefaultAnnotationPrefix + "/" + types.DefaultNetworkAnnotation
+
+	numaNodeCapability = "numaNode"
+	ipRangesCapability = "ipRanges"
+	deviceIDCapability = "deviceID"
+	pciBusIDCapability = "pciBusID"
+
+	// AddFailureAnnot records the delegate ADD failure of a pod matching
+	// one of the addFailureAnnotationPatterns
+	AddFailureAnnot = "v1.multus-cni.io/network-add-failure"
+
+	// DefaultRouteSelectionAnnot selects how the default route of a pod is
+	// chosen among its default-route requests, with conditionalDefaultRoute
+	DefaultRouteSelectionAnnot = "k8s.v1.cni.cncf.io/default-route-selection"
+	// DefaultRouteSelectionStatic installs every default-route request
+	DefaultRouteSelectionStatic = "static"
+	// DefaultRouteSelectionReachable installs the first default-route
+	// request whose gateway is reachable
+	DefaultRouteSelectionReachable = "reachable"
+
+	namespaceDefaultNetworksAnnot     = "v1.multus-cni.io/default-networks"
+	namespaceDefaultNetworksModeAnnot = "v1.multus-cni.io/default-networks-mode"
 )
 
 // NoK8sNetworkError indicates error, no network in kubernetes
@@ -66,6 +100,10 @@ type ClientInfo struct {
 	// multus-thick uses these informer
 	PodInformer    cache.SharedIndexInformer
 	NetDefInformer cache.SharedIndexInformer
+
+	// set by WithAPIRequestPolicy
+	requestTimeout time.Duration
+	requestRetries int
 }
 
 // AddPod adds pod into kubernetes
@@ -79,7 +117,9 @@ func (c *ClientInfo) GetPod(namespace, name string) (*v1.Pod, error) {
 		logging.Debugf("GetPod for [%s/%s] will use informer cache", namespace, name)
 		return listers.NewPodLister(c.PodInformer.GetIndexer()).Pods(namespace).Get(name)
 	}
-	return c.Client.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	return apiRequest(c, fmt.Sprintf("the get of pod %s/%s", namespace, name), func(ctx context.Context) (*v1.Pod, error) {
+		return c.Client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	})
 }
 
 // GetPodContext gets pod from kubernetes with context
@@ -93,7 +133,19 @@ func (c *ClientInfo) GetPodContext(ctx context.Context, namespace, name string)
 
 // GetPodAPILiveQuery does a live API query for the pod, instead of using informers, for cases when a failure occurred, as to prevent a cache miss.
 func (c *ClientInfo) GetPodAPILiveQuery(ctx context.Context, namespace, name string) (*v1.Pod, error) {
-	return c.Client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	return apiRequest(c, fmt.Sprintf("the get of pod %s/%s", namespace, name), func(reqCtx context.Context) (*v1.Pod, error) {
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			reqCtx, cancel = context.WithDeadline(reqCtx, deadline)
+			defer cancel()
+		}
+		return c.Client.CoreV1().Pods(namespace).Get(reqCtx, name, metav1.GetOptions{})
+	})
+}
+
+// GetNamespace gets a namespace from kubernetes
+func (c *ClientInfo) GetNamespace(name string) (*v1.Namespace, error) {
+	return c.Client.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
 }
 
 // DeletePod deletes a pod from kubernetes
@@ -110,16 +162,75 @@ func (c *ClientInfo) AddNetAttachDef(netattach *nettypes.NetworkAttachmentDefini
 func (c *ClientInfo) GetNetAttachDef(namespace, name string) (*nettypes.NetworkAttachmentDefinition, error) {
 	if c.NetDefInformer != nil {
 		logging.Debugf("GetNetAttachDef for [%s/%s] will use informer cache", namespace, name)
-		return netlister.NewNetworkAttachmentDefinitionLister(c.NetDefInformer.GetIndexer()).NetworkAttachmentDefinitions(namespace).Get(name)
+		netattach, err := netlister.NewNetworkAttachmentDefinitionLister(c.NetDefInformer.GetIndexer()).NetworkAttachmentDefinitions(namespace).Get(name)
+		if !errors.IsNotFound(err) {
+			return netattach, err
+		}
+		// the informer may not have seen a just created net-attach-def yet
+		return c.refreshNetAttachDef(namespace, name)
+	}
+	return c.getNetAttachDefFromAPI(namespace, name)
+}
+
+// getNetAttachDefFromAPI gets the net-attach-def from the API server
+func (c *ClientInfo) getNetAttachDefFromAPI(namespace, name string) (*nettypes.NetworkAttachmentDefinition, error) {
+	return apiRequest(c, fmt.Sprintf("the get of net-attach-def %s/%s", namespace, name), func(ctx context.Context) (*nettypes.NetworkAttachmentDefinition, error) {
+		return c.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(namespace).Get(ctx, name, metav1.GetOptions{})
+	})
+}
+
+// refreshNetAttachDef gets the net-attach-def from the API server and, as
+// the informer cache is not up to date, asks the informer to relist
+func (c *ClientInfo) refreshNetAttachDef(namespace, name string) (*nettypes.NetworkAttachmentDefinition, error) {
+	logging.Debugf("GetNetAttachDef: [%s/%s] not in the informer cache, refreshing it", namespace, name)
+	netattach, err := c.getNetAttachDefFromAPI(namespace, name)
+	if err != nil {
+		return nil, err
 	}
-	return c.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if informer, ok := c.NetDefInformer.(*RelistableInformer); ok {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), netAttachDefRelistTimeout)
+			defer cancel()
+			if _, err := informer.Relist(ctx); err != nil {
+				logging.Verbosef("warning: failed to relist the net-attach-def informer cache: %v", err)
+			}
+		}()
+	}
+	return netattach, nil
 }
 
-// Eventf puts event into kubernetes events
+// ResyncNetAttachDefs asks the net-attach-def informer to relist them from
+// the API server, which replaces the content of its cache, and returns the
+// number of net-attach-defs listed
+func (c *ClientInfo) ResyncNetAttachDefs(ctx context.Context) (int, error) {
+	informer, ok := c.NetDefInformer.(*RelistableInformer)
+	if !ok {
+		return 0, fmt.Errorf("no net-attach-def informer to resync")
+	}
+	ctx, cancel := context.WithTimeout(ctx, netAttachDefRelistTimeout)
+	defer cancel()
+	count, err := informer.Relist(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to relist the net-attach-defs: %v", err)
+	}
+	logging.Verbosef("ResyncNetAttachDefs: %d net-attach-defs relisted into the informer cache", count)
+	return count, nil
+}
+
+// Eventf puts event into kubernetes events. Events are best effort: without
+// a recorder the event is dropped, and a panic of the recorder, which is a
+// bug, is logged as an error with its stack rather than failing the caller
 func (c *ClientInfo) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
-	if c != nil && c.EventRecorder != nil {
-		c.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	if c == nil || c.EventRecorder == nil {
+		logging.Debugf("Eventf: no event recorder, dropping the %s %s event", eventtype, reason)
+		return
 	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = logging.Errorf("Eventf: the event recorder panicked on the %s %s event: %v\n%s", eventtype, reason, r, debug.Stack())
+		}
+	}()
+	c.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
 }
 
 func (e *NoK8sNetworkError) Error() string { return e.message }
@@ -161,7 +272,7 @@ func SetPodNetworkStatusAnnotation(client *ClientInfo, podName string, podNamesp
 	}
 
 	if netStatus != nil {
-		err = netutils.SetNetworkStatus(client.Client, pod, netStatus)
+		err = setPodNetworkStatus(client, pod, netStatus, conf)
 		if err != nil {
 			return logging.Errorf("SetPodNetworkStatusAnnotation: failed to update the pod %v in out of cluster comm: %v", podName, err)
 		}
@@ -170,127 +281,423 @@ func SetPodNetworkStatusAnnotation(client *ClientInfo, podName string, podNamesp
 	return nil
 }
 
-func parsePodNetworkObjectName(podnetwork string) (string, string, string, error) {
-	var netNsName string
-	var netIfName string
-	var networkName string
+// setPodNetworkStatus writes the whole network status of the pod, along with
+// its primary IP if any, in a single update of its annotations
+func setPodNetworkStatus(client *ClientInfo, pod *v1.Pod, netStatus []nettypes.NetworkStatus, conf *types.NetConf) error {
+	statuses := make([]describedNetworkStatus, 0, len(netStatus))
+	for _, status := range netStatus {
+		statuses = append(statuses, describedNetworkStatus{
+			NetworkStatus: status,
+			Description:   networkDescription(status, conf.Delegates),
+		})
+	}
+	annotation, err := encodeNetworkStatus(statuses, conf.NetworkStatusFormat)
+	if err != nil {
+		return err
+	}
+	annotations := map[string]string{
+		conf.AnnotationKey(types.NetworkStatusAnnotation): annotation,
+	}
+	if ip := primaryIP(netStatus, conf); ip != "" {
+		annotations[conf.AnnotationKey(types.PrimaryIPAnnotation)] = ip
+	}
+
+	return setPodAnnotations(client, pod, annotations)
+}
+
+// describedNetworkStatus is a network status along with the description of
+// its network, which NetworkStatus has no field for
+type describedNetworkStatus struct {
+	nettypes.NetworkStatus
+	Description string `json:"description,omitempty"`
+}
 
-	logging.Debugf("parsePodNetworkObjectName: %s", podnetwork)
-	slashItems := strings.Split(podnetwork, "/")
-	if len(slashItems) == 2 {
-		netNsName = strings.TrimSpace(slashItems[0])
-		networkName = slashItems[1]
-	} else if len(slashItems) == 1 {
-		networkName = slashItems[0]
-	} else {
-		return "", "", "", logging.Errorf("parsePodNetworkObjectName: Invalid network object (failed at '/')")
+// networkDescription returns the description of the delegate of the network
+// status: the one of its interface if the network is attached more than once
+func networkDescription(status nettypes.NetworkStatus, delegates []*types.DelegateNetConf) string {
+	description := ""
+	found := false
+	for _, delegate := range delegates {
+		if delegate.Name != status.Name {
+			continue
+		}
+		if delegate.IfnameRequest == status.Interface {
+			return delegate.Description
+		}
+		if !found {
+			description, found = delegate.Description, true
+		}
 	}
+	return description
+}
 
-	atItems := strings.Split(networkName, "@")
-	networkName = strings.TrimSpace(atItems[0])
-	if len(atItems) == 2 {
-		netIfName = strings.TrimSpace(atItems[1])
-	} else if len(atItems) != 1 {
-		return "", "", "", logging.Errorf("parsePodNetworkObjectName: Invalid network object (failed at '@')")
+// primaryIP returns the first IP of the network status of the delegate with
+// a primary-ip request, otherwise of the network named by the
+// primaryIPNetwork, otherwise of the default network; the first of them
+// which has an IP wins
+func primaryIP(netStatus []nettypes.NetworkStatus, conf *types.NetConf) string {
+	var candidates []*nettypes.NetworkStatus
+	for _, delegate := range conf.Delegates {
+		if !delegate.PrimaryIPRequest {
+			continue
+		}
+		for i := range netStatus {
+			if netStatus[i].Name == delegate.Name && (delegate.IfnameRequest == "" || netStatus[i].Interface == delegate.IfnameRequest) {
+				candidates = append(candidates, &netStatus[i])
+				break
+			}
+		}
+	}
+	for i := range netStatus {
+		if conf.PrimaryIPNetwork != "" && netStatus[i].Name == conf.PrimaryIPNetwork {
+			candidates = append(candidates, &netStatus[i])
+		}
+	}
+	for i := range netStatus {
+		if netStatus[i].Default {
+			candidates = append(candidates, &netStatus[i])
+		}
 	}
 
-	// Check and see if each item matches the specification for valid attachment name.
-	// "Valid attachment names must be comprised of units of the DNS-1123 label format"
-	// [a-z0-9]([-a-z0-9]*[a-z0-9])?
-	// It must start and end alphanumerically.
-	allItems := []string{netNsName, networkName}
-	expr := regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
-	for i := range allItems {
-		matched := expr.MatchString(allItems[i])
-		if !matched && len([]rune(allItems[i])) > 0 {
-			return "", "", "", logging.Errorf(fmt.Sprintf("parsePodNetworkObjectName: Failed to parse: one or more items did not match comma-delimited format (must consist of lower case alphanumeric characters). Must start and end with an alphanumeric character), mismatch @ '%v'", allItems[i]))
+	for _, status := range candidates {
+		if len(status.IPs) > 0 {
+			return status.IPs[0]
 		}
 	}
+	return ""
+}
 
-	if len(netIfName) > 0 {
-		if len(netIfName) > (syscall.IFNAMSIZ-1) || strings.ContainsAny(netIfName, " \t\n\v\f\r/") {
-			return "", "", "", logging.Errorf(fmt.Sprintf("parsePodNetworkObjectName: Failed to parse interface name: must be less than 15 chars and not contain '/' or spaces. interface name '%s'", netIfName))
+// AddFailure is the value of the AddFailureAnnot annotation
+type AddFailure struct {
+	// Network is the name of the network whose ADD failed
+	Network string `json:"network"`
+	// Interface is the interface name of the network in the pod
+	Interface string `json:"interface"`
+	// Reason is the error of the delegate
+	Reason string `json:"reason"`
+	// Pattern is the addFailureAnnotationPatterns entry the error matched
+	Pattern string `json:"pattern"`
+}
+
+// SetPodAddFailure records the delegate ADD failure in the AddFailureAnnot
+// annotation of the pod
+func SetPodAddFailure(client *ClientInfo, pod *v1.Pod, failure *AddFailure) error {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+	return setPodAnnotation(client, pod, AddFailureAnnot, string(data))
+}
+
+// setPodAnnotation sets an annotation of the pod, see setPodAnnotations
+func setPodAnnotation(client *ClientInfo, pod *v1.Pod, key, annotation string) error {
+	return setPodAnnotations(client, pod, map[string]string{key: annotation})
+}
+
+// setPodAnnotations sets annotations of the pod. The pod is read again
+// before each attempt, whose update is rejected if the pod changed in the
+// meantime and then retried, so the annotations are never computed from a
+// stale pod nor partially applied.
+func setPodAnnotations(client *ClientInfo, pod *v1.Pod, annotations map[string]string) error {
+	podUID := pod.UID
+	pods := client.Client.CoreV1().Pods(pod.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := apiRequest(client, fmt.Sprintf("the get of pod %s/%s", pod.Namespace, pod.Name), func(ctx context.Context) (*v1.Pod, error) {
+			return pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		})
+		if err != nil {
+			return err
 		}
+		if latest.UID != podUID {
+			return fmt.Errorf("pod %s/%s was recreated (UID %q instead of %q)", pod.Namespace, pod.Name, latest.UID, podUID)
+		}
+
+		if latest.Annotations == nil {
+			latest.Annotations = map[string]string{}
+		}
+		for key, annotation := range annotations {
+			latest.Annotations[key] = annotation
+		}
+		// the update carries the resourceVersion of the read pod, so it fails
+		// with a conflict if the pod was modified since
+		updated, err := apiRequest(client, fmt.Sprintf("the status update of pod %s/%s", pod.Namespace, pod.Name), func(ctx context.Context) (*v1.Pod, error) {
+			return pods.UpdateStatus(ctx, latest, metav1.UpdateOptions{})
+		})
+		if err != nil {
+			return err
+		}
+		for key, annotation := range annotations {
+			if updated.Annotations[key] != annotation {
+				return fmt.Errorf("annotation %s of pod %s/%s was not applied", key, pod.Namespace, pod.Name)
+			}
+		}
+		return nil
+	})
+}
+
+// networkStatusFilePath returns the path of the network status file of a
+// container in dir
+func networkStatusFilePath(dir, podUID, containerID string) string {
+	if podUID == "" {
+		return filepath.Join(dir, containerID+".json")
 	}
+	return filepath.Join(dir, podUID+"-"+containerID+".json")
+}
 
-	logging.Debugf("parsePodNetworkObjectName: parsed: %s, %s, %s", netNsName, networkName, netIfName)
-	return netNsName, networkName, netIfName, nil
+// WriteNetworkStatusFile writes the network status of a container in dir,
+// named by the pod UID and the container ID
+func WriteNetworkStatusFile(dir, podUID, containerID string, netStatus []nettypes.NetworkStatus) error {
+	data, err := json.MarshalIndent(netStatus, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the network status: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create the network status directory %s: %v", dir, err)
+	}
+	path := networkStatusFilePath(dir, podUID, containerID)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the network status file %s: %v", tmpPath, err)
+	}
+	// readers never see a partially written file
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename the network status file %s: %v", tmpPath, err)
+	}
+	return nil
 }
 
-func parsePodNetworkAnnotation(podNetworks, defaultNamespace string) ([]*types.NetworkSelectionElement, error) {
-	var networks []*types.NetworkSelectionElement
+// RemoveNetworkStatusFile removes the network status file of a container
+// from dir, if any
+func RemoveNetworkStatusFile(dir, podUID, containerID string) error {
+	if err := os.Remove(networkStatusFilePath(dir, podUID, containerID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
 
+func parsePodNetworkAnnotation(podNetworks, defaultNamespace string) ([]*types.NetworkSelectionElement, error) {
 	logging.Debugf("parsePodNetworkAnnotation: %s, %s", podNetworks, defaultNamespace)
-	if podNetworks == "" {
-		return nil, logging.Errorf("parsePodNetworkAnnotation: pod annotation does not have \"network\" as key")
+	networks, err := types.ParseNetworkSelectionElements(podNetworks, defaultNamespace)
+	if err != nil {
+		return nil, logging.Errorf("parsePodNetworkAnnotation: %v", err)
+	}
+	return networks, nil
+}
+
+// ValidateNetAttachDef checks that the CNI config of the net-attach-def, read
+// as for an attachment, loads as a delegate
+func ValidateNetAttachDef(nad *nettypes.NetworkAttachmentDefinition, conf *types.NetConf) error {
+	_, err := getNetAttachDefDelegate(nad, conf)
+	return err
+}
+
+// getNetAttachDef gets a net-attach-def from the cluster of externalNADKubeconfig
+// if set, otherwise from the local cluster
+func getNetAttachDef(client *ClientInfo, conf *types.NetConf, namespace, name string) (*nettypes.NetworkAttachmentDefinition, error) {
+	if conf.ExternalNADKubeconfig == "" {
+		return client.GetNetAttachDef(namespace, name)
+	}
+
+	netClient, err := GetExternalNetClient(conf.ExternalNADKubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return apiRequest(client, fmt.Sprintf("the get of net-attach-def %s/%s", namespace, name), func(ctx context.Context) (*nettypes.NetworkAttachmentDefinition, error) {
+		return netClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(namespace).Get(ctx, name, metav1.GetOptions{})
+	})
+}
+
+// listNetAttachDefs lists the net-attach-defs of a namespace from the cluster
+// of externalNADKubeconfig if set, otherwise from the local cluster
+func listNetAttachDefs(client *ClientInfo, conf *types.NetConf, namespace string) ([]*nettypes.NetworkAttachmentDefinition, error) {
+	if conf.ExternalNADKubeconfig == "" && client.NetDefInformer != nil {
+		return netlister.NewNetworkAttachmentDefinitionLister(client.NetDefInformer.GetIndexer()).NetworkAttachmentDefinitions(namespace).List(labels.Everything())
 	}
 
-	if strings.ContainsAny(podNetworks, "[{\"") {
-		if err := json.Unmarshal([]byte(podNetworks), &networks); err != nil {
-			return nil, logging.Errorf("parsePodNetworkAnnotation: failed to parse pod Network Attachment Selection Annotation JSON format: %v", err)
+	netClient := client.NetClient
+	if conf.ExternalNADKubeconfig != "" {
+		var err error
+		netClient, err = GetExternalNetClient(conf.ExternalNADKubeconfig)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		// Comma-delimited list of network attachment object names
-		for _, item := range strings.Split(podNetworks, ",") {
-			// Remove leading and trailing whitespace.
-			item = strings.TrimSpace(item)
+	}
+	list, err := apiRequest(client, fmt.Sprintf("the list of the net-attach-defs of namespace %s", namespace), func(ctx context.Context) (*nettypes.NetworkAttachmentDefinitionList, error) {
+		return netClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(namespace).List(ctx, metav1.ListOptions{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	nads := make([]*nettypes.NetworkAttachmentDefinition, 0, len(list.Items))
+	for i := range list.Items {
+		nads = append(nads, &list.Items[i])
+	}
+	return nads, nil
+}
 
-			// Parse network name (i.e. <namespace>/<network name>@<ifname>)
-			netNsName, networkName, netIfName, err := parsePodNetworkObjectName(item)
-			if err != nil {
-				return nil, logging.Errorf("parsePodNetworkAnnotation: %v", err)
-			}
+// advertisedCapabilities returns the capabilities enabled by a CNI config or
+// by any plugin of a CNI config list
+func advertisedCapabilities(configBytes []byte) (map[string]bool, error) {
+	var conf struct {
+		Capabilities map[string]bool `json:"capabilities"`
+		Plugins      []struct {
+			Capabilities map[string]bool `json:"capabilities"`
+		} `json:"plugins"`
+	}
+	if err := json.Unmarshal(configBytes, &conf); err != nil {
+		return nil, err
+	}
+	capabilities := map[string]bool{}
+	for name, enabled := range conf.Capabilities {
+		capabilities[name] = capabilities[name] || enabled
+	}
+	for _, plugin := range conf.Plugins {
+		for name, enabled := range plugin.Capabilities {
+			capabilities[name] = capabilities[name] || enabled
+		}
+	}
+	return capabilities, nil
+}
 
-			networks = append(networks, &types.NetworkSelectionElement{
-				Name:             networkName,
-				Namespace:        netNsName,
-				InterfaceRequest: netIfName,
-			})
+// selectNetAttachDefByCapabilities returns the name of the only net-attach-def
+// of namespace whose CNI config advertises all the required capabilities
+func selectNetAttachDefByCapabilities(client *ClientInfo, conf *types.NetConf, namespace string, required map[string]bool) (string, error) {
+	var requiredNames []string
+	for name, enabled := range required {
+		if enabled {
+			requiredNames = append(requiredNames, name)
 		}
 	}
+	sort.Strings(requiredNames)
+	if len(requiredNames) == 0 {
+		return "", fmt.Errorf("network selection by capabilities in namespace %s does not require any capability", namespace)
+	}
 
-	for _, n := range networks {
-		if n.Namespace == "" {
-			n.Namespace = defaultNamespace
+	nads, err := listNetAttachDefs(client, conf, namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to list the network-attachment-definitions of namespace %s: %v", namespace, err)
+	}
+
+	var matches []string
+	for _, nad := range nads {
+		delegate, err := getNetAttachDefDelegate(nad, conf)
+		if err != nil {
+			logging.Debugf("selectNetAttachDefByCapabilities: skipping %s/%s: %v", namespace, nad.Name, err)
+			continue
 		}
-		if n.MacRequest != "" {
-			// validate MAC address
-			if _, err := net.ParseMAC(n.MacRequest); err != nil {
-				return nil, logging.Errorf("parsePodNetworkAnnotation: failed to mac: %v", err)
-			}
+		capabilities, err := advertisedCapabilities(delegate.Bytes)
+		if err != nil {
+			logging.Debugf("selectNetAttachDefByCapabilities: skipping %s/%s: %v", namespace, nad.Name, err)
+			continue
 		}
-		if n.InfinibandGUIDRequest != "" {
-			// validate GUID address
-			if _, err := net.ParseMAC(n.InfinibandGUIDRequest); err != nil {
-				return nil, logging.Errorf("parsePodNetworkAnnotation: failed to validate infiniband GUID: %v", err)
+		matched := true
+		for _, name := range requiredNames {
+			if !capabilities[name] {
+				matched = false
+				break
 			}
 		}
-		if n.IPRequest != nil {
-			for _, ip := range n.IPRequest {
-				// validate IP address
-				if strings.Contains(ip, "/") {
-					if _, _, err := net.ParseCIDR(ip); err != nil {
-						return nil, logging.Errorf("failed to parse CIDR %q: %v", ip, err)
-					}
-				} else if net.ParseIP(ip) == nil {
-					return nil, logging.Errorf("failed to parse IP address %q", ip)
-				}
-			}
+		if matched {
+			matches = append(matches, nad.Name)
+		}
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no network-attachment-definition in namespace %s has the capabilities %v", namespace, requiredNames)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("several network-attachment-definitions in namespace %s have the capabilities %v: %v", namespace, requiredNames, matches)
+}
+
+// prefetchNetAttachDefs lists the net-attach-defs of each namespace referenced by
+// networks once, so that resolving many attachments costs one API call per
+// namespace instead of one per attachment. It is skipped when an informer
+// already caches them; namespaces that cannot be listed fall back to Get.
+func prefetchNetAttachDefs(client *ClientInfo, conf *types.NetConf, podNamespace string, networks []*types.NetworkSelectionElement) map[string]*nettypes.NetworkAttachmentDefinition {
+	if len(networks) < 2 {
+		return nil
+	}
+
+	var netClient netclient.Interface
+	if conf.ExternalNADKubeconfig != "" {
+		var err error
+		if netClient, err = GetExternalNetClient(conf.ExternalNADKubeconfig); err != nil {
+			return nil
+		}
+	} else {
+		if client == nil || client.NetClient == nil || client.NetDefInformer != nil {
+			return nil
 		}
-		// compatibility pre v3.2, will be removed in v4.0
-		if n.DeprecatedInterfaceRequest != "" && n.InterfaceRequest == "" {
-			n.InterfaceRequest = n.DeprecatedInterfaceRequest
+		netClient = client.NetClient
+	}
+
+	nads := map[string]*nettypes.NetworkAttachmentDefinition{}
+	listed := map[string]bool{}
+	for _, net := range networks {
+		if listed[net.Namespace] {
+			continue
+		}
+		// Leave namespace isolation violations to the caller to report
+		if conf.NamespaceIsolation && net.Namespace != podNamespace && !isValidNamespaceReference(net.Namespace, conf.NonIsolatedNamespaces) {
+			continue
+		}
+		listed[net.Namespace] = true
+
+		namespace := net.Namespace
+		list, err := apiRequest(client, fmt.Sprintf("the list of the net-attach-defs of namespace %s", namespace), func(ctx context.Context) (*nettypes.NetworkAttachmentDefinitionList, error) {
+			return netClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(namespace).List(ctx, metav1.ListOptions{})
+		})
+		if err != nil {
+			logging.Debugf("prefetchNetAttachDefs: failed to list net-attach-defs in namespace %s, falling back to get: %v", net.Namespace, err)
+			continue
+		}
+		for i := range list.Items {
+			nads[net.Namespace+"/"+list.Items[i].Name] = &list.Items[i]
 		}
 	}
+	return nads
+}
 
-	return networks, nil
+// lookupNetAttachDef returns a net-attach-def from the prefetched ones, or
+// looks it up, so that the caller gets the API server's own not-found error
+func lookupNetAttachDef(client *ClientInfo, conf *types.NetConf, namespace, name string, nads map[string]*nettypes.NetworkAttachmentDefinition) (*nettypes.NetworkAttachmentDefinition, error) {
+	if customResource, ok := nads[namespace+"/"+name]; ok {
+		return customResource, nil
+	}
+	return getNetAttachDef(client, conf, namespace, name)
 }
 
-func getKubernetesDelegate(client *ClientInfo, net *types.NetworkSelectionElement, confdir string, pod *v1.Pod, resourceMap map[string]*types.ResourceInfo) (*types.DelegateNetConf, map[string]*types.ResourceInfo, error) {
+func getKubernetesDelegate(client *ClientInfo, net *types.NetworkSelectionElement, conf *types.NetConf, pod *v1.Pod, resourceMap map[string]*types.ResourceInfo, nads map[string]*nettypes.NetworkAttachmentDefinition) (*types.DelegateNetConf, map[string]*types.ResourceInfo, error) {
+
+	logging.Debugf("getKubernetesDelegate: %v, %v, %s, %v, %v", client, net, conf.ConfDir, pod, resourceMap)
 
-	logging.Debugf("getKubernetesDelegate: %v, %v, %s, %v, %v", client, net, confdir, pod, resourceMap)
+	// the elements of the default-network annotation and of the namespace
+	// default networks are not checked by GetNetworkDelegates
+	if err := validateSelectionElementRequests(net, conf); err != nil {
+		return nil, resourceMap, logging.Errorf("getKubernetesDelegate: %v", err)
+	}
 
-	customResource, err := client.GetNetAttachDef(net.Namespace, net.Name)
+	customResource, err := lookupNetAttachDef(client, conf, net.Namespace, net.Name, nads)
+	if err != nil && errors.IsNotFound(err) && net.FallbackName != "" {
+		fallbackResource, fallbackErr := lookupNetAttachDef(client, conf, net.Namespace, net.FallbackName, nads)
+		if fallbackErr != nil {
+			errMsg := fmt.Sprintf("cannot find a network-attachment-definition (%s) nor its fallback (%s) in namespace (%s): %v; %v", net.Name, net.FallbackName, net.Namespace, err, fallbackErr)
+			if client != nil {
+				client.Eventf(pod, v1.EventTypeWarning, "NoNetworkFound", errMsg)
+			}
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: " + errMsg)
+		}
+		logging.Verbosef("getKubernetesDelegate: network-attachment-definition (%s) not found in namespace (%s), using its fallback (%s)", net.Name, net.Namespace, net.FallbackName)
+		// the delegate and its network status refer to the net-attach-def in use
+		fallbackNet := *net
+		fallbackNet.Name = net.FallbackName
+		net = &fallbackNet
+		customResource, err = fallbackResource, nil
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("cannot find a network-attachment-definition (%s) in namespace (%s): %v", net.Name, net.Namespace, err)
 		if client != nil {
@@ -301,6 +708,9 @@ func getKubernetesDelegate(client *ClientInfo, net *types.NetworkSelectionElemen
 
 	// Get resourceName annotation from NetworkAttachmentDefinition
 	deviceID := ""
+	var numaNode *int64
+	// set when the net-attach-def has a resource but no device is allocated
+	missingDevice := false
 	resourceName, ok := customResource.GetAnnotations()[resourceNameAnnot]
 	if ok && pod != nil && pod.Name != "" && pod.Namespace != "" {
 		// ResourceName annotation is found; try to get device info from resourceMap
@@ -323,24 +733,181 @@ func getKubernetesDelegate(client *ClientInfo, net *types.NetworkSelectionElemen
 			if idCount := len(entry.DeviceIDs); idCount > 0 && idCount > entry.Index {
 				deviceID = entry.DeviceIDs[entry.Index]
 				logging.Debugf("getKubernetesDelegate: podName: %s deviceID: %s", pod.Name, deviceID)
+				if node, ok := entry.NUMANodes[deviceID]; ok {
+					numaNode = &node
+				}
 				entry.Index++ // increment Index for next delegate
 			}
 		}
+
+		missingDevice = deviceID == ""
 	}
 
-	configBytes, err := netutils.GetCNIConfig(customResource, confdir)
+	delegate, err := getNetAttachDefDelegate(customResource, conf)
 	if err != nil {
 		return nil, resourceMap, err
 	}
+	configBytes := delegate.Bytes
+
+	// Fail early instead of passing a device-less config to a delegate
+	// expecting a device
+	if missingDevice {
+		errMsg := ""
+		if conf.NetworkResourceInjection {
+			errMsg = fmt.Sprintf("network-attachment-definition (%s/%s) requires resource %q but no device is allocated to pod %s/%s", net.Namespace, net.Name, resourceName, pod.Namespace, pod.Name)
+		} else if capability := deviceCapability(configBytes); capability != "" {
+			errMsg = fmt.Sprintf("network-attachment-definition (%s/%s) advertises the %s capability but no device of resource %q is allocated to pod %s/%s", net.Namespace, net.Name, capability, resourceName, pod.Namespace, pod.Name)
+		}
+		if errMsg != "" {
+			client.Eventf(pod, v1.EventTypeWarning, "NoDeviceAllocated", errMsg)
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: " + errMsg)
+		}
+	}
 
-	delegate, err := types.LoadDelegateNetConf(configBytes, net, deviceID, resourceName)
-	if err != nil {
+	// Fixed cni-args shipped by the net-attach-def author; the pod's own
+	// cni-args take precedence on conflicting keys
+	if rawArgs, ok := customResource.GetAnnotations()[cniArgsAnnot]; ok {
+		net, err = mergeNetAttachDefCNIArgs(net, rawArgs)
+		if err != nil {
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: invalid %s annotation in network-attachment-definition (%s/%s): %v", cniArgsAnnot, net.Namespace, net.Name, err)
+		}
+	}
+
+	if net.MasterRequest != "" {
+		configBytes, err = overrideMaster(configBytes, net.MasterRequest)
+		if err != nil {
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: failed to override the master interface of network-attachment-definition (%s/%s): %v", net.Namespace, net.Name, err)
+		}
+		if delegate, err = types.ParseDelegateNetConf(configBytes); err != nil {
+			return nil, resourceMap, err
+		}
+	}
+
+	if net.IPFromPool != "" {
+		if err := checkIPFromPool(configBytes); err != nil {
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: network-attachment-definition (%s/%s): %v", net.Namespace, net.Name, err)
+		}
+	}
+
+	if err := types.ApplyNetworkSelectionElement(delegate, net, deviceID, resourceName); err != nil {
 		return nil, resourceMap, err
 	}
 
+	delegate.NetAttachDef = customResource.GetNamespace() + "/" + customResource.GetName()
+	delegate.NetAttachDefResourceVersion = customResource.GetResourceVersion()
+
+	// the description of the network selection element takes precedence
+	if description, ok := customResource.GetAnnotations()[descriptionAnnot]; ok && delegate.Description == "" {
+		delegate.Description = description
+	}
+
+	// Only the delegates advertising the numaNode capability get the hint
+	if numaNode != nil {
+		if capabilities, err := advertisedCapabilities(configBytes); err == nil && capabilities[numaNodeCapability] {
+			delegate.NUMANode = numaNode
+		}
+	}
+
+	if rawProbe, ok := customResource.GetAnnotations()[postAddProbeAnnot]; ok {
+		delegate.PostAddProbe, err = parsePostAddProbe(rawProbe)
+		if err != nil {
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: invalid %s annotation in network-attachment-definition (%s/%s): %v", postAddProbeAnnot, net.Namespace, net.Name, err)
+		}
+	}
+
+	if rawPolicy, ok := customResource.GetAnnotations()[retryPolicyAnnot]; ok {
+		delegate.RetryPolicy, err = types.LoadRetryPolicy([]byte(rawPolicy))
+		if err != nil {
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: invalid %s annotation in network-attachment-definition (%s/%s): %v", retryPolicyAnnot, net.Namespace, net.Name, err)
+		}
+	}
+
+	// The Secret is looked up in the namespace of the net-attach-def only
+	if rawRef, ok := customResource.GetAnnotations()[configSecretRefAnnot]; ok {
+		name, key, found := strings.Cut(rawRef, "/")
+		if !found || name == "" || key == "" {
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: invalid %s annotation in network-attachment-definition (%s/%s): %q is not <secret>/<key>", configSecretRefAnnot, net.Namespace, net.Name, rawRef)
+		}
+		delegate.ConfigSecretRef = &types.SecretKeyRef{Namespace: customResource.GetNamespace(), Name: name, Key: key}
+		if err := LoadSecretConfig(client, delegate); err != nil {
+			return nil, resourceMap, logging.Errorf("getKubernetesDelegate: network-attachment-definition (%s/%s): %v", net.Namespace, net.Name, err)
+		}
+	}
+
 	return delegate, resourceMap, nil
 }
 
+// LoadSecretConfig loads the config of the Secret key the delegate refers to
+// into its SecretConfig
+func LoadSecretConfig(client *ClientInfo, delegate *types.DelegateNetConf) error {
+	ref := delegate.ConfigSecretRef
+	if ref == nil {
+		return nil
+	}
+	if client == nil {
+		return fmt.Errorf("no kubernetes client to get secret %s/%s", ref.Namespace, ref.Name)
+	}
+	secret, err := client.Client.CoreV1().Secrets(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %v", ref.Namespace, ref.Name, err)
+	}
+	data, ok := secret.Data[ref.Key]
+	if !ok {
+		return fmt.Errorf("secret %s/%s has no key %q", ref.Namespace, ref.Name, ref.Key)
+	}
+	config := map[string]interface{}{}
+	// the content is not part of the error, as it is sensitive
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("key %q of secret %s/%s is not a JSON object", ref.Key, ref.Namespace, ref.Name)
+	}
+	delegate.SecretConfig = config
+	return nil
+}
+
+// parsePostAddProbe parses and checks the post-ADD probe of a net-attach-def
+func parsePostAddProbe(rawProbe string) (*types.PostAddProbe, error) {
+	probe := &types.PostAddProbe{}
+	if err := json.Unmarshal([]byte(rawProbe), probe); err != nil {
+		return nil, err
+	}
+	switch probe.Protocol {
+	case types.PostAddProbeICMP:
+		if net.ParseIP(probe.Target) == nil {
+			return nil, fmt.Errorf("icmp target %q is not an IP", probe.Target)
+		}
+	case types.PostAddProbeTCP:
+		if _, _, err := net.SplitHostPort(probe.Target); err != nil {
+			return nil, fmt.Errorf("tcp target %q is not host:port: %v", probe.Target, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown protocol %q, must be %q or %q", probe.Protocol, types.PostAddProbeICMP, types.PostAddProbeTCP)
+	}
+	if probe.TimeoutSeconds < 0 {
+		return nil, fmt.Errorf("negative timeoutSeconds %d", probe.TimeoutSeconds)
+	}
+	return probe, nil
+}
+
+// mergeNetAttachDefCNIArgs returns a copy of net whose cni-args are the ones
+// in the given net-attach-def annotation, overridden by net's own cni-args
+func mergeNetAttachDefCNIArgs(net *types.NetworkSelectionElement, rawArgs string) (*types.NetworkSelectionElement, error) {
+	args := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(rawArgs), &args); err != nil {
+		return net, err
+	}
+	if len(args) == 0 {
+		return net, nil
+	}
+	if net.CNIArgs != nil {
+		for key, val := range *net.CNIArgs {
+			args[key] = val
+		}
+	}
+	merged := *net
+	merged.CNIArgs = &args
+	return &merged, nil
+}
+
 // GetK8sArgs gets k8s related args from CNI args
 func GetK8sArgs(args *skel.CmdArgs) (*types.K8sArgs, error) {
 	k8sArgs := &types.K8sArgs{}
@@ -378,12 +945,29 @@ func TryLoadPodDelegates(pod *v1.Pod, conf *types.NetConf, clientInfo *ClientInf
 		return 0, nil, logging.Errorf("TryLoadPodDelegates: error in loading K8s cluster default network from pod annotation: %v", err)
 	}
 	if delegate != nil {
-		logging.Debugf("TryLoadPodDelegates: Overwrite the cluster default network with %v from pod annotations", delegate)
+		logging.Debugf("TryLoadPodDelegates: Overwrite the cluster default network with %s from pod annotations", delegate.Name)
 
-		conf.Delegates[0] = delegate
+		if len(conf.Delegates) == 0 {
+			// with allowNoDefaultNetwork, the annotation adds the default network
+			conf.Delegates = append(conf.Delegates, delegate)
+		} else {
+			conf.Delegates[masterPluginIndex(conf.Delegates)] = delegate
+		}
 	}
 
-	networks, err := GetPodNetwork(pod)
+	networks, err := getPodNetwork(pod, conf.AnnotationKey(types.NetworksAnnotation))
+	if _, ok := err.(*NoK8sNetworkError); ok && conf.InheritNetworksFromOwner {
+		networks, err = getOwnerNetwork(clientInfo, pod, conf.AnnotationKey(types.NetworksAnnotation))
+	}
+	if _, ok := err.(*NoK8sNetworkError); ok || err == nil {
+		injected, injectErr := getInjectedNetworks(pod, conf, networks)
+		if injectErr != nil {
+			return 0, nil, logging.Errorf("TryLoadPodDelegates: %v", injectErr)
+		}
+		if len(injected) > 0 {
+			networks, err = append(networks, injected...), nil
+		}
+	}
 	if networks != nil {
 		delegates, err := GetNetworkDelegates(clientInfo, pod, networks, conf, resourceMap)
 
@@ -409,7 +993,22 @@ func TryLoadPodDelegates(pod *v1.Pod, conf *types.NetConf, clientInfo *ClientInf
 		}
 
 		if isGatewayConfigured {
-			err = types.CheckGatewayConfig(conf.Delegates)
+			selection := pod.Annotations[DefaultRouteSelectionAnnot]
+			switch selection {
+			case "", DefaultRouteSelectionStatic:
+			case DefaultRouteSelectionReachable:
+				if !conf.ConditionalDefaultRoute {
+					logging.Verbosef("warning: TryLoadPodDelegates: ignoring the %s annotation of pod %s/%s, conditionalDefaultRoute is not enabled", DefaultRouteSelectionAnnot, pod.Namespace, pod.Name)
+					selection = DefaultRouteSelectionStatic
+				}
+			default:
+				return 0, nil, logging.Errorf("TryLoadPodDelegates: invalid %s annotation %q, must be %q or %q", DefaultRouteSelectionAnnot, selection, DefaultRouteSelectionStatic, DefaultRouteSelectionReachable)
+			}
+			if selection == DefaultRouteSelectionReachable {
+				err = types.CheckConditionalGatewayConfig(conf.Delegates)
+			} else {
+				err = types.CheckGatewayConfig(conf.Delegates)
+			}
 			if err != nil {
 				return 0, nil, err
 			}
@@ -426,9 +1025,15 @@ func TryLoadPodDelegates(pod *v1.Pod, conf *types.NetConf, clientInfo *ClientInf
 
 // GetPodNetwork gets net-attach-def annotation from pod
 func GetPodNetwork(pod *v1.Pod) ([]*types.NetworkSelectionElement, error) {
+	return getPodNetwork(pod, networkAttachmentAnnot)
+}
+
+// getPodNetwork gets the networks of the annotation of key annotationKey
+// from pod
+func getPodNetwork(pod *v1.Pod, annotationKey string) ([]*types.NetworkSelectionElement, error) {
 	logging.Debugf("GetPodNetwork: %v", pod)
 
-	netAnnot := pod.Annotations[networkAttachmentAnnot]
+	netAnnot := pod.Annotations[annotationKey]
 	defaultNamespace := pod.ObjectMeta.Namespace
 
 	if len(netAnnot) == 0 {
@@ -442,6 +1047,88 @@ func GetPodNetwork(pod *v1.Pod) ([]*types.NetworkSelectionElement, error) {
 	return networks, nil
 }
 
+// getOwnerNetwork walks up the controller owner references of the pod and
+// returns the networks in the annotation, of key annotationKey, of the
+// closest controller having one. The networks are parsed in the namespace of
+// the pod, as owners always live in that namespace.
+func getOwnerNetwork(client *ClientInfo, pod *v1.Pod, annotationKey string) ([]*types.NetworkSelectionElement, error) {
+	if client == nil || client.Client == nil {
+		return nil, &NoK8sNetworkError{"no kubernetes network found"}
+	}
+
+	ownerRefs := pod.OwnerReferences
+	for depth := 0; depth < maxOwnerDepth; depth++ {
+		ref := metav1.GetControllerOfNoCopy(&metav1.ObjectMeta{OwnerReferences: ownerRefs})
+		if ref == nil {
+			break
+		}
+		owner, err := getOwnerMeta(client, pod.Namespace, ref)
+		if err != nil {
+			return nil, logging.Errorf("getOwnerNetwork: failed to get %s %s/%s owning pod %s: %v", ref.Kind, pod.Namespace, ref.Name, pod.Name, err)
+		}
+		if owner == nil {
+			break
+		}
+		if netAnnot := owner.Annotations[annotationKey]; netAnnot != "" {
+			logging.Debugf("getOwnerNetwork: pod %s/%s inherits networks from %s %s", pod.Namespace, pod.Name, ref.Kind, ref.Name)
+			return parsePodNetworkAnnotation(netAnnot, pod.Namespace)
+		}
+		ownerRefs = owner.OwnerReferences
+	}
+	return nil, &NoK8sNetworkError{"no kubernetes network found"}
+}
+
+// maxOwnerDepth bounds the owner reference walk of getOwnerNetwork
+const maxOwnerDepth = 4
+
+// getOwnerMeta returns the metadata of the workload referenced by ref, or
+// nil if its kind is not a known workload
+func getOwnerMeta(client *ClientInfo, namespace string, ref *metav1.OwnerReference) (*metav1.ObjectMeta, error) {
+	group := strings.Split(ref.APIVersion, "/")[0]
+	ctx := context.TODO()
+
+	switch {
+	case group == "apps" && ref.Kind == "ReplicaSet":
+		rs, err := client.Client.AppsV1().ReplicaSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &rs.ObjectMeta, nil
+	case group == "apps" && ref.Kind == "Deployment":
+		d, err := client.Client.AppsV1().Deployments(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &d.ObjectMeta, nil
+	case group == "apps" && ref.Kind == "StatefulSet":
+		ss, err := client.Client.AppsV1().StatefulSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &ss.ObjectMeta, nil
+	case group == "apps" && ref.Kind == "DaemonSet":
+		ds, err := client.Client.AppsV1().DaemonSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &ds.ObjectMeta, nil
+	case group == "batch" && ref.Kind == "Job":
+		job, err := client.Client.BatchV1().Jobs(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &job.ObjectMeta, nil
+	case group == "batch" && ref.Kind == "CronJob":
+		cj, err := client.Client.BatchV1().CronJobs(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &cj.ObjectMeta, nil
+	}
+	logging.Debugf("getOwnerMeta: owner kind %s (%s) is not a known workload", ref.Kind, ref.APIVersion)
+	return nil, nil
+}
+
 // GetNetworkDelegates returns delegatenetconf from net-attach-def annotation in pod
 func GetNetworkDelegates(k8sclient *ClientInfo, pod *v1.Pod, networks []*types.NetworkSelectionElement, conf *types.NetConf, resourceMap map[string]*types.ResourceInfo) ([]*types.DelegateNetConf, error) {
 	logging.Debugf("GetNetworkDelegates: %v, %v, %v, %v, %v", k8sclient, pod, networks, conf, resourceMap)
@@ -450,6 +1137,7 @@ func GetNetworkDelegates(k8sclient *ClientInfo, pod *v1.Pod, networks []*types.N
 	var delegates []*types.DelegateNetConf
 	defaultNamespace := pod.ObjectMeta.Namespace
 
+	nads := prefetchNetAttachDefs(k8sclient, conf, defaultNamespace, networks)
 	for _, net := range networks {
 
 		// The pods namespace (stored as defaultNamespace, does not equal the annotation's target namespace in net.Namespace)
@@ -463,7 +1151,31 @@ func GetNetworkDelegates(k8sclient *ClientInfo, pod *v1.Pod, networks []*types.N
 			}
 		}
 
-		delegate, updatedResourceMap, err := getKubernetesDelegate(k8sclient, net, conf.ConfDir, pod, resourceMap)
+		if err := validateSelectionElementRequests(net, conf); err != nil {
+			return nil, logging.Errorf("GetNetworkDelegates: %v", err)
+		}
+
+		if len(net.InlineDelegate) > 0 {
+			if err := validateInlineDelegate(defaultNamespace, conf); err != nil {
+				return nil, logging.Errorf("GetNetworkDelegates: %v", err)
+			}
+			delegate, err := getInlineDelegate(net, conf)
+			if err != nil {
+				return nil, logging.Errorf("GetNetworkDelegates: failed getting the inline delegate: %v", err)
+			}
+			delegates = append(delegates, delegate)
+			continue
+		}
+
+		if net.Name == "" && len(net.Capabilities) > 0 {
+			name, err := selectNetAttachDefByCapabilities(k8sclient, conf, net.Namespace, net.Capabilities)
+			if err != nil {
+				return nil, logging.Errorf("GetNetworkDelegates: %v", err)
+			}
+			net.Name = name
+		}
+
+		delegate, updatedResourceMap, err := getKubernetesDelegate(k8sclient, net, conf, pod, resourceMap, nads)
 		if err != nil {
 			return nil, logging.Errorf("GetNetworkDelegates: failed getting the delegate: %v", err)
 		}
@@ -471,9 +1183,266 @@ func GetNetworkDelegates(k8sclient *ClientInfo, pod *v1.Pod, networks []*types.N
 		resourceMap = updatedResourceMap
 	}
 
+	if err := checkDuplicateIPRequests(delegates); err != nil {
+		return nil, logging.Errorf("GetNetworkDelegates: %v", err)
+	}
+
 	return delegates, nil
 }
 
+// validateSelectionElementRequests checks the netns and master requested by a
+// network selection element
+func validateSelectionElementRequests(net *types.NetworkSelectionElement, conf *types.NetConf) error {
+	if net.NetnsRequest != "" {
+		if err := validateNetnsRequest(net.NetnsRequest, conf); err != nil {
+			return err
+		}
+	}
+	if net.MasterRequest != "" {
+		if err := validateMasterRequest(net.MasterRequest, conf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNetnsRequest checks that the network namespace requested by a network
+// selection element is permitted and lives under one of the allowed prefixes
+func validateNetnsRequest(netns string, conf *types.NetConf) error {
+	if !conf.AllowNetnsRequest {
+		return fmt.Errorf("network namespace %q requested but allowNetnsRequest is not enabled", netns)
+	}
+	if !filepath.IsAbs(netns) {
+		return fmt.Errorf("network namespace %q must be an absolute path", netns)
+	}
+	cleaned := filepath.Clean(netns)
+	for _, prefix := range conf.AllowedNetnsPrefixes {
+		if prefix == "" {
+			continue
+		}
+		if strings.HasPrefix(cleaned, filepath.Clean(prefix)+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("network namespace %q is not under an allowed prefix %v", netns, conf.AllowedNetnsPrefixes)
+}
+
+// validateMasterRequest checks that the master interface requested by a
+// network selection element matches one of the allowed ones
+func validateMasterRequest(master string, conf *types.NetConf) error {
+	for _, pattern := range conf.AllowedMasterInterfaces {
+		if matched, _ := filepath.Match(pattern, master); matched {
+			return nil
+		}
+	}
+	return fmt.Errorf("master interface %q is not one of the allowedMasterInterfaces %v", master, conf.AllowedMasterInterfaces)
+}
+
+// validateInlineDelegate checks that pods of the namespace may embed the CNI
+// config of a network in their network selection elements
+func validateInlineDelegate(podNamespace string, conf *types.NetConf) error {
+	if !conf.AllowInlineDelegates {
+		return fmt.Errorf("inline delegate requested but allowInlineDelegates is not enabled")
+	}
+	if !isValidNamespaceReference(podNamespace, conf.InlineDelegateNamespaces) {
+		return fmt.Errorf("inline delegate requested but namespace %q is not one of the inlineDelegateNamespaces %v", podNamespace, conf.InlineDelegateNamespaces)
+	}
+	return nil
+}
+
+// getInlineDelegate loads the delegate from the CNI config embedded in the
+// network selection element
+func getInlineDelegate(net *types.NetworkSelectionElement, conf *types.NetConf) (*types.DelegateNetConf, error) {
+	if err := checkDelegateConfigSize(conf, fmt.Sprintf("the inline config of network %q", net.Name), len(net.InlineDelegate)); err != nil {
+		return nil, err
+	}
+	configBytes := []byte(net.InlineDelegate)
+	if net.MasterRequest != "" {
+		var err error
+		configBytes, err = overrideMaster(configBytes, net.MasterRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to override the master interface: %v", err)
+		}
+	}
+	if net.IPFromPool != "" {
+		if err := checkIPFromPool(configBytes); err != nil {
+			return nil, err
+		}
+	}
+	return types.LoadDelegateNetConf(configBytes, net, "", "")
+}
+
+// delegateConfigSizeError is the error of a CNI config over the
+// maxDelegateConfigBytes of the multus config
+type delegateConfigSizeError struct {
+	source string
+	size   int
+	limit  int
+}
+
+func (e *delegateConfigSizeError) Error() string {
+	return fmt.Sprintf("%s is %d bytes, over the maxDelegateConfigBytes limit of %d", e.source, e.size, e.limit)
+}
+
+// checkDelegateConfigSize fails if the CNI config of source, of size bytes, is
+// over the maxDelegateConfigBytes of the multus config
+func checkDelegateConfigSize(conf *types.NetConf, source string, size int) error {
+	if conf.MaxDelegateConfigBytes > 0 && size > conf.MaxDelegateConfigBytes {
+		return &delegateConfigSizeError{source: source, size: size, limit: conf.MaxDelegateConfigBytes}
+	}
+	return nil
+}
+
+// getCNIConfigFromFile returns the CNI config of confDir whose name is name,
+// or the first one if name is empty, as netutils.GetCNIConfigFromFile does,
+// with the same errors.
+// The files over maxDelegateConfigBytes are skipped before they are parsed;
+// if no other file matches, the lookup fails with the error of the first one.
+func getCNIConfigFromFile(conf *types.NetConf, name, confDir string) ([]byte, error) {
+	files, err := libcni.ConfFiles(confDir, []string{".conf", ".json", ".conflist"})
+	if err != nil || len(files) == 0 {
+		return nil, fmt.Errorf("No networks found in %s", confDir)
+	}
+
+	var sizeErr error
+	for _, confFile := range files {
+		fInfo, err := os.Stat(confFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkDelegateConfigSize(conf, fmt.Sprintf("the CNI config file %s", confFile), int(fInfo.Size())); err != nil {
+			if sizeErr == nil {
+				sizeErr = err
+			}
+			continue
+		}
+
+		if strings.HasSuffix(confFile, ".conflist") {
+			confList, err := libcni.ConfListFromFile(confFile)
+			if err != nil {
+				return nil, fmt.Errorf("Error loading CNI conflist file %s: %v", confFile, err)
+			}
+			if confList.Name == name || name == "" {
+				return confList.Bytes, nil
+			}
+		} else {
+			conf, err := libcni.ConfFromFile(confFile)
+			if err != nil {
+				return nil, fmt.Errorf("Error loading CNI config file %s: %v", confFile, err)
+			}
+			if conf.Network.Name == name || name == "" {
+				// Ensure the config has a "type" so we know what plugin to run
+				if conf.Network.Type == "" {
+					return nil, fmt.Errorf("Error loading CNI config file %s: no 'type'; perhaps this is a .conflist?", confFile)
+				}
+				return conf.Bytes, nil
+			}
+		}
+	}
+	if sizeErr != nil {
+		return nil, sizeErr
+	}
+	return nil, fmt.Errorf("no network available in the name %s in cni dir %s", name, confDir)
+}
+
+// checkIPFromPool checks that the CNI config advertises the ipRanges
+// capability, through which the ipFromPool of a network selection element
+// reaches its IPAM
+func checkIPFromPool(configBytes []byte) error {
+	capabilities, err := advertisedCapabilities(configBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read the capabilities of the CNI config: %v", err)
+	}
+	if !capabilities[ipRangesCapability] {
+		return fmt.Errorf("ipFromPool requested but the CNI config does not advertise the %s capability", ipRangesCapability)
+	}
+	return nil
+}
+
+// deviceCapability returns the deviceID or pciBusID capability advertised by
+// the CNI config, if any
+func deviceCapability(configBytes []byte) string {
+	capabilities, err := advertisedCapabilities(configBytes)
+	if err != nil {
+		return ""
+	}
+	for _, capability := range []string{deviceIDCapability, pciBusIDCapability} {
+		if capabilities[capability] {
+			return capability
+		}
+	}
+	return ""
+}
+
+// overrideMaster sets the master interface in the CNI config, or in the one
+// of its first plugin for a conflist
+func overrideMaster(configBytes []byte, master string) ([]byte, error) {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, err
+	}
+	target := config
+	if plugins, ok := config["plugins"].([]interface{}); ok {
+		if len(plugins) == 0 {
+			return nil, fmt.Errorf("conflist has no plugin")
+		}
+		plugin, ok := plugins[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid first plugin in conflist")
+		}
+		target = plugin
+	}
+	target["master"] = master
+	return json.Marshal(config)
+}
+
+// ipRequestEntry holds a parsed static IP request and the delegate which requested it
+type ipRequestEntry struct {
+	ip       net.IP
+	ipNet    *net.IPNet
+	delegate *types.DelegateNetConf
+}
+
+// checkDuplicateIPRequests verifies that the same static IP is not requested by
+// two different attachments in the same pod. Overlapping CIDRs are only warned.
+func checkDuplicateIPRequests(delegates []*types.DelegateNetConf) error {
+	var entries []ipRequestEntry
+
+	for _, delegate := range delegates {
+		for _, ipRequest := range delegate.IPRequest {
+			entry := ipRequestEntry{delegate: delegate}
+			if strings.Contains(ipRequest, "/") {
+				ip, ipNet, err := net.ParseCIDR(ipRequest)
+				if err != nil {
+					return fmt.Errorf("failed to parse CIDR %q: %v", ipRequest, err)
+				}
+				entry.ip = ip
+				entry.ipNet = ipNet
+			} else {
+				entry.ip = net.ParseIP(ipRequest)
+				if entry.ip == nil {
+					return fmt.Errorf("failed to parse IP address %q", ipRequest)
+				}
+			}
+
+			for _, prev := range entries {
+				if prev.delegate == delegate {
+					continue
+				}
+				if prev.ip.Equal(entry.ip) {
+					return fmt.Errorf("IP address %s is requested by both %q and %q", entry.ip, prev.delegate.Name, delegate.Name)
+				}
+				if prev.ipNet != nil && entry.ipNet != nil &&
+					(prev.ipNet.Contains(entry.ipNet.IP) || entry.ipNet.Contains(prev.ipNet.IP)) {
+					logging.Verbosef("warning: requested CIDR %s for %q overlaps with %s for %q", entry.ipNet, delegate.Name, prev.ipNet, prev.delegate.Name)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return nil
+}
+
 func isValidNamespaceReference(targetns string, allowednamespaces []string) bool {
 	for _, eachns := range allowednamespaces {
 		if eachns == targetns {
@@ -484,8 +1453,8 @@ func isValidNamespaceReference(targetns string, allowednamespaces []string) bool
 }
 
 // getNetDelegate loads delegate network for clusterNetwork/defaultNetworks
-func getNetDelegate(client *ClientInfo, pod *v1.Pod, netname, confdir, namespace string, resourceMap map[string]*types.ResourceInfo) (*types.DelegateNetConf, map[string]*types.ResourceInfo, error) {
-	logging.Debugf("getNetDelegate: %v, %v, %v, %s", client, netname, confdir, namespace)
+func getNetDelegate(client *ClientInfo, pod *v1.Pod, netname, namespace string, conf *types.NetConf, resourceMap map[string]*types.ResourceInfo) (*types.DelegateNetConf, map[string]*types.ResourceInfo, error) {
+	logging.Debugf("getNetDelegate: %v, %v, %v, %s", client, netname, conf.ConfDir, namespace)
 	var configBytes []byte
 	isNetnamePath := strings.Contains(netname, "/")
 
@@ -496,14 +1465,14 @@ func getNetDelegate(client *ClientInfo, pod *v1.Pod, netname, confdir, namespace
 			Name:      netname,
 			Namespace: namespace,
 		}
-		delegate, resourceMap, err := getKubernetesDelegate(client, net, confdir, pod, resourceMap)
+		delegate, resourceMap, err := getKubernetesDelegate(client, net, conf, pod, resourceMap, nil)
 		if err == nil {
 			return delegate, resourceMap, nil
 		}
 
 		// option2) search CNI json config file, which has <netname> as CNI name, from confDir
 
-		configBytes, err = netutils.GetCNIConfigFromFile(netname, confdir)
+		configBytes, err = getCNIConfigFromFile(conf, netname, conf.ConfDir)
 		if err == nil {
 			delegate, err := types.LoadDelegateNetConf(configBytes, nil, "", "")
 			if err != nil {
@@ -511,6 +1480,9 @@ func getNetDelegate(client *ClientInfo, pod *v1.Pod, netname, confdir, namespace
 			}
 			return delegate, resourceMap, nil
 		}
+		if _, ok := err.(*delegateConfigSizeError); ok {
+			return nil, resourceMap, err
+		}
 	} else {
 		fInfo, err := os.Stat(netname)
 		if err != nil {
@@ -525,7 +1497,7 @@ func getNetDelegate(client *ClientInfo, pod *v1.Pod, netname, confdir, namespace
 			}
 			if len(files) > 0 {
 				var configBytes []byte
-				configBytes, err = netutils.GetCNIConfigFromFile("", netname)
+				configBytes, err = getCNIConfigFromFile(conf, "", netname)
 				if err == nil {
 					delegate, err := types.LoadDelegateNetConf(configBytes, nil, "", "")
 					if err != nil {
@@ -537,6 +1509,9 @@ func getNetDelegate(client *ClientInfo, pod *v1.Pod, netname, confdir, namespace
 			}
 		} else {
 			// option4) if file path (absolute), then load it directly
+			if err := checkDelegateConfigSize(conf, fmt.Sprintf("the CNI config file %s", netname), int(fInfo.Size())); err != nil {
+				return nil, resourceMap, err
+			}
 			if strings.HasSuffix(netname, ".conflist") {
 				confList, err := libcni.ConfListFromFile(netname)
 				if err != nil {
@@ -580,25 +1555,50 @@ func GetDefaultNetworks(pod *v1.Pod, conf *types.NetConf, kubeClient *ClientInfo
 		return resourceMap, nil
 	}
 
-	delegate, resourceMap, err := getNetDelegate(kubeClient, pod, conf.ClusterNetwork, conf.ConfDir, conf.MultusNamespace, resourceMap)
+	delegate, resourceMap, err := getNetDelegate(kubeClient, pod, conf.ClusterNetwork, conf.MultusNamespace, conf, resourceMap)
 
 	if err != nil {
 		return resourceMap, logging.Errorf("GetDefaultNetworks: failed to get clusterNetwork %s in namespace %s", conf.ClusterNetwork, conf.MultusNamespace)
 	}
 	delegate.MasterPlugin = true
-	delegates = append(delegates, delegate)
+	clusterDelegate := delegate
 
 	// Pod in kube-system namespace does not have default network for now.
 	if pod != nil && !types.CheckSystemNamespaces(pod.ObjectMeta.Namespace, conf.SystemNamespaces) {
-		for _, netname := range conf.DefaultNetworks {
-			delegate, resourceMap, err := getNetDelegate(kubeClient, pod, netname, conf.ConfDir, conf.MultusNamespace, resourceMap)
+		defaultNetworks := conf.DefaultNetworks
+		var namespaceNetworks []*types.NetworkSelectionElement
+		if conf.NamespaceDefaultNetworks {
+			var replace bool
+			namespaceNetworks, replace, err = getNamespaceDefaultNetworks(kubeClient, pod, conf)
 			if err != nil {
 				return resourceMap, err
 			}
+			if replace {
+				defaultNetworks = nil
+			}
+		}
+
+		for _, netname := range defaultNetworks {
+			delegate, resourceMap, err := getNetDelegate(kubeClient, pod, netname, conf.MultusNamespace, conf, resourceMap)
+			if err != nil {
+				return resourceMap, err
+			}
+			delegates = append(delegates, delegate)
+		}
+		for _, net := range namespaceNetworks {
+			delegate, resourceMap, err = getKubernetesDelegate(kubeClient, net, conf, pod, resourceMap, nil)
+			if err != nil {
+				return resourceMap, logging.Errorf("GetDefaultNetworks: failed getting the delegate of namespace %s: %v", pod.ObjectMeta.Namespace, err)
+			}
 			delegates = append(delegates, delegate)
 		}
 	}
 
+	if conf.DefaultNetworksOrder == types.DefaultNetworksBeforeClusterNetwork {
+		delegates = append(delegates, clusterDelegate)
+	} else {
+		delegates = append([]*types.DelegateNetConf{clusterDelegate}, delegates...)
+	}
 	if err = conf.AddDelegates(delegates); err != nil {
 		return resourceMap, err
 	}
@@ -606,12 +1606,92 @@ func GetDefaultNetworks(pod *v1.Pod, conf *types.NetConf, kubeClient *ClientInfo
 	return resourceMap, nil
 }
 
+// getNamespaceDefaultNetworks returns the default networks set by the
+// annotations of the namespace of the pod, and whether they replace the ones
+// of the configuration instead of being added to them
+func getNamespaceDefaultNetworks(kubeClient *ClientInfo, pod *v1.Pod, conf *types.NetConf) ([]*types.NetworkSelectionElement, bool, error) {
+	podNamespace := pod.ObjectMeta.Namespace
+	namespace, err := kubeClient.GetNamespace(podNamespace)
+	if err != nil {
+		return nil, false, logging.Errorf("getNamespaceDefaultNetworks: failed to get namespace %s: %v", podNamespace, err)
+	}
+
+	var replace bool
+	switch mode := namespace.Annotations[namespaceDefaultNetworksModeAnnot]; mode {
+	case "", "append":
+	case "replace":
+		replace = true
+	default:
+		return nil, false, logging.Errorf("getNamespaceDefaultNetworks: unknown %s %q in namespace %s, must be one of: append, replace", namespaceDefaultNetworksModeAnnot, mode, podNamespace)
+	}
+
+	netAnnot := strings.TrimSpace(namespace.Annotations[namespaceDefaultNetworksAnnot])
+	if netAnnot == "" {
+		return nil, replace, nil
+	}
+	networks, err := parsePodNetworkAnnotation(netAnnot, podNamespace)
+	if err != nil {
+		return nil, false, logging.Errorf("getNamespaceDefaultNetworks: invalid %s in namespace %s: %v", namespaceDefaultNetworksAnnot, podNamespace, err)
+	}
+	for _, net := range networks {
+		if conf.NamespaceIsolation && net.Namespace != podNamespace && !isValidNamespaceReference(net.Namespace, conf.NonIsolatedNamespaces) {
+			return nil, false, logging.Errorf("getNamespaceDefaultNetworks: namespace isolation enabled, namespace %s refers to target namespace %s", podNamespace, net.Namespace)
+		}
+	}
+	return networks, replace, nil
+}
+
+// getInjectedNetworks returns the networks of the networkInjectionRules whose
+// podSelector matches the labels of the pod, but those it already requests
+func getInjectedNetworks(pod *v1.Pod, conf *types.NetConf, requested []*types.NetworkSelectionElement) ([]*types.NetworkSelectionElement, error) {
+	podNamespace := pod.ObjectMeta.Namespace
+	seen := map[string]bool{}
+	for _, net := range requested {
+		seen[net.Namespace+"/"+net.Name] = true
+	}
+
+	var injected []*types.NetworkSelectionElement
+	for _, rule := range conf.NetworkInjectionRules {
+		selector, err := labels.Parse(rule.PodSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid networkInjectionRules podSelector %q: %v", rule.PodSelector, err)
+		}
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		networks, err := parsePodNetworkAnnotation(rule.Network, podNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid networkInjectionRules network %q: %v", rule.Network, err)
+		}
+		for _, net := range networks {
+			if conf.NamespaceIsolation && net.Namespace != podNamespace && !isValidNamespaceReference(net.Namespace, conf.NonIsolatedNamespaces) {
+				return nil, fmt.Errorf("namespace isolation enabled, networkInjectionRules network %q is outside of pod namespace %s", rule.Network, podNamespace)
+			}
+			key := net.Namespace + "/" + net.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			logging.Debugf("getInjectedNetworks: injecting network %s into pod %s/%s", key, podNamespace, pod.Name)
+			injected = append(injected, net)
+		}
+	}
+	return injected, nil
+}
+
 // tryLoadK8sPodDefaultNetwork get pod default network from annotations
 func tryLoadK8sPodDefaultNetwork(kubeClient *ClientInfo, pod *v1.Pod, conf *types.NetConf) (*types.DelegateNetConf, error) {
 	var netAnnot string
 	logging.Debugf("tryLoadK8sPodDefaultNetwork: %v, %v, %v", kubeClient, pod, conf)
 
 	netAnnot, ok := pod.Annotations[defaultNetAnnot]
+	altKey := conf.AnnotationKey(types.DefaultNetworkAnnotation)
+	if altAnnot, altOk := pod.Annotations[altKey]; altOk {
+		if ok && altAnnot != netAnnot {
+			return nil, logging.Errorf("tryLoadK8sPodDefaultNetwork: %s %q and %s %q conflict", defaultNetAnnot, netAnnot, altKey, altAnnot)
+		}
+		netAnnot, ok = altAnnot, true
+	}
 	if !ok {
 		logging.Debugf("tryLoadK8sPodDefaultNetwork: Pod default network annotation is not defined")
 		return nil, nil
@@ -626,7 +1706,14 @@ func tryLoadK8sPodDefaultNetwork(kubeClient *ClientInfo, pod *v1.Pod, conf *type
 		return nil, logging.Errorf("tryLoadK8sPodDefaultNetwork: more than one default network is specified: %s", netAnnot)
 	}
 
-	delegate, _, err := getKubernetesDelegate(kubeClient, networks[0], conf.ConfDir, pod, nil)
+	// besides multusNamespace, the pod may only refer to its own namespace or a non-isolated one
+	targetNamespace := networks[0].Namespace
+	if conf.NamespaceIsolation && targetNamespace != conf.MultusNamespace && targetNamespace != pod.ObjectMeta.Namespace &&
+		!isValidNamespaceReference(targetNamespace, conf.NonIsolatedNamespaces) {
+		return nil, logging.Errorf("tryLoadK8sPodDefaultNetwork: namespace isolation enabled, pod is in namespace %s but its default network refers to target namespace %s", pod.ObjectMeta.Namespace, targetNamespace)
+	}
+
+	delegate, _, err := getKubernetesDelegate(kubeClient, networks[0], conf, pod, nil, nil)
 	if err != nil {
 		return nil, logging.Errorf("tryLoadK8sPodDefaultNetwork: failed getting the delegate: %v", err)
 	}
@@ -635,6 +1722,18 @@ func tryLoadK8sPodDefaultNetwork(kubeClient *ClientInfo, pod *v1.Pod, conf *type
 	return delegate, nil
 }
 
+// masterPluginIndex returns the index of the cluster network delegate, which
+// is the first one unless defaultNetworksOrder lists it after the default
+// networks
+func masterPluginIndex(delegates []*types.DelegateNetConf) int {
+	for idx, delegate := range delegates {
+		if delegate.MasterPlugin {
+			return idx
+		}
+	}
+	return 0
+}
+
 // ConfigSourceAnnotationKey specifies kubernetes annotation, defined in k8s.io/kubernetes/pkg/kubelet/types
 const ConfigSourceAnnotationKey = "kubernetes.io/config.source"
 
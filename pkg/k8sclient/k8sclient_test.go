@@ -18,10 +18,17 @@ package k8sclient
 // disable dot-imports only for testing
 //revive:disable:dot-imports
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	types020 "github.com/containernetworking/cni/pkg/types/020"
 	testutils "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/testing"
@@ -33,7 +40,15 @@ import (
 	netfake "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/fake"
 	netutils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
 
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -85,6 +100,167 @@ var _ = Describe("k8sclient operations", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	Context("caching the delegates of net-attach-defs", func() {
+		var savedCache *nadDelegateCache
+
+		BeforeEach(func() {
+			savedCache = nadDelegates
+			nadDelegates = newNADDelegateCache(nadDelegateCacheSize)
+		})
+
+		AfterEach(func() {
+			nadDelegates = savedCache
+		})
+
+		It("reuses the delegate of an unchanged net-attach-def and recompiles it after a resourceVersion bump", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			nad := testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", `{"name": "net1", "type": "mynet", "cniVersion": "0.3.1"}`)
+			nad.UID = "net1-uid"
+			nad.ResourceVersion = "1"
+			_, err = clientInfo.AddNetAttachDef(nad)
+			Expect(err).NotTo(HaveOccurred())
+
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			delegateType := func() string {
+				networks, err := GetPodNetwork(fakePod)
+				Expect(err).NotTo(HaveOccurred())
+				delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(delegates).To(HaveLen(1))
+				return delegates[0].Conf.Type
+			}
+			updateNAD := func(config, resourceVersion string) {
+				nad.Spec.Config = config
+				nad.ResourceVersion = resourceVersion
+				_, err := clientInfo.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(nad.Namespace).Update(context.TODO(), nad, metav1.UpdateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Expect(delegateType()).To(Equal("mynet"))
+			Expect(nadDelegates.misses).To(Equal(1))
+
+			// the delegate is not compiled again for the same resourceVersion
+			updateNAD(`{"name": "net1", "type": "othernet", "cniVersion": "0.3.1"}`, "1")
+			Expect(delegateType()).To(Equal("mynet"))
+			Expect(nadDelegates.hits).To(Equal(1))
+
+			updateNAD(`{"name": "net1", "type": "othernet", "cniVersion": "0.3.1"}`, "2")
+			Expect(delegateType()).To(Equal("othernet"))
+			Expect(nadDelegates.misses).To(Equal(2))
+			Expect(nadDelegates.lru.Len()).To(Equal(1))
+		})
+
+		It("returns a copy of the cached delegate", func() {
+			nad := testutils.NewFakeNetAttachDef("test", "net1", `{"name": "net1", "cniVersion": "0.3.1", "plugins": [{"type": "mynet", "capabilities": {"ips": true}}]}`)
+			nad.UID = "net1-uid"
+			nad.ResourceVersion = "1"
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+
+			delegate, err := getNetAttachDefDelegate(nad, netConf)
+			Expect(err).NotTo(HaveOccurred())
+			delegate.Name = "changed"
+			delegate.Bytes[0] = ' '
+			delegate.ConfList.Plugins[0].Capabilities["ips"] = false
+			delegate.IPRequest = append(delegate.IPRequest, "10.1.1.1/24")
+
+			delegate, err = getNetAttachDefDelegate(nad, netConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nadDelegates.hits).To(Equal(1))
+			Expect(delegate.Name).To(Equal("net1"))
+			Expect(string(delegate.Bytes)).To(Equal(nad.Spec.Config))
+			Expect(delegate.ConfList.Plugins[0].Capabilities["ips"]).To(BeTrue())
+			Expect(delegate.IPRequest).To(BeEmpty())
+		})
+
+		It("evicts the least recently used delegate", func() {
+			cache := newNADDelegateCache(2)
+			cache.add("a", "1", &types.DelegateNetConf{Name: "a"})
+			cache.add("b", "1", &types.DelegateNetConf{Name: "b"})
+			_, ok := cache.get("a", "1")
+			Expect(ok).To(BeTrue())
+			cache.add("c", "1", &types.DelegateNetConf{Name: "c"})
+
+			_, ok = cache.get("b", "1")
+			Expect(ok).To(BeFalse())
+			delegate, ok := cache.get("a", "1")
+			Expect(ok).To(BeTrue())
+			Expect(delegate.Name).To(Equal("a"))
+			_, ok = cache.get("c", "1")
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Context("selecting a network by capabilities", func() {
+		const portMapNet = `{
+	"cniVersion": "0.3.1",
+	"name": "%s",
+	"plugins": [
+		{"type": "bridge"},
+		{"type": "portmap", "capabilities": {"portMappings": true}}
+	]
+}`
+		var clientInfo *ClientInfo
+		var fakePod *v1.Pod
+
+		BeforeEach(func() {
+			fakePod = testutils.NewFakePod(fakePodName, `[{"capabilities": {"portMappings": true}, "interface": "net5"}]`, "")
+			clientInfo = NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "plain",
+				`{"cniVersion": "0.3.1", "name": "plain", "type": "bridge"}`))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "withports", fmt.Sprintf(portMapNet, "withports")))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		getDelegates := func() ([]*types.DelegateNetConf, error) {
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			return GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		}
+
+		It("selects the only net-attach-def with the capabilities", func() {
+			delegates, err := getDelegates()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates).To(HaveLen(1))
+			Expect(delegates[0].Name).To(Equal("test/withports"))
+			Expect(delegates[0].ConfList.Name).To(Equal("withports"))
+			Expect(delegates[0].IfnameRequest).To(Equal("net5"))
+		})
+
+		It("fails when several net-attach-defs have the capabilities", func() {
+			_, err := clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "alsoports", fmt.Sprintf(portMapNet, "alsoports")))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = getDelegates()
+			Expect(err).To(MatchError(ContainSubstring("several network-attachment-definitions in namespace test have the capabilities [portMappings]: [alsoports withports]")))
+		})
+
+		It("fails when no net-attach-def has the capabilities", func() {
+			Expect(clientInfo.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(fakePod.ObjectMeta.Namespace).Delete(
+				context.TODO(), "withports", metav1.DeleteOptions{})).To(Succeed())
+
+			_, err := getDelegates()
+			Expect(err).To(MatchError(ContainSubstring("no network-attachment-definition in namespace test has the capabilities [portMappings]")))
+		})
+
+		It("rejects an element with both a name and capabilities", func() {
+			fakePod.ObjectMeta.Annotations[networkAttachmentAnnot] = `[{"name": "plain", "capabilities": {"portMappings": true}}]`
+			_, err := GetPodNetwork(fakePod)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	It("retrieves delegates from kubernetes using simple format annotation", func() {
 		fakePod := testutils.NewFakePod(fakePodName, "net1,net2", "")
 		net1 := `{
@@ -161,6 +337,144 @@ var _ = Describe("k8sclient operations", func() {
 		Expect(err).To(MatchError("GetNetworkDelegates: failed getting the delegate: getKubernetesDelegate: cannot find a network-attachment-definition (net1) in namespace (test): network-attachment-definitions.k8s.cni.cncf.io \"net1\" not found"))
 	})
 
+	It("uses the fallback network when the network does not exist", func() {
+		fakePod := testutils.NewFakePod(fakePodName, `[{"name": "net1", "fallbackName": "net2"}]`, "")
+		net2 := `{
+	"name": "net2",
+	"type": "mynet2",
+	"cniVersion": "0.2.0"
+}`
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(delegates)).To(Equal(1))
+		Expect(delegates[0].Conf.Name).To(Equal("net2"))
+		Expect(delegates[0].Conf.Type).To(Equal("mynet2"))
+		Expect(delegates[0].Name).To(Equal("test/net2"))
+	})
+
+	It("fails when neither the network nor its fallback exist", func() {
+		fakePod := testutils.NewFakePod(fakePodName, `[{"name": "net1", "fallbackName": "net2"}]`, "")
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(len(delegates)).To(Equal(0))
+		Expect(err).To(MatchError("GetNetworkDelegates: failed getting the delegate: getKubernetesDelegate: cannot find a network-attachment-definition (net1) nor its fallback (net2) in namespace (test): " +
+			"network-attachment-definitions.k8s.cni.cncf.io \"net1\" not found; network-attachment-definitions.k8s.cni.cncf.io \"net2\" not found"))
+	})
+
+	It("rejects a fallbackName without a name", func() {
+		_, err := types.ParseNetworkSelectionElements(`[{"capabilities": {"portMappings": true}, "fallbackName": "net2"}]`, "test")
+		Expect(err).To(MatchError(`network selection element with fallbackName "net2" must have a name`))
+	})
+
+	It("prefetches net-attach-defs with one list per namespace", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "net1,net2,net3,other/net4,other/net5", "")
+		netConfig := `{
+	"name": "%s",
+	"type": "mynet",
+	"cniVersion": "0.2.0"
+}`
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		for _, name := range []string{"net1", "net2", "net3"} {
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", name, fmt.Sprintf(netConfig, name)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for _, name := range []string{"net4", "net5"} {
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("other", name, fmt.Sprintf(netConfig, name)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+
+		fakeNetClient := clientInfo.NetClient.(*netfake.Clientset)
+		fakeNetClient.ClearActions()
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(5))
+		Expect(delegates[4].Name).To(Equal("other/net5"))
+
+		verbs := map[string]int{}
+		for _, action := range fakeNetClient.Actions() {
+			verbs[action.GetVerb()]++
+		}
+		Expect(verbs).To(Equal(map[string]int{"list": 2}))
+
+		// a net-attach-def missing from the list keeps the not-found error
+		networks = append(networks, &types.NetworkSelectionElement{Name: "net6", Namespace: "other"})
+		_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).To(MatchError("GetNetworkDelegates: failed getting the delegate: getKubernetesDelegate: cannot find a network-attachment-definition (net6) in namespace (other): network-attachment-definitions.k8s.cni.cncf.io \"net6\" not found"))
+	})
+
+	It("retrieves net-attach-defs from the externalNADKubeconfig cluster", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+		net1 := `{
+	"name": "net1",
+	"type": "mynet",
+	"cniVersion": "0.2.0"
+}`
+		localNet1 := `{
+	"name": "net1",
+	"type": "localnet",
+	"cniVersion": "0.2.0"
+}`
+		externalKubeconfig := filepath.Join(tmpDir, "external.kubeconfig")
+
+		// pods live in the local cluster only
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", localNet1))
+		Expect(err).NotTo(HaveOccurred())
+
+		externalClientInfo := NewFakeClientInfo()
+		_, err = externalClientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		externalNetClients[externalKubeconfig] = externalClientInfo.NetClient
+		defer delete(externalNetClients, externalKubeconfig)
+
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		netConf.ExternalNADKubeconfig = externalKubeconfig
+
+		numK8sDelegates, _, err := TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(numK8sDelegates).To(Equal(1))
+		Expect(netConf.Delegates[1].Conf.Type).To(Equal("mynet"))
+
+		// the external client is built once and reused
+		netClient, err := GetExternalNetClient(externalKubeconfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netClient).To(BeIdenticalTo(externalClientInfo.NetClient))
+	})
+
 	It("retrieves delegates from kubernetes using JSON format annotation", func() {
 		fakePod := testutils.NewFakePod(fakePodName, `[
 {"name":"net1"},
@@ -286,6 +600,69 @@ var _ = Describe("k8sclient operations", func() {
 		Expect(delegates[2].Conf.Type).To(Equal("mynet3"))
 	})
 
+	It("fails when the same static IP is requested by two attachments", func() {
+		fakePod := testutils.NewFakePod(fakePodName, `[
+{"name":"net1", "ips": ["10.10.10.10/24"]},
+{"name":"net2", "ips": ["10.10.10.10/24"]}
+]`, "")
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", `{
+			"name": "net1",
+			"type": "mynet",
+			"cniVersion": "0.2.0"
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", `{
+			"name": "net2",
+			"type": "mynet2",
+			"cniVersion": "0.2.0"
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).To(MatchError(`GetNetworkDelegates: IP address 10.10.10.10 is requested by both "test/net1" and "test/net2"`))
+	})
+
+	It("allows overlapping but distinct static IPs across attachments", func() {
+		fakePod := testutils.NewFakePod(fakePodName, `[
+{"name":"net1", "ips": ["10.10.10.10/24"]},
+{"name":"net2", "ips": ["10.10.10.11/24"]}
+]`, "")
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", `{
+			"name": "net1",
+			"type": "mynet",
+			"cniVersion": "0.2.0"
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", `{
+			"name": "net2",
+			"type": "mynet2",
+			"cniVersion": "0.2.0"
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(2))
+	})
+
 	It("retrieves delegates from kubernetes using on-disk config files", func() {
 		fakePod := testutils.NewFakePod(fakePodName, "net1,net2", "")
 
@@ -444,6 +821,48 @@ var _ = Describe("k8sclient operations", func() {
 		Expect(netConf.Delegates[1].Conf.Type).To(Equal("mynet2"))
 	})
 
+	DescribeTable("orders the default networks relative to the cluster network",
+		func(order string, expected []string) {
+			fakePod := testutils.NewFakePod(fakePodName, "", "")
+			fakePod.Annotations[defaultNetAnnot] = "kube-system/net3"
+			netConf, err := types.LoadNetConf([]byte(fmt.Sprintf(`{
+				"name":"node-cni-network",
+				"type":"multus",
+				"clusterNetwork": "net1",
+				"defaultNetworks": ["net2"],
+				"defaultNetworksOrder": %q,
+				"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+			}`, order)))
+			Expect(err).NotTo(HaveOccurred())
+
+			clientInfo := NewFakeClientInfo()
+			_, err = clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			for i, nadType := range []string{"mynet", "mynet2", "mynet3"} {
+				_, err = clientInfo.AddNetAttachDef(
+					testutils.NewFakeNetAttachDef("kube-system", fmt.Sprintf("net%d", i+1), fmt.Sprintf(`{"type": %q}`, nadType)))
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			_, err = GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, delegate := range netConf.Delegates {
+				names = append(names, fmt.Sprintf("%s master=%t", delegate.Conf.Name, delegate.MasterPlugin))
+			}
+			Expect(names).To(Equal(expected))
+
+			// the default-network annotation of the pod replaces the cluster
+			// network wherever it is
+			_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netConf.Delegates[masterPluginIndex(netConf.Delegates)].Conf.Name).To(Equal("net3"))
+			Expect(netConf.Delegates).To(HaveLen(2))
+		},
+		Entry("after the cluster network by default", "after-cluster-network", []string{"net1 master=true", "net2 master=false"}),
+		Entry("before the cluster network", "before-cluster-network", []string{"net2 master=false", "net1 master=true"}),
+	)
+
 	It("ignore default networks from CRD in case of kube-system namespace", func() {
 		fakePod := testutils.NewFakePod(fakePodName, "", "")
 		// overwrite namespace
@@ -478,6 +897,106 @@ var _ = Describe("k8sclient operations", func() {
 		Expect(netConf.Delegates[0].Conf.Type).To(Equal("mynet"))
 	})
 
+	Context("with namespaceDefaultNetworks", func() {
+		var clientInfo *ClientInfo
+		var fakePod *v1.Pod
+
+		BeforeEach(func() {
+			fakePod = testutils.NewFakePod(fakePodName, "", "")
+			clientInfo = NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			for _, nad := range []*nettypes.NetworkAttachmentDefinition{
+				testutils.NewFakeNetAttachDef("kube-system", "myCRD1", "{\"type\": \"mynet\"}"),
+				testutils.NewFakeNetAttachDef("kube-system", "myCRD2", "{\"type\": \"mynet2\"}"),
+				testutils.NewFakeNetAttachDef("test", "tenant-net", "{\"type\": \"tenant\"}"),
+				testutils.NewFakeNetAttachDef("other", "other-net", "{\"type\": \"other\"}"),
+			} {
+				_, err = clientInfo.AddNetAttachDef(nad)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		addNamespace := func(annotations map[string]string) {
+			_, err := clientInfo.Client.CoreV1().Namespaces().Create(context.TODO(), &v1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: annotations},
+			}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		loadNetConf := func(extra string) *types.NetConf {
+			netConf, err := types.LoadNetConf([]byte(`{
+				"name":"node-cni-network",
+				"type":"multus",
+				"clusterNetwork": "myCRD1",
+				"defaultNetworks": ["myCRD2"],
+				"namespaceDefaultNetworks": true,
+				` + extra + `
+				"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			return netConf
+		}
+
+		delegateNames := func(netConf *types.NetConf) []string {
+			var names []string
+			for _, delegate := range netConf.Delegates {
+				names = append(names, delegate.Conf.Name)
+			}
+			return names
+		}
+
+		It("adds the networks of the namespace to the default networks", func() {
+			addNamespace(map[string]string{namespaceDefaultNetworksAnnot: "tenant-net"})
+			netConf := loadNetConf("")
+
+			_, err := GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegateNames(netConf)).To(Equal([]string{"myCRD1", "myCRD2", "tenant-net"}))
+			Expect(netConf.Delegates[2].Conf.Type).To(Equal("tenant"))
+		})
+
+		It("replaces the default networks by the ones of the namespace", func() {
+			addNamespace(map[string]string{
+				namespaceDefaultNetworksAnnot:     "tenant-net",
+				namespaceDefaultNetworksModeAnnot: "replace",
+			})
+			netConf := loadNetConf("")
+
+			_, err := GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegateNames(netConf)).To(Equal([]string{"myCRD1", "tenant-net"}))
+		})
+
+		It("keeps the default networks when the namespace has no annotation", func() {
+			addNamespace(nil)
+			netConf := loadNetConf("")
+
+			_, err := GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegateNames(netConf)).To(Equal([]string{"myCRD1", "myCRD2"}))
+		})
+
+		It("rejects a network of another namespace with namespace isolation", func() {
+			addNamespace(map[string]string{namespaceDefaultNetworksAnnot: "other/other-net"})
+			netConf := loadNetConf(`"namespaceIsolation": true,`)
+
+			_, err := GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+			Expect(err).To(MatchError(ContainSubstring("namespace isolation enabled")))
+		})
+
+		It("rejects an unknown mode", func() {
+			addNamespace(map[string]string{
+				namespaceDefaultNetworksAnnot:     "tenant-net",
+				namespaceDefaultNetworksModeAnnot: "merge",
+			})
+			netConf := loadNetConf("")
+
+			_, err := GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+			Expect(err).To(MatchError(ContainSubstring(`unknown v1.multus-cni.io/default-networks-mode "merge"`)))
+		})
+	})
+
 	It("retrieves cluster network from file", func() {
 		fakePod := testutils.NewFakePod(fakePodName, "", "")
 		conf := `{
@@ -636,8 +1155,9 @@ var _ = Describe("k8sclient operations", func() {
 		Expect(netConf.Delegates[0].Conf.Type).To(Equal("mynet1"))
 	})
 
-	It("fails with bad confdir", func() {
-		fakePod := testutils.NewFakePod(fakePodName, "", "net1")
+	It("overwrite cluster network when the k8s.v1.cni.cncf.io/default-network annotation is set", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "", "")
+		fakePod.Annotations[defaultNetAltAnnot] = "net1"
 		conf := `{
 			"name":"node-cni-network",
 			"type":"multus",
@@ -651,7 +1171,159 @@ var _ = Describe("k8sclient operations", func() {
 		clientInfo := NewFakeClientInfo()
 		_, err = clientInfo.AddPod(fakePod)
 		Expect(err).NotTo(HaveOccurred())
-		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net1", ""))
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("kube-system", "net1", "{\"type\": \"mynet1\"}"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("kube-system", "net2", "{\"type\": \"mynet2\"}"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.Delegates[0].Conf.Type).To(Equal("mynet2"))
+
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.Delegates).To(HaveLen(1))
+		Expect(netConf.Delegates[0].Conf.Name).To(Equal("net1"))
+		Expect(netConf.Delegates[0].Conf.Type).To(Equal("mynet1"))
+		Expect(netConf.Delegates[0].MasterPlugin).To(BeTrue())
+
+		// both annotations must agree
+		fakePod.Annotations[defaultNetAnnot] = "net2"
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).To(MatchError(ContainSubstring(`v1.multus-cni.io/default-network "net2" and k8s.v1.cni.cncf.io/default-network "net1" conflict`)))
+	})
+
+	It("rejects the netns requested by the default-network annotation unless allowed", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "", "")
+		fakePod.Annotations[defaultNetAnnot] = `[{"name":"net1","netns":"/proc/1/ns/net"}]`
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"clusterNetwork": "net2",
+			"multusNamespace" : "kube-system",
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("kube-system", "net1", "{\"type\": \"mynet1\"}"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("kube-system", "net2", "{\"type\": \"mynet2\"}"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).To(MatchError(ContainSubstring(`network namespace "/proc/1/ns/net" requested but allowNetnsRequest is not enabled`)))
+
+		netConf.AllowNetnsRequest = true
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).To(MatchError(ContainSubstring(`network namespace "/proc/1/ns/net" is not under an allowed prefix`)))
+	})
+
+	It("rejects the master requested by the default-network annotation unless allowed", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "", "")
+		fakePod.Annotations[defaultNetAnnot] = `[{"name":"net1","master":"eth2"}]`
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"clusterNetwork": "net2",
+			"multusNamespace" : "kube-system",
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("kube-system", "net1", "{\"type\": \"macvlan\", \"master\": \"eth0\"}"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("kube-system", "net2", "{\"type\": \"mynet2\"}"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).To(MatchError(ContainSubstring(`master interface "eth2" is not one of the allowedMasterInterfaces []`)))
+
+		netConf.AllowedMasterInterfaces = []string{"eth1"}
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).To(MatchError(ContainSubstring(`master interface "eth2" is not one of the allowedMasterInterfaces [eth1]`)))
+
+		netConf.AllowedMasterInterfaces = []string{"eth*"}
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		config := map[string]interface{}{}
+		Expect(json.Unmarshal(netConf.Delegates[0].Bytes, &config)).To(Succeed())
+		Expect(config["master"]).To(Equal("eth2"))
+	})
+
+	It("applies namespace isolation to the default network of the pod annotation", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "", "")
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"clusterNetwork": "net2",
+			"multusNamespace" : "kube-system",
+			"namespaceIsolation": true,
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("kube-system", "net2", "{\"type\": \"mynet2\"}"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef("other", "gpu", "{\"type\": \"gpunet\"}"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "gpu", "{\"type\": \"gpunet\"}"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = GetDefaultNetworks(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		fakePod.Annotations[defaultNetAltAnnot] = "other/gpu"
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).To(MatchError(ContainSubstring("namespace isolation enabled, pod is in namespace test but its default network refers to target namespace other")))
+
+		fakePod.Annotations[defaultNetAltAnnot] = "test/gpu"
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.Delegates[0].Name).To(Equal("test/gpu"))
+		Expect(netConf.Delegates[0].MasterPlugin).To(BeTrue())
+	})
+
+	It("fails with bad confdir", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "", "net1")
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"clusterNetwork": "net2",
+			"multusNamespace" : "kube-system",
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net1", ""))
 		Expect(err).NotTo(HaveOccurred())
 		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net2", ""))
 		Expect(err).NotTo(HaveOccurred())
@@ -845,27 +1517,676 @@ users:
 		clientInfo := NewFakeClientInfo()
 		_, err = clientInfo.AddPod(fakePod)
 		Expect(err).NotTo(HaveOccurred())
-		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net1", net1))
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		k8sArgs, err := GetK8sArgs(args)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod, err := clientInfo.GetPod(string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
+		networks, err := GetPodNetwork(pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		netConf, err := types.LoadNetConf([]byte(conf))
+		netConf.ConfDir = tmpDir
+		_, err = GetNetworkDelegates(clientInfo, pod, networks, netConf, nil)
+
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(MatchError("GetNetworkDelegates: namespace isolation enabled, annotation violates permission, pod is in namespace test but refers to target namespace kube-system"))
+
+	})
+
+	It("Properly allows a specified namespace reference when namespace isolation is enabled", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "kube-system/net1", "")
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"delegates": [{
+			"name": "weave1",
+				"cniVersion": "0.2.0",
+				"type": "weave-net"
+			}],
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml",
+			"namespaceIsolation": true,
+			"globalNamespaces": "kube-system,donkey-kong"
+		}`
+
+		Expect(err).NotTo(HaveOccurred())
+
+		net1 := `{
+	"name": "net1",
+	"type": "mynet",
+	"cniVersion": "0.2.0"
+}`
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		k8sArgs, err := GetK8sArgs(args)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod, err := clientInfo.GetPod(string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
+		networks, err := GetPodNetwork(pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		netConf, err := types.LoadNetConf([]byte(conf))
+		netConf.ConfDir = tmpDir
+		_, err = GetNetworkDelegates(clientInfo, pod, networks, netConf, nil)
+
+		Expect(err).NotTo(HaveOccurred())
+
+	})
+
+	It("Validates a netns request against the allow flag and prefixes", func() {
+		fakePod := testutils.NewFakePod(fakePodName, `[{"name":"net1","netns":"/var/run/netns/alt"}]`, "")
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"delegates": [{
+			"name": "weave1",
+				"cniVersion": "0.2.0",
+				"type": "weave-net"
+			}],
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+
+		net1 := `{
+	"name": "net1",
+	"type": "mynet",
+	"cniVersion": "0.2.0"
+}`
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+
+		_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).To(MatchError(`GetNetworkDelegates: network namespace "/var/run/netns/alt" requested but allowNetnsRequest is not enabled`))
+
+		netConf.AllowNetnsRequest = true
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(1))
+		Expect(delegates[0].NetnsRequest).To(Equal("/var/run/netns/alt"))
+
+		networks[0].NetnsRequest = "/var/run/netns/../../../proc/1/ns/net"
+		_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).To(MatchError(`GetNetworkDelegates: network namespace "/var/run/netns/../../../proc/1/ns/net" is not under an allowed prefix [/var/run/netns /run/netns]`))
+	})
+
+	DescribeTable("overrides the master interface of a delegate from the allowed ones", func(master string, allowed []string, expectedErr string) {
+		fakePod := testutils.NewFakePod(fakePodName, fmt.Sprintf(`[{"name":"net1","master":%q}]`, master), "")
+		net1 := `{
+	"name": "net1",
+	"type": "macvlan",
+	"master": "eth0",
+	"cniVersion": "0.3.1"
+}`
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks[0].MasterRequest).To(Equal(master))
+
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		netConf.AllowedMasterInterfaces = allowed
+
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(expectedErr))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(1))
+		config := map[string]interface{}{}
+		Expect(json.Unmarshal(delegates[0].Bytes, &config)).To(Succeed())
+		Expect(config["master"]).To(Equal(master))
+		Expect(config["type"]).To(Equal("macvlan"))
+	},
+		Entry("allowed interface", "eth1", []string{"eth1"}, ""),
+		Entry("allowed pattern", "ens1f1", []string{"eth1", "ens1f*"}, ""),
+		Entry("disallowed interface", "eth2", []string{"eth1", "ens1f*"}, `GetNetworkDelegates: master interface "eth2" is not one of the allowedMasterInterfaces [eth1 ens1f*]`),
+		Entry("no allowed interface", "eth1", nil, `GetNetworkDelegates: master interface "eth1" is not one of the allowedMasterInterfaces []`),
+	)
+
+	DescribeTable("passes the ipFromPool of a network to the delegates supporting ipRanges", func(ipFromPool, net1, expectedErr string) {
+		fakePod := testutils.NewFakePod(fakePodName, fmt.Sprintf(`[{"name":"net1","ipFromPool":%q}]`, ipFromPool), "")
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+
+		networks, err := GetPodNetwork(fakePod)
+		if err == nil {
+			var delegates []*types.DelegateNetConf
+			delegates, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+			if err == nil {
+				Expect(delegates).To(HaveLen(1))
+				Expect(delegates[0].IPFromPool).To(Equal(ipFromPool))
+			}
+		}
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+	},
+		Entry("with the ipRanges capability", "10.0.5.0/24", `{
+	"name": "net1",
+	"type": "macvlan",
+	"capabilities": {"ipRanges": true},
+	"ipam": {"type": "host-local"},
+	"cniVersion": "0.3.1"
+}`, ""),
+		Entry("with the ipRanges capability in a conflist plugin", "2001:db8::/64", `{
+	"name": "net1",
+	"cniVersion": "0.3.1",
+	"plugins": [{"type": "macvlan", "capabilities": {"ipRanges": true}, "ipam": {"type": "host-local"}}]
+}`, ""),
+		Entry("without the ipRanges capability", "10.0.5.0/24", `{
+	"name": "net1",
+	"type": "macvlan",
+	"ipam": {"type": "dhcp"},
+	"cniVersion": "0.3.1"
+}`, "ipFromPool requested but the CNI config does not advertise the ipRanges capability"),
+		Entry("with an invalid CIDR", "10.0.5.0/33", `{
+	"name": "net1",
+	"type": "macvlan",
+	"capabilities": {"ipRanges": true},
+	"cniVersion": "0.3.1"
+}`, `failed to parse ipFromPool "10.0.5.0/33"`),
+		Entry("with a host CIDR", "10.0.5.7/24", `{
+	"name": "net1",
+	"type": "macvlan",
+	"capabilities": {"ipRanges": true},
+	"cniVersion": "0.3.1"
+}`, `ipFromPool "10.0.5.7/24" is not a network CIDR, did you mean "10.0.5.0/24"?`),
+	)
+
+	It("overrides the master interface of the first plugin of a conflist", func() {
+		config, err := overrideMaster([]byte(`{"name": "net1", "cniVersion": "0.3.1", "plugins": [{"type": "ipvlan", "master": "eth0"}, {"type": "tuning"}]}`), "eth1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(config)).To(Equal(`{"cniVersion":"0.3.1","name":"net1","plugins":[{"master":"eth1","type":"ipvlan"},{"type":"tuning"}]}`))
+	})
+
+	DescribeTable("loads an inline delegate of a pod in an allowed namespace", func(allow bool, namespaces []string, expectedErr string) {
+		fakePod := testutils.NewFakePod(fakePodName, `[{"delegate":{"name":"adhoc","type":"bridge","cniVersion":"0.3.1"},"interface":"net7","mac":"c2:11:22:33:44:66"}]`, "")
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		netConf.AllowInlineDelegates = allow
+		netConf.InlineDelegateNamespaces = namespaces
+
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(expectedErr))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(1))
+		Expect(delegates[0].Name).To(Equal("adhoc"))
+		Expect(delegates[0].Conf.Type).To(Equal("bridge"))
+		Expect(delegates[0].IfnameRequest).To(Equal("net7"))
+		Expect(delegates[0].MacRequest).To(Equal("c2:11:22:33:44:66"))
+	},
+		Entry("allowed namespace", true, []string{"kube-system", "test"}, ""),
+		Entry("not enabled", false, []string{"test"}, "GetNetworkDelegates: inline delegate requested but allowInlineDelegates is not enabled"),
+		Entry("disallowed namespace", true, []string{"kube-system"}, `GetNetworkDelegates: inline delegate requested but namespace "test" is not one of the inlineDelegateNamespaces [kube-system]`),
+		Entry("no allowed namespace", true, nil, `GetNetworkDelegates: inline delegate requested but namespace "test" is not one of the inlineDelegateNamespaces []`),
+	)
+
+	It("rejects the delegate configs over maxDelegateConfigBytes", func() {
+		largeConfig := fmt.Sprintf(`{"name":"net1","type":"mynet","cniVersion":"0.3.1","padding":%q}`, strings.Repeat("x", 200))
+		fakePod := testutils.NewFakePod(fakePodName, fmt.Sprintf(`[{"name":"net1"},{"delegate":%s}]`, largeConfig), "")
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", largeConfig))
+		Expect(err).NotTo(HaveOccurred())
+
+		networks, err := GetPodNetwork(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		netConf.AllowInlineDelegates = true
+		netConf.InlineDelegateNamespaces = []string{"test"}
+		netConf.MaxDelegateConfigBytes = 100
+
+		_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("the config of net-attach-def test/net1 is %d bytes, over the maxDelegateConfigBytes limit of 100", len(largeConfig)))))
+
+		_, err = GetNetworkDelegates(clientInfo, fakePod, networks[1:], netConf, nil)
+		Expect(err).To(MatchError(ContainSubstring("over the maxDelegateConfigBytes limit of 100")))
+
+		netConf.MaxDelegateConfigBytes = len(largeConfig)
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(2))
+	})
+
+	It("rejects the CNI config files over maxDelegateConfigBytes before parsing them", func() {
+		// not even JSON, so that parsing it would fail with another error
+		largeConfig := strings.Repeat("x", 200)
+		Expect(os.WriteFile(filepath.Join(tmpDir, "10-net1.conf"), []byte(largeConfig), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmpDir, "20-net2.conf"), []byte(`{"name":"net2","type":"mynet","cniVersion":"0.3.1"}`), 0600)).To(Succeed())
+		fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", ""))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net2", ""))
+		Expect(err).NotTo(HaveOccurred())
+
+		netConf, err := types.LoadNetConf([]byte(genericConf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		netConf.MaxDelegateConfigBytes = 100
+
+		_, err = GetNetworkDelegates(clientInfo, fakePod, []*types.NetworkSelectionElement{{Name: "net1", Namespace: "test"}}, netConf, nil)
+		Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("the CNI config file %s is 200 bytes, over the maxDelegateConfigBytes limit of 100", filepath.Join(tmpDir, "10-net1.conf")))))
+
+		// the file over the limit does not fail the lookup of the other ones
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, []*types.NetworkSelectionElement{{Name: "net2", Namespace: "test"}}, netConf, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(1))
+		Expect(delegates[0].Conf.Type).To(Equal("mynet"))
+	})
+
+	Context("networkInjectionRules", func() {
+		var clientInfo *ClientInfo
+		var netConf *types.NetConf
+
+		BeforeEach(func() {
+			clientInfo = NewFakeClientInfo()
+			_, err := clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "storage", `{"name": "storage", "type": "storagenet", "cniVersion": "0.3.1"}`))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", `{"name": "net1", "type": "mynet", "cniVersion": "0.3.1"}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			netConf, err = types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			netConf.NetworkInjectionRules = []types.NetworkInjectionRule{{PodSelector: "net=storage", Network: "storage@stor0"}}
+		})
+
+		It("injects the network into a labeled pod without annotation", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "", "")
+			fakePod.Labels = map[string]string{"net": "storage"}
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+
+			numK8sDelegates, _, err := TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(numK8sDelegates).To(Equal(1))
+			Expect(netConf.Delegates[1].Name).To(Equal("test/storage"))
+			Expect(netConf.Delegates[1].IfnameRequest).To(Equal("stor0"))
+		})
+
+		It("appends the network to the annotation of a labeled pod once", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+			fakePod.Labels = map[string]string{"net": "storage"}
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			netConf.NetworkInjectionRules = append(netConf.NetworkInjectionRules, types.NetworkInjectionRule{PodSelector: "net in (storage, backup)", Network: "storage"})
+
+			numK8sDelegates, _, err := TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(numK8sDelegates).To(Equal(2))
+			Expect(netConf.Delegates[1].Name).To(Equal("test/net1"))
+			Expect(netConf.Delegates[2].Name).To(Equal("test/storage"))
+		})
+
+		It("does not inject the network into an unlabeled pod", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "", "")
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+
+			numK8sDelegates, _, err := TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(numK8sDelegates).To(Equal(0))
+			Expect(netConf.Delegates).To(HaveLen(1))
+		})
+
+		It("respects namespace isolation", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "", "")
+			fakePod.Labels = map[string]string{"net": "storage"}
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			netConf.NamespaceIsolation = true
+			netConf.NetworkInjectionRules[0].Network = "infra/storage"
+
+			_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+			Expect(err).To(MatchError(`TryLoadPodDelegates: namespace isolation enabled, networkInjectionRules network "infra/storage" is outside of pod namespace test`))
+		})
+	})
+
+	It("inherits the networks annotation from the owning workload when enabled", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "", "")
+		isController := true
+		fakePod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d8", Controller: &isController}}
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"delegates": [{
+			"name": "weave1",
+				"cniVersion": "0.2.0",
+				"type": "weave-net"
+			}],
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", `{"name": "net1", "type": "mynet", "cniVersion": "0.2.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("other", "net2", `{"name": "net2", "type": "mynet2", "cniVersion": "0.2.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		replicaSet := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web-5d8",
+				Namespace:   "test",
+				Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": "net1"},
+			},
+		}
+		_, err = clientInfo.Client.AppsV1().ReplicaSets("test").Create(context.TODO(), replicaSet, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		// disabled by default
+		numK8sDelegates, _, err := TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(numK8sDelegates).To(Equal(0))
+
+		netConf.InheritNetworksFromOwner = true
+		numK8sDelegates, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(numK8sDelegates).To(Equal(1))
+		Expect(netConf.Delegates[1].Conf.Name).To(Equal("net1"))
+		Expect(netConf.Delegates[1].Conf.Type).To(Equal("mynet"))
+
+		// namespace isolation applies with the namespace of the pod
+		replicaSet.Annotations["k8s.v1.cni.cncf.io/networks"] = "other/net2"
+		_, err = clientInfo.Client.AppsV1().ReplicaSets("test").Update(context.TODO(), replicaSet, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		netConf.NamespaceIsolation = true
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("pod is in namespace test but refers to target namespace other"))
+	})
+
+	It("reads and writes the network annotations under a custom annotationPrefix", func() {
+		fakePod := testutils.NewFakePod(fakePodName, "net2", "")
+		fakePod.Annotations["example.com/networks"] = "net1"
+		fakePod.Annotations["example.com/default-network"] = "net3"
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"annotationPrefix": "example.com",
+			"delegates": [{
+			"name": "weave1",
+				"cniVersion": "0.2.0",
+				"type": "weave-net"
+			}],
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+		Expect(netConf.AnnotationKey(types.NetworkStatusAnnotation)).To(Equal("example.com/network-status"))
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", `{"name": "net1", "type": "mynet", "cniVersion": "0.2.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net2", `{"name": "net2", "type": "mynet2", "cniVersion": "0.2.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		// the default network comes from the multus namespace
+		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net3", `{"name": "net3", "type": "mynet3", "cniVersion": "0.2.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		// the annotations of the default prefix are ignored
+		numK8sDelegates, _, err := TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(numK8sDelegates).To(Equal(1))
+		Expect(netConf.Delegates).To(HaveLen(2))
+		Expect(netConf.Delegates[0].Conf.Name).To(Equal("net3"))
+		Expect(netConf.Delegates[1].Conf.Name).To(Equal("net1"))
+
+		k8sArgs, err := GetK8sArgs(args)
+		Expect(err).NotTo(HaveOccurred())
+		netStatus := []nettypes.NetworkStatus{{Name: "test/net1", Interface: "net1", IPs: []string{"1.1.1.2"}}}
+		Expect(SetNetworkStatus(clientInfo, k8sArgs, netStatus, netConf)).To(Succeed())
+
+		pod, err := clientInfo.GetPod(fakePod.Namespace, fakePod.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Annotations).NotTo(HaveKey("k8s.v1.cni.cncf.io/network-status"))
+		var written []nettypes.NetworkStatus
+		Expect(json.Unmarshal([]byte(pod.Annotations["example.com/network-status"]), &written)).To(Succeed())
+		Expect(written).To(Equal(netStatus))
+	})
+
+	It("writes the descriptions of the networks into their network status", func() {
+		fakePod := testutils.NewFakePod(fakePodName,
+			`[{"name": "net1", "interface": "net1", "description": "storage frontend"}, {"name": "net2", "interface": "net2"}, {"name": "net2", "interface": "net3", "description": "replication"}]`, "")
+		conf := `{
+			"name":"node-cni-network",
+			"type":"multus",
+			"delegates": [{
+			"name": "weave1",
+				"cniVersion": "0.2.0",
+				"type": "weave-net"
+			}],
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		nad1 := testutils.NewFakeNetAttachDef("test", "net1", `{"name": "net1", "type": "mynet", "cniVersion": "0.2.0"}`)
+		nad1.Annotations = map[string]string{descriptionAnnot: "overridden by the pod"}
+		_, err = clientInfo.AddNetAttachDef(nad1)
+		Expect(err).NotTo(HaveOccurred())
+		nad2 := testutils.NewFakeNetAttachDef("test", "net2", `{"name": "net2", "type": "mynet2", "cniVersion": "0.2.0"}`)
+		nad2.Annotations = map[string]string{descriptionAnnot: "backup"}
+		_, err = clientInfo.AddNetAttachDef(nad2)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.Delegates).To(HaveLen(4))
+		Expect(netConf.Delegates[1].Description).To(Equal("storage frontend"))
+		Expect(netConf.Delegates[2].Description).To(Equal("backup"))
+		Expect(netConf.Delegates[3].Description).To(Equal("replication"))
+
+		k8sArgs, err := GetK8sArgs(args)
+		Expect(err).NotTo(HaveOccurred())
+		netStatus := []nettypes.NetworkStatus{
+			{Name: "weave1", Interface: "eth0", Default: true},
+			{Name: "test/net1", Interface: "net1"},
+			{Name: "test/net2", Interface: "net2"},
+			{Name: "test/net2", Interface: "net3"},
+		}
+		Expect(SetNetworkStatus(clientInfo, k8sArgs, netStatus, netConf)).To(Succeed())
+
+		pod, err := clientInfo.GetPod(fakePod.Namespace, fakePod.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Annotations["k8s.v1.cni.cncf.io/network-status"]).To(MatchJSON(`[
+			{"name": "weave1", "interface": "eth0", "default": true, "dns": {}},
+			{"name": "test/net1", "interface": "net1", "dns": {}, "description": "storage frontend"},
+			{"name": "test/net2", "interface": "net2", "dns": {}, "description": "backup"},
+			{"name": "test/net2", "interface": "net3", "dns": {}, "description": "replication"}
+		]`))
+		// the descriptions do not get in the way of reading the statuses
+		written, err := netutils.GetNetworkStatus(pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal(netStatus))
+	})
+
+	DescribeTable("round-trips the network status in each networkStatusFormat", func(format string, checkAnnotation func(string)) {
+		fakePod := testutils.NewFakePod(fakePodName, "", "")
+		conf := fmt.Sprintf(`{
+			"name":"node-cni-network",
+			"type":"multus",
+			"networkStatusFormat": %q,
+			"delegates": [{
+			"name": "weave1",
+				"cniVersion": "0.2.0",
+				"type": "weave-net"
+			}],
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`, format)
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		k8sArgs, err := GetK8sArgs(args)
+		Expect(err).NotTo(HaveOccurred())
+		netStatus := []nettypes.NetworkStatus{
+			{Name: "weave1", Interface: "eth0", IPs: []string{"10.0.0.2"}, Mac: "0a:58:0a:00:00:02", Default: true},
+			{Name: "test/net1", Interface: "net1", IPs: []string{"1.1.1.2", "fd00::2"}, DNS: nettypes.DNS{Nameservers: []string{"10.0.0.10"}}},
+		}
+		Expect(SetNetworkStatus(clientInfo, k8sArgs, netStatus, netConf)).To(Succeed())
+
+		pod, err := clientInfo.GetPod(fakePod.Namespace, fakePod.Name)
+		Expect(err).NotTo(HaveOccurred())
+		annotation := pod.Annotations["k8s.v1.cni.cncf.io/network-status"]
+		checkAnnotation(annotation)
+		written, err := DecodeNetworkStatusAnnotation(annotation)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal(netStatus))
+	},
+		Entry("indented", types.NetworkStatusFormatIndented, func(annotation string) {
+			Expect(annotation).To(ContainSubstring("\n    "))
+		}),
+		Entry("compact", types.NetworkStatusFormatCompact, func(annotation string) {
+			Expect(annotation).To(Equal(`[{"default":true,"dns":{},"interface":"eth0","ips":["10.0.0.2"],"mac":"0a:58:0a:00:00:02","name":"weave1"},` +
+				`{"dns":{"nameservers":["10.0.0.10"]},"interface":"net1","ips":["1.1.1.2","fd00::2"],"name":"test/net1"}]`))
+		}),
+		Entry("gzip", types.NetworkStatusFormatGzip, func(annotation string) {
+			Expect(annotation).To(HavePrefix(types.NetworkStatusGzipPrefix))
+			Expect(annotation).NotTo(ContainSubstring("weave1"))
+		}),
+	)
+
+	It("rejects a corrupted gzip network status", func() {
+		_, err := DecodeNetworkStatusAnnotation(types.NetworkStatusGzipPrefix + "not base64!")
+		Expect(err).To(MatchError(ContainSubstring("failed to decode the base64 network status")))
+		_, err = DecodeNetworkStatusAnnotation(types.NetworkStatusGzipPrefix + "bm90IGd6aXA=")
+		Expect(err).To(MatchError(ContainSubstring("failed to gunzip the network status")))
+	})
+
+	It("rejects a gzip network status over the size limit", func() {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(bytes.Repeat([]byte(" "), maxNetworkStatusBytes+1))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+		_, err = DecodeNetworkStatusAnnotation(types.NetworkStatusGzipPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()))
+		Expect(err).To(MatchError(fmt.Sprintf("failed to gunzip the network status: over the limit of %d bytes", maxNetworkStatusBytes)))
+	})
+
+	DescribeTable("writes the primary IP of the pod along with its network status", func(networks, primaryIPNetwork, expectedIP string) {
+		fakePod := testutils.NewFakePod(fakePodName, networks, "")
+		conf := fmt.Sprintf(`{
+			"name":"node-cni-network",
+			"type":"multus",
+			"primaryIPNetwork": %q,
+			"delegates": [{
+			"name": "weave1",
+				"cniVersion": "0.2.0",
+				"type": "weave-net"
+			}],
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
+		}`, primaryIPNetwork)
+		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		netConf.ConfDir = tmpDir
+
+		clientInfo := NewFakeClientInfo()
+		_, err = clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		for _, name := range []string{"net1", "net2"} {
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", name, fmt.Sprintf(`{"name": %q, "type": "mynet", "cniVersion": "0.2.0"}`, name)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, _, err = TryLoadPodDelegates(fakePod, netConf, clientInfo, nil)
 		Expect(err).NotTo(HaveOccurred())
 
 		k8sArgs, err := GetK8sArgs(args)
 		Expect(err).NotTo(HaveOccurred())
-
-		pod, err := clientInfo.GetPod(string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
-		networks, err := GetPodNetwork(pod)
-		Expect(err).NotTo(HaveOccurred())
-
-		netConf, err := types.LoadNetConf([]byte(conf))
-		netConf.ConfDir = tmpDir
-		_, err = GetNetworkDelegates(clientInfo, pod, networks, netConf, nil)
-
-		Expect(err).To(HaveOccurred())
-		Expect(err).To(MatchError("GetNetworkDelegates: namespace isolation enabled, annotation violates permission, pod is in namespace test but refers to target namespace kube-system"))
-
-	})
-
-	It("Properly allows a specified namespace reference when namespace isolation is enabled", func() {
-		fakePod := testutils.NewFakePod(fakePodName, "kube-system/net1", "")
+		netStatus := []nettypes.NetworkStatus{
+			{Name: "weave1", Interface: "eth0", IPs: []string{"10.0.0.2", "fd00::2"}, Default: true},
+			{Name: "test/net1", Interface: "net1", IPs: []string{"192.168.1.2"}},
+			{Name: "test/net1", Interface: "net2", IPs: []string{"192.168.2.2"}},
+			{Name: "test/net2", Interface: "net3"},
+		}
+		Expect(SetNetworkStatus(clientInfo, k8sArgs, netStatus, netConf)).To(Succeed())
+
+		pod, err := clientInfo.GetPod(fakePod.Namespace, fakePod.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Annotations).To(HaveKeyWithValue("k8s.v1.cni.cncf.io/primary-ip", expectedIP))
+		Expect(pod.Annotations).To(HaveKey("k8s.v1.cni.cncf.io/network-status"))
+	},
+		Entry("the default network unless told otherwise",
+			`[{"name": "net1", "interface": "net1"}, {"name": "net1", "interface": "net2"}, {"name": "net2", "interface": "net3"}]`, "", "10.0.0.2"),
+		Entry("the primaryIPNetwork",
+			`[{"name": "net1", "interface": "net1"}, {"name": "net1", "interface": "net2"}, {"name": "net2", "interface": "net3"}]`, "test/net1", "192.168.1.2"),
+		Entry("the attachment with primary-ip over the primaryIPNetwork",
+			`[{"name": "net1", "interface": "net1"}, {"name": "net1", "interface": "net2", "primary-ip": true}, {"name": "net2", "interface": "net3"}]`, "test/net1", "192.168.2.2"),
+		Entry("the default network when the primary attachment has no IP",
+			`[{"name": "net1", "interface": "net1"}, {"name": "net1", "interface": "net2"}, {"name": "net2", "interface": "net3", "primary-ip": true}]`, "", "10.0.0.2"),
+	)
+
+	It("merges the net-attach-def cni-args annotation with the pod's cni-args", func() {
+		fakePod := testutils.NewFakePod(fakePodName, `[{"name":"net1"},{"name":"net1","interface":"net2","cni-args":{"vrf":"pod-vrf","podKey":"pod"}}]`, "")
 		conf := `{
 			"name":"node-cni-network",
 			"type":"multus",
@@ -874,38 +2195,51 @@ users:
 				"cniVersion": "0.2.0",
 				"type": "weave-net"
 			}],
-			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml",
-			"namespaceIsolation": true,
-			"globalNamespaces": "kube-system,donkey-kong"
+			"kubeconfig":"/etc/kubernetes/node-kubeconfig.yaml"
 		}`
 
-		Expect(err).NotTo(HaveOccurred())
-
 		net1 := `{
 	"name": "net1",
 	"type": "mynet",
 	"cniVersion": "0.2.0"
 }`
+		nad := testutils.NewFakeNetAttachDef("test", "net1", net1)
+		nad.Annotations = map[string]string{"k8s.v1.cni.cncf.io/cniArgs": `{"vrf":"fabric-vrf","fabric":"blue"}`}
 
 		clientInfo := NewFakeClientInfo()
-		_, err = clientInfo.AddPod(fakePod)
-		Expect(err).NotTo(HaveOccurred())
-		_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net1", net1))
+		_, err := clientInfo.AddPod(fakePod)
 		Expect(err).NotTo(HaveOccurred())
-
-		k8sArgs, err := GetK8sArgs(args)
+		_, err = clientInfo.AddNetAttachDef(nad)
 		Expect(err).NotTo(HaveOccurred())
 
-		pod, err := clientInfo.GetPod(string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
-		networks, err := GetPodNetwork(pod)
+		networks, err := GetPodNetwork(fakePod)
 		Expect(err).NotTo(HaveOccurred())
 
 		netConf, err := types.LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
 		netConf.ConfDir = tmpDir
-		_, err = GetNetworkDelegates(clientInfo, pod, networks, netConf, nil)
 
+		delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
 		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(2))
+
+		cniArgs := func(delegate *types.DelegateNetConf) map[string]interface{} {
+			rawConf := map[string]interface{}{}
+			Expect(json.Unmarshal(delegate.Bytes, &rawConf)).To(Succeed())
+			return rawConf["args"].(map[string]interface{})["cni"].(map[string]interface{})
+		}
+		Expect(cniArgs(delegates[0])).To(Equal(map[string]interface{}{"vrf": "fabric-vrf", "fabric": "blue"}))
+		Expect(cniArgs(delegates[1])).To(Equal(map[string]interface{}{"vrf": "pod-vrf", "fabric": "blue", "podKey": "pod"}))
+		// the pod's network selection element is left untouched
+		Expect(*networks[1].CNIArgs).To(Equal(map[string]interface{}{"vrf": "pod-vrf", "podKey": "pod"}))
 
+		badNad := testutils.NewFakeNetAttachDef("test", "bad-args", net1)
+		badNad.Annotations = map[string]string{"k8s.v1.cni.cncf.io/cniArgs": `not-json`}
+		_, err = clientInfo.AddNetAttachDef(badNad)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = GetNetworkDelegates(clientInfo, fakePod, []*types.NetworkSelectionElement{{Name: "bad-args", Namespace: "test"}}, netConf, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid k8s.v1.cni.cncf.io/cniArgs annotation in network-attachment-definition (test/bad-args)"))
 	})
 
 	Context("Error function", func() {
@@ -999,6 +2333,282 @@ users:
 			_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
 			Expect(err).To(HaveOccurred())
 		})
+
+		It("uses the allocated device when networkResourceInjection is enabled", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testutils.NewFakeNetAttachDefAnnotation(fakePod.ObjectMeta.Namespace, "net1", `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "0.2.0"
+	}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			netConf.NetworkResourceInjection = true
+			resourceMap := map[string]*types.ResourceInfo{
+				"intel.com/sriov": {DeviceIDs: []string{"0000:af:06.0"}},
+			}
+			delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, resourceMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates).To(HaveLen(1))
+			Expect(delegates[0].DeviceID).To(Equal("0000:af:06.0"))
+			Expect(delegates[0].ResourceName).To(Equal("intel.com/sriov"))
+		})
+
+		It("fails when no device is allocated and networkResourceInjection is enabled", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testutils.NewFakeNetAttachDefAnnotation(fakePod.ObjectMeta.Namespace, "net1", `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "0.2.0"
+	}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			resourceMap := map[string]*types.ResourceInfo{}
+
+			// without the option the delegate is loaded without a device
+			delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, resourceMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates[0].DeviceID).To(BeEmpty())
+
+			netConf.NetworkResourceInjection = true
+			_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, resourceMap)
+			Expect(err).To(MatchError(`GetNetworkDelegates: failed getting the delegate: getKubernetesDelegate: network-attachment-definition (test/net1) requires resource "intel.com/sriov" but no device is allocated to pod test/testPod`))
+		})
+
+		It("passes the NUMA node of the device only to the delegates advertising numaNode", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "net1,net2", "")
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testutils.NewFakeNetAttachDefAnnotation(fakePod.ObjectMeta.Namespace, "net1", `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {"numaNode": true},
+		"cniVersion": "0.2.0"
+	}`))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testutils.NewFakeNetAttachDefAnnotation(fakePod.ObjectMeta.Namespace, "net2", `{
+		"name": "net2",
+		"type": "mynet",
+		"cniVersion": "0.2.0"
+	}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			netConf.NetworkResourceInjection = true
+			resourceMap := map[string]*types.ResourceInfo{
+				"intel.com/sriov": {
+					DeviceIDs: []string{"0000:af:06.0", "0000:af:06.1"},
+					NUMANodes: map[string]int64{"0000:af:06.0": 1, "0000:af:06.1": 1},
+				},
+			}
+			delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, resourceMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates).To(HaveLen(2))
+			Expect(delegates[0].NUMANode).NotTo(BeNil())
+			Expect(*delegates[0].NUMANode).To(BeEquivalentTo(1))
+			Expect(delegates[1].DeviceID).To(Equal("0000:af:06.1"))
+			Expect(delegates[1].NUMANode).To(BeNil())
+		})
+
+		DescribeTable("passes the allocated device to the delegates advertising the device capability", func(capability string) {
+			fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testutils.NewFakeNetAttachDefAnnotation(fakePod.ObjectMeta.Namespace, "net1", fmt.Sprintf(`{
+		"name": "net1",
+		"type": "sriov",
+		"capabilities": {"%s": true},
+		"cniVersion": "1.0.0"
+	}`, capability)))
+			Expect(err).NotTo(HaveOccurred())
+
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+
+			// the device is passed as runtimeConfig
+			resourceMap := map[string]*types.ResourceInfo{
+				"intel.com/sriov": {DeviceIDs: []string{"0000:af:06.0"}},
+			}
+			delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, resourceMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates).To(HaveLen(1))
+			Expect(delegates[0].DeviceID).To(Equal("0000:af:06.0"))
+			rt, _ := types.CreateCNIRuntimeConf(&skel.CmdArgs{ContainerID: "123456789", IfName: "net1"}, &types.K8sArgs{}, "net1", nil, delegates[0])
+			Expect(rt.CapabilityArgs).To(HaveKeyWithValue("deviceID", "0000:af:06.0"))
+			Expect(rt.CapabilityArgs).To(HaveKeyWithValue("pciBusID", "0000:af:06.0"))
+
+			// without a device, even without networkResourceInjection
+			_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, map[string]*types.ResourceInfo{})
+			Expect(err).To(MatchError(fmt.Sprintf(`GetNetworkDelegates: failed getting the delegate: getKubernetesDelegate: network-attachment-definition (test/net1) advertises the %s capability but no device of resource "intel.com/sriov" is allocated to pod test/testPod`, capability)))
+		},
+			Entry("deviceID", "deviceID"),
+			Entry("pciBusID", "pciBusID"),
+		)
+	})
+
+	Context("parsePostAddProbe", func() {
+		DescribeTable("parses the valid probes", func(rawProbe string, expected types.PostAddProbe) {
+			probe, err := parsePostAddProbe(rawProbe)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*probe).To(Equal(expected))
+		},
+			Entry("icmp", `{"protocol":"icmp","target":"10.1.1.1"}`, types.PostAddProbe{Protocol: "icmp", Target: "10.1.1.1"}),
+			Entry("icmp over IPv6", `{"protocol":"icmp","target":"2001:db8::1"}`, types.PostAddProbe{Protocol: "icmp", Target: "2001:db8::1"}),
+			Entry("tcp", `{"protocol":"tcp","target":"10.1.1.1:80","timeoutSeconds":3}`, types.PostAddProbe{Protocol: "tcp", Target: "10.1.1.1:80", TimeoutSeconds: 3}),
+		)
+
+		DescribeTable("rejects the invalid probes", func(rawProbe string, expectedErr string) {
+			_, err := parsePostAddProbe(rawProbe)
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+			Entry("unknown protocol", `{"protocol":"udp","target":"10.1.1.1:53"}`, `unknown protocol "udp"`),
+			Entry("icmp target is not an IP", `{"protocol":"icmp","target":"gateway"}`, `icmp target "gateway" is not an IP`),
+			Entry("tcp target without port", `{"protocol":"tcp","target":"10.1.1.1"}`, `tcp target "10.1.1.1" is not host:port`),
+			Entry("negative timeout", `{"protocol":"icmp","target":"10.1.1.1","timeoutSeconds":-1}`, "negative timeoutSeconds -1"),
+			Entry("not JSON", `tcp://10.1.1.1:80`, "invalid character"),
+		)
+
+		It("fails to get the delegate of a net-attach-def with an invalid probe", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			nad := testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", `{"name": "net1", "type": "mynet", "cniVersion": "0.3.1"}`)
+			nad.Annotations = map[string]string{postAddProbeAnnot: `{"protocol":"udp","target":"10.1.1.1:53"}`}
+			_, err = clientInfo.AddNetAttachDef(nad)
+			Expect(err).NotTo(HaveOccurred())
+
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+			Expect(err).To(MatchError(ContainSubstring("invalid k8s.v1.cni.cncf.io/postAddProbe annotation in network-attachment-definition (test/net1)")))
+		})
+
+		It("gets the retry policy of a net-attach-def from its annotation", func() {
+			fakePod := testutils.NewFakePod(fakePodName, "net1,net2", "")
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			nad := testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", `{"name": "net1", "type": "mynet", "cniVersion": "0.3.1"}`)
+			nad.Annotations = map[string]string{retryPolicyAnnot: `{"errorPatterns": ["device or resource busy"], "maxRetries": 2}`}
+			_, err = clientInfo.AddNetAttachDef(nad)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", `{"name": "net2", "type": "mynet", "cniVersion": "0.3.1"}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			delegates, err := GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates).To(HaveLen(2))
+			Expect(delegates[0].RetryPolicy).To(Equal(&types.RetryPolicy{
+				ErrorPatterns:        []string{"device or resource busy"},
+				MaxRetries:           2,
+				IntervalMilliseconds: 500,
+				BackoffFactor:        1,
+			}))
+			Expect(delegates[1].RetryPolicy).To(BeNil())
+
+			nad.Annotations[retryPolicyAnnot] = `{"errorPatterns": ["("]}`
+			_, err = clientInfo.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(nad.Namespace).Update(context.TODO(), nad, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+			Expect(err).To(MatchError(ContainSubstring("invalid k8s.v1.cni.cncf.io/retryPolicy annotation in network-attachment-definition (test/net1)")))
+		})
+	})
+
+	Context("configSecretRef", func() {
+		var clientInfo *ClientInfo
+		var fakePod *v1.Pod
+
+		BeforeEach(func() {
+			fakePod = testutils.NewFakePod(fakePodName, "net1", "")
+			clientInfo = NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.Client.CoreV1().Secrets(fakePod.ObjectMeta.Namespace).Create(context.TODO(), &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "overlay-key", Namespace: fakePod.ObjectMeta.Namespace},
+				Data: map[string][]byte{
+					"config":  []byte(`{"sharedKey": "s3cr3t-k3y"}`),
+					"garbage": []byte(`s3cr3t-k3y`),
+				},
+			}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		getDelegates := func(secretRef string) ([]*types.DelegateNetConf, error) {
+			nad := testutils.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", `{"name": "net1", "type": "overlay", "cniVersion": "0.3.1"}`)
+			nad.Annotations = map[string]string{configSecretRefAnnot: secretRef}
+			_, err := clientInfo.AddNetAttachDef(nad)
+			Expect(err).NotTo(HaveOccurred())
+
+			networks, err := GetPodNetwork(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			netConf, err := types.LoadNetConf([]byte(genericConf))
+			Expect(err).NotTo(HaveOccurred())
+			netConf.ConfDir = tmpDir
+			return GetNetworkDelegates(clientInfo, fakePod, networks, netConf, nil)
+		}
+
+		It("loads the secret config of a net-attach-def apart from its config", func() {
+			delegates, err := getDelegates("overlay-key/config")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates).To(HaveLen(1))
+			Expect(*delegates[0].ConfigSecretRef).To(Equal(types.SecretKeyRef{Namespace: "test", Name: "overlay-key", Key: "config"}))
+			Expect(delegates[0].SecretConfig).To(Equal(map[string]interface{}{"sharedKey": "s3cr3t-k3y"}))
+			Expect(string(delegates[0].Bytes)).NotTo(ContainSubstring("s3cr3t"))
+		})
+
+		DescribeTable("fails on an invalid secret reference", func(secretRef, expectedErr string) {
+			_, err := getDelegates(secretRef)
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			Expect(err.Error()).NotTo(ContainSubstring("s3cr3t"))
+		},
+			Entry("without a key", "overlay-key", `"overlay-key" is not <secret>/<key>`),
+			Entry("unknown secret", "other-key/config", "failed to get secret test/other-key"),
+			Entry("unknown key", "overlay-key/other", `secret test/overlay-key has no key "other"`),
+			Entry("not a JSON object", "overlay-key/garbage", `key "garbage" of secret test/overlay-key is not a JSON object`),
+		)
 	})
 
 	Context("parsePodNetworkObjectName", func() {
@@ -1293,6 +2903,61 @@ users:
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("retries the network status update on conflict with the complete status", func() {
+			netConf, err := types.LoadNetConf([]byte(`{
+			"name": "node-cni-network",
+			"type": "multus",
+			"kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+			"delegates": [{
+				"type": "weave-net"
+			}]
+		}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			netstatus := []nettypes.NetworkStatus{
+				{Name: "weave1", Interface: "eth0", IPs: []string{"1.1.1.2"}, Default: true},
+				{Name: "test/net1", Interface: "net1", IPs: []string{"1.1.1.3"}},
+			}
+
+			fakePod := testutils.NewFakePod(fakePodName, "net1", "")
+			clientInfo := NewFakeClientInfo()
+			_, err = clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+
+			// the first update conflicts with a concurrent change of the pod
+			fakeClient := clientInfo.Client.(*fake.Clientset)
+			updates := 0
+			fakeClient.PrependReactor("update", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				updates++
+				if updates > 1 {
+					return false, nil, nil
+				}
+				// the reactor runs with the client locked, so use its tracker
+				obj, err := fakeClient.Tracker().Get(v1.SchemeGroupVersion.WithResource("pods"), fakePod.Namespace, fakePod.Name)
+				Expect(err).NotTo(HaveOccurred())
+				pod := obj.(*v1.Pod)
+				pod.Annotations["concurrent"] = "change"
+				Expect(fakeClient.Tracker().Update(v1.SchemeGroupVersion.WithResource("pods"), pod, pod.Namespace)).To(Succeed())
+				return true, nil, errors.NewConflict(v1.Resource("pods"), fakePod.Name, fmt.Errorf("the object has been modified"))
+			})
+
+			args = &skel.CmdArgs{
+				Args: fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.Name, fakePod.Namespace),
+			}
+			k8sArgs, err := GetK8sArgs(args)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(SetNetworkStatus(clientInfo, k8sArgs, netstatus, netConf)).To(Succeed())
+			Expect(updates).To(Equal(2))
+
+			pod, err := clientInfo.GetPod(fakePod.Namespace, fakePod.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pod.Annotations).To(HaveKeyWithValue("concurrent", "change"))
+			written, err := netutils.GetNetworkStatus(pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(written).To(Equal(netstatus))
+		})
+
 		It("Fails to set pod network annotations when pod UIDs don't match", func() {
 			result := &types020.Result{
 				CNIVersion: "0.2.0",
@@ -1553,4 +3218,167 @@ users:
 			Expect(err).NotTo(HaveOccurred())
 		})
 	})
+	Context("net-attach-def informer cache", func() {
+		var clientInfo *ClientInfo
+
+		BeforeEach(func() {
+			clientInfo = NewFakeClientInfo()
+			// the watch of the informer misses every event, as a stale one
+			informer := NewRelistableInformer(&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return clientInfo.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(metav1.NamespaceAll).List(context.TODO(), options)
+				},
+				WatchFunc: func(_ metav1.ListOptions) (watch.Interface, error) {
+					return watch.NewFake(), nil
+				},
+			}, &nettypes.NetworkAttachmentDefinition{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			clientInfo.NetDefInformer = informer
+			stopCh := make(chan struct{})
+			DeferCleanup(func() { close(stopCh) })
+			go informer.Run(stopCh)
+			Expect(cache.WaitForCacheSync(stopCh, informer.HasSynced)).To(BeTrue())
+		})
+
+		It("picks up the new net-attach-defs on a forced resync", func() {
+			_, err := clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", "{}"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("kube-system", "net2", "{}"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clientInfo.NetDefInformer.GetStore().ListKeys()).To(BeEmpty())
+
+			count, err := clientInfo.ResyncNetAttachDefs(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(2))
+			Eventually(clientInfo.NetDefInformer.GetStore().ListKeys).Should(ConsistOf("test/net1", "kube-system/net2"))
+
+			// the deleted net-attach-defs are dropped
+			Expect(clientInfo.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions("kube-system").Delete(
+				context.TODO(), "net2", metav1.DeleteOptions{})).To(Succeed())
+			count, err = clientInfo.ResyncNetAttachDefs(context.TODO())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(1))
+			Eventually(clientInfo.NetDefInformer.GetStore().ListKeys).Should(ConsistOf("test/net1"))
+		})
+
+		It("refreshes a net-attach-def missing from the informer cache once before failing", func() {
+			_, err := clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", "{}"))
+			Expect(err).NotTo(HaveOccurred())
+
+			netattach, err := clientInfo.GetNetAttachDef("test", "net1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netattach.Name).To(Equal("net1"))
+			// the informer relists in the background
+			Eventually(clientInfo.NetDefInformer.GetStore().ListKeys, 5*time.Second).Should(ConsistOf("test/net1"))
+
+			_, err = clientInfo.GetNetAttachDef("test", "net2")
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("fails to resync without an informer", func() {
+			_, err := NewFakeClientInfo().ResyncNetAttachDefs(context.TODO())
+			Expect(err).To(MatchError("no net-attach-def informer to resync"))
+		})
+	})
+
+	Context("with an API request policy", func() {
+		var clientInfo *ClientInfo
+
+		BeforeEach(func() {
+			origInterval := apiRequestRetryInterval
+			apiRequestRetryInterval = time.Millisecond
+			DeferCleanup(func() { apiRequestRetryInterval = origInterval })
+			clientInfo = NewFakeClientInfo()
+			_, err := clientInfo.AddNetAttachDef(testutils.NewFakeNetAttachDef("test", "net1", "{}"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddPod(testutils.NewFakePod(fakePodName, "", ""))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		// failNetAttachDefGets fails the first failures net-attach-def gets
+		// with err, and returns a pointer to the number of gets
+		failNetAttachDefGets := func(failures int, err error) *int {
+			gets := 0
+			clientInfo.NetClient.(*netfake.Clientset).PrependReactor("get", "network-attachment-definitions", func(k8stesting.Action) (bool, runtime.Object, error) {
+				gets++
+				if gets > failures {
+					return false, nil, nil
+				}
+				return true, nil, err
+			})
+			return &gets
+		}
+
+		It("retries the requests failing with a transient error", func() {
+			gets := failNetAttachDefGets(2, errors.NewServiceUnavailable("etcd is down"))
+			netattach, err := clientInfo.WithAPIRequestPolicy(time.Second, 2).GetNetAttachDef("test", "net1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(netattach.Name).To(Equal("net1"))
+			Expect(*gets).To(Equal(3))
+		})
+
+		It("fails once the retries are exhausted", func() {
+			gets := failNetAttachDefGets(2, errors.NewServiceUnavailable("etcd is down"))
+			_, err := clientInfo.WithAPIRequestPolicy(time.Second, 1).GetNetAttachDef("test", "net1")
+			Expect(errors.IsServiceUnavailable(err)).To(BeTrue())
+			Expect(*gets).To(Equal(2))
+		})
+
+		It("does not retry the requests failing with other errors", func() {
+			gets := failNetAttachDefGets(0, nil)
+			_, err := clientInfo.WithAPIRequestPolicy(time.Second, 2).GetNetAttachDef("test", "net2")
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(*gets).To(Equal(1))
+		})
+
+		It("times out and retries the requests which take too long", func() {
+			gets := 0
+			clientInfo.Client.(*fake.Clientset).PrependReactor("get", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+				gets++
+				if gets <= 2 {
+					time.Sleep(200 * time.Millisecond)
+				}
+				return false, nil, nil
+			})
+
+			start := time.Now()
+			_, err := clientInfo.WithAPIRequestPolicy(20*time.Millisecond, 1).GetPod("test", fakePodName)
+			Expect(err).To(MatchError(ContainSubstring("API request timed out after 20ms")))
+			Expect(time.Since(start)).To(BeNumerically("<", 200*time.Millisecond))
+
+			Eventually(func() error {
+				_, err := clientInfo.WithAPIRequestPolicy(20*time.Millisecond, 1).GetPod("test", fakePodName)
+				return err
+			}).Should(Succeed())
+		})
+
+		It("retries the status updates of the pod", func() {
+			updates := 0
+			clientInfo.Client.(*fake.Clientset).PrependReactor("update", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+				updates++
+				if updates == 1 {
+					return true, nil, errors.NewInternalError(fmt.Errorf("transient"))
+				}
+				return false, nil, nil
+			})
+
+			pod, err := clientInfo.GetPod("test", fakePodName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(setPodAnnotation(clientInfo.WithAPIRequestPolicy(time.Second, 1), pod, "key", "value")).To(Succeed())
+			Expect(updates).To(Equal(2))
+			pod, err = clientInfo.GetPod("test", fakePodName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pod.Annotations).To(HaveKeyWithValue("key", "value"))
+		})
+	})
+
+	It("drops the events without a client or an event recorder", func() {
+		pod := testutils.NewFakePod(fakePodName, "", "")
+		Expect(func() {
+			var clientInfo *ClientInfo
+			clientInfo.Eventf(pod, v1.EventTypeNormal, "AddedInterface", "Add %s", "eth0")
+		}).NotTo(Panic())
+		Expect(func() {
+			NewFakeClientInfo().Eventf(pod, v1.EventTypeNormal, "AddedInterface", "Add %s", "eth0")
+		}).NotTo(Panic())
+	})
 })
@@ -23,6 +23,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	certificatesv1 "k8s.io/api/certificates/v1"
@@ -52,6 +53,10 @@ const (
 
 var (
 	certUsages = []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth}
+
+	// net-attach-def clients for externalNADKubeconfig, by kubeconfig path
+	externalNetClients     = map[string]netclient.Interface{}
+	externalNetClientsLock sync.Mutex
 )
 
 // getPerNodeKubeconfig creates new kubeConfig, based on bootstrap, with new certDir
@@ -221,6 +226,32 @@ func GetK8sClient(kubeconfig string, kubeClient *ClientInfo) (*ClientInfo, error
 	return newClientInfo(config)
 }
 
+// GetExternalNetClient returns a net-attach-def client for the cluster of the
+// given kubeconfig. The client is built on first use and reused afterwards.
+func GetExternalNetClient(kubeconfig string) (netclient.Interface, error) {
+	externalNetClientsLock.Lock()
+	defer externalNetClientsLock.Unlock()
+
+	if client, ok := externalNetClients[kubeconfig]; ok {
+		return client, nil
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, logging.Errorf("GetExternalNetClient: failed to get context for the kubeconfig %v: %v", kubeconfig, err)
+	}
+	config.Timeout = time.Minute
+	config.QPS = 50
+	config.Burst = 50
+
+	client, err := netclient.NewForConfig(config)
+	if err != nil {
+		return nil, logging.Errorf("GetExternalNetClient: failed to create client for the kubeconfig %v: %v", kubeconfig, err)
+	}
+	externalNetClients[kubeconfig] = client
+	return client, nil
+}
+
 // newClientInfo returns a `ClientInfo` from a configuration created from an
 // existing kubeconfig file.
 func newClientInfo(config *rest.Config) (*ClientInfo, error) {
@@ -0,0 +1,132 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sclient
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	netutils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// nadDelegateCacheSize is the number of net-attach-defs whose delegate is cached
+const nadDelegateCacheSize = 512
+
+// nadDelegateCache is an LRU cache of the delegates compiled from the spec of
+// net-attach-defs, by UID. An entry is only valid for the resourceVersion of
+// the net-attach-def it was compiled from.
+type nadDelegateCache struct {
+	sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+	hits    int
+	misses  int
+}
+
+type nadDelegateCacheEntry struct {
+	uid             string
+	resourceVersion string
+	delegate        *types.DelegateNetConf
+}
+
+func newNADDelegateCache(size int) *nadDelegateCache {
+	return &nadDelegateCache{
+		size:    size,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// get returns the delegate cached for uid at resourceVersion, if any
+func (c *nadDelegateCache) get(uid, resourceVersion string) (*types.DelegateNetConf, bool) {
+	c.Lock()
+	defer c.Unlock()
+	elem, ok := c.entries[uid]
+	if !ok || elem.Value.(*nadDelegateCacheEntry).resourceVersion != resourceVersion {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*nadDelegateCacheEntry).delegate, true
+}
+
+// add caches the delegate of uid at resourceVersion, replacing the one of any
+// other resourceVersion and evicting the least recently used entry if full
+func (c *nadDelegateCache) add(uid, resourceVersion string, delegate *types.DelegateNetConf) {
+	c.Lock()
+	defer c.Unlock()
+	entry := &nadDelegateCacheEntry{uid: uid, resourceVersion: resourceVersion, delegate: delegate}
+	if elem, ok := c.entries[uid]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[uid] = c.lru.PushFront(entry)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nadDelegateCacheEntry).uid)
+	}
+}
+
+var nadDelegates = newNADDelegateCache(nadDelegateCacheSize)
+
+// getNetAttachDefDelegate returns the delegate compiled from the CNI config
+// of a net-attach-def, before any network selection element is applied to
+// it, from the cache if it was already compiled at the same resourceVersion.
+// The configs read from a file of confDir are not cached, as the file may
+// change while the net-attach-def does not.
+func getNetAttachDefDelegate(nad *nettypes.NetworkAttachmentDefinition, conf *types.NetConf) (*types.DelegateNetConf, error) {
+	source := fmt.Sprintf("the config of net-attach-def %s/%s", nad.Namespace, nad.Name)
+	if err := checkDelegateConfigSize(conf, source, len(nad.Spec.Config)); err != nil {
+		return nil, err
+	}
+	if nad.Spec.Config == "" {
+		config, err := getCNIConfigFromFile(conf, nad.Name, conf.ConfDir)
+		if err != nil {
+			return nil, fmt.Errorf("GetCNIConfig: err in GetCNIConfigFromFile: %v", err)
+		}
+		return types.ParseDelegateNetConf(config)
+	}
+	if nad.ResourceVersion == "" || nad.UID == "" {
+		config, err := netutils.GetCNIConfig(nad, conf.ConfDir)
+		if err != nil {
+			return nil, err
+		}
+		return types.ParseDelegateNetConf(config)
+	}
+
+	uid := string(nad.UID)
+	delegate, ok := nadDelegates.get(uid, nad.ResourceVersion)
+	if !ok {
+		config, err := netutils.GetCNIConfig(nad, conf.ConfDir)
+		if err != nil {
+			return nil, err
+		}
+		delegate, err = types.ParseDelegateNetConf(config)
+		if err != nil {
+			return nil, err
+		}
+		nadDelegates.add(uid, nad.ResourceVersion, delegate)
+	}
+	// callers own the returned delegate
+	return delegate.DeepCopy(), nil
+}
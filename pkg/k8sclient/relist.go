@@ -0,0 +1,213 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// netAttachDefRelistTimeout bounds the wait for a relist of the net-attach-def
+// informer, whose reflector backs off for up to 30 seconds between its lists
+const netAttachDefRelistTimeout = time.Minute
+
+// RelistableInformer is a shared index informer which can be asked to list
+// its objects again, e.g. when its watch missed some events. Its store is
+// only ever written by its own reflector.
+type RelistableInformer struct {
+	cache.SharedIndexInformer
+	lw *relistableListWatch
+}
+
+// NewRelistableInformer returns a shared index informer of the objects of lw
+func NewRelistableInformer(lw cache.ListerWatcher, exampleObject runtime.Object, resyncPeriod time.Duration, indexers cache.Indexers) *RelistableInformer {
+	rlw := &relistableListWatch{ListerWatcher: lw, relisted: make(chan struct{})}
+	return &RelistableInformer{
+		SharedIndexInformer: cache.NewSharedIndexInformer(rlw, exampleObject, resyncPeriod, indexers),
+		lw:                  rlw,
+	}
+}
+
+// Relist ends the watch of the informer with an expired error, on which its
+// reflector lists the objects again and replaces its store with them. It
+// returns the number of objects listed, once the reflector watches again.
+func (i *RelistableInformer) Relist(ctx context.Context) (int, error) {
+	return i.lw.relist(ctx)
+}
+
+// relistableListWatch tracks the relists requested, by generation, and the
+// lists and watches of the reflector which fulfil them
+type relistableListWatch struct {
+	cache.ListerWatcher
+
+	mu sync.Mutex
+	// generation of the last relist requested
+	requested uint64
+	// generation of the list in progress, and the objects it got so far
+	listing      uint64
+	listingCount int
+	// generation and objects of the last complete list
+	listed      uint64
+	listedCount int
+	// generation and objects of the last list the store was replaced with
+	relistedGen   uint64
+	relistedCount int
+	// closed, and replaced, whenever relistedGen changes
+	relisted chan struct{}
+	// closed to end the watch in progress
+	stopWatch chan struct{}
+}
+
+func (lw *relistableListWatch) relist(ctx context.Context) (int, error) {
+	lw.mu.Lock()
+	lw.requested++
+	gen := lw.requested
+	if lw.stopWatch != nil {
+		close(lw.stopWatch)
+		lw.stopWatch = nil
+	}
+	lw.mu.Unlock()
+
+	for {
+		lw.mu.Lock()
+		if lw.relistedGen >= gen {
+			count := lw.relistedCount
+			lw.mu.Unlock()
+			return count, nil
+		}
+		relisted := lw.relisted
+		lw.mu.Unlock()
+
+		select {
+		case <-relisted:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// List lists the objects, by pages, as the reflector does before it watches
+func (lw *relistableListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	lw.mu.Lock()
+	if options.Continue == "" {
+		lw.listing, lw.listingCount = lw.requested, 0
+	}
+	lw.mu.Unlock()
+
+	list, err := lw.ListerWatcher.List(options)
+	if err != nil {
+		return nil, err
+	}
+
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.listingCount += meta.LenList(list)
+	if continueToken, err := meta.NewAccessor().Continue(list); err == nil && continueToken == "" {
+		lw.listed, lw.listedCount = lw.listing, lw.listingCount
+	}
+	return list, nil
+}
+
+// Watch watches the objects, which the reflector only does once its store is
+// replaced with the last list
+func (lw *relistableListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	lw.mu.Lock()
+	if lw.listed > lw.relistedGen {
+		lw.relistedGen, lw.relistedCount = lw.listed, lw.listedCount
+		close(lw.relisted)
+		lw.relisted = make(chan struct{})
+	}
+	lw.mu.Unlock()
+
+	w, err := lw.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	stop := make(chan struct{})
+	if lw.requested > lw.listed {
+		// a relist was requested since the last list began
+		close(stop)
+	} else {
+		lw.stopWatch = stop
+	}
+	return newInterruptibleWatch(w, stop), nil
+}
+
+// interruptibleWatch passes on the events of a watch until stop is closed,
+// and then ends with an expired error
+type interruptibleWatch struct {
+	watch.Interface
+	result   chan watch.Event
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newInterruptibleWatch(w watch.Interface, stop <-chan struct{}) *interruptibleWatch {
+	iw := &interruptibleWatch{Interface: w, result: make(chan watch.Event), done: make(chan struct{})}
+	go func() {
+		defer close(iw.result)
+		for {
+			select {
+			case event, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+				select {
+				case iw.result <- event:
+				case <-iw.done:
+					return
+				}
+			case <-stop:
+				expired := &metav1.Status{
+					Status:  metav1.StatusFailure,
+					Code:    http.StatusGone,
+					Reason:  metav1.StatusReasonExpired,
+					Message: "relist requested",
+				}
+				select {
+				case iw.result <- watch.Event{Type: watch.Error, Object: expired}:
+				case <-iw.done:
+				}
+				return
+			case <-iw.done:
+				return
+			}
+		}
+	}()
+	return iw
+}
+
+// ResultChan returns the events of the watch
+func (w *interruptibleWatch) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+// Stop stops the watch
+func (w *interruptibleWatch) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+		w.Interface.Stop()
+	})
+}
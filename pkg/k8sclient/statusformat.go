@@ -0,0 +1,111 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// maxNetworkStatusBytes bounds the gunzipped size of a network-status
+// annotation, which anyone who may update the pod controls
+const maxNetworkStatusBytes = 4 << 20
+
+// encodeNetworkStatus returns the network-status annotation of the statuses in
+// format, the indented one if unset
+func encodeNetworkStatus(statuses []describedNetworkStatus, format string) (string, error) {
+	if format == "" || format == types.NetworkStatusFormatIndented {
+		var indented []string
+		for _, status := range statuses {
+			data, err := json.MarshalIndent(status, "", "    ")
+			if err != nil {
+				return "", fmt.Errorf("error with Marshal Indent: %v", err)
+			}
+			indented = append(indented, string(data))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(indented, ",")), nil
+	}
+
+	compact, err := compactJSON(statuses)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case types.NetworkStatusFormatCompact:
+		return string(compact), nil
+	case types.NetworkStatusFormatGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(compact); err != nil {
+			return "", fmt.Errorf("failed to gzip the network status: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			return "", fmt.Errorf("failed to gzip the network status: %v", err)
+		}
+		return types.NetworkStatusGzipPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	}
+	return "", fmt.Errorf("unknown networkStatusFormat %q", format)
+}
+
+// compactJSON marshals v on a single line, with the keys of its objects sorted
+func compactJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the network status: %v", err)
+	}
+	// the keys of the maps, unlike the fields of the structs, are sorted
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the network status: %v", err)
+	}
+	return json.Marshal(generic)
+}
+
+// DecodeNetworkStatusAnnotation parses a network-status annotation, whichever
+// of the networkStatusFormat it was written in
+func DecodeNetworkStatusAnnotation(annotation string) ([]nettypes.NetworkStatus, error) {
+	data := []byte(annotation)
+	if encoded, ok := strings.CutPrefix(annotation, types.NetworkStatusGzipPrefix); ok {
+		compressed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the base64 network status: %v", err)
+		}
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip the network status: %v", err)
+		}
+		defer r.Close()
+		if data, err = io.ReadAll(io.LimitReader(r, maxNetworkStatusBytes+1)); err != nil {
+			return nil, fmt.Errorf("failed to gunzip the network status: %v", err)
+		}
+		if len(data) > maxNetworkStatusBytes {
+			return nil, fmt.Errorf("failed to gunzip the network status: over the limit of %d bytes", maxNetworkStatusBytes)
+		}
+	}
+	var statuses []nettypes.NetworkStatus
+	if err := json.Unmarshal(data, &statuses); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the network status: %v", err)
+	}
+	return statuses, nil
+}
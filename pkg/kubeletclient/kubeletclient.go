@@ -148,10 +148,21 @@ func (rc *kubeletClient) GetPodResourceMap(pod *v1.Pod) (map[string]*types.Resou
 
 func (rc *kubeletClient) getDevicePluginResources(devices []*podresourcesapi.ContainerDevices, resourceMap map[string]*types.ResourceInfo) {
 	for _, dev := range devices {
-		if rInfo, ok := resourceMap[dev.ResourceName]; ok {
+		rInfo, ok := resourceMap[dev.ResourceName]
+		if ok {
 			rInfo.DeviceIDs = append(rInfo.DeviceIDs, dev.DeviceIds...)
 		} else {
-			resourceMap[dev.ResourceName] = &types.ResourceInfo{DeviceIDs: dev.DeviceIds}
+			rInfo = &types.ResourceInfo{DeviceIDs: dev.DeviceIds}
+			resourceMap[dev.ResourceName] = rInfo
+		}
+		// the NUMA node of the devices is only known if they share a single one
+		if nodes := dev.GetTopology().GetNodes(); len(nodes) == 1 {
+			if rInfo.NUMANodes == nil {
+				rInfo.NUMANodes = map[string]int64{}
+			}
+			for _, deviceID := range dev.DeviceIds {
+				rInfo.NUMANodes[deviceID] = nodes[0].GetID()
+			}
 		}
 	}
 }
@@ -21,6 +21,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
@@ -42,10 +43,24 @@ const (
 var loggingStderr bool
 var loggingW io.Writer
 var loggingLevel Level
+var configuredLevel Level
+var levelOverridden bool
 var logger *lumberjack.Logger
 
 const defaultTimestampFormat = time.RFC3339
 
+// maxRecentErrors is the number of error messages kept for RecentErrors
+const maxRecentErrors = 20
+
+// ErrorRecord is an error message logged by Errorf or Panicf
+type ErrorRecord struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+var recentErrorsLock sync.Mutex
+var recentErrors []ErrorRecord
+
 // LogOptions specifies the configuration of the log
 type LogOptions struct {
 	MaxAge     *int  `json:"maxAge,omitempty"`
@@ -122,6 +137,24 @@ func printf(level Level, format string, a ...interface{}) {
 	}
 }
 
+// recordError keeps the message in the last maxRecentErrors error messages
+func recordError(message string) {
+	recentErrorsLock.Lock()
+	defer recentErrorsLock.Unlock()
+	if len(recentErrors) == maxRecentErrors {
+		recentErrors = recentErrors[1:]
+	}
+	recentErrors = append(recentErrors, ErrorRecord{Time: time.Now(), Message: message})
+}
+
+// RecentErrors returns the last error messages logged, oldest first, whatever
+// the logging level
+func RecentErrors() []ErrorRecord {
+	recentErrorsLock.Lock()
+	defer recentErrorsLock.Unlock()
+	return append([]ErrorRecord{}, recentErrors...)
+}
+
 // Debugf prints logging if logging level >= debug
 func Debugf(format string, a ...interface{}) {
 	printf(DebugLevel, format, a...)
@@ -135,12 +168,14 @@ func Verbosef(format string, a ...interface{}) {
 // Errorf prints logging if logging level >= error
 func Errorf(format string, a ...interface{}) error {
 	printf(ErrorLevel, format, a...)
+	recordError(fmt.Sprintf(format, a...))
 	return fmt.Errorf(format, a...)
 }
 
 // Panicf prints logging plus stack trace. This should be used only for unrecoverable error
 func Panicf(format string, a ...interface{}) {
 	printf(PanicLevel, format, a...)
+	recordError(fmt.Sprintf(format, a...))
 	printf(PanicLevel, "========= Stack trace output ========")
 	printf(PanicLevel, "%+v", errors.New("Multus Panic"))
 	printf(PanicLevel, "========= Stack trace output end ========")
@@ -166,12 +201,34 @@ func getLoggingLevel(levelStr string) Level {
 	return UnknownLevel
 }
 
-// SetLogLevel sets logging level
+// SetLogLevel sets logging level. While the level is raised at runtime by
+// RaiseLogLevel, the new level only takes effect after ResetLogLevel.
 func SetLogLevel(levelStr string) {
 	level := getLoggingLevel(levelStr)
 	if level < MaxLevel {
-		loggingLevel = level
+		configuredLevel = level
+		if !levelOverridden {
+			loggingLevel = level
+		}
+	}
+}
+
+// RaiseLogLevel raises the logging level by one, up to DebugLevel, until
+// ResetLogLevel is called. It returns the new level.
+func RaiseLogLevel() Level {
+	if loggingLevel < DebugLevel {
+		loggingLevel++
 	}
+	levelOverridden = true
+	return loggingLevel
+}
+
+// ResetLogLevel restores the logging level set by SetLogLevel. It returns
+// the restored level.
+func ResetLogLevel() Level {
+	levelOverridden = false
+	loggingLevel = configuredLevel
+	return loggingLevel
 }
 
 // SetLogStderr sets flag for logging stderr output
@@ -208,5 +265,6 @@ func init() {
 	loggingStderr = true
 	loggingW = nil
 	loggingLevel = PanicLevel
+	configuredLevel = PanicLevel
 	logger = nil
 }
@@ -74,6 +74,19 @@ var _ = Describe("logging operations", func() {
 		Expect(loggingLevel.String()).To(Equal("panic"))
 	})
 
+	It("Check raising and resetting the loglevel", func() {
+		SetLogLevel("error")
+		Expect(RaiseLogLevel()).To(Equal(VerboseLevel))
+		Expect(RaiseLogLevel()).To(Equal(DebugLevel))
+		Expect(RaiseLogLevel()).To(Equal(DebugLevel))
+
+		// the configured level only applies after a reset
+		SetLogLevel("panic")
+		Expect(GetLoggingLevel()).To(Equal(DebugLevel))
+		Expect(ResetLogLevel()).To(Equal(PanicLevel))
+		Expect(GetLoggingLevel()).To(Equal(PanicLevel))
+	})
+
 	It("Check loglevel setter with invalid level", func() {
 		currentLevel := loggingLevel
 		SetLogLevel("XXXX")
@@ -117,6 +130,17 @@ var _ = Describe("logging operations", func() {
 		logger = nil
 	})
 
+	It("Check the recent errors are kept whatever the logging level", func() {
+		for i := 0; i < maxRecentErrors+2; i++ {
+			_ = Errorf("error %d", i)
+		}
+		Verbosef("not an error")
+		errs := RecentErrors()
+		Expect(errs).To(HaveLen(maxRecentErrors))
+		Expect(errs[0].Message).To(Equal("error 2"))
+		Expect(errs[maxRecentErrors-1].Message).To(Equal(fmt.Sprintf("error %d", maxRecentErrors+1)))
+	})
+
 	// Tests public getter
 	It("Check getter for logging level with current level", func() {
 		currentLevel := loggingLevel
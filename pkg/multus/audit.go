@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+const (
+	auditResultSuccess = "success"
+	auditResultFailure = "failure"
+)
+
+// auditRecord is the audit log line of a completed ADD or DEL
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Command     string    `json:"command"`
+	Namespace   string    `json:"namespace"`
+	Pod         string    `json:"pod"`
+	PodUID      string    `json:"podUID,omitempty"`
+	ContainerID string    `json:"containerID"`
+	// names of the delegates, in delegate order
+	Delegates []string `json:"delegates"`
+	// success or failure
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// writeAuditRecord appends the record of a completed operation to the audit
+// log file, if any. A failure to write it is logged but does not fail the
+// operation.
+func writeAuditRecord(path, command string, args *skel.CmdArgs, k8sArgs *types.K8sArgs, delegates []*types.DelegateNetConf, opErr error) {
+	if path == "" {
+		return
+	}
+	record := auditRecord{
+		Time:        time.Now().UTC(),
+		Command:     command,
+		Namespace:   string(k8sArgs.K8S_POD_NAMESPACE),
+		Pod:         string(k8sArgs.K8S_POD_NAME),
+		PodUID:      string(k8sArgs.K8S_POD_UID),
+		ContainerID: args.ContainerID,
+		Delegates:   make([]string, 0, len(delegates)),
+		Result:      auditResultSuccess,
+	}
+	for _, delegate := range delegates {
+		record.Delegates = append(record.Delegates, delegateNetName(delegate))
+	}
+	if opErr != nil {
+		record.Result = auditResultFailure
+		record.Error = opErr.Error()
+	}
+	if err := appendAuditRecord(path, &record); err != nil {
+		_ = logging.Errorf("failed to write the audit record of the %s of container %s: %v", command, args.ContainerID, err)
+	}
+}
+
+// appendAuditRecord appends the record as a single JSON line, in one write so
+// that the records of concurrent operations do not interleave, and syncs it
+func appendAuditRecord(path string, record *auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the audit record: %v", err)
+	}
+	line = append(line, '\n')
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open the audit log %s: %v", path, err)
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write the audit log %s: %v", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync the audit log %s: %v", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// CachedContainer is a container whose ADD completed, as recorded in the
+// multus and libcni caches
+type CachedContainer struct {
+	ContainerID string
+	K8sArgs     types.K8sArgs
+	// Delegates are the delegates of the container, as cached on its ADD
+	Delegates []*types.DelegateNetConf
+	// NetworkStatus is the network status computed from the cached results
+	// of its delegates
+	NetworkStatus []nettypes.NetworkStatus
+}
+
+// cachedResult is the part of a libcni result cache file needed to tie it
+// to its container and delegate
+type cachedResult struct {
+	ContainerID string      `json:"containerId"`
+	NetworkName string      `json:"networkName"`
+	CniArgs     [][2]string `json:"cniArgs,omitempty"`
+	raw         []byte
+}
+
+// ListCachedContainers lists the containers which have both a scratch cache
+// entry, in either cache layout, and result caches in cniDir, ordered by
+// container ID
+func ListCachedContainers(cniDir string) ([]*CachedContainer, error) {
+	return listCachedContainers(cniDir, "")
+}
+
+// listCachedContainers is ListCachedContainers, limited to the pods of
+// namespace if set: the scratch caches of the other containers are not read
+func listCachedContainers(cniDir, namespace string) ([]*CachedContainer, error) {
+	cniDir = expandCNIDir(cniDir)
+	resultsDir := filepath.Join(cniDir, "results")
+	entries, err := os.ReadDir(resultsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, logging.Errorf("ListCachedContainers: failed to read %q: %v", resultsDir, err)
+	}
+
+	results := map[string][]*cachedResult{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(resultsDir, entry.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			logging.Debugf("ListCachedContainers: cannot read %q, skipped: %v", path, err)
+			continue
+		}
+		cached := &cachedResult{raw: b}
+		if err := json.Unmarshal(b, cached); err != nil || cached.ContainerID == "" {
+			logging.Debugf("ListCachedContainers: cannot parse %q, skipped: %v", path, err)
+			continue
+		}
+		results[cached.ContainerID] = append(results[cached.ContainerID], cached)
+	}
+
+	var containers []*CachedContainer
+	for containerID, cachedResults := range results {
+		container := &CachedContainer{ContainerID: containerID}
+		for _, arg := range cachedResults[0].CniArgs {
+			switch arg[0] {
+			case "K8S_POD_NAMESPACE":
+				container.K8sArgs.K8S_POD_NAMESPACE = cnitypes.UnmarshallableString(arg[1])
+			case "K8S_POD_NAME":
+				container.K8sArgs.K8S_POD_NAME = cnitypes.UnmarshallableString(arg[1])
+			case "K8S_POD_UID":
+				container.K8sArgs.K8S_POD_UID = cnitypes.UnmarshallableString(arg[1])
+			}
+		}
+		if namespace != "" && string(container.K8sArgs.K8S_POD_NAMESPACE) != namespace {
+			continue
+		}
+
+		var netconfBytes []byte
+		for _, dir := range []string{cniDir, nestedCacheLayout{}.dir(cniDir, &container.K8sArgs)} {
+			if netconfBytes, _, err = consumeScratchNetConf(containerID, dir); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			// the ADD of the container did not complete, or it was deleted
+			continue
+		}
+		delegates, err := loadCachedDelegates(netconfBytes)
+		if err != nil {
+			logging.Debugf("ListCachedContainers: cannot load the cache of container %s, skipped: %v", containerID, err)
+			continue
+		}
+		container.Delegates = delegates
+
+		for _, delegate := range delegates {
+			netName := delegate.Conf.Name
+			if netName == "" {
+				netName = delegate.ConfList.Name
+			}
+			for _, cached := range cachedResults {
+				if cached.NetworkName != netName {
+					continue
+				}
+				netStatuses, err := cachedNetworkStatuses(cached.raw, delegate)
+				if err != nil {
+					logging.Debugf("ListCachedContainers: no network status for network %s of container %s: %v", netName, containerID, err)
+					continue
+				}
+				container.NetworkStatus = append(container.NetworkStatus, netStatuses...)
+			}
+		}
+		containers = append(containers, container)
+	}
+
+	sort.Slice(containers, func(i, j int) bool { return containers[i].ContainerID < containers[j].ContainerID })
+	return containers, nil
+}
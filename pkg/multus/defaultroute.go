@@ -0,0 +1,125 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/plugins/pkg/ns"
+	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/netutils"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// gatewayProbeTimeout bounds the probe of each candidate gateway
+const gatewayProbeTimeout = time.Second
+
+// gatewayCandidate is a delegate whose default-route request is installed
+// only if it is the first one whose gateways are reachable
+type gatewayCandidate struct {
+	// name of the CNI config, as in the libcni cache
+	netName  string
+	ifName   string
+	rt       *libcni.RuntimeConf
+	gateways []net.IP
+	delegate *types.DelegateNetConf
+	// index of the delegate, and of its network statuses
+	idx int
+}
+
+// probeGateway checks that gw replies to an ICMP echo request sent from the
+// network namespace netnsPath; it is a variable so that the tests can stub it
+var probeGateway = func(netnsPath string, gw net.IP) error {
+	return ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		return icmpEcho(gw.String(), gatewayProbeTimeout)
+	})
+}
+
+// setDefaultGateway installs the default route through the gateways on ifName
+// and records them in the libcni cache of the delegate; it is a variable so
+// that the tests can stub it
+var setDefaultGateway = func(cniDir string, rt *libcni.RuntimeConf, netName, ifName string, gateways []net.IP) error {
+	if err := netutils.SetDefaultGW(rt.NetNS, ifName, gateways); err != nil {
+		return fmt.Errorf("error setting default gateway: %v", err)
+	}
+	if err := netutils.AddDefaultGWCache(cniDir, rt, netName, ifName, gateways); err != nil {
+		return fmt.Errorf("error setting default gateway in cache: %v", err)
+	}
+	return nil
+}
+
+// selectDefaultGateway returns the first candidate, in delegate order, whose
+// gateways are all reachable, or the first candidate and false if there is
+// none
+func selectDefaultGateway(candidates []*gatewayCandidate) (*gatewayCandidate, bool) {
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].idx < candidates[j].idx })
+	for _, candidate := range candidates {
+		reachable := true
+		for _, gw := range candidate.gateways {
+			if err := probeGateway(candidate.rt.NetNS, gw); err != nil {
+				logging.Verbosef("gateway %s of network %q on %s is unreachable: %v", gw, candidate.netName, candidate.ifName, err)
+				reachable = false
+				break
+			}
+		}
+		if reachable {
+			return candidate, true
+		}
+	}
+	return candidates[0], false
+}
+
+// filterUnchosenGateways marks the gateways of the candidates which are not
+// chosen for filtering, as those of the delegates without default-route, so
+// that the default route installed by their plugin is removed
+func filterUnchosenGateways(candidates []*gatewayCandidate, chosen *gatewayCandidate) {
+	for _, candidate := range candidates {
+		if candidate == chosen {
+			continue
+		}
+		for _, gw := range candidate.gateways {
+			if gw.To4() != nil {
+				candidate.delegate.IsFilterV4Gateway = true
+			} else {
+				candidate.delegate.IsFilterV6Gateway = true
+			}
+		}
+	}
+}
+
+// recordDefaultGateway sets the gateway of the network statuses of the
+// candidates, so that only the installed default route shows
+func recordDefaultGateway(netStatuses [][]nettypes.NetworkStatus, candidates []*gatewayCandidate, chosen *gatewayCandidate) {
+	for _, candidate := range candidates {
+		for i := range netStatuses[candidate.idx] {
+			status := &netStatuses[candidate.idx][i]
+			if status.Interface != candidate.ifName {
+				continue
+			}
+			status.Gateway = nil
+			if candidate == chosen {
+				for _, gw := range candidate.gateways {
+					status.Gateway = append(status.Gateway, gw.String())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+
+	v1 "k8s.io/api/core/v1"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// deterministicMAC derives the MAC address of the occurrence-th attachment of
+// network by the pod of identity: the prefix, followed by the leading bytes of
+// a hash of the seed, identity, network and occurrence. Without prefix, the
+// address is made locally administered and unicast.
+func deterministicMAC(conf *types.DeterministicMACConf, identity, network string, occurrence int) (net.HardwareAddr, error) {
+	prefix, err := types.ParseMACPrefix(conf.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d", conf.Seed, identity, network, occurrence)))
+	mac := make(net.HardwareAddr, 6)
+	copy(mac, prefix)
+	copy(mac[len(prefix):], sum[:])
+	if len(prefix) == 0 {
+		mac[0] = mac[0]&^0x01 | 0x02
+	}
+	return mac, nil
+}
+
+// assignDeterministicMACs requests a deterministic MAC address for the
+// secondary delegates requesting none, if the pod has a stable identity. A
+// derived address which is requested by another delegate of the pod, or
+// attached to another pod of its namespace cached in cniDir, fails the ADD
+// rather than being silently replaced by one which would not be stable. The
+// addresses of the other namespaces are derived from other identities.
+func assignDeterministicMACs(conf *types.DeterministicMACConf, pod *v1.Pod, delegates []*types.DelegateNetConf, cniDir string) error {
+	if conf == nil || pod == nil {
+		return nil
+	}
+	label := pod.Labels[conf.IdentityLabel]
+	if label == "" {
+		return nil
+	}
+	identity := pod.Namespace + "/" + label
+
+	// owners of the MAC addresses in use, by address
+	owners := map[string]string{}
+	for _, delegate := range delegates {
+		if mac, err := net.ParseMAC(delegate.MacRequest); err == nil {
+			owners[mac.String()] = fmt.Sprintf("network %q of the pod", delegate.Name)
+		}
+	}
+	containers, err := listCachedContainers(cniDir, pod.Namespace)
+	if err != nil {
+		logging.Verbosef("warning: assignDeterministicMACs: cannot check the MAC addresses of the cached pods of namespace %s for collisions: %v", pod.Namespace, err)
+	}
+	for _, container := range containers {
+		if string(container.K8sArgs.K8S_POD_NAMESPACE) == pod.Namespace && string(container.K8sArgs.K8S_POD_NAME) == pod.Name {
+			continue
+		}
+		for _, status := range container.NetworkStatus {
+			if mac, err := net.ParseMAC(status.Mac); err == nil {
+				owners[mac.String()] = fmt.Sprintf("network %q of pod %s/%s", status.Name, container.K8sArgs.K8S_POD_NAMESPACE, container.K8sArgs.K8S_POD_NAME)
+			}
+		}
+	}
+
+	occurrences := map[string]int{}
+	for _, delegate := range delegates {
+		if delegate.MasterPlugin || delegate.MacRequest != "" {
+			continue
+		}
+		mac, err := deterministicMAC(conf, identity, delegate.Name, occurrences[delegate.Name])
+		if err != nil {
+			return err
+		}
+		occurrences[delegate.Name]++
+		if owner, ok := owners[mac.String()]; ok {
+			return fmt.Errorf("the deterministic MAC address %s of network %q collides with the one of %s", mac, delegate.Name, owner)
+		}
+		owners[mac.String()] = fmt.Sprintf("network %q of the pod", delegate.Name)
+		delegate.MacRequest = mac.String()
+		logging.Debugf("assignDeterministicMACs: MAC address %s for network %q of %s", mac, delegate.Name, identity)
+	}
+	return nil
+}
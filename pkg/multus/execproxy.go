@@ -0,0 +1,193 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	cniversion "github.com/containernetworking/cni/pkg/version"
+)
+
+const (
+	// ExecProxyExecEndpoint is the endpoint of the exec proxy executing a
+	// delegate plugin
+	ExecProxyExecEndpoint = "/exec"
+	// ExecProxyFindEndpoint is the endpoint of the exec proxy looking up a
+	// delegate plugin in the CNI bin directories
+	ExecProxyFindEndpoint = "/find"
+)
+
+// ExecProxyExecRequest is the request of ExecProxyExecEndpoint
+type ExecProxyExecRequest struct {
+	PluginPath string   `json:"pluginPath"`
+	Stdin      []byte   `json:"stdin"`
+	Env        []string `json:"env"`
+}
+
+// ExecProxyExecResponse is the response of ExecProxyExecEndpoint. Error is
+// set when the plugin failed, in which case Stdout holds its CNI error, if
+// any.
+type ExecProxyExecResponse struct {
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ExecProxyFindRequest is the request of ExecProxyFindEndpoint
+type ExecProxyFindRequest struct {
+	Plugin string   `json:"plugin"`
+	Paths  []string `json:"paths"`
+}
+
+// ExecProxyFindResponse is the response of ExecProxyFindEndpoint. Error is
+// set when the plugin was not found.
+type ExecProxyFindResponse struct {
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ExecProxy implements invoke.Exec by sending the invocations of the delegate
+// plugins, as JSON over HTTP, to an exec proxy listening on a unix socket,
+// which executes them on behalf of multus
+type ExecProxy struct {
+	Stderr     io.Writer
+	socketPath string
+	client     *http.Client
+	cniversion.PluginDecoder
+}
+
+var _ invoke.Exec = &ExecProxy{}
+
+// NewExecProxy returns an ExecProxy sending the invocations to the exec proxy
+// listening on socketPath
+func NewExecProxy(socketPath string) *ExecProxy {
+	return &ExecProxy{
+		socketPath: socketPath,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// execWithProxy returns an ExecProxy if socketPath is set, or the given exec
+// unchanged otherwise or if it already is one
+func execWithProxy(exec invoke.Exec, socketPath string) invoke.Exec {
+	if _, ok := exec.(*ExecProxy); ok || socketPath == "" {
+		return exec
+	}
+	return NewExecProxy(socketPath)
+}
+
+// ExecPlugin has the exec proxy execute the plugin with the given
+// environment/stdin data
+func (e *ExecProxy) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	resp := &ExecProxyExecResponse{}
+	if err := e.post(ctx, ExecProxyExecEndpoint, &ExecProxyExecRequest{PluginPath: pluginPath, Stdin: stdinData, Env: environ}, resp); err != nil {
+		return nil, err
+	}
+
+	// stderr is only informational, so failures to copy it are ignored
+	if e.Stderr != nil && len(resp.Stderr) > 0 {
+		_, _ = e.Stderr.Write(resp.Stderr)
+	}
+	if resp.Error != "" {
+		return nil, execProxyPluginErr(resp)
+	}
+	return resp.Stdout, nil
+}
+
+// WithStderr returns a copy of the exec which also writes plugin stderr to w
+func (e *ExecProxy) WithStderr(w io.Writer) invoke.Exec {
+	c := *e
+	if e.Stderr != nil {
+		c.Stderr = io.MultiWriter(e.Stderr, w)
+	} else {
+		c.Stderr = w
+	}
+	return &c
+}
+
+// FindInPath has the exec proxy look up the plugin in paths, as the plugins
+// may not be visible from multus
+func (e *ExecProxy) FindInPath(plugin string, paths []string) (string, error) {
+	resp := &ExecProxyFindResponse{}
+	if err := e.post(context.TODO(), ExecProxyFindEndpoint, &ExecProxyFindRequest{Plugin: plugin, Paths: paths}, resp); err != nil {
+		return "", err
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("%s", resp.Error)
+	}
+	return resp.Path, nil
+}
+
+// post sends req to the endpoint of the exec proxy and decodes its response
+func (e *ExecProxy) post(ctx context.Context, endpoint string, req, resp interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the exec proxy request: %v", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://execproxy"+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create the exec proxy request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := e.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send the request to the exec proxy %s: %v", e.socketPath, err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the response of the exec proxy %s: %v", e.socketPath, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("exec proxy %s request failed with status %v: '%s'", endpoint, httpResp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("failed to parse the response of the exec proxy %s: %v", e.socketPath, err)
+	}
+	return nil
+}
+
+// execProxyPluginErr returns the error of a failed plugin, as RawExec does:
+// the CNI error it printed, otherwise its stderr or the error of the proxy
+func execProxyPluginErr(resp *ExecProxyExecResponse) error {
+	emsg := cnitypes.Error{}
+	if len(resp.Stdout) == 0 {
+		if len(resp.Stderr) == 0 {
+			emsg.Msg = fmt.Sprintf("netplugin failed with no error message: %s", resp.Error)
+		} else {
+			emsg.Msg = fmt.Sprintf("netplugin failed: %q", string(resp.Stderr))
+		}
+	} else if perr := json.Unmarshal(resp.Stdout, &emsg); perr != nil {
+		emsg.Msg = fmt.Sprintf("netplugin failed but error parsing its diagnostic message %q: %v", string(resp.Stdout), perr)
+	}
+	return &emsg
+}
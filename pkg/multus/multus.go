@@ -16,24 +16,33 @@
 package multus
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/containernetworking/cni/libcni"
 	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/skel"
 	cnitypes "github.com/containernetworking/cni/pkg/types"
 	cni100 "github.com/containernetworking/cni/pkg/types/100"
+	cniversion "github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ns"
 	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	nadutils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
 	"github.com/vishvananda/netlink"
+	"go.opentelemetry.io/otel/trace"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8snet "k8s.io/apimachinery/pkg/util/net"
@@ -42,6 +51,7 @@ import (
 	k8s "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/netutils"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/tracing"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
 )
 
@@ -49,6 +59,14 @@ const (
 	shortPollDuration    = 250 * time.Millisecond
 	informerPollDuration = 50 * time.Millisecond
 	shortPollTimeout     = 2500 * time.Millisecond
+
+	// maxDelegateStderr limits how much delegate stderr is kept and surfaced
+	maxDelegateStderr = 1024
+
+	// preferCachedDelegatesAnnot enables preferCachedDelegates for a single pod
+	preferCachedDelegatesAnnot = "v1.multus-cni.io/prefer-cached-delegates"
+	// teardownOrderAnnot overrides teardownOrder for a single pod
+	teardownOrderAnnot = "v1.multus-cni.io/teardown-order"
 )
 
 var (
@@ -64,6 +82,99 @@ func PrintVersionString() string {
 	return fmt.Sprintf("version:%s(%s%s), commit:%s, date:%s", version, gitTreeState, releaseStatus, commit, date)
 }
 
+// expandCNIDir expands environment variable references (e.g. $MULTUS_CACHE_DIR)
+// in the configured cniDir. If any referenced variable is unset, the literal
+// cniDir is used. Unlike resolveCNIDir, it leaves the filesystem untouched, for
+// the readers of the caches.
+func expandCNIDir(cniDir string) string {
+	unset := false
+	resolved := os.Expand(cniDir, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			unset = true
+		}
+		return value
+	})
+	if unset {
+		logging.Verbosef("warning: cniDir %q references an unset environment variable, using it literally", cniDir)
+		return cniDir
+	}
+	if resolved != cniDir {
+		logging.Debugf("expandCNIDir: resolved %q to %q", cniDir, resolved)
+	}
+	return resolved
+}
+
+// resolveCNIDir expands the configured cniDir as expandCNIDir does. The
+// directory is created if needed, and rejected if it cannot be.
+func resolveCNIDir(cniDir string) (string, error) {
+	resolved := expandCNIDir(cniDir)
+	if err := os.MkdirAll(resolved, 0700); err != nil {
+		return "", logging.Errorf("resolveCNIDir: cniDir %q (%q) cannot be used: %v", resolved, cniDir, err)
+	}
+	return resolved, nil
+}
+
+// scratchCacheLayout derives the directory where the delegates of a
+// container are cached, under the multus cniDir
+type scratchCacheLayout interface {
+	dir(cniDir string, k8sArgs *types.K8sArgs) string
+}
+
+// flatCacheLayout caches all the containers directly in cniDir
+type flatCacheLayout struct{}
+
+func (flatCacheLayout) dir(cniDir string, _ *types.K8sArgs) string {
+	return cniDir
+}
+
+// nestedCacheLayout caches the containers in cniDir/<pod namespace>/<pod UID>
+type nestedCacheLayout struct{}
+
+func (nestedCacheLayout) dir(cniDir string, k8sArgs *types.K8sArgs) string {
+	dir := cniDir
+	for _, name := range []string{string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_UID)} {
+		// the names missing from CNI_ARGS, or not usable in a path, are skipped
+		if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+			continue
+		}
+		dir = filepath.Join(dir, name)
+	}
+	return dir
+}
+
+func getScratchCacheLayout(layout string) scratchCacheLayout {
+	if layout == types.CacheLayoutNested {
+		return nestedCacheLayout{}
+	}
+	return flatCacheLayout{}
+}
+
+// scratchCacheDir returns the directory where the delegates of the container
+// are cached, according to the cacheLayout of conf
+func scratchCacheDir(conf *types.NetConf, k8sArgs *types.K8sArgs) string {
+	return getScratchCacheLayout(conf.CacheLayout).dir(conf.CNIDir, k8sArgs)
+}
+
+// ScratchCacheExists reports whether the delegates of the container are in
+// the scratch cache described by conf, i.e. whether its ADD completed and no
+// DEL followed
+func ScratchCacheExists(conf *types.NetConf, k8sArgs *types.K8sArgs, containerID string) bool {
+	_, err := os.Stat(filepath.Join(scratchCacheDir(conf, k8sArgs), containerID))
+	return err == nil
+}
+
+// removeScratchCacheDirs removes the directories of the nested layout left
+// empty once the cache of a container is deleted
+func removeScratchCacheDirs(conf *types.NetConf, dataDir string) {
+	for dir := dataDir; dir != conf.CNIDir && strings.HasPrefix(dir, conf.CNIDir); dir = filepath.Dir(dir) {
+		// fails, and stops, on the first directory which is not empty
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
 func saveScratchNetConf(containerID, dataDir string, netconf []byte) error {
 	logging.Debugf("saveScratchNetConf: %s, %s, %s", containerID, dataDir, string(netconf))
 	if err := os.MkdirAll(dataDir, 0700); err != nil {
@@ -80,100 +191,1072 @@ func saveScratchNetConf(containerID, dataDir string, netconf []byte) error {
 	return err
 }
 
+// delDeferPollInterval is how often a deferred DEL looks for a newer ADD
+var delDeferPollInterval = 100 * time.Millisecond
+
+// deferDelForNewerAdd holds a DEL while the scratch cache of the container was
+// written less than grace ago, i.e. while an ADD of the container is in
+// progress or just done. It reports whether the cache was written again in
+// the meantime, meaning that a newer ADD now owns the container's interfaces.
+func deferDelForNewerAdd(containerID, dataDir string, grace time.Duration) bool {
+	path := filepath.Join(dataDir, containerID)
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	modTime := info.ModTime()
+	for time.Since(modTime) < grace {
+		logging.Debugf("deferDelForNewerAdd: cache of container %s written %v ago, deferring DEL", containerID, time.Since(modTime))
+		time.Sleep(delDeferPollInterval)
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
 func consumeScratchNetConf(containerID, dataDir string) ([]byte, string, error) {
 	logging.Debugf("consumeScratchNetConf: %s, %s", containerID, dataDir)
 	path := filepath.Join(dataDir, containerID)
 
-	b, err := os.ReadFile(path)
-	return b, path, err
+	b, err := os.ReadFile(path)
+	return b, path, err
+}
+
+func getIfname(delegate *types.DelegateNetConf, argif string, idx int) string {
+	logging.Debugf("getIfname: %s, %s, %d", delegate.Name, argif, idx)
+	if delegate.IfnameRequest != "" {
+		return delegate.IfnameRequest
+	}
+	if delegate.MasterPlugin {
+		// master plugin always uses the CNI-provided interface name
+		return argif
+	}
+
+	// Otherwise construct a unique interface name from the delegate's
+	// position in the delegate list
+	return fmt.Sprintf("net%d", idx)
+}
+
+func getDelegateDeviceInfo(_ *types.DelegateNetConf, runtimeConf *libcni.RuntimeConf) (*nettypes.DeviceInfo, error) {
+	// If the DPDeviceInfoFile was created, it was copied to the CNIDeviceInfoFile.
+	// If the DPDeviceInfoFile was not created, CNI might have created it. So
+	// either way, load CNIDeviceInfoFile.
+	if info, ok := runtimeConf.CapabilityArgs["CNIDeviceInfoFile"]; ok {
+		if infostr, ok := info.(string); ok {
+			return nadutils.LoadDeviceInfoFromCNI(infostr)
+		}
+	} else {
+		logging.Debugf("getDelegateDeviceInfo(): No CapArgs - info=%v ok=%v", info, ok)
+	}
+	return nil, nil
+}
+
+// cachedDelegates is the scratch cache of a container saved with cachePodUID,
+// or without a default network; otherwise, the cache is the delegates list
+// alone
+type cachedDelegates struct {
+	PodUID    string                   `json:"podUID"`
+	Delegates []*types.DelegateNetConf `json:"delegates"`
+	// NoDefaultNetwork tells that none of the delegates is the master plugin
+	NoDefaultNetwork bool `json:"noDefaultNetwork,omitempty"`
+}
+
+// saveDelegates saves the delegates of the container, along with podUID if
+// not empty
+func saveDelegates(containerID, dataDir string, delegates []*types.DelegateNetConf, podUID string) error {
+	logging.Debugf("saveDelegates: %s, %s, %v, %s", containerID, dataDir, delegates, podUID)
+	noDefaultNetwork := true
+	for _, delegate := range delegates {
+		if delegate.MasterPlugin {
+			noDefaultNetwork = false
+			break
+		}
+	}
+	var delegatesBytes []byte
+	var err error
+	if podUID != "" || noDefaultNetwork {
+		delegatesBytes, err = json.Marshal(&cachedDelegates{PodUID: podUID, Delegates: delegates, NoDefaultNetwork: noDefaultNetwork})
+	} else {
+		delegatesBytes, err = json.Marshal(delegates)
+	}
+	if err != nil {
+		return logging.Errorf("saveDelegates: error serializing delegate netconf: %v", err)
+	}
+
+	if err = saveScratchNetConf(containerID, dataDir, delegatesBytes); err != nil {
+		return logging.Errorf("saveDelegates: error in saving the delegates : %v", err)
+	}
+
+	return err
+}
+
+// loadCachedDelegates parses the delegates saved by saveDelegates
+func loadCachedDelegates(b []byte) ([]*types.DelegateNetConf, error) {
+	delegates, _, err := loadCachedDelegatesAndPodUID(b)
+	return delegates, err
+}
+
+// loadCachedDelegatesAndPodUID parses the delegates saved by saveDelegates,
+// and the pod UID saved along with them, if any
+func loadCachedDelegatesAndPodUID(b []byte) ([]*types.DelegateNetConf, string, error) {
+	cached := &cachedDelegates{}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(b, cached); err != nil {
+			return nil, "", err
+		}
+	} else if err := json.Unmarshal(b, &cached.Delegates); err != nil {
+		return nil, "", err
+	}
+	delegates := cached.Delegates
+	if len(delegates) == 0 {
+		return nil, "", fmt.Errorf("no delegates in cache")
+	}
+	// check plugins field and enable ConfListPlugin if there is
+	for _, v := range delegates {
+		if len(v.ConfList.Plugins) != 0 {
+			v.ConfListPlugin = true
+		}
+	}
+	if cached.NoDefaultNetwork {
+		return delegates, cached.PodUID, nil
+	}
+	// caches written before the master plugin was cached have it first
+	for _, v := range delegates {
+		if v.MasterPlugin {
+			return delegates, cached.PodUID, nil
+		}
+	}
+	delegates[0].MasterPlugin = true
+	return delegates, cached.PodUID, nil
+}
+
+// cachePodUID returns the pod UID to save along with the delegates: the one
+// of the request, else of the pod, if cachePodUID is set
+func cachePodUID(conf *types.NetConf, k8sArgs *types.K8sArgs, pod *v1.Pod) string {
+	if !conf.CachePodUID {
+		return ""
+	}
+	if k8sArgs.K8S_POD_UID != "" {
+		return string(k8sArgs.K8S_POD_UID)
+	}
+	if pod != nil {
+		return string(pod.UID)
+	}
+	return ""
+}
+
+// preferCachedDelegates reports whether the delegates cached by a previous
+// ADD are used instead of resolving them again
+func preferCachedDelegates(conf *types.NetConf, pod *v1.Pod) bool {
+	if conf.PreferCachedDelegates {
+		return true
+	}
+	return pod != nil && pod.Annotations[preferCachedDelegatesAnnot] == "true"
+}
+
+// loadPreferredCachedDelegates replaces the delegates of conf with those
+// cached by a previous ADD of the container, and reports whether there were
+// any usable
+func loadPreferredCachedDelegates(args *skel.CmdArgs, k8sArgs *types.K8sArgs, conf *types.NetConf) bool {
+	netconfBytes, _, err := consumeScratchNetConf(args.ContainerID, scratchCacheDir(conf, k8sArgs))
+	if err != nil {
+		return false
+	}
+	delegates, podUID, err := loadCachedDelegatesAndPodUID(netconfBytes)
+	if err != nil {
+		logging.Verbosef("warning: ignoring the invalid delegates cache of container %s: %v", args.ContainerID, err)
+		return false
+	}
+	if podUID != "" && k8sArgs.K8S_POD_UID != "" && podUID != string(k8sArgs.K8S_POD_UID) {
+		logging.Verbosef("warning: ignoring the delegates cache of container %s, it belongs to pod UID %s", args.ContainerID, podUID)
+		return false
+	}
+	logging.Verbosef("CmdAdd: using the cached delegates of container %s", args.ContainerID)
+	conf.Delegates = delegates
+	return true
+}
+
+func getValidAttachmentFromCache(b []byte) (string, string, error) {
+	type simpleCacheV1 struct {
+		Kind           string                 `json:"kind"`
+		ContainerID    string                 `json:"containerId"`
+		IfName         string                 `json:"ifName"`
+	}
+
+	cache := &simpleCacheV1{}
+	if err := json.Unmarshal(b, cache); err != nil {
+		return "", "", fmt.Errorf("getValidAttachmentFromCache: invalid json: %v", err)
+	}
+
+	if cache.ContainerID == "" || cache.IfName == "" {
+		return "", "", fmt.Errorf("invalid cache: containerID:%q, ifName:%q", cache.ContainerID, cache.IfName)
+	}
+
+	return cache.ContainerID, cache.IfName, nil
+}
+
+func gatherValidAttachmentsFromCache(cniDir string) ([]cnitypes.GCAttachment, error) {
+	cacheDir := filepath.Join(cniDir, "results")
+	dirEntries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	allAttachments := []cnitypes.GCAttachment{}
+	for _, dirEnt := range dirEntries {
+		path := filepath.Join(cacheDir, dirEnt.Name())
+		delegatesBytes, err := os.ReadFile(path)
+		// if delegates cannot read that, skipped for now (because cannot recover).
+		if err != nil {
+			logging.Errorf("gatherSavedDelegates: cannot read %q, skipped to add", path)
+			continue
+		}
+		containerID, ifName, err := getValidAttachmentFromCache(delegatesBytes)
+		if err != nil {
+			logging.Errorf("gatherSavedDelegates: cannot read cache, skipped to add: %v", err)
+			continue
+		}
+		allAttachments = append(allAttachments, cnitypes.GCAttachment{ContainerID: containerID, IfName: ifName})
+	}
+	return allAttachments, nil
+}
+
+// InterfaceOwner describes the delegate which created an interface of a container
+type InterfaceOwner struct {
+	ContainerID string `json:"containerId"`
+	IfName      string `json:"ifName"`
+	// Network is the network (e.g. network-attachment-definition) of the delegate
+	Network string `json:"network"`
+	// Name and Type are the ones of the delegate CNI config
+	Name          string                   `json:"name"`
+	Type          string                   `json:"type"`
+	NetworkStatus []nettypes.NetworkStatus `json:"networkStatus,omitempty"`
+}
+
+// InterfaceNotFoundError indicates that no delegate of the container created
+// the interface
+type InterfaceNotFoundError struct {
+	message string
+}
+
+func (e *InterfaceNotFoundError) Error() string { return e.message }
+
+// InvalidContainerIDError indicates that the container ID cannot be the one
+// of a cached container
+type InvalidContainerIDError struct {
+	message string
+}
+
+func (e *InvalidContainerIDError) Error() string { return e.message }
+
+// GetInterfaceOwner finds the delegate which created the interface ifName of
+// the container from the multus and libcni caches in cniDir, along with the
+// network status computed from its cached result
+func GetInterfaceOwner(cniDir, containerID, ifName string) (*InterfaceOwner, error) {
+	// the container ID is a path element of the caches
+	if containerID == "" || strings.Contains(containerID, "/") || strings.Contains(containerID, "..") {
+		return nil, &InvalidContainerIDError{fmt.Sprintf("invalid container ID %q", containerID)}
+	}
+	cniDir = expandCNIDir(cniDir)
+	netconfBytes, _, err := consumeScratchNetConf(containerID, cniDir)
+	if os.IsNotExist(err) {
+		// the container may be cached in the nested layout
+		if paths, _ := filepath.Glob(filepath.Join(cniDir, "*", "*", containerID)); len(paths) == 1 {
+			netconfBytes, _, err = consumeScratchNetConf(containerID, filepath.Dir(paths[0]))
+		}
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &InterfaceNotFoundError{fmt.Sprintf("no cache of container %s", containerID)}
+		}
+		return nil, logging.Errorf("GetInterfaceOwner: failed to read the cache of container %s: %v", containerID, err)
+	}
+	delegates, err := loadCachedDelegates(netconfBytes)
+	if err != nil {
+		return nil, logging.Errorf("GetInterfaceOwner: failed to load the cache of container %s: %v", containerID, err)
+	}
+
+	for _, delegate := range delegates {
+		netName := delegate.Conf.Name
+		pluginType := delegate.Conf.Type
+		if netName == "" {
+			netName = delegate.ConfList.Name
+			if len(delegate.ConfList.Plugins) > 0 {
+				pluginType = delegate.ConfList.Plugins[0].Type
+			}
+		}
+		// libcni caches the result of a delegate per network and interface
+		resultPath := filepath.Join(cniDir, "results", fmt.Sprintf("%s-%s-%s", netName, containerID, ifName))
+		cached, err := os.ReadFile(resultPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, logging.Errorf("GetInterfaceOwner: failed to read %s: %v", resultPath, err)
+		}
+
+		owner := &InterfaceOwner{
+			ContainerID: containerID,
+			IfName:      ifName,
+			Network:     delegate.Name,
+			Name:        netName,
+			Type:        pluginType,
+		}
+		if owner.Network == "" {
+			owner.Network = netName
+		}
+		netStatuses, err := cachedNetworkStatuses(cached, delegate)
+		if err != nil {
+			logging.Verbosef("warning: no network status for interface %s of container %s: %v", ifName, containerID, err)
+		}
+		owner.NetworkStatus = netStatuses
+		return owner, nil
+	}
+	return nil, &InterfaceNotFoundError{fmt.Sprintf("no delegate of container %s created interface %s", containerID, ifName)}
+}
+
+// cachedNetworkStatuses computes the network statuses of a delegate from its
+// libcni result cache
+func cachedNetworkStatuses(cached []byte, delegate *types.DelegateNetConf) ([]nettypes.NetworkStatus, error) {
+	cache := struct {
+		Result json.RawMessage `json:"result"`
+	}{}
+	if err := json.Unmarshal(cached, &cache); err != nil {
+		return nil, err
+	}
+	if len(cache.Result) == 0 {
+		return nil, fmt.Errorf("no cached result")
+	}
+	resultVersion := struct {
+		CNIVersion string `json:"cniVersion"`
+	}{}
+	if err := json.Unmarshal(cache.Result, &resultVersion); err != nil {
+		return nil, err
+	}
+	result, err := cniversion.NewResult(resultVersion.CNIVersion, cache.Result)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := nadutils.CreateNetworkStatuses(result, delegate.Name, delegate.MasterPlugin, nil)
+	if err != nil {
+		return nil, err
+	}
+	var netStatuses []nettypes.NetworkStatus
+	for _, status := range statuses {
+		netStatuses = append(netStatuses, *status)
+	}
+	return netStatuses, nil
+}
+
+// redactNetworkStatus removes the fields at the given paths, dot separated
+// JSON keys, from the network status
+func redactNetworkStatus(status *nettypes.NetworkStatus, paths []string) (*nettypes.NetworkStatus, error) {
+	if len(paths) == 0 {
+		return status, nil
+	}
+	b, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		keys := strings.Split(path, ".")
+		parent := fields
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = child
+		}
+		if parent != nil {
+			delete(parent, keys[len(keys)-1])
+		}
+	}
+	if b, err = json.Marshal(fields); err != nil {
+		return nil, err
+	}
+	redacted := &nettypes.NetworkStatus{}
+	if err := json.Unmarshal(b, redacted); err != nil {
+		return nil, err
+	}
+	return redacted, nil
+}
+
+// masterPluginIndex returns the index of the master plugin among the
+// delegates, the first one if none is
+func masterPluginIndex(delegates []*types.DelegateNetConf) int {
+	for idx, delegate := range delegates {
+		if delegate.MasterPlugin {
+			return idx
+		}
+	}
+	return 0
+}
+
+// injectPrevResult sets the prevResult multus got from a previous plugin of
+// its chain in the config of the delegate, or in the one of its first plugin
+// for a conflist, converted to the CNI version of the delegate
+func injectPrevResult(delegate *types.DelegateNetConf, prevResult *cni100.Result) error {
+	cniVersion := delegate.Conf.CNIVersion
+	if delegate.ConfListPlugin {
+		cniVersion = delegate.ConfList.CNIVersion
+	}
+	var converted cnitypes.Result = prevResult
+	if cniVersion != "" {
+		var err error
+		if converted, err = prevResult.GetAsVersion(cniVersion); err != nil {
+			return err
+		}
+	}
+	resultBytes, err := json.Marshal(converted)
+	if err != nil {
+		return err
+	}
+	var rawResult interface{}
+	if err := json.Unmarshal(resultBytes, &rawResult); err != nil {
+		return err
+	}
+
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal(delegate.Bytes, &conf); err != nil {
+		return err
+	}
+	if delegate.ConfListPlugin {
+		plugins, _ := conf["plugins"].([]interface{})
+		if len(plugins) == 0 {
+			return fmt.Errorf("conflist %q has no plugin", delegate.ConfList.Name)
+		}
+		plugin, ok := plugins[0].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid first plugin in conflist %q", delegate.ConfList.Name)
+		}
+		plugin["prevResult"] = rawResult
+	} else {
+		conf["prevResult"] = rawResult
+	}
+	delegate.Bytes, err = json.Marshal(conf)
+	return err
+}
+
+// resultMTU returns the MTU reported for the container interface ifName in
+// result, or 0 if there is none
+func resultMTU(result cnitypes.Result, ifName string) int {
+	res, err := cni100.NewResultFromResult(result)
+	if err != nil {
+		return 0
+	}
+	for _, intf := range res.Interfaces {
+		if intf.Name == ifName && intf.Sandbox != "" {
+			return intf.Mtu
+		}
+	}
+	return 0
+}
+
+// inheritMTU sets the mtu of the delegate config, or of the first plugin of a
+// conflist, unless it has one already
+func inheritMTU(delegate *types.DelegateNetConf, mtu int) error {
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal(delegate.Bytes, &conf); err != nil {
+		return err
+	}
+	target := conf
+	if delegate.ConfListPlugin {
+		plugins, _ := conf["plugins"].([]interface{})
+		if len(plugins) == 0 {
+			return fmt.Errorf("conflist %q has no plugin", delegate.ConfList.Name)
+		}
+		plugin, ok := plugins[0].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid first plugin in conflist %q", delegate.ConfList.Name)
+		}
+		target = plugin
+	}
+	if _, ok := target["mtu"]; ok {
+		return nil
+	}
+	target["mtu"] = mtu
+
+	var err error
+	delegate.Bytes, err = json.Marshal(conf)
+	return err
+}
+
+// preparedDelegate is a delegate ready to be added
+type preparedDelegate struct {
+	netName string
+	ifName  string
+	rt      *libcni.RuntimeConf
+}
+
+// prepareDelegate returns the runtime config of the delegate at index idx,
+// and passes it the default network MTU, if any
+func prepareDelegate(delegate *types.DelegateNetConf, idx int, args *skel.CmdArgs, k8sArgs *types.K8sArgs, n *types.NetConf, defaultMTU int) (*preparedDelegate, error) {
+	ifName := getIfname(delegate, args.IfName, idx)
+	rt, cniDeviceInfoPath := types.CreateCNIRuntimeConf(args, k8sArgs, ifName, n.RuntimeConfig, delegate)
+	if cniDeviceInfoPath != "" && delegate.ResourceName != "" && delegate.DeviceID != "" {
+		err := nadutils.CopyDeviceInfoForCNIFromDP(cniDeviceInfoPath, delegate.ResourceName, delegate.DeviceID)
+		// Even if the filename is set, file may not be present. Ignore error,
+		// but log and in the future may need to filter on specific errors.
+		if err != nil {
+			logging.Debugf("CmdAdd: CopyDeviceInfoForCNIFromDP returned an error - err=%v", err)
+		}
+	}
+
+	// We collect the delegate netName for the cachefile name as well as following errors
+	netName := delegate.Conf.Name
+	if netName == "" {
+		netName = delegate.ConfList.Name
+	}
+	if defaultMTU > 0 && !delegate.MasterPlugin {
+		if err := inheritMTU(delegate, defaultMTU); err != nil {
+			return nil, fmt.Errorf("error passing the default network MTU to delegate %q: %v", netName, err)
+		}
+	}
+	return &preparedDelegate{netName: netName, ifName: ifName, rt: rt}, nil
+}
+
+// delegateAdd is the outcome of the ADD of a delegate; entry is nil if the
+// delegate was not invoked
+type delegateAdd struct {
+	result cnitypes.Result
+	entry  *delegateTraceEntry
+	err    error
+}
+
+// addDelegate adds the prepared delegate, unless its net-attach-def is
+// quarantined; it is safe to call concurrently for different delegates
+func addDelegate(ctx context.Context, exec invoke.Exec, kubeClient *k8s.ClientInfo, pod *v1.Pod, delegate *types.DelegateNetConf, prepared *preparedDelegate, n *types.NetConf) *delegateAdd {
+	quarantine := netAttachDefQuarantine(ctx)
+	if quarantine != nil && delegate.NetAttachDef != "" {
+		if err := quarantine.Check(delegate.NetAttachDef, delegate.NetAttachDefResourceVersion); err != nil {
+			return &delegateAdd{err: err}
+		}
+	}
+
+	entry := &delegateTraceEntry{name: prepared.netName, ifName: prepared.ifName, start: time.Now()}
+	_, delegateSpan := startDelegateSpan(ctx, "ADD", prepared.netName, prepared.ifName)
+	result, err := addDelegateRetrying(ctx, exec, kubeClient, pod, delegate, prepared.rt, n)
+	tracing.EndSpan(delegateSpan, err)
+	if quarantine != nil && delegate.NetAttachDef != "" {
+		if err == nil {
+			quarantine.RecordSuccess(delegate.NetAttachDef)
+		} else if isNetAttachDefFailure(ctx, err) {
+			quarantine.RecordFailure(delegate.NetAttachDef, delegate.NetAttachDefResourceVersion)
+		}
+	}
+	entry.end = time.Now()
+	entry.err = err
+	return &delegateAdd{result: result, entry: entry, err: err}
+}
+
+// isNetAttachDefFailure reports whether the ADD error of a delegate may be the
+// fault of its net-attach-def, i.e. the ADD was not cancelled and the quota
+// of the namespace of the pod did not reject it
+func isNetAttachDefFailure(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	_, quotaErr := err.(*namespaceQuotaError)
+	return !quotaErr
+}
+
+// addDelegateRetrying adds the delegate and, while its ADD fails with an error
+// matching one of the patterns of its retry policy, deletes and adds it again,
+// up to maxRetries times
+func addDelegateRetrying(ctx context.Context, exec invoke.Exec, kubeClient *k8s.ClientInfo, pod *v1.Pod, delegate *types.DelegateNetConf, rt *libcni.RuntimeConf, n *types.NetConf) (cnitypes.Result, error) {
+	result, err := DelegateAddContext(ctx, exec, kubeClient, pod, delegate, rt, n)
+	retry := delegateRetryPolicy(delegate, n)
+	if retry == nil {
+		return result, err
+	}
+	delay := time.Duration(retry.IntervalMilliseconds) * time.Millisecond
+	for attempt := 1; err != nil && attempt <= retry.MaxRetries && matchesRetryPattern(retry.ErrorPatterns, err); attempt++ {
+		logging.Verbosef("warning: retrying the ADD of network %q (%d/%d) in %v after a transient error: %v", delegateNetName(delegate), attempt, retry.MaxRetries, delay, err)
+		// clean up what the failed ADD left, as the runtime would
+		if delErr := DelegateDel(exec, pod, delegate, rt, n); delErr != nil {
+			logging.Debugf("addDelegateRetrying: DEL of network %q failed: %v", delegateNetName(delegate), delErr)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		delay = time.Duration(float64(delay) * retry.BackoffFactor)
+		result, err = DelegateAddContext(ctx, exec, kubeClient, pod, delegate, rt, n)
+	}
+	return result, err
+}
+
+// delegateRetryPolicy returns the retry policy of the delegate: the one of its
+// net-attach-def, else defaultNetworkRetry for the default network, else
+// delegateRetryPolicy, if any
+func delegateRetryPolicy(delegate *types.DelegateNetConf, n *types.NetConf) *types.RetryPolicy {
+	if delegate.RetryPolicy != nil {
+		return delegate.RetryPolicy
+	}
+	if delegate.MasterPlugin && n.DefaultNetworkRetry != nil {
+		return n.DefaultNetworkRetry
+	}
+	return n.DelegateRetryPolicy
+}
+
+// matchesRetryPattern reports whether the error matches one of the patterns
+func matchesRetryPattern(patterns []string, err error) bool {
+	for _, pattern := range patterns {
+		// the patterns are validated when the policy is loaded
+		if re, reErr := regexp.Compile(pattern); reErr == nil && re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// annotateAddFailure records the ADD failure of a delegate in an annotation of
+// the pod, when its error matches one of the addFailureAnnotationPatterns
+func annotateAddFailure(kubeClient *k8s.ClientInfo, pod *v1.Pod, n *types.NetConf, delegate *types.DelegateNetConf, netName, ifName string, addErr error) {
+	if kubeClient == nil || pod == nil {
+		return
+	}
+	for _, pattern := range n.AddFailureAnnotationPatterns {
+		// the patterns are validated by LoadNetConf
+		if re, err := regexp.Compile(pattern); err != nil || !re.MatchString(addErr.Error()) {
+			continue
+		}
+		network := delegate.Name
+		if network == "" {
+			network = netName
+		}
+		failure := &k8s.AddFailure{
+			Network:   network,
+			Interface: ifName,
+			Reason:    addErr.Error(),
+			Pattern:   pattern,
+		}
+		if err := k8s.SetPodAddFailure(kubeClient, pod, failure); err != nil {
+			logging.Verbosef("warning: failed to set the %s annotation of pod %s/%s: %v", k8s.AddFailureAnnot, pod.Namespace, pod.Name, err)
+		}
+		return
+	}
+}
+
+// delegateConfBytes returns the config the delegate is invoked with: its
+// Bytes, with its SecretConfig merged in the top level of the config, or in
+// the one of its first plugin for a conflist. Neither the merged config nor
+// the delegate itself, which holds the SecretConfig, is ever logged.
+func delegateConfBytes(delegate *types.DelegateNetConf) ([]byte, error) {
+	if delegate.SecretConfig == nil {
+		return delegate.Bytes, nil
+	}
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal(delegate.Bytes, &conf); err != nil {
+		return nil, err
+	}
+	target := conf
+	if delegate.ConfListPlugin {
+		plugins, _ := conf["plugins"].([]interface{})
+		if len(plugins) == 0 {
+			return nil, fmt.Errorf("conflist %q has no plugin", delegate.ConfList.Name)
+		}
+		plugin, ok := plugins[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid first plugin in conflist %q", delegate.ConfList.Name)
+		}
+		target = plugin
+	}
+	for key, value := range delegate.SecretConfig {
+		target[key] = value
+	}
+	return json.Marshal(conf)
+}
+
+// loadSecretConfigs loads the Secret configs of the delegates, which are not
+// part of the delegates cache
+func loadSecretConfigs(kubeClient *k8s.ClientInfo, delegates []*types.DelegateNetConf) error {
+	for _, delegate := range delegates {
+		if delegate.ConfigSecretRef == nil || delegate.SecretConfig != nil {
+			continue
+		}
+		if err := k8s.LoadSecretConfig(kubeClient, delegate); err != nil {
+			return fmt.Errorf("delegate %q: %v", delegate.Name, err)
+		}
+	}
+	return nil
+}
+
+// scrubCachedConfig replaces the config libcni cached along with the result
+// of a delegate with the one of the delegate without its Secret config
+func scrubCachedConfig(cniDir, netName string, rt *libcni.RuntimeConf, delegate *types.DelegateNetConf) error {
+	resultPath := resultCachePath(cniDir, netName, rt)
+	cached, err := os.ReadFile(resultPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	cache := map[string]interface{}{}
+	if err := json.Unmarshal(cached, &cache); err != nil {
+		return err
+	}
+	// []byte is cached in base64, like libcni does
+	cache["config"] = delegate.Bytes
+	cached, err = json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(resultPath, cached, 0600)
+}
+
+// resultCachePath returns the path of the file where libcni caches the result
+// of the network under cacheDir
+func resultCachePath(cacheDir, netName string, rt *libcni.RuntimeConf) string {
+	return filepath.Join(cacheDir, "results", fmt.Sprintf("%s-%s-%s", netName, rt.ContainerID, rt.IfName))
+}
+
+// copyResultCache copies the result libcni cached for the delegate in cniDir
+// to resultCacheDir, where tools like cnitool look for it
+func copyResultCache(cniDir, resultCacheDir, netName string, rt *libcni.RuntimeConf) error {
+	if filepath.Clean(cniDir) == filepath.Clean(resultCacheDir) {
+		return nil
+	}
+	cached, err := os.ReadFile(resultCachePath(cniDir, netName, rt))
+	if err != nil {
+		return err
+	}
+	path := resultCachePath(resultCacheDir, netName, rt)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, cached, 0600)
+}
+
+// removeResultCache removes the result copied for the delegate to
+// resultCacheDir, as libcni does on DEL
+func removeResultCache(cniDir, resultCacheDir, netName string, rt *libcni.RuntimeConf) error {
+	if filepath.Clean(cniDir) == filepath.Clean(resultCacheDir) {
+		return nil
+	}
+	if err := os.Remove(resultCachePath(resultCacheDir, netName, rt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// mergePrevResult adds the interfaces, IPs and routes of the prevResult
+// multus got from a previous plugin of its chain to the result of multus,
+// which the master delegate did not pass through
+func mergePrevResult(ctx context.Context, prevResult *cni100.Result, result cnitypes.Result, routeConflictPolicy string) (cnitypes.Result, error) {
+	res, err := cni100.NewResultFromResult(result)
+	if err != nil {
+		return nil, err
+	}
+
+	// the interfaces of prevResult missing from the result go first, the
+	// IPs of the result then refer to shifted interface indexes
+	var missing []*cni100.Interface
+	for _, prevIface := range prevResult.Interfaces {
+		found := false
+		for _, iface := range res.Interfaces {
+			if iface.Name == prevIface.Name && iface.Sandbox == prevIface.Sandbox {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, prevIface)
+		}
+	}
+	merged := &cni100.Result{CNIVersion: res.CNIVersion, DNS: res.DNS}
+	merged.Interfaces = append(append(merged.Interfaces, missing...), res.Interfaces...)
+	seenIPs := map[string]bool{}
+	for _, ip := range res.IPs {
+		seenIPs[ip.Address.String()] = true
+	}
+	for _, ip := range prevResult.IPs {
+		if seenIPs[ip.Address.String()] {
+			continue
+		}
+		prevIP := *ip
+		if ip.Interface != nil {
+			// the index of the interface in merged.Interfaces, whether it is
+			// a missing one or one the result passed through
+			prevIP.Interface = nil
+			if *ip.Interface >= 0 && *ip.Interface < len(prevResult.Interfaces) {
+				prevIface := prevResult.Interfaces[*ip.Interface]
+				for i, iface := range merged.Interfaces {
+					if iface.Name == prevIface.Name && iface.Sandbox == prevIface.Sandbox {
+						prevIP.Interface = cni100.Int(i)
+						break
+					}
+				}
+			}
+		}
+		merged.IPs = append(merged.IPs, &prevIP)
+	}
+	for _, ip := range res.IPs {
+		resIP := *ip
+		if ip.Interface != nil {
+			resIP.Interface = cni100.Int(*ip.Interface + len(missing))
+		}
+		merged.IPs = append(merged.IPs, &resIP)
+	}
+	if merged.Routes, err = mergeRoutes(ctx, prevResult.Routes, res.Routes, routeConflictPolicy); err != nil {
+		return nil, err
+	}
+	if len(merged.DNS.Nameservers) == 0 && len(merged.DNS.Search) == 0 && merged.DNS.Domain == "" {
+		merged.DNS = prevResult.DNS
+	}
+
+	return merged.GetAsVersion(result.Version())
+}
+
+// mergeRoutes returns the routes of prevRoutes followed by routes, without
+// duplicates. A route of prevRoutes with the destination and table of one of
+// routes but another gateway conflicts with it: it is dropped with a warning,
+// or fails the merge with the error routeConflictPolicy.
+func mergeRoutes(ctx context.Context, prevRoutes, routes []*cnitypes.Route, routeConflictPolicy string) ([]*cnitypes.Route, error) {
+	routeKey := func(route *cnitypes.Route) string {
+		table := "main"
+		if route.Table != nil {
+			table = fmt.Sprint(*route.Table)
+		}
+		return route.Dst.String() + " table " + table
+	}
+	gateways := map[string]net.IP{}
+	for _, route := range routes {
+		gateways[routeKey(route)] = route.GW
+	}
+
+	var merged []*cnitypes.Route
+	seen := map[string]bool{}
+	for _, route := range prevRoutes {
+		if gw, ok := gateways[routeKey(route)]; ok && !gw.Equal(route.GW) {
+			if routeConflictPolicy == types.RouteConflictPolicyError {
+				return nil, fmt.Errorf("route to %s via %v of the prevResult conflicts with the one via %v of the result", routeKey(route), route.GW, gw)
+			}
+			warnf(ctx, "dropping the route to %s via %v of the prevResult, which conflicts with the one via %v of the result", routeKey(route), route.GW, gw)
+			continue
+		}
+		if !seen[route.String()] {
+			seen[route.String()] = true
+			merged = append(merged, route)
+		}
+	}
+	for _, route := range routes {
+		if !seen[route.String()] {
+			seen[route.String()] = true
+			merged = append(merged, route)
+		}
+	}
+	return merged, nil
+}
+
+// hostAddr is an address assigned to a host interface
+type hostAddr struct {
+	ifName string
+	ip     net.IP
 }
 
-func getIfname(delegate *types.DelegateNetConf, argif string, idx int) string {
-	logging.Debugf("getIfname: %v, %s, %d", delegate, argif, idx)
-	if delegate.IfnameRequest != "" {
-		return delegate.IfnameRequest
+// hostInterfaceAddrs lists the addresses of the interfaces in the current
+// (host) network namespace. It is a variable so tests can replace it.
+var hostInterfaceAddrs = func() ([]hostAddr, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, err
 	}
-	if delegate.MasterPlugin {
-		// master plugin always uses the CNI-provided interface name
-		return argif
+	var addrs []hostAddr
+	for _, link := range links {
+		linkAddrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range linkAddrs {
+			addrs = append(addrs, hostAddr{ifName: link.Attrs().Name, ip: addr.IP})
+		}
 	}
-
-	// Otherwise construct a unique interface name from the delegate's
-	// position in the delegate list
-	return fmt.Sprintf("net%d", idx)
+	return addrs, nil
 }
 
-func getDelegateDeviceInfo(_ *types.DelegateNetConf, runtimeConf *libcni.RuntimeConf) (*nettypes.DeviceInfo, error) {
-	// If the DPDeviceInfoFile was created, it was copied to the CNIDeviceInfoFile.
-	// If the DPDeviceInfoFile was not created, CNI might have created it. So
-	// either way, load CNIDeviceInfoFile.
-	if info, ok := runtimeConf.CapabilityArgs["CNIDeviceInfoFile"]; ok {
-		if infostr, ok := info.(string); ok {
-			return nadutils.LoadDeviceInfoFromCNI(infostr)
+// multusPluginTypes are the plugin types of multus itself, which a delegate
+// would call back into
+var multusPluginTypes = map[string]bool{"multus": true, "multus-shim": true}
+
+// checkSelfReference fails if a delegate, or a plugin of a conflist
+// delegate, is multus itself, which would recurse into multus on every ADD
+func checkSelfReference(delegates []*types.DelegateNetConf) error {
+	for _, delegate := range delegates {
+		pluginTypes := []string{delegate.Conf.Type}
+		if delegate.ConfListPlugin {
+			pluginTypes = pluginTypes[:0]
+			for _, plugin := range delegate.ConfList.Plugins {
+				pluginTypes = append(pluginTypes, plugin.Type)
+			}
+		}
+		for _, pluginType := range pluginTypes {
+			if multusPluginTypes[pluginType] {
+				return fmt.Errorf("delegate %q is of type %q, multus cannot delegate to itself: check the clusterNetwork, the default network and the net-attach-defs of the pod", delegate.Name, pluginType)
+			}
 		}
-	} else {
-		logging.Debugf("getDelegateDeviceInfo(): No CapArgs - info=%v ok=%v", info, ok)
 	}
-	return nil, nil
+	return nil
 }
 
-func saveDelegates(containerID, dataDir string, delegates []*types.DelegateNetConf) error {
-	logging.Debugf("saveDelegates: %s, %s, %v", containerID, dataDir, delegates)
-	delegatesBytes, err := json.Marshal(delegates)
-	if err != nil {
-		return logging.Errorf("saveDelegates: error serializing delegate netconf: %v", err)
+// checkHostIPConflicts fails if a static IP requested for a delegate is
+// already assigned to a host interface
+func checkHostIPConflicts(delegates []*types.DelegateNetConf) error {
+	var requested []*types.DelegateNetConf
+	for _, delegate := range delegates {
+		if len(delegate.IPRequest) > 0 {
+			requested = append(requested, delegate)
+		}
 	}
-
-	if err = saveScratchNetConf(containerID, dataDir, delegatesBytes); err != nil {
-		return logging.Errorf("saveDelegates: error in saving the delegates : %v", err)
+	if len(requested) == 0 {
+		return nil
 	}
 
-	return err
+	addrs, err := hostInterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("failed to list the host interface addresses: %v", err)
+	}
+	for _, delegate := range requested {
+		for _, ipRequest := range delegate.IPRequest {
+			ip := net.ParseIP(ipRequest)
+			if strings.Contains(ipRequest, "/") {
+				ip, _, _ = net.ParseCIDR(ipRequest)
+			}
+			if ip == nil {
+				continue
+			}
+			for _, addr := range addrs {
+				if addr.ip.Equal(ip) {
+					return fmt.Errorf("IP %s requested for network %q is already assigned to host interface %s", ip, delegate.Name, addr.ifName)
+				}
+			}
+		}
+	}
+	return nil
 }
 
-func getValidAttachmentFromCache(b []byte) (string, string, error) {
-	type simpleCacheV1 struct {
-		Kind           string                 `json:"kind"`
-		ContainerID    string                 `json:"containerId"`
-		IfName         string                 `json:"ifName"`
+// checkPortMappingPolicy fails if a delegate would get portMappings in its
+// runtimeConfig while the portMappingNamespacePolicy denies the pod namespace
+func checkPortMappingPolicy(args *skel.CmdArgs, k8sArgs *types.K8sArgs, n *types.NetConf) error {
+	namespace := string(k8sArgs.K8S_POD_NAMESPACE)
+	if portMappingsAllowed(n.PortMappingNamespacePolicy, namespace) {
+		return nil
 	}
-
-	cache := &simpleCacheV1{}
-	if err := json.Unmarshal(b, cache); err != nil {
-		return "", "", fmt.Errorf("getValidAttachmentFromCache: invalid json: %v", err)
+	for idx, delegate := range n.Delegates {
+		rt, _ := types.CreateCNIRuntimeConf(args, k8sArgs, getIfname(delegate, args.IfName, idx), n.RuntimeConfig, delegate)
+		if _, ok := rt.CapabilityArgs["portMappings"]; ok && hasCapability(delegate, "portMappings") {
+			return fmt.Errorf("network %q requests port mappings, which the portMappingNamespacePolicy denies to namespace %q", delegate.Name, namespace)
+		}
 	}
+	return nil
+}
 
-	if cache.ContainerID == "" || cache.IfName == "" {
-		return "", "", fmt.Errorf("invalid cache: containerID:%q, ifName:%q", cache.ContainerID, cache.IfName)
+// portMappingsAllowed tells whether the policy allows the portMappings of the
+// pods of the namespace
+func portMappingsAllowed(policy *types.PortMappingNamespacePolicy, namespace string) bool {
+	if policy == nil {
+		return true
+	}
+	for _, denied := range policy.DeniedNamespaces {
+		if denied == namespace {
+			return false
+		}
+	}
+	if len(policy.AllowedNamespaces) == 0 {
+		return true
 	}
+	for _, allowed := range policy.AllowedNamespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
 
-	return cache.ContainerID, cache.IfName, nil
+// hasCapability tells whether the delegate config, or one of the plugins of a
+// conflist, enables the capability, without which libcni does not pass its
+// runtimeConfig
+func hasCapability(delegate *types.DelegateNetConf, capability string) bool {
+	if !delegate.ConfListPlugin {
+		return delegate.Conf.Capabilities[capability]
+	}
+	for _, plugin := range delegate.ConfList.Plugins {
+		if plugin.Capabilities[capability] {
+			return true
+		}
+	}
+	return false
 }
 
-func gatherValidAttachmentsFromCache(cniDir string) ([]cnitypes.GCAttachment, error) {
-	cacheDir := filepath.Join(cniDir, "results")
-	dirEntries, err := os.ReadDir(cacheDir)
-	if err != nil {
-		return nil, err
+// enableBandwidthCapability enables the bandwidth capability of the plugins
+// of pluginTypes, in the delegates with a bandwidth request which advertise
+// no bandwidth capability, so that libcni passes them the request
+func enableBandwidthCapability(delegates []*types.DelegateNetConf, pluginTypes []string) error {
+	bandwidthTypes := map[string]bool{}
+	for _, pluginType := range pluginTypes {
+		bandwidthTypes[pluginType] = true
 	}
 
-	allAttachments := []cnitypes.GCAttachment{}
-	for _, dirEnt := range dirEntries {
-		path := filepath.Join(cacheDir, dirEnt.Name())
-		delegatesBytes, err := os.ReadFile(path)
-		// if delegates cannot read that, skipped for now (because cannot recover).
-		if err != nil {
-			logging.Errorf("gatherSavedDelegates: cannot read %q, skipped to add", path)
+	for _, delegate := range delegates {
+		if delegate.BandwidthRequest == nil || hasCapability(delegate, "bandwidth") {
 			continue
 		}
-		containerID, ifName, err := getValidAttachmentFromCache(delegatesBytes)
-		if err != nil {
-			logging.Errorf("gatherSavedDelegates: cannot read cache, skipped to add: %v", err)
+		conf := map[string]interface{}{}
+		if err := json.Unmarshal(delegate.Bytes, &conf); err != nil {
+			return err
+		}
+		targets := []interface{}{conf}
+		if delegate.ConfListPlugin {
+			targets, _ = conf["plugins"].([]interface{})
+		}
+		enabled := false
+		for i, target := range targets {
+			plugin, ok := target.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid plugin in delegate %q", delegate.Name)
+			}
+			if pluginType, _ := plugin["type"].(string); !bandwidthTypes[pluginType] {
+				continue
+			}
+			if _, ok := plugin["capabilities"]; !ok {
+				plugin["capabilities"] = map[string]interface{}{}
+			}
+			capabilities, ok := plugin["capabilities"].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid capabilities in delegate %q", delegate.Name)
+			}
+			capabilities["bandwidth"] = true
+
+			// keep the parsed config in line, for hasCapability
+			parsed := &delegate.Conf
+			if delegate.ConfListPlugin {
+				parsed = delegate.ConfList.Plugins[i]
+			}
+			if parsed.Capabilities == nil {
+				parsed.Capabilities = map[string]bool{}
+			}
+			parsed.Capabilities["bandwidth"] = true
+			enabled = true
+		}
+		if !enabled {
 			continue
 		}
-		allAttachments = append(allAttachments, cnitypes.GCAttachment{ContainerID: containerID, IfName: ifName})
+		logging.Verbosef("enableBandwidthCapability: enabled the bandwidth capability of delegate %q", delegate.Name)
+		var err error
+		if delegate.Bytes, err = json.Marshal(conf); err != nil {
+			return err
+		}
 	}
-	return allAttachments, nil
+	return nil
 }
 
 func validateIfName(nsname string, ifname string) error {
@@ -197,12 +1280,88 @@ func validateIfName(nsname string, ifname string) error {
 	return err
 }
 
+// defaultNetworkResultReady reports whether the default network result has at
+// least one IP address and a default route
+func defaultNetworkResultReady(result cnitypes.Result) bool {
+	if result == nil {
+		return false
+	}
+	res, err := cni100.NewResultFromResult(result)
+	if err != nil {
+		logging.Debugf("defaultNetworkResultReady: failed to read result: %v", err)
+		return false
+	}
+	return len(res.IPs) > 0 && len(types.GetGatewayFromResult(res)) > 0
+}
+
+// defaultNetworkIfaceReady reports whether ifname in the pod network namespace
+// has at least one global unicast address and the namespace has a default route
+func defaultNetworkIfaceReady(nsname string, ifname string) (bool, error) {
+	podNs, err := ns.GetNS(nsname)
+	if err != nil {
+		return false, err
+	}
+	defer podNs.Close()
+
+	ready := false
+	err = podNs.Do(func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(ifname)
+		if err != nil {
+			return err
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return err
+		}
+		hasIP := false
+		for _, addr := range addrs {
+			if addr.IP.IsGlobalUnicast() {
+				hasIP = true
+				break
+			}
+		}
+		if !hasIP {
+			return nil
+		}
+		routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+		if err != nil {
+			return err
+		}
+		for _, route := range routes {
+			if route.Dst == nil {
+				ready = true
+				break
+			}
+		}
+		return nil
+	})
+	return ready, err
+}
+
+// waitForDefaultNetwork waits until the default network is usable, judging
+// first by its CNI result and then by the state of the pod network namespace
+func waitForDefaultNetwork(nsname string, ifname string, result cnitypes.Result, timeout time.Duration) error {
+	if defaultNetworkResultReady(result) {
+		return nil
+	}
+	logging.Verbosef("waitForDefaultNetwork: result for %s has no IP or default route, waiting up to %v", ifname, timeout)
+
+	return wait.PollImmediate(shortPollDuration, timeout, func() (bool, error) {
+		ready, err := defaultNetworkIfaceReady(nsname, ifname)
+		if err != nil {
+			logging.Debugf("waitForDefaultNetwork: %s not ready yet: %v", ifname, err)
+			return false, nil
+		}
+		return ready, nil
+	})
+}
+
 func confAdd(rt *libcni.RuntimeConf, rawNetconf []byte, multusNetconf *types.NetConf, exec invoke.Exec) (cnitypes.Result, error) {
-	logging.Debugf("confAdd: %v, %s", rt, string(rawNetconf))
+	logging.Debugf("confAdd: %v", rt)
 	// In part, adapted from K8s pkg/kubelet/dockershim/network/cni/cni.go
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{multusNetconf.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, execWithEnvAllowlist(exec, multusNetconf.DelegateEnvAllowlist))
 
 	conf, err := libcni.ConfFromBytes(rawNetconf)
 	if err != nil {
@@ -218,11 +1377,11 @@ func confAdd(rt *libcni.RuntimeConf, rawNetconf []byte, multusNetconf *types.Net
 }
 
 func confCheck(rt *libcni.RuntimeConf, rawNetconf []byte, multusNetconf *types.NetConf, exec invoke.Exec) error {
-	logging.Debugf("confCheck: %v, %s", rt, string(rawNetconf))
+	logging.Debugf("confCheck: %v", rt)
 
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{multusNetconf.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, execWithEnvAllowlist(exec, multusNetconf.DelegateEnvAllowlist))
 
 	conf, err := libcni.ConfFromBytes(rawNetconf)
 	if err != nil {
@@ -238,11 +1397,11 @@ func confCheck(rt *libcni.RuntimeConf, rawNetconf []byte, multusNetconf *types.N
 }
 
 func confDel(rt *libcni.RuntimeConf, rawNetconf []byte, multusNetconf *types.NetConf, exec invoke.Exec) error {
-	logging.Debugf("confDel: %v, %s", rt, string(rawNetconf))
+	logging.Debugf("confDel: %v", rt)
 	// In part, adapted from K8s pkg/kubelet/dockershim/network/cni/cni.go
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{multusNetconf.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, execWithEnvAllowlist(exec, multusNetconf.DelegateEnvAllowlist))
 
 	conf, err := libcni.ConfFromBytes(rawNetconf)
 	if err != nil {
@@ -258,11 +1417,11 @@ func confDel(rt *libcni.RuntimeConf, rawNetconf []byte, multusNetconf *types.Net
 }
 
 func conflistAdd(rt *libcni.RuntimeConf, rawnetconflist []byte, multusNetconf *types.NetConf, exec invoke.Exec) (cnitypes.Result, error) {
-	logging.Debugf("conflistAdd: %v, %s", rt, string(rawnetconflist))
+	logging.Debugf("conflistAdd: %v", rt)
 	// In part, adapted from K8s pkg/kubelet/dockershim/network/cni/cni.go
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{multusNetconf.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, execWithEnvAllowlist(exec, multusNetconf.DelegateEnvAllowlist))
 
 	confList, err := libcni.ConfListFromBytes(rawnetconflist)
 	if err != nil {
@@ -278,11 +1437,11 @@ func conflistAdd(rt *libcni.RuntimeConf, rawnetconflist []byte, multusNetconf *t
 }
 
 func conflistCheck(rt *libcni.RuntimeConf, rawnetconflist []byte, multusNetconf *types.NetConf, exec invoke.Exec) error {
-	logging.Debugf("conflistCheck: %v, %s", rt, string(rawnetconflist))
+	logging.Debugf("conflistCheck: %v", rt)
 
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{multusNetconf.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, execWithEnvAllowlist(exec, multusNetconf.DelegateEnvAllowlist))
 
 	confList, err := libcni.ConfListFromBytes(rawnetconflist)
 	if err != nil {
@@ -298,11 +1457,11 @@ func conflistCheck(rt *libcni.RuntimeConf, rawnetconflist []byte, multusNetconf
 }
 
 func conflistDel(rt *libcni.RuntimeConf, rawnetconflist []byte, multusNetconf *types.NetConf, exec invoke.Exec) error {
-	logging.Debugf("conflistDel: %v, %s", rt, string(rawnetconflist))
+	logging.Debugf("conflistDel: %v", rt)
 	// In part, adapted from K8s pkg/kubelet/dockershim/network/cni/cni.go
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{multusNetconf.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, multusNetconf.CNIDir, execWithEnvAllowlist(exec, multusNetconf.DelegateEnvAllowlist))
 
 	confList, err := libcni.ConfListFromBytes(rawnetconflist)
 	if err != nil {
@@ -317,9 +1476,164 @@ func conflistDel(rt *libcni.RuntimeConf, rawnetconflist []byte, multusNetconf *t
 	return err
 }
 
+// StderrExec is implemented by invoke.Exec implementations which can return a
+// copy of themselves that also writes the plugin stderr to the given writer.
+type StderrExec interface {
+	invoke.Exec
+	WithStderr(stderr io.Writer) invoke.Exec
+}
+
+// execWithStderr returns an exec that copies the delegate stderr to w, or the
+// given exec unchanged if it cannot do so
+func execWithStderr(exec invoke.Exec, w io.Writer) invoke.Exec {
+	switch e := exec.(type) {
+	case nil:
+		// same as the libcni default, plus w
+		return &invoke.DefaultExec{
+			RawExec:       &invoke.RawExec{Stderr: io.MultiWriter(os.Stderr, w)},
+			PluginDecoder: cniversion.PluginDecoder{},
+		}
+	case StderrExec:
+		return e.WithStderr(w)
+	}
+	return exec
+}
+
+// configDumpExec writes the config passed to the delegate plugins on ADD,
+// i.e. after the runtimeConfig injection of libcni, in
+// <dir>/<containerID>/<ifName>-<plugin index>.json
+type configDumpExec struct {
+	invoke.Exec
+	dir         string
+	containerID string
+	ifName      string
+	index       int
+}
+
+// execWithConfigDump returns an exec that dumps the delegate configs in dir
+// at debug log level, or the given exec unchanged otherwise
+func execWithConfigDump(exec invoke.Exec, dir string, rt *libcni.RuntimeConf) invoke.Exec {
+	if dir == "" || logging.GetLoggingLevel() < logging.DebugLevel {
+		return exec
+	}
+	if exec == nil {
+		// same as the libcni default
+		exec = &invoke.DefaultExec{
+			RawExec:       &invoke.RawExec{Stderr: os.Stderr},
+			PluginDecoder: cniversion.PluginDecoder{},
+		}
+	}
+	return &configDumpExec{Exec: exec, dir: dir, containerID: rt.ContainerID, ifName: rt.IfName}
+}
+
+// ExecPlugin dumps the config of ADD and executes the plugin
+func (e *configDumpExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	for _, env := range environ {
+		if env == "CNI_COMMAND=ADD" {
+			path := filepath.Join(e.dir, e.containerID, fmt.Sprintf("%s-%d.json", e.ifName, e.index))
+			e.index++
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				logging.Verbosef("warning: failed to dump the config of %s: %v", pluginPath, err)
+			} else if err := os.WriteFile(path, stdinData, 0600); err != nil {
+				logging.Verbosef("warning: failed to dump the config of %s: %v", pluginPath, err)
+			}
+			break
+		}
+	}
+	return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+// removeDelegateConfigDump removes the delegate configs dumped for the container
+func removeDelegateConfigDump(dir, containerID string) {
+	if err := os.RemoveAll(filepath.Join(dir, containerID)); err != nil {
+		logging.Verbosef("warning: failed to remove the delegate configs dumped for container %s: %v", containerID, err)
+	}
+}
+
+// envAllowlistExec passes only the CNI_* variables and the allowed ones of
+// the environment to the delegates
+type envAllowlistExec struct {
+	invoke.Exec
+	allowed map[string]bool
+}
+
+// ExecPlugin executes the plugin with the filtered environment
+func (e *envAllowlistExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	filtered := make([]string, 0, len(environ))
+	for _, env := range environ {
+		name := strings.SplitN(env, "=", 2)[0]
+		if strings.HasPrefix(name, "CNI_") || e.allowed[name] {
+			filtered = append(filtered, env)
+		}
+	}
+	return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, filtered)
+}
+
+// execWithEnvAllowlist returns an exec that filters the delegate environment
+// with allowlist, or the given exec unchanged if allowlist is not set
+func execWithEnvAllowlist(exec invoke.Exec, allowlist []string) invoke.Exec {
+	if allowlist == nil {
+		return exec
+	}
+	if exec == nil {
+		// same as the libcni default
+		exec = &invoke.DefaultExec{
+			RawExec:       &invoke.RawExec{Stderr: os.Stderr},
+			PluginDecoder: cniversion.PluginDecoder{},
+		}
+	}
+	allowed := map[string]bool{}
+	for _, name := range allowlist {
+		allowed[name] = true
+	}
+	return &envAllowlistExec{Exec: exec, allowed: allowed}
+}
+
+// stderrBuffer keeps the first maxDelegateStderr bytes written to it
+type stderrBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	if room := maxDelegateStderr - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// String returns the kept stderr on a single line, with non-printable
+// characters removed
+func (b *stderrBuffer) String() string {
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return ' '
+		case !unicode.IsPrint(r) || r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, b.Buffer.String())
+	s = strings.TrimSpace(s)
+	if b.truncated {
+		s += " [truncated]"
+	}
+	return s
+}
+
 // DelegateAdd ...
 func DelegateAdd(exec invoke.Exec, kubeClient *k8s.ClientInfo, pod *v1.Pod, delegate *types.DelegateNetConf, rt *libcni.RuntimeConf, multusNetconf *types.NetConf) (cnitypes.Result, error) {
-	logging.Debugf("DelegateAdd: %v, %v, %v", exec, delegate, rt)
+	return DelegateAddContext(context.Background(), exec, kubeClient, pod, delegate, rt, multusNetconf)
+}
+
+// DelegateAddContext is DelegateAdd reporting its warnings to the Warnings of ctx
+func DelegateAddContext(ctx context.Context, exec invoke.Exec, kubeClient *k8s.ClientInfo, pod *v1.Pod, delegate *types.DelegateNetConf, rt *libcni.RuntimeConf, multusNetconf *types.NetConf) (cnitypes.Result, error) {
+	logging.Debugf("DelegateAdd: %v, %s, %v", exec, string(delegate.Bytes), rt)
+	exec = execWithProxy(exec, multusNetconf.ExecProxySocket)
 
 	if err := validateIfName(rt.NetNS, rt.IfName); err != nil {
 		return nil, logging.Errorf("DelegateAdd: cannot set %q interface name to %q: %v", delegate.Conf.Type, rt.IfName, err)
@@ -359,65 +1673,208 @@ func DelegateAdd(exec invoke.Exec, kubeClient *k8s.ClientInfo, pod *v1.Pod, dele
 
 	var result cnitypes.Result
 	var err error
+	stderr := &stderrBuffer{}
+	exec = execWithStderr(exec, stderr)
+	// the config of a delegate with a Secret config is never dumped
+	if delegate.SecretConfig == nil {
+		exec = execWithConfigDump(exec, multusNetconf.DelegateConfigDumpDir, rt)
+	}
+	confBytes, err := delegateConfBytes(delegate)
+	if err != nil {
+		return nil, logging.Errorf("DelegateAdd: failed to merge the secret config of delegate %q: %v", delegate.Name, err)
+	}
 	if delegate.ConfListPlugin {
-		result, err = conflistAdd(rt, delegate.Bytes, multusNetconf, exec)
+		result, err = conflistAdd(rt, confBytes, multusNetconf, exec)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		result, err = confAdd(rt, delegate.Bytes, multusNetconf, exec)
+		result, err = confAdd(rt, confBytes, multusNetconf, exec)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	var cniConfName string
+	if delegate.ConfListPlugin {
+		cniConfName = delegate.ConfList.Name
+	} else {
+		cniConfName = delegate.Conf.Name
+	}
+
+	if delegate.SecretConfig != nil {
+		if err := scrubCachedConfig(multusNetconf.CNIDir, cniConfName, rt, delegate); err != nil {
+			logging.Verbosef("warning: failed to remove the secret config of delegate %q from the result cache: %v", delegate.Name, err)
+		}
+	}
+	if multusNetconf.ResultCacheDir != "" {
+		if err := copyResultCache(multusNetconf.CNIDir, multusNetconf.ResultCacheDir, cniConfName, rt); err != nil {
+			logging.Verbosef("warning: failed to copy the result of delegate %q to %s: %v", delegate.Name, multusNetconf.ResultCacheDir, err)
+		}
+	}
+
+	// the plugin succeeded, so anything it wrote to stderr is a warning
+	var stderrWarning string
+	if stderr.Len() > 0 {
+		stderrWarning = stderr.String()
+		warnf(ctx, "delegate %s(%s) wrote to stderr: %s", delegate.Name, cniConfName, stderrWarning)
+	}
+
 	if logging.GetLoggingLevel() >= logging.VerboseLevel {
 		data, _ := json.Marshal(result)
-		var cniConfName string
-		if delegate.ConfListPlugin {
-			cniConfName = delegate.ConfList.Name
-		} else {
-			cniConfName = delegate.Conf.Name
+
+		podUID := "unknownUID"
+		if pod != nil {
+			podUID = string(pod.ObjectMeta.UID)
+		}
+		logging.Verbosef("Add: %s:%s:%s:%s(%s):%s %s", rt.Args[1][1], rt.Args[2][1], podUID, delegate.Name, cniConfName, rt.IfName, string(data))
+	}
+
+	res, err := cni100.NewResultFromResult(result)
+	if err != nil {
+		logging.Errorf("DelegateAdd: error converting result: %v", err)
+		return result, nil
+	}
+
+	if pod != nil {
+		// check Interfaces and IPs because some CNI plugin just return empty result
+		if (res.Interfaces != nil || res.IPs != nil) && sendsPerInterfaceEvents(multusNetconf) {
+			// send kubernetes events
+			msg := "Add " + addedInterfaceMessage(rt.IfName, res, delegate.Name)
+			if stderrWarning != "" {
+				msg += fmt.Sprintf(" (stderr: %s)", stderrWarning)
+			}
+			kubeClient.Eventf(pod, v1.EventTypeNormal, "AddedInterface", "%s", msg)
+		}
+	} else if multusNetconf.PreferCachedDelegates && kubeClient != nil {
+		// the pod is not read when its cached delegates are reused
+		logging.Debugf("DelegateAdd: pod %s/%s not read with preferCachedDelegates, no AddedInterface event for %s", rt.Args[1][1], rt.Args[2][1], rt.IfName)
+	} else {
+		// for further debug https://github.com/k8snetworkplumbingwg/multus-cni/issues/481
+		logging.Errorf("DelegateAdd: pod nil pointer: namespace: %s, name: %s, container id: %s, pod: %v", rt.Args[1][1], rt.Args[2][1], rt.Args[3][1], pod)
+	}
+	return result, nil
+}
+
+// validateResult checks that the result of a delegate is consistent: the IPs
+// refer to interfaces of the result, and the addresses, gateways and routes
+// are well-formed and of the same IP family
+func validateResult(result cnitypes.Result) error {
+	if result == nil {
+		return nil
+	}
+	res, err := cni100.NewResultFromResult(result)
+	if err != nil {
+		return fmt.Errorf("cannot convert the result: %v", err)
+	}
+	for i, ip := range res.IPs {
+		if ip.Interface != nil && (*ip.Interface < 0 || *ip.Interface >= len(res.Interfaces)) {
+			return fmt.Errorf("IP %d refers to interface index %d, but the result has %d interfaces", i, *ip.Interface, len(res.Interfaces))
 		}
+		if !validIPNet(ip.Address) {
+			return fmt.Errorf("IP %d has an invalid address %q", i, ip.Address.String())
+		}
+		if ip.Gateway != nil && isIPv4(ip.Gateway) != isIPv4(ip.Address.IP) {
+			return fmt.Errorf("IP %d has gateway %s, which is not of the family of address %s", i, ip.Gateway, ip.Address.String())
+		}
+	}
+	for i, route := range res.Routes {
+		if route == nil || !validIPNet(route.Dst) {
+			return fmt.Errorf("route %d has an invalid destination", i)
+		}
+		// an IPv4 route may have an IPv6 gateway (RFC 5549), not the reverse
+		if route.GW != nil && isIPv4(route.GW) && !isIPv4(route.Dst.IP) {
+			return fmt.Errorf("route %d to %s has IPv4 gateway %s", i, route.Dst.String(), route.GW)
+		}
+	}
+	return nil
+}
+
+// validIPNet reports whether ipNet has an IP and a mask of the same family
+func validIPNet(ipNet net.IPNet) bool {
+	if ipNet.IP == nil {
+		return false
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits == 0 && ones == 0 {
+		return false
+	}
+	if isIPv4(ipNet.IP) {
+		return bits == 8*net.IPv4len
+	}
+	return bits == 8*net.IPv6len
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
 
-		podUID := "unknownUID"
-		if pod != nil {
-			podUID = string(pod.ObjectMeta.UID)
+// highestCNIVersion returns the highest of the CNI versions, all of which the
+// results of these versions can be converted up to
+func highestCNIVersion(versions []string) (string, error) {
+	highest := ""
+	for _, version := range versions {
+		if highest == "" {
+			highest = version
+			continue
+		}
+		higher, err := cniversion.GreaterThanOrEqualTo(version, highest)
+		if err != nil {
+			return "", err
+		}
+		if higher {
+			highest = version
 		}
-		logging.Verbosef("Add: %s:%s:%s:%s(%s):%s %s", rt.Args[1][1], rt.Args[2][1], podUID, delegate.Name, cniConfName, rt.IfName, string(data))
 	}
+	return highest, nil
+}
 
-	// get IP addresses from result
-	ips := []string{}
+// sortResultIPs orders the IPv4 and IPv6 addresses of the result as
+// preferred. The sort is stable, so the addresses of a family keep their
+// delegate order and each interface gets its addresses in the preferred order.
+func sortResultIPs(result cnitypes.Result, preference string) (cnitypes.Result, error) {
+	if result == nil || preference == "" || preference == types.IPFamilyPreferenceAsIs {
+		return result, nil
+	}
 	res, err := cni100.NewResultFromResult(result)
 	if err != nil {
-		logging.Errorf("DelegateAdd: error converting result: %v", err)
-		return result, nil
+		return nil, err
 	}
+	preferIPv4 := preference == types.IPFamilyPreferenceIPv4
+	sort.SliceStable(res.IPs, func(i, j int) bool {
+		iIsIPv4 := res.IPs[i].Address.IP.To4() != nil
+		jIsIPv4 := res.IPs[j].Address.IP.To4() != nil
+		return iIsIPv4 != jIsIPv4 && iIsIPv4 == preferIPv4
+	})
+	if res.Version() == result.Version() {
+		return res, nil
+	}
+	return res.GetAsVersion(result.Version())
+}
+
+// sendsPerInterfaceEvents reports whether DelegateAdd sends an AddedInterface
+// event for each interface it adds
+func sendsPerInterfaceEvents(conf *types.NetConf) bool {
+	return conf == nil || conf.InterfaceEvents == "" || conf.InterfaceEvents == types.InterfaceEventsPerInterface
+}
+
+// addedInterfaceMessage describes an added interface for AddedInterface events
+func addedInterfaceMessage(ifName string, res *cni100.Result, delegateName string) string {
+	ips := []string{}
 	for _, ip := range res.IPs {
 		ips = append(ips, ip.Address.String())
 	}
-
-	if pod != nil {
-		// check Interfaces and IPs because some CNI plugin just return empty result
-		if res.Interfaces != nil || res.IPs != nil {
-			// send kubernetes events
-			if delegate.Name != "" {
-				kubeClient.Eventf(pod, v1.EventTypeNormal, "AddedInterface", "Add %s %v from %s", rt.IfName, ips, delegate.Name)
-			} else {
-				kubeClient.Eventf(pod, v1.EventTypeNormal, "AddedInterface", "Add %s %v", rt.IfName, ips)
-			}
-		}
-	} else {
-		// for further debug https://github.com/k8snetworkplumbingwg/multus-cni/issues/481
-		logging.Errorf("DelegateAdd: pod nil pointer: namespace: %s, name: %s, container id: %s, pod: %v", rt.Args[1][1], rt.Args[2][1], rt.Args[3][1], pod)
+	msg := fmt.Sprintf("%s %v", ifName, ips)
+	if delegateName != "" {
+		msg += fmt.Sprintf(" from %s", delegateName)
 	}
-	return result, nil
+	return msg
 }
 
 // DelegateCheck ...
 func DelegateCheck(exec invoke.Exec, delegateConf *types.DelegateNetConf, rt *libcni.RuntimeConf, multusNetconf *types.NetConf) error {
-	logging.Debugf("DelegateCheck: %v, %v, %v", exec, delegateConf, rt)
+	logging.Debugf("DelegateCheck: %v, %s, %v", exec, string(delegateConf.Bytes), rt)
+	exec = execWithProxy(exec, multusNetconf.ExecProxySocket)
 
 	if logging.GetLoggingLevel() >= logging.VerboseLevel {
 		var cniConfName string
@@ -429,14 +1886,17 @@ func DelegateCheck(exec invoke.Exec, delegateConf *types.DelegateNetConf, rt *li
 		logging.Verbosef("Check: %s:%s:%s(%s):%s %s", rt.Args[1][1], rt.Args[2][1], delegateConf.Name, cniConfName, rt.IfName, string(delegateConf.Bytes))
 	}
 
-	var err error
+	confBytes, err := delegateConfBytes(delegateConf)
+	if err != nil {
+		return logging.Errorf("DelegateCheck: failed to merge the secret config of delegate %q: %v", delegateConf.Name, err)
+	}
 	if delegateConf.ConfListPlugin {
-		err = conflistCheck(rt, delegateConf.Bytes, multusNetconf, exec)
+		err = conflistCheck(rt, confBytes, multusNetconf, exec)
 		if err != nil {
 			return logging.Errorf("DelegateCheck: error invoking ConflistCheck - %q: %v", delegateConf.ConfList.Name, err)
 		}
 	} else {
-		err = confCheck(rt, delegateConf.Bytes, multusNetconf, exec)
+		err = confCheck(rt, confBytes, multusNetconf, exec)
 		if err != nil {
 			return logging.Errorf("DelegateCheck: error invoking DelegateCheck - %q: %v", delegateConf.Conf.Type, err)
 		}
@@ -447,15 +1907,16 @@ func DelegateCheck(exec invoke.Exec, delegateConf *types.DelegateNetConf, rt *li
 
 // DelegateDel ...
 func DelegateDel(exec invoke.Exec, pod *v1.Pod, delegateConf *types.DelegateNetConf, rt *libcni.RuntimeConf, multusNetconf *types.NetConf) error {
-	logging.Debugf("DelegateDel: %v, %v, %v, %v", exec, pod, delegateConf, rt)
+	logging.Debugf("DelegateDel: %v, %v, %s, %v", exec, pod, string(delegateConf.Bytes), rt)
+	exec = execWithProxy(exec, multusNetconf.ExecProxySocket)
 
+	var confName string
+	if delegateConf.ConfListPlugin {
+		confName = delegateConf.ConfList.Name
+	} else {
+		confName = delegateConf.Conf.Name
+	}
 	if logging.GetLoggingLevel() >= logging.VerboseLevel {
-		var confName string
-		if delegateConf.ConfListPlugin {
-			confName = delegateConf.ConfList.Name
-		} else {
-			confName = delegateConf.Conf.Name
-		}
 		podUID := "unknownUID"
 		if pod != nil {
 			podUID = string(pod.ObjectMeta.UID)
@@ -463,34 +1924,110 @@ func DelegateDel(exec invoke.Exec, pod *v1.Pod, delegateConf *types.DelegateNetC
 		logging.Verbosef("Del: %s:%s:%s:%s:%s %s", rt.Args[1][1], rt.Args[2][1], podUID, confName, rt.IfName, string(delegateConf.Bytes))
 	}
 
-	var err error
+	confBytes, err := delegateConfBytes(delegateConf)
+	if err != nil {
+		return logging.Errorf("DelegateDel: failed to merge the secret config of delegate %q: %v", delegateConf.Name, err)
+	}
 	if delegateConf.ConfListPlugin {
-		err = conflistDel(rt, delegateConf.Bytes, multusNetconf, exec)
+		err = conflistDel(rt, confBytes, multusNetconf, exec)
 		if err != nil {
 			return logging.Errorf("DelegateDel: error invoking ConflistDel - %q: %v", delegateConf.ConfList.Name, err)
 		}
 	} else {
-		err = confDel(rt, delegateConf.Bytes, multusNetconf, exec)
+		err = confDel(rt, confBytes, multusNetconf, exec)
 		if err != nil {
 			return logging.Errorf("DelegateDel: error invoking DelegateDel - %q: %v", delegateConf.Conf.Type, err)
 		}
 	}
 
+	if multusNetconf.ResultCacheDir != "" {
+		if err := removeResultCache(multusNetconf.CNIDir, multusNetconf.ResultCacheDir, confName, rt); err != nil {
+			logging.Verbosef("warning: failed to remove the result of delegate %q from %s: %v", delegateConf.Name, multusNetconf.ResultCacheDir, err)
+		}
+	}
+
 	return err
 }
 
-// delPlugins deletes plugins in reverse order from lastdIdx
-// Uses netRt as base RuntimeConf (coming from NetConf) but merges it
-// with each of the delegates' configuration
-func delPlugins(exec invoke.Exec, pod *v1.Pod, args *skel.CmdArgs, k8sArgs *types.K8sArgs, delegates []*types.DelegateNetConf, lastIdx int, netRt *types.RuntimeConfig, multusNetconf *types.NetConf) error {
-	logging.Debugf("delPlugins: %v, %v, %v, %v, %v, %d, %v", exec, pod, args, k8sArgs, delegates, lastIdx, netRt)
+// delegateAddOrder returns the indexes of delegates in the order they are
+// added. The master plugin goes first, unless defaultNetworkLast asks for it
+// to be added after all the other delegates.
+func delegateAddOrder(delegates []*types.DelegateNetConf, multusNetconf *types.NetConf) []int {
+	order := make([]int, 0, len(delegates))
+	var masters []int
+	for idx, delegate := range delegates {
+		if delegate.MasterPlugin && multusNetconf != nil && multusNetconf.DefaultNetworkLast {
+			masters = append(masters, idx)
+			continue
+		}
+		order = append(order, idx)
+	}
+	return append(order, masters...)
+}
+
+// teardownOrder returns the names of the delegates to delete first, from the
+// teardown-order annotation of the pod if any, otherwise from teardownOrder
+func teardownOrder(conf *types.NetConf, pod *v1.Pod) []string {
+	if pod != nil {
+		if annot, ok := pod.Annotations[teardownOrderAnnot]; ok {
+			var names []string
+			for _, name := range strings.Split(annot, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+			return names
+		}
+	}
+	if conf == nil {
+		return nil
+	}
+	return conf.TeardownOrder
+}
+
+// delegateDelOrder returns the indexes of the delegates added up to position
+// lastPos of addOrder, in the order they are deleted: first the ones named in
+// teardown, in that order, then the others in reverse ADD order. A name is
+// the interface name of a delegate, or its network name.
+func delegateDelOrder(delegates []*types.DelegateNetConf, addOrder []int, lastPos int, defaultIfName string, teardown []string) []int {
+	pending := make([]int, 0, lastPos+1)
+	for pos := lastPos; pos >= 0; pos-- {
+		pending = append(pending, addOrder[pos])
+	}
+
+	order := make([]int, 0, len(pending))
+	for _, name := range teardown {
+		if name == "" {
+			continue
+		}
+		for i, idx := range pending {
+			delegate := delegates[idx]
+			if name == getIfname(delegate, defaultIfName, idx) || name == delegate.Name ||
+				name == delegate.Conf.Name || (delegate.ConfListPlugin && name == delegate.ConfList.Name) {
+				order = append(order, idx)
+				pending = append(pending[:i], pending[i+1:]...)
+				break
+			}
+		}
+	}
+	return append(order, pending...)
+}
+
+// delPlugins deletes the delegates added up to position lastPos of their ADD
+// order, in reverse order unless a teardown order is set
+func delPlugins(ctx context.Context, exec invoke.Exec, pod *v1.Pod, args *skel.CmdArgs, k8sArgs *types.K8sArgs, delegates []*types.DelegateNetConf, lastPos int, netRt *types.RuntimeConfig, multusNetconf *types.NetConf) error {
+	logging.Debugf("delPlugins: %v, %v, %v, %v, %v, %d, %v", exec, pod, args, k8sArgs, delegates, lastPos, netRt)
 
 	var errorstrings []string
-	for idx := lastIdx; idx >= 0; idx-- {
+	addOrder := delegateAddOrder(delegates, multusNetconf)
+	for _, idx := range delegateDelOrder(delegates, addOrder, lastPos, args.IfName, teardownOrder(multusNetconf, pod)) {
 		ifName := getIfname(delegates[idx], args.IfName, idx)
 		rt, cniDeviceInfoPath := types.CreateCNIRuntimeConf(args, k8sArgs, ifName, netRt, delegates[idx])
 		// Attempt to delete all but do not error out, instead, collect all errors.
-		if err := DelegateDel(exec, pod, delegates[idx], rt, multusNetconf); err != nil {
+		_, delegateSpan := startDelegateSpan(ctx, "DEL", delegates[idx].Name, ifName)
+		err := DelegateDel(exec, pod, delegates[idx], rt, multusNetconf)
+		tracing.EndSpan(delegateSpan, err)
+		if err != nil {
 			errorstrings = append(errorstrings, err.Error())
 		}
 		if cniDeviceInfoPath != "" {
@@ -511,6 +2048,58 @@ func delPlugins(exec invoke.Exec, pod *v1.Pod, args *skel.CmdArgs, k8sArgs *type
 	return nil
 }
 
+// startOperationSpan starts the span of a CNI operation. Its parent is the
+// span in ctx or, with the annotation trace context source, the one in the pod
+// annotations.
+func startOperationSpan(ctx context.Context, cmd string, conf *types.NetConf, pod *v1.Pod, args *skel.CmdArgs, k8sArgs *types.K8sArgs) (context.Context, trace.Span) {
+	if conf.Tracing != nil && conf.Tracing.TraceContextSource == tracing.SourceAnnotation && pod != nil &&
+		!trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = tracing.ContextFromAnnotations(ctx, pod.Annotations)
+	}
+	return tracing.Tracer().Start(ctx, "multus "+cmd, trace.WithAttributes(
+		tracing.PodNamespaceKey.String(string(k8sArgs.K8S_POD_NAMESPACE)),
+		tracing.PodNameKey.String(string(k8sArgs.K8S_POD_NAME)),
+		tracing.ContainerIDKey.String(args.ContainerID),
+	))
+}
+
+// startDelegateSpan starts the span of a delegate invocation
+func startDelegateSpan(ctx context.Context, cmd, netName, ifName string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "delegate "+cmd, trace.WithAttributes(
+		tracing.NetworkKey.String(netName),
+		tracing.IfNameKey.String(ifName),
+	))
+}
+
+// delegateTraceEntry records a single delegate invocation of a CmdAdd
+type delegateTraceEntry struct {
+	name   string
+	ifName string
+	start  time.Time
+	end    time.Time
+	err    error
+}
+
+func (e delegateTraceEntry) String() string {
+	status := "ok"
+	if e.err != nil {
+		status = fmt.Sprintf("failed: %v", e.err)
+	}
+	return fmt.Sprintf("%s(%s) start=%s end=%s took=%v %s", e.name, e.ifName,
+		e.start.Format(time.RFC3339Nano), e.end.Format(time.RFC3339Nano), e.end.Sub(e.start), status)
+}
+
+// delegateTrace is the ordered list of delegates invoked by a CmdAdd
+type delegateTrace []delegateTraceEntry
+
+func (t delegateTrace) String() string {
+	entries := make([]string, 0, len(t))
+	for idx, e := range t {
+		entries = append(entries, fmt.Sprintf("[%d] %s", idx, e))
+	}
+	return strings.Join(entries, ", ")
+}
+
 func cmdErr(k8sArgs *types.K8sArgs, format string, args ...interface{}) error {
 	prefix := "Multus: "
 	if k8sArgs != nil {
@@ -617,16 +2206,28 @@ func GetPod(kubeClient *k8s.ClientInfo, k8sArgs *types.K8sArgs, isDel bool) (*v1
 
 // CmdAdd ...
 func CmdAdd(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (cnitypes.Result, error) {
+	return CmdAddContext(context.Background(), args, exec, kubeClient)
+}
+
+// CmdAddContext is CmdAdd, traced as a child of the span in ctx, if any
+func CmdAddContext(ctx context.Context, args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (_ cnitypes.Result, err error) {
 	n, err := types.LoadNetConf(args.StdinData)
 	logging.Debugf("CmdAdd: %v, %v, %v", args, exec, kubeClient)
 	if err != nil {
 		return nil, cmdErr(nil, "error loading netconf: %v", err)
 	}
+	exec = execWithProxy(exec, n.ExecProxySocket)
+
+	n.CNIDir, err = resolveCNIDir(n.CNIDir)
+	if err != nil {
+		return nil, cmdErr(nil, "error resolving cniDir: %v", err)
+	}
 
 	kubeClient, err = k8s.GetK8sClient(n.Kubeconfig, kubeClient)
 	if err != nil {
 		return nil, cmdErr(nil, "error getting k8s client: %v", err)
 	}
+	kubeClient = kubeClient.WithAPIRequestPolicy(time.Duration(n.APIRequestTimeoutSeconds)*time.Second, n.APIRequestRetries)
 
 	k8sArgs, err := k8s.GetK8sArgs(args)
 	if err != nil {
@@ -639,61 +2240,233 @@ func CmdAdd(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (c
 		}
 	}
 
-	pod, err := GetPod(kubeClient, k8sArgs, false)
-	if err != nil {
-		return nil, err
+	// the delegates of a previous ADD are reused, if asked to, so that the
+	// container can be re-added while the API server is unreachable: with
+	// preferCachedDelegates, they are looked up before the pod, which is
+	// then not needed
+	var kc *k8s.ClientInfo
+	var pod *v1.Pod
+	useCacheConf := false
+	if !n.DisableDelegateCache && n.PreferCachedDelegates {
+		useCacheConf = loadPreferredCachedDelegates(args, k8sArgs, n)
+	}
+	if !useCacheConf {
+		pod, err = GetPod(kubeClient, k8sArgs, false)
+		if err != nil {
+			return nil, err
+		}
+		if !n.DisableDelegateCache && preferCachedDelegates(n, pod) {
+			useCacheConf = loadPreferredCachedDelegates(args, k8sArgs, n)
+		}
+	}
+	if useCacheConf {
+		if err := loadSecretConfigs(kubeClient, n.Delegates); err != nil {
+			return nil, cmdErr(k8sArgs, "error loading the secret configs of the cached delegates: %v", err)
+		}
+		kc = kubeClient
 	}
 
+	ctx, span := startOperationSpan(ctx, "ADD", n, pod, args, k8sArgs)
+	defer func() { tracing.EndSpan(span, err) }()
+	defer func() { writeAuditRecord(n.AuditLogFile, "ADD", args, k8sArgs, n.Delegates, err) }()
+
 	// resourceMap holds Pod device allocation information; only initizized if CRD contains 'resourceName' annotation.
 	// This will only be initialized once and all delegate objects can reference this to look up device info.
 	var resourceMap map[string]*types.ResourceInfo
 
-	if n.ClusterNetwork != "" {
-		resourceMap, err = k8s.GetDefaultNetworks(pod, n, kubeClient, resourceMap)
+	if !useCacheConf {
+		if n.ClusterNetwork != "" {
+			resourceMap, err = k8s.GetDefaultNetworks(pod, n, kubeClient, resourceMap)
+			if err != nil {
+				return nil, cmdErr(k8sArgs, "failed to get clusterNetwork/defaultNetworks: %v", err)
+			}
+		}
+
+		_, kc, err = k8s.TryLoadPodDelegates(pod, n, kubeClient, resourceMap)
 		if err != nil {
-			return nil, cmdErr(k8sArgs, "failed to get clusterNetwork/defaultNetworks: %v", err)
+			return nil, cmdErr(k8sArgs, "error loading k8s delegates k8s args: %v", err)
 		}
-		// First delegate is always the master plugin
-		n.Delegates[0].MasterPlugin = true
 	}
 
-	_, kc, err := k8s.TryLoadPodDelegates(pod, n, kubeClient, resourceMap)
-	if err != nil {
-		return nil, cmdErr(k8sArgs, "error loading k8s delegates k8s args: %v", err)
+	// only possible with allowNoDefaultNetwork
+	if len(n.Delegates) == 0 {
+		return nil, cmdErr(k8sArgs, "no delegate: the pod has no network attachment and there is no default network")
+	}
+
+	if err := checkSelfReference(n.Delegates); err != nil {
+		return nil, cmdErr(k8sArgs, "%v", err)
+	}
+
+	if err := assignDeterministicMACs(n.DeterministicMACs, pod, n.Delegates, n.CNIDir); err != nil {
+		return nil, cmdErr(k8sArgs, "%v", err)
+	}
+
+	if n.CheckHostIPConflicts {
+		if err := checkHostIPConflicts(n.Delegates); err != nil {
+			return nil, cmdErr(k8sArgs, "%v", err)
+		}
+	}
+
+	if err := checkPortMappingPolicy(args, k8sArgs, n); err != nil {
+		return nil, cmdErr(k8sArgs, "%v", err)
+	}
+
+	if n.AutoBandwidthCapability {
+		if err := enableBandwidthCapability(n.Delegates, n.BandwidthPluginTypes); err != nil {
+			return nil, cmdErr(k8sArgs, "error enabling the bandwidth capability: %v", err)
+		}
+	}
+
+	if n.NodeCNIArgsFile != "" {
+		if err := injectNodeCNIArgs(n.Delegates, n.NodeCNIArgsFile); err != nil {
+			return nil, cmdErr(k8sArgs, "%v", err)
+		}
+	}
+
+	if quota := namespaceInterfaceQuota(ctx); quota != nil {
+		namespace := string(k8sArgs.K8S_POD_NAMESPACE)
+		if err := quota.Reserve(namespace, args.ContainerID, secondaryInterfaces(n.Delegates)); err != nil {
+			return nil, cmdErr(k8sArgs, "%v", err)
+		}
+		defer func() {
+			if err != nil {
+				quota.Release(namespace, args.ContainerID)
+			}
+		}()
 	}
 
 	// cache the multus config
-	if err := saveDelegates(args.ContainerID, n.CNIDir, n.Delegates); err != nil {
-		return nil, cmdErr(k8sArgs, "error saving the delegates: %v", err)
+	if !n.DisableDelegateCache {
+		if err := saveDelegates(args.ContainerID, scratchCacheDir(n, k8sArgs), n.Delegates, cachePodUID(n, k8sArgs, pod)); err != nil {
+			return nil, cmdErr(k8sArgs, "error saving the delegates: %v", err)
+		}
+	}
+
+	// multus chained behind another plugin passes its prevResult on to the
+	// master plugin
+	if n.PrevResult != nil && len(n.Delegates) > 0 {
+		master := n.Delegates[masterPluginIndex(n.Delegates)]
+		if err := injectPrevResult(master, n.PrevResult); err != nil {
+			return nil, cmdErr(k8sArgs, "error passing the prevResult to delegate %q: %v", master.Name, err)
+		}
 	}
 
 	var result, tmpResult cnitypes.Result
-	var netStatus []nettypes.NetworkStatus
-	for idx, delegate := range n.Delegates {
-		ifName := getIfname(delegate, args.IfName, idx)
-		rt, cniDeviceInfoPath := types.CreateCNIRuntimeConf(args, k8sArgs, ifName, n.RuntimeConfig, delegate)
-		if cniDeviceInfoPath != "" && delegate.ResourceName != "" && delegate.DeviceID != "" {
-			err = nadutils.CopyDeviceInfoForCNIFromDP(cniDeviceInfoPath, delegate.ResourceName, delegate.DeviceID)
-			// Even if the filename is set, file may not be present. Ignore error,
-			// but log and in the future may need to filter on specific errors.
-			if err != nil {
-				logging.Debugf("CmdAdd: CopyDeviceInfoForCNIFromDP returned an error - err=%v", err)
+	// CNI versions of the delegate results, for resultCNIVersionTarget
+	var resultVersions []string
+	// network statuses are kept in delegate order, whatever the ADD order is
+	netStatuses := make([][]nettypes.NetworkStatus, len(n.Delegates))
+	var trace delegateTrace
+	var addedInterfaces []string
+	// MTU of the default network interface, for inheritDefaultMTU
+	var defaultMTU int
+	// conditional default-route requests, see conditionalDefaultRoute
+	var gatewayCandidates []*gatewayCandidate
+	defer func() {
+		logging.Verbosef("CmdAdd: delegate trace for %s/%s (%s): %s", k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, args.ContainerID, trace)
+	}()
+	addOrder := delegateAddOrder(n.Delegates, n)
+	summarizeDelegates(ctx, args.ContainerID, n.Delegates, addOrder, args.IfName)
+	prepared := make([]*preparedDelegate, len(addOrder))
+	// ADDs run ahead of their turn, in parallel, with parallelDelegates
+	parallelAdds := map[int]*delegateAdd{}
+	// last position whose delegate was added, to roll back from
+	lastAdded := -1
+	for pos, idx := range addOrder {
+		delegate := n.Delegates[idx]
+		if prepared[pos] == nil {
+			if prepared[pos], err = prepareDelegate(delegate, idx, args, k8sArgs, n, defaultMTU); err != nil {
+				_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, max(pos, lastAdded), n.RuntimeConfig, n)
+				return nil, cmdErr(k8sArgs, "%v", err)
+			}
+		}
+		netName, ifName, rt := prepared[pos].netName, prepared[pos].ifName, prepared[pos].rt
+
+		add, ok := parallelAdds[pos]
+		if !ok && n.ParallelDelegates && !delegate.MasterPlugin && pos+1 < len(addOrder) && !n.Delegates[addOrder[pos+1]].MasterPlugin {
+			// the secondary delegates up to the next master plugin, if any
+			end := pos + 1
+			for end+1 < len(addOrder) && !n.Delegates[addOrder[end+1]].MasterPlugin {
+				end++
+			}
+			for p := pos + 1; p <= end; p++ {
+				if prepared[p], err = prepareDelegate(n.Delegates[addOrder[p]], addOrder[p], args, k8sArgs, n, defaultMTU); err != nil {
+					_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, max(p, lastAdded), n.RuntimeConfig, n)
+					return nil, cmdErr(k8sArgs, "%v", err)
+				}
+			}
+			logging.Debugf("CmdAdd: adding the delegates %d to %d in parallel", pos, end)
+			var wg sync.WaitGroup
+			adds := make([]*delegateAdd, end-pos+1)
+			for p := pos; p <= end; p++ {
+				wg.Add(1)
+				go func(p int) {
+					defer wg.Done()
+					adds[p-pos] = addDelegate(ctx, exec, kubeClient, pod, n.Delegates[addOrder[p]], prepared[p], n)
+				}(p)
 			}
+			wg.Wait()
+			for p := pos; p <= end; p++ {
+				parallelAdds[p] = adds[p-pos]
+			}
+			add, lastAdded = parallelAdds[pos], end
+		} else if !ok {
+			add = addDelegate(ctx, exec, kubeClient, pod, delegate, prepared[pos], n)
 		}
+		lastAdded = max(pos, lastAdded)
 
-		// We collect the delegate netName for the cachefile name as well as following errors
-		netName := delegate.Conf.Name
-		if netName == "" {
-			netName = delegate.ConfList.Name
+		tmpResult, err = add.result, add.err
+		if add.entry != nil {
+			trace = append(trace, *add.entry)
+			logging.Debugf("CmdAdd: delegate %s", *add.entry)
 		}
-		tmpResult, err = DelegateAdd(exec, kubeClient, pod, delegate, rt, n)
 		if err != nil {
+			if add.entry != nil {
+				annotateAddFailure(kubeClient, pod, n, delegate, netName, ifName, err)
+			}
 			// If the add failed, tear down all networks we already added
 			// Ignore errors; DEL must be idempotent anyway
-			_ = delPlugins(exec, nil, args, k8sArgs, n.Delegates, idx, n.RuntimeConfig, n)
+			_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, lastAdded, n.RuntimeConfig, n)
 			return nil, cmdPluginErr(k8sArgs, netName, "error adding container to network %q: %v", netName, err)
 		}
 
+		if err := validateResult(tmpResult); err != nil {
+			_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, lastAdded, n.RuntimeConfig, n)
+			return nil, cmdPluginErr(k8sArgs, netName, "delegate %q returned an invalid result: %v", netName, err)
+		}
+		if tmpResult != nil {
+			resultVersions = append(resultVersions, tmpResult.Version())
+		}
+
+		if delegate.PostAddProbe != nil {
+			if err := runPostAddProbe(rt.NetNS, delegate.PostAddProbe); err != nil {
+				_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, lastAdded, n.RuntimeConfig, n)
+				return nil, cmdPluginErr(k8sArgs, netName, "post-ADD %s probe of %s from %q failed: %v", delegate.PostAddProbe.Protocol, delegate.PostAddProbe.Target, ifName, err)
+			}
+		}
+
+		tmpResult, err = sortResultIPs(tmpResult, n.IPFamilyPreference)
+		if err != nil {
+			_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, lastAdded, n.RuntimeConfig, n)
+			return nil, cmdPluginErr(k8sArgs, netName, "error ordering the IPs of network %q: %v", netName, err)
+		}
+		summarizeDelegateResult(ctx, netName, ifName, tmpResult)
+
+		if n.InheritDefaultMTU && delegate.MasterPlugin {
+			if defaultMTU = resultMTU(tmpResult, ifName); defaultMTU == 0 {
+				warnf(ctx, "the result of default network %q has no MTU for %s, secondary networks keep their own", netName, ifName)
+			}
+		}
+
+		// Hold secondary delegates until the default network is usable
+		if n.WaitForDefaultNetwork && delegate.MasterPlugin && pos < len(addOrder)-1 {
+			timeout := time.Duration(n.WaitForDefaultNetworkTimeout) * time.Second
+			if err := waitForDefaultNetwork(rt.NetNS, ifName, tmpResult, timeout); err != nil {
+				_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, lastAdded, n.RuntimeConfig, n)
+				return nil, cmdPluginErr(k8sArgs, netName, "default network %q has no IP address or default route after %v: %v", netName, timeout, err)
+			}
+		}
+
 		// Master plugin result is always used if present
 		if delegate.MasterPlugin || result == nil {
 			result = tmpResult
@@ -703,6 +2476,9 @@ func CmdAdd(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (c
 		if err != nil {
 			logging.Errorf("CmdAdd: failed to read result: %v, but proceed", err)
 		}
+		if res != nil && (res.Interfaces != nil || res.IPs != nil) {
+			addedInterfaces = append(addedInterfaces, addedInterfaceMessage(ifName, res, delegate.Name))
+		}
 
 		// check Interfaces and IPs because some CNI plugin does not create any interface
 		// and just returns empty result
@@ -745,7 +2521,7 @@ func CmdAdd(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (c
 
 			// Remove gateway if `default-route` network selection is specified
 			if deleteV4gateway || deleteV6gateway {
-				err = netutils.DeleteDefaultGW(args.Netns, ifName)
+				err = netutils.DeleteDefaultGW(rt.NetNS, ifName)
 				if err != nil {
 					return nil, cmdErr(k8sArgs, "error deleting default gateway: %v", err)
 				}
@@ -755,15 +2531,20 @@ func CmdAdd(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (c
 				}
 			}
 
-			// Here we'll set the default gateway which specified in `default-route` network selection
-			if adddefaultgateway {
-				err = netutils.SetDefaultGW(args.Netns, ifName, *delegate.GatewayRequest)
-				if err != nil {
-					return nil, cmdErr(k8sArgs, "error setting default gateway: %v", err)
-				}
-				err = netutils.AddDefaultGWCache(n.CNIDir, rt, netName, ifName, *delegate.GatewayRequest)
-				if err != nil {
-					return nil, cmdErr(k8sArgs, "error setting default gateway in cache: %v", err)
+			// Here we'll set the default gateway which specified in `default-route` network selection,
+			// or, if it is conditional, once the gateways of all the delegates can be probed
+			if adddefaultgateway && delegate.ConditionalGateway {
+				gatewayCandidates = append(gatewayCandidates, &gatewayCandidate{
+					netName:  netName,
+					ifName:   ifName,
+					rt:       rt,
+					gateways: *delegate.GatewayRequest,
+					delegate: delegate,
+					idx:      idx,
+				})
+			} else if adddefaultgateway {
+				if err := setDefaultGateway(n.CNIDir, rt, netName, ifName, *delegate.GatewayRequest); err != nil {
+					return nil, cmdErr(k8sArgs, "%v", err)
 				}
 			}
 		}
@@ -787,7 +2568,11 @@ func CmdAdd(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (c
 
 				// Append all returned statuses after dereferencing each
 				for _, status := range delegateNetStatuses {
-					netStatus = append(netStatus, *status)
+					status, err = redactNetworkStatus(status, n.StatusFieldRedactions)
+					if err != nil {
+						return nil, cmdErr(k8sArgs, "error redacting network status of %s: %v", delegate.Name, err)
+					}
+					netStatuses[idx] = append(netStatuses[idx], *status)
 				}
 			}
 		} else if devinfo != nil {
@@ -796,40 +2581,125 @@ func CmdAdd(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (c
 		}
 	}
 
+	if len(gatewayCandidates) > 0 {
+		chosen, reachable := selectDefaultGateway(gatewayCandidates)
+		if !reachable {
+			warnf(ctx, "no default-route gateway is reachable, using the one of network %q on %s", chosen.netName, chosen.ifName)
+		}
+		logging.Verbosef("CmdAdd: default route of %s/%s through %v on %s", k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, chosen.gateways, chosen.ifName)
+		if err := setDefaultGateway(n.CNIDir, chosen.rt, chosen.netName, chosen.ifName, chosen.gateways); err != nil {
+			return nil, cmdErr(k8sArgs, "%v", err)
+		}
+		filterUnchosenGateways(gatewayCandidates, chosen)
+		recordDefaultGateway(netStatuses, gatewayCandidates, chosen)
+	}
+
+	if n.PrevResult != nil && result != nil {
+		if result, err = mergePrevResult(ctx, n.PrevResult, result, n.RouteConflictPolicy); err != nil {
+			_ = delPlugins(ctx, exec, nil, args, k8sArgs, n.Delegates, len(n.Delegates)-1, n.RuntimeConfig, n)
+			return nil, cmdErr(k8sArgs, "error merging the prevResult: %v", err)
+		}
+	}
+
+	// report the result in the highest version of the delegate results, so
+	// that a newer secondary network does not lose the fields of its version
+	if n.ResultCNIVersionTarget == types.ResultCNIVersionTargetHighest && result != nil {
+		target, err := highestCNIVersion(resultVersions)
+		if err != nil {
+			return nil, cmdErr(k8sArgs, "error comparing the CNI versions of the delegate results %v: %v", resultVersions, err)
+		}
+		if target != result.Version() {
+			converted, err := result.GetAsVersion(target)
+			if err != nil {
+				return nil, cmdErr(k8sArgs, "error converting the result from CNI version %s to %s: %v", result.Version(), target, err)
+			}
+			logging.Debugf("CmdAdd: converted the result from CNI version %s to %s", result.Version(), target)
+			result = converted
+		}
+	}
+
+	// report the result in the configured version rather than the master plugin's one
+	if n.ResultCNIVersion != "" && result != nil {
+		converted, err := result.GetAsVersion(n.ResultCNIVersion)
+		if err != nil {
+			return nil, cmdErr(k8sArgs, "error converting the result from CNI version %s to %s: %v", result.Version(), n.ResultCNIVersion, err)
+		}
+		result = converted
+	}
+
 	// set the network status annotation in apiserver, only in case Multus as kubeconfig
 	if kubeClient != nil && kc != nil {
 		if !types.CheckSystemNamespaces(string(k8sArgs.K8S_POD_NAME), n.SystemNamespaces) {
+			var netStatus []nettypes.NetworkStatus
+			for _, statuses := range netStatuses {
+				netStatus = append(netStatus, statuses...)
+			}
 			err = k8s.SetNetworkStatus(kubeClient, k8sArgs, netStatus, n)
-			if err != nil {
+			if err != nil && useCacheConf {
+				// the cached delegates are used so that the API server is not needed
+				warnf(ctx, "failed to set the network status of container %s: %v", args.ContainerID, err)
+				err = nil
+			} else if err != nil {
 				if strings.Contains(err.Error(), "failed to query the pod") {
 					return nil, cmdErr(k8sArgs, "error setting the networks status, pod was already deleted: %v", err)
 				}
 				return nil, cmdErr(k8sArgs, "error setting the networks status: %v", err)
 			}
+			if n.NetworkStatusFile != "" {
+				if err := k8s.WriteNetworkStatusFile(n.NetworkStatusFile, string(k8sArgs.K8S_POD_UID), args.ContainerID, netStatus); err != nil {
+					warnf(ctx, "failed to write the network status of container %s: %v", args.ContainerID, err)
+				}
+			}
 		}
 	}
 
+	if n.InterfaceEvents == types.InterfaceEventsSummary && pod != nil && len(addedInterfaces) > 0 {
+		kubeClient.Eventf(pod, v1.EventTypeNormal, "AddedInterface", "Add %s", strings.Join(addedInterfaces, ", "))
+	}
+
 	return result, nil
 }
 
 // CmdCheck ...
 func CmdCheck(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) error {
+	return CmdCheckContext(context.Background(), args, exec, kubeClient)
+}
+
+// CmdCheckContext is CmdCheck, traced as a child of the span in ctx, if any
+func CmdCheckContext(ctx context.Context, args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (err error) {
 	in, err := types.LoadNetConf(args.StdinData)
 	logging.Debugf("CmdCheck: %v, %v, %v", args, exec, kubeClient)
 	if err != nil {
 		return err
 	}
+	exec = execWithProxy(exec, in.ExecProxySocket)
+
+	in.CNIDir, err = resolveCNIDir(in.CNIDir)
+	if err != nil {
+		return cmdErr(nil, "error resolving cniDir: %v", err)
+	}
 
 	k8sArgs, err := k8s.GetK8sArgs(args)
 	if err != nil {
 		return cmdErr(nil, "error getting k8s args: %v", err)
 	}
 
+	ctx, span := startOperationSpan(ctx, "CHECK", in, nil, args, k8sArgs)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if in.NodeCNIArgsFile != "" {
+		if err := injectNodeCNIArgs(in.Delegates, in.NodeCNIArgsFile); err != nil {
+			return cmdErr(k8sArgs, "%v", err)
+		}
+	}
+
 	for idx, delegate := range in.Delegates {
 		ifName := getIfname(delegate, args.IfName, idx)
 
 		rt, _ := types.CreateCNIRuntimeConf(args, k8sArgs, ifName, in.RuntimeConfig, delegate)
+		_, delegateSpan := startDelegateSpan(ctx, "CHECK", delegate.Name, ifName)
 		err = DelegateCheck(exec, delegate, rt, in)
+		tracing.EndSpan(delegateSpan, err)
 		if err != nil {
 			return err
 		}
@@ -840,16 +2710,36 @@ func CmdCheck(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo)
 
 // CmdDel ...
 func CmdDel(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) error {
+	return CmdDelContext(context.Background(), args, exec, kubeClient)
+}
+
+// CmdDelContext is CmdDel, traced as a child of the span in ctx, if any
+func CmdDelContext(ctx context.Context, args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) (err error) {
 	in, err := types.LoadNetConf(args.StdinData)
 	logging.Debugf("CmdDel: %v, %v, %v", args, exec, kubeClient)
 	if err != nil {
 		return err
 	}
+	exec = execWithProxy(exec, in.ExecProxySocket)
+
+	in.CNIDir, err = resolveCNIDir(in.CNIDir)
+	if err != nil {
+		return cmdErr(nil, "error resolving cniDir: %v", err)
+	}
 
 	netns, err := ns.GetNS(args.Netns)
 	if netns != nil {
 		defer netns.Close()
 	}
+	netnsGone := isNetnsGone(err)
+	if netnsGone {
+		// e.g. on a forced deletion of the pod: the delegates are deleted
+		// without a netns, at best effort, and the cache is cleaned up
+		logging.Verbosef("warning: netns %q of container %s is gone: %v", args.Netns, args.ContainerID, err)
+		delArgs := *args
+		delArgs.Netns = ""
+		args = &delArgs
+	}
 
 	k8sArgs, err := k8s.GetK8sArgs(args)
 	if err != nil {
@@ -871,6 +2761,7 @@ func CmdDel(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) er
 	if err != nil {
 		return cmdErr(nil, "error getting k8s client: %v", err)
 	}
+	kubeClient = kubeClient.WithAPIRequestPolicy(time.Duration(in.APIRequestTimeoutSeconds)*time.Second, in.APIRequestRetries)
 
 	pod, err := GetPod(kubeClient, k8sArgs, true)
 	if err != nil {
@@ -878,23 +2769,51 @@ func CmdDel(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) er
 		logging.Errorf("Multus: GetPod failed: %v, but continue to delete", err)
 	}
 
+	ctx, span := startOperationSpan(ctx, "DEL", in, pod, args, k8sArgs)
+	defer func() { tracing.EndSpan(span, err) }()
+	defer func() { writeAuditRecord(in.AuditLogFile, "DEL", args, k8sArgs, in.Delegates, err) }()
+
+	cacheDir := scratchCacheDir(in, k8sArgs)
+	if in.DelDeferSeconds > 0 && deferDelForNewerAdd(args.ContainerID, cacheDir, time.Duration(in.DelDeferSeconds)*time.Second) {
+		logging.Verbosef("warning: skipping DEL of container %s, a newer ADD of it came in within %d seconds", args.ContainerID, in.DelDeferSeconds)
+		return nil
+	}
+
+	if in.NetworkStatusFile != "" {
+		if err := k8s.RemoveNetworkStatusFile(in.NetworkStatusFile, string(k8sArgs.K8S_POD_UID), args.ContainerID); err != nil {
+			logging.Verbosef("warning: failed to remove the network status of container %s: %v", args.ContainerID, err)
+		}
+	}
+
+	if in.DelegateConfigDumpDir != "" {
+		removeDelegateConfigDump(in.DelegateConfigDumpDir, args.ContainerID)
+	}
+
 	// Read the cache to get delegates json for the pod
-	netconfBytes, path, err := consumeScratchNetConf(args.ContainerID, in.CNIDir)
+	var netconfBytes []byte
+	var path string
+	if in.DisableDelegateCache {
+		// the delegates are resolved again, as if the cache was lost
+		err = os.ErrNotExist
+	} else {
+		netconfBytes, path, err = consumeScratchNetConf(args.ContainerID, cacheDir)
+	}
 	useCacheConf := false
 	if err == nil {
-		in.Delegates = []*types.DelegateNetConf{}
-		if err := json.Unmarshal(netconfBytes, &in.Delegates); err != nil {
+		delegates, podUID, err := loadCachedDelegatesAndPodUID(netconfBytes)
+		if err != nil {
 			logging.Errorf("Multus: failed to load netconf: %v", err)
+		} else if podUID != "" && k8sArgs.K8S_POD_UID != "" && podUID != string(k8sArgs.K8S_POD_UID) {
+			// the container ID was reused: the cache and the interfaces it
+			// describes belong to another pod
+			return cmdErr(k8sArgs, "refusing to delete the cached delegates of container %s: they belong to pod UID %s, not %s", args.ContainerID, podUID, k8sArgs.K8S_POD_UID)
 		} else {
+			in.Delegates = delegates
 			useCacheConf = true
-			// check plugins field and enable ConfListPlugin if there is
-			for _, v := range in.Delegates {
-				if len(v.ConfList.Plugins) != 0 {
-					v.ConfListPlugin = true
-				}
+			if err := loadSecretConfigs(kubeClient, in.Delegates); err != nil {
+				// error happen but continue to delete
+				logging.Errorf("Multus: failed to load the secret configs: %v", err)
 			}
-			// First delegate is always the master plugin
-			in.Delegates[0].MasterPlugin = true
 		}
 	}
 
@@ -906,8 +2825,6 @@ func CmdDel(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) er
 				if err != nil {
 					return cmdErr(k8sArgs, "failed to get clusterNetwork/defaultNetworks: %v", err)
 				}
-				// First delegate is always the master plugin
-				in.Delegates[0].MasterPlugin = true
 			}
 
 			// Get pod annotation and so on
@@ -920,12 +2837,33 @@ func CmdDel(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) er
 				// Get clusterNetwork before, so continue to delete
 				logging.Errorf("Multus: failed to get delegates: %v, but continue to delete clusterNetwork", err)
 			}
+		} else if in.DisableDelegateCache {
+			// the pod is gone: only the delegates of the multus config, i.e.
+			// the cluster network, can still be resolved and deleted
+			logging.Verbosef("warning: pod %s/%s of container %s is gone and the delegate cache is disabled, only deleting its cluster network", k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, args.ContainerID)
+			if in.ClusterNetwork != "" {
+				if _, err := k8s.GetDefaultNetworks(nil, in, kubeClient, nil); err != nil {
+					logging.Errorf("Multus: failed to get the clusterNetwork of container %s: %v, cannot properly delete", args.ContainerID, err)
+					return nil
+				}
+			}
+			if len(in.Delegates) == 0 {
+				return nil
+			}
 		} else {
 			// The options to continue with a delete have been exhausted (cachefile + API query didn't work)
 			// We cannot exit with an error as this may cause a sandbox to never get deleted.
 			logging.Errorf("Multus: failed to get the cached delegates file: %v, cannot properly delete", err)
 			return nil
 		}
+
+		// the cached delegates already have the node CNI args of the ADD
+		if in.NodeCNIArgsFile != "" {
+			if err := injectNodeCNIArgs(in.Delegates, in.NodeCNIArgsFile); err != nil {
+				// error happen but continue to delete
+				logging.Errorf("Multus: %v", err)
+			}
+		}
 	}
 
 	// set CNIVersion in delegate CNI config if there is no CNIVersion and multus conf have CNIVersion.
@@ -940,7 +2878,26 @@ func CmdDel(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) er
 		}
 	}
 
-	e := delPlugins(exec, pod, args, k8sArgs, in.Delegates, len(in.Delegates)-1, in.RuntimeConfig, in)
+	if in.PrevResult != nil && len(in.Delegates) > 0 {
+		master := in.Delegates[masterPluginIndex(in.Delegates)]
+		if err := injectPrevResult(master, in.PrevResult); err != nil {
+			// error happen but continue to delete
+			logging.Errorf("Multus: failed to pass the prevResult to delegate %q: %v", master.Name, err)
+		}
+	}
+
+	e := delPlugins(ctx, exec, pod, args, k8sArgs, in.Delegates, len(in.Delegates)-1, in.RuntimeConfig, in)
+	if e != nil && in.IgnoreDelErrors {
+		logging.Verbosef("warning: ignoring the failed DEL of container %s: %v", args.ContainerID, e)
+		e = nil
+	}
+	if e != nil && netnsGone {
+		logging.Verbosef("warning: ignoring the failed DEL of container %s, its netns is gone: %v", args.ContainerID, e)
+		e = nil
+	}
+	if quota := namespaceInterfaceQuota(ctx); quota != nil && e == nil {
+		quota.Release(string(k8sArgs.K8S_POD_NAMESPACE), args.ContainerID)
+	}
 
 	// Enable Option only delegate plugin delete success to delete cache file
 	// CNI Runtime maybe return an error to block sandbox cleanup a while initiative,
@@ -953,18 +2910,30 @@ func CmdDel(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) er
 			// Block sandbox cleanup error message can not contain "no such file or directory", CNI Runtime maybe should adaptor it !
 			if e == nil || strings.Contains(e.Error(), "no such file or directory") {
 				_ = os.Remove(path) // lgtm[go/path-injection]
+				removeScratchCacheDirs(in, cacheDir)
 			}
 		}
 	} else {
 		if useCacheConf {
 			// remove used cache file
 			_ = os.Remove(path) // lgtm[go/path-injection]
+			removeScratchCacheDirs(in, cacheDir)
 		}
 	}
 
 	return e
 }
 
+// isNetnsGone reports whether the error of getting the netns of a DEL tells
+// that the netns is missing or is not a netns anymore
+func isNetnsGone(err error) bool {
+	switch err.(type) {
+	case ns.NSPathNotExistErr, ns.NSPathNotNSErr:
+		return true
+	}
+	return false
+}
+
 // CmdStatus ...
 func CmdStatus(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) error {
 	n, err := types.LoadNetConf(args.StdinData)
@@ -972,11 +2941,18 @@ func CmdStatus(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo)
 	if err != nil {
 		return cmdErr(nil, "error loading netconf: %v", err)
 	}
+	exec = execWithProxy(exec, n.ExecProxySocket)
+
+	n.CNIDir, err = resolveCNIDir(n.CNIDir)
+	if err != nil {
+		return cmdErr(nil, "error resolving cniDir: %v", err)
+	}
 
 	kubeClient, err = k8s.GetK8sClient(n.Kubeconfig, kubeClient)
 	if err != nil {
 		return cmdErr(nil, "error getting k8s client: %v", err)
 	}
+	kubeClient = kubeClient.WithAPIRequestPolicy(time.Duration(n.APIRequestTimeoutSeconds)*time.Second, n.APIRequestRetries)
 
 	if n.ReadinessIndicatorFile != "" {
 		if err := types.GetReadinessIndicatorFile(n.ReadinessIndicatorFile); err != nil {
@@ -993,11 +2969,16 @@ func CmdStatus(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo)
 		n.Delegates[0].MasterPlugin = true
 	}
 
+	// without a default network, there is no network to check
+	if len(n.Delegates) == 0 {
+		return nil
+	}
+
 	// invoke delegate's STATUS command
 	// we only need to check cluster network status
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{n.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, n.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, n.CNIDir, execWithEnvAllowlist(exec, n.DelegateEnvAllowlist))
 
 	conf, err := libcni.ConfListFromBytes(n.Delegates[0].Bytes)
 	if err != nil {
@@ -1019,11 +3000,18 @@ func CmdGC(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) err
 	if err != nil {
 		return cmdErr(nil, "error loading netconf: %v", err)
 	}
+	exec = execWithProxy(exec, n.ExecProxySocket)
+
+	n.CNIDir, err = resolveCNIDir(n.CNIDir)
+	if err != nil {
+		return cmdErr(nil, "error resolving cniDir: %v", err)
+	}
 
 	kubeClient, err = k8s.GetK8sClient(n.Kubeconfig, kubeClient)
 	if err != nil {
 		return cmdErr(nil, "error getting k8s client: %v", err)
 	}
+	kubeClient = kubeClient.WithAPIRequestPolicy(time.Duration(n.APIRequestTimeoutSeconds)*time.Second, n.APIRequestRetries)
 
 	if n.ReadinessIndicatorFile != "" {
 		if err := types.GetReadinessIndicatorFile(n.ReadinessIndicatorFile); err != nil {
@@ -1040,11 +3028,16 @@ func CmdGC(args *skel.CmdArgs, exec invoke.Exec, kubeClient *k8s.ClientInfo) err
 		n.Delegates[0].MasterPlugin = true
 	}
 
+	// without a default network, there is no network to collect
+	if len(n.Delegates) == 0 {
+		return nil
+	}
+
 	// invoke delegate's GC command
 	// we only need to check cluster network status
 	binDirs := filepath.SplitList(os.Getenv("CNI_PATH"))
 	binDirs = append([]string{n.BinDir}, binDirs...)
-	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, n.CNIDir, exec)
+	cniNet := libcni.NewCNIConfigWithCacheDir(binDirs, n.CNIDir, execWithEnvAllowlist(exec, n.DelegateEnvAllowlist))
 
 	conf, err := libcni.ConfListFromBytes(n.Delegates[0].Bytes)
 	if err != nil {
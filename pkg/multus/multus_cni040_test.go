@@ -24,6 +24,7 @@ import (
 
 	"github.com/containernetworking/cni/pkg/skel"
 	cni040 "github.com/containernetworking/cni/pkg/types/040"
+	cni100 "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
@@ -135,6 +136,122 @@ var _ = Describe("multus operations cniVersion 0.3.1 config", func() {
 		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
 	})
 
+	It("converts the master plugin result to resultCNIVersion", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "resultCNIVersion": "1.0.0",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "0.4.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin040(nil, "eth0", "", &cni040.Result{
+			CNIVersion: "0.4.0",
+			IPs: []*cni040.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			}},
+		}, nil)
+
+		result, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Version()).To(Equal("1.0.0"))
+		r := result.(*cni100.Result)
+		Expect(r.IPs).To(HaveLen(1))
+		Expect(r.IPs[0].Address.String()).To(Equal("1.1.1.2/24"))
+	})
+
+	DescribeTable("converts the version of the result of mixed 0.4.0/1.0.0 delegates to resultCNIVersionTarget", func(target, expectedVersion string) {
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "resultCNIVersionTarget": %q,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "0.4.0",
+	        "type": "weave-net"
+	    }]
+	}`, target)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin040(nil, "eth0", "", &cni040.Result{
+			CNIVersion: "0.4.0",
+			Interfaces: []*cni040.Interface{{Name: "eth0", Mac: "0a:58:0a:00:00:02", Sandbox: testNS.Path()}},
+			IPs:        []*cni040.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24"), Interface: cni040.Int(0)}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "net1", Mac: "0a:58:0a:00:00:03", Mtu: 9000, Sandbox: testNS.Path()}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24"), Interface: cni100.Int(0)}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Version()).To(Equal(expectedVersion))
+		res, err := cni100.NewResultFromResult(result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Interfaces).To(HaveLen(1))
+		Expect(res.Interfaces[0].Mac).To(Equal("0a:58:0a:00:00:02"))
+		Expect(res.IPs).To(HaveLen(1))
+		Expect(res.IPs[0].Address.String()).To(Equal("1.1.1.2/24"))
+		Expect(*res.IPs[0].Interface).To(Equal(0))
+		// the result of the secondary network is not merged into it
+		Expect(res.Interfaces[0].Mtu).To(BeZero())
+	},
+		Entry("the version of the master plugin", "master", "0.4.0"),
+		Entry("the highest version of the delegates", "highest", "1.0.0"),
+	)
+
+	It("rejects resultCNIVersionTarget highest with resultCNIVersion", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "resultCNIVersion": "1.0.0",
+	    "resultCNIVersionTarget": "highest",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "0.4.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		_, err := CmdAdd(args, newFakeExec(), nil)
+		Expect(err).To(MatchError(ContainSubstring(`resultCNIVersionTarget "highest" cannot be set with resultCNIVersion`)))
+	})
+
 	It("executes delegates with runtimeConfigs", func() {
 		podNet := `[{"name":"net1",
                              "mac": "c2:11:22:33:44:66",
@@ -17,34 +17,53 @@ package multus
 // disable dot-imports only for testing
 //revive:disable:dot-imports
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/containernetworking/cni/libcni"
 	"github.com/containernetworking/cni/pkg/skel"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
 	cni100 "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
+	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/vishvananda/netlink"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
 	testhelpers "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/testing"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/tracing"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	informerfactory "k8s.io/client-go/informers"
 	v1coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	netdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	netdefclient "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned"
+	netfake "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/fake"
 	netdefinformer "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/informers/externalversions"
 	netdefinformerv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/informers/externalversions/k8s.cni.cncf.io/v1"
 )
@@ -503,6 +522,1365 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 		Expect(err).To(MatchError("[//:other1]: error adding container to network \"other1\": expected plugin failure"))
 	})
 
+	It("waits for the default network and proceeds when it has an IP and default route", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "waitForDefaultNetwork": true,
+	    "waitForDefaultNetworkTimeout": 1,
+	    "delegates": [%s,%s]
+	}`, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		expectedResult1 := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+			Routes: []*cnitypes.Route{{
+				Dst: *testhelpers.EnsureCIDR("0.0.0.0/0"),
+				GW:  net.ParseIP("1.1.1.1"),
+			},
+			},
+		}
+		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
+		expectedResult2 := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.5/24"),
+			},
+			},
+		}
+		fExec.addPlugin100(nil, "net1", expectedConf2, expectedResult2, nil)
+
+		result, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(2))
+		Expect(reflect.DeepEqual(result, expectedResult1)).To(BeTrue())
+	})
+
+	It("fails and cleans up when the default network never gets an IP", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "waitForDefaultNetwork": true,
+	    "waitForDefaultNetworkTimeout": 1,
+	    "delegates": [%s,%s]
+	}`, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		// default network result has neither IPs nor routes
+		expectedResult1 := &cni100.Result{
+			CNIVersion: "1.0.0",
+		}
+		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, &cni100.Result{CNIVersion: "1.0.0"}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).To(MatchError(ContainSubstring("default network \"weave1\" has no IP address or default route after 1s")))
+		// the secondary delegate is never invoked and the default one is torn down
+		Expect(fExec.addIndex).To(Equal(1))
+		Expect(fExec.delIndex).To(Equal(1))
+	})
+
+	DescribeTable("handles a failing delegate DEL according to ignoreDelErrors", func(ignoreDelErrors bool) {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "ignoreDelErrors": %t,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    },{
+	        "name": "other1",
+	        "cniVersion": "1.0.0",
+	        "type": "other-plugin"
+	    }]
+	}`, tmpDir, ignoreDelErrors)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cacheFilePath := filepath.Join(tmpDir, "123456789")
+		Expect(cacheFilePath).To(BeAnExistingFile())
+
+		// the interface of net1 is already gone
+		fExec.plugins["net1"].err = errors.New("link net1 not found")
+		err = CmdDel(args, fExec, nil)
+		if ignoreDelErrors {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(ContainSubstring("link net1 not found")))
+		}
+		// all delegates are deleted and the cache is removed either way
+		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
+		Expect(cacheFilePath).NotTo(BeAnExistingFile())
+	},
+		Entry("fails the DEL by default", false),
+		Entry("succeeds with ignoreDelErrors", true),
+	)
+
+	It("deletes the delegates without a netns and cleans up the cache when the netns is gone", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "retryDeleteOnError": true,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    },{
+	        "name": "other1",
+	        "cniVersion": "1.0.0",
+	        "type": "other-plugin"
+	    }]
+	}`, tmpDir)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cacheFilePath := filepath.Join(tmpDir, "123456789")
+		Expect(cacheFilePath).To(BeAnExistingFile())
+
+		// the pod was force deleted: its netns is gone and net1 fails to enter it
+		args.Netns = filepath.Join(tmpDir, "gone-netns")
+		fExec.plugins["net1"].err = errors.New("failed to open netns")
+		Expect(CmdDel(args, fExec, nil)).To(Succeed())
+
+		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
+		for _, ifName := range []string{"eth0", "net1"} {
+			Expect(fExec.environs[ifName]).To(ContainElement("CNI_NETNS="))
+		}
+		Expect(cacheFilePath).NotTo(BeAnExistingFile())
+	})
+
+	DescribeTable("retries the ADD of the default network on a transient error", func(addErr string, expectedErr string, expectedExecuted []string) {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "defaultNetworkRetry": {
+	        "errorPatterns": ["connection refused"],
+	        "maxRetries": 2,
+	        "intervalMilliseconds": 1
+	    },
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    },{
+	        "name": "other1",
+	        "cniVersion": "1.0.0",
+	        "type": "other-plugin"
+	    }]
+	}`, tmpDir)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+		// the primary CNI restarts and refuses the first ADDs of weave1
+		fExec.plugins["eth0"].transientFailures = 2
+		fExec.plugins["eth0"].transientErr = errors.New(addErr)
+
+		_, err := CmdAdd(args, fExec, nil)
+		if expectedErr == "" {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		}
+		Expect(fExec.executed).To(Equal(expectedExecuted))
+	},
+		Entry("succeeds once the default network recovers", "dial unix /run/weave.sock: connection refused", "",
+			[]string{"ADD eth0", "DEL eth0", "ADD eth0", "DEL eth0", "ADD eth0", "ADD net1"}),
+		Entry("fails at once on other errors", "no IP addresses available", "no IP addresses available",
+			[]string{"ADD eth0", "DEL eth0"}),
+	)
+
+	It("retries the ADD of a delegate with the delegateRetryPolicy before rolling back", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegateRetryPolicy": {
+	        "errorPatterns": ["device or resource busy"],
+	        "maxRetries": 2,
+	        "intervalMilliseconds": 1,
+	        "backoffFactor": 2
+	    },
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    },{
+	        "name": "other1",
+	        "cniVersion": "1.0.0",
+	        "type": "other-plugin"
+	    }]
+	}`, tmpDir)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+		// the device of other1 is momentarily busy
+		fExec.plugins["net1"].transientFailures = 1
+		fExec.plugins["net1"].transientErr = errors.New("failed to move link: device or resource busy")
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.executed).To(Equal([]string{"ADD eth0", "ADD net1", "DEL net1", "ADD net1"}))
+
+		// once the retries are exhausted, the delegates are rolled back
+		fExec = newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{CNIVersion: "1.0.0"}, nil)
+		fExec.addPlugin100(nil, "net1", "", &cni100.Result{CNIVersion: "1.0.0"}, nil)
+		fExec.plugins["net1"].transientFailures = 3
+		fExec.plugins["net1"].transientErr = errors.New("failed to move link: device or resource busy")
+
+		_, err = CmdAdd(args, fExec, nil)
+		Expect(err).To(MatchError(ContainSubstring("device or resource busy")))
+		Expect(fExec.executed).To(Equal([]string{"ADD eth0", "ADD net1", "DEL net1", "ADD net1", "DEL net1", "ADD net1", "DEL net1", "DEL eth0"}))
+	})
+
+	It("logs a delegate trace with all delegates in order", func() {
+		logFile := filepath.Join(tmpDir, "multus.log")
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "logFile": "%s",
+	    "logLevel": "verbose",
+	    "delegates": [%s,%s]
+	}`, logFile, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, nil, fmt.Errorf("expected plugin failure"))
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).To(HaveOccurred())
+
+		logs, err := os.ReadFile(logFile)
+		Expect(err).NotTo(HaveOccurred())
+		var traceLine string
+		for _, line := range strings.Split(string(logs), "\n") {
+			if strings.Contains(line, "CmdAdd: delegate trace for") {
+				traceLine = line
+			}
+		}
+		Expect(traceLine).NotTo(BeEmpty())
+		Expect(traceLine).To(MatchRegexp(`\[0\] weave1\(eth0\) start=\S+ end=\S+ took=\S+ ok, \[1\] other1\(net1\) start=\S+ end=\S+ took=\S+ failed: expected plugin failure`))
+	})
+
+	It("finds the delegate which created an interface from the cache", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegates": [%s,%s]
+	}`, tmpDir, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "net1", Sandbox: testNS.Path()}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24"), Interface: cni100.Int(0)}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		owner, err := GetInterfaceOwner(tmpDir, args.ContainerID, "net1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner.Name).To(Equal("other1"))
+		Expect(owner.Type).To(Equal("other-plugin"))
+		Expect(owner.NetworkStatus).To(HaveLen(1))
+		Expect(owner.NetworkStatus[0].IPs).To(Equal([]string{"1.1.1.3"}))
+
+		owner, err = GetInterfaceOwner(tmpDir, args.ContainerID, "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner.Name).To(Equal("weave1"))
+		Expect(owner.Type).To(Equal("weave-net"))
+
+		_, err = GetInterfaceOwner(tmpDir, args.ContainerID, "net2")
+		Expect(err).To(BeAssignableToTypeOf(&InterfaceNotFoundError{}))
+		_, err = GetInterfaceOwner(tmpDir, "unknown-container", "eth0")
+		Expect(err).To(BeAssignableToTypeOf(&InterfaceNotFoundError{}))
+	})
+
+	DescribeTable("saves and deletes the delegates cache in the cacheLayout", func(layout string, cachePath string) {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        "K8S_POD_NAME=testPod;K8S_POD_NAMESPACE=test;K8S_POD_UID=testUID",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "cacheLayout": "%s",
+	    "delegates": [%s]
+	}`, tmpDir, layout, expectedConf1)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(tmpDir, cachePath)).To(BeARegularFile())
+
+		owner, err := GetInterfaceOwner(tmpDir, args.ContainerID, "eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner.Name).To(Equal("weave1"))
+
+		err = CmdDel(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
+		Expect(filepath.Join(tmpDir, cachePath)).NotTo(BeAnExistingFile())
+		// the directories of the nested layout are removed with the cache
+		Expect(filepath.Join(tmpDir, "test")).NotTo(BeAnExistingFile())
+	},
+		Entry("flat", types.CacheLayoutFlat, "123456789"),
+		Entry("nested", types.CacheLayoutNested, "test/testUID/123456789"),
+	)
+
+	DescribeTable("resolves the delegates again on DEL with disableDelegateCache", func(podPresent bool, expectedDels []string) {
+		fakePod := testhelpers.NewFakePod("testpod", "net1,net2", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.Name, fakePod.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "disableDelegateCache": true,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, tmpDir)),
+		}
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+
+		fExec := newFakeExec()
+		for _, ifName := range []string{"eth0", "net1", "net2"} {
+			fExec.addPlugin100(nil, ifName, "", &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+			}, nil)
+		}
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(tmpDir, args.ContainerID)).NotTo(BeAnExistingFile())
+
+		if !podPresent {
+			Expect(clientInfo.DeletePod(fakePod.Namespace, fakePod.Name)).To(Succeed())
+		}
+		fExec.executed = nil
+		Expect(CmdDel(args, fExec, clientInfo)).To(Succeed())
+		Expect(fExec.executed).To(Equal(expectedDels))
+	},
+		Entry("deletes the delegates of the pod", true, []string{"DEL net2", "DEL net1", "DEL eth0"}),
+		Entry("deletes the cluster network once the pod is gone", false, []string{"DEL eth0"}),
+	)
+
+	DescribeTable("adds a pod with only secondary networks according to allowNoDefaultNetwork", func(allowNoDefaultNetwork bool, podNetworks string, expectedErr string) {
+		fakePod := testhelpers.NewFakePod("testpod", podNetworks, "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.Name, fakePod.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "allowNoDefaultNetwork": %t
+	}`, tmpDir, allowNoDefaultNetwork)),
+		}
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+
+		// the interfaces are named after the position of their delegate
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "net0", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", net2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.4/24")}},
+		}, nil)
+
+		result, err := CmdAdd(args, fExec, clientInfo)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			Expect(fExec.addIndex).To(Equal(0))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(2))
+		// the result of the first delegate is returned
+		Expect(result.(*cni100.Result).IPs[0].Address.String()).To(Equal("1.1.1.3/24"))
+
+		// none of the cached delegates becomes the master plugin
+		netconfBytes, _, err := consumeScratchNetConf(args.ContainerID, tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		delegates, err := loadCachedDelegates(netconfBytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegates).To(HaveLen(2))
+		Expect(delegates[0].MasterPlugin).To(BeFalse())
+		Expect(delegates[1].MasterPlugin).To(BeFalse())
+
+		Expect(CmdDel(args, fExec, clientInfo)).To(Succeed())
+		Expect(fExec.delIndex).To(Equal(2))
+	},
+		Entry("adds the secondary networks with allowNoDefaultNetwork", true, "net1,net2", ""),
+		Entry("requires a default network without allowNoDefaultNetwork", false, "net1,net2", "at least one delegate/clusterNetwork must be specified"),
+		Entry("requires a network with allowNoDefaultNetwork", true, "", "no delegate: the pod has no network attachment and there is no default network"),
+	)
+
+	DescribeTable("fails fast when a delegate is multus itself", func(clusterNetwork, net1, expectedErr string) {
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.Name, fakePod.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "multusNamespace": "test",
+	    "clusterNetwork": %q
+	}`, tmpDir, clusterNetwork)),
+		}
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "default-multus", `{
+		"name": "default-multus",
+		"type": "multus",
+		"cniVersion": "1.0.0"
+	}`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "default", `{
+		"name": "default",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		fExec := newFakeExec()
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		Expect(err).To(MatchError(ContainSubstring("multus cannot delegate to itself")))
+		Expect(fExec.executed).To(BeEmpty())
+	},
+		Entry("the cluster network", "default-multus", `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`, `delegate "test/default-multus" is of type "multus"`),
+		Entry("a secondary network", "default", `{
+		"name": "net1",
+		"type": "multus",
+		"cniVersion": "1.0.0"
+	}`, `delegate "test/net1" is of type "multus"`),
+		Entry("a plugin of a secondary conflist", "default", `{
+		"name": "net1",
+		"cniVersion": "1.0.0",
+		"plugins": [{"type": "mynet"}, {"type": "multus-shim"}]
+	}`, `delegate "test/net1" is of type "multus-shim"`),
+	)
+
+	It("derives the same MAC address for the same pod identity", func() {
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {"mac": true},
+		"cniVersion": "1.0.0"
+	}`
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef("test", "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		// addPod adds the container of a pod, of the StatefulSet identity if
+		// any, and returns the MAC address requested for net1
+		addPod := func(containerID, podName, identity string) string {
+			fakePod := testhelpers.NewFakePod(podName, "net1", "")
+			if identity != "" {
+				fakePod.Labels = map[string]string{"statefulset.kubernetes.io/pod-name": identity}
+			}
+			if _, err := clientInfo.GetPod(fakePod.Namespace, fakePod.Name); err != nil {
+				_, err = clientInfo.AddPod(fakePod)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			args := &skel.CmdArgs{
+				ContainerID: containerID,
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.Name, fakePod.Namespace),
+				StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "deterministicMACs": {"prefix": "0e:00", "seed": "cluster-a"},
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, tmpDir)),
+			}
+			fExec := newFakeExec()
+			fExec.addPlugin100(nil, "eth0", "", &cni100.Result{CNIVersion: "1.0.0"}, nil)
+			fExec.addPlugin100(nil, "net1", "", &cni100.Result{CNIVersion: "1.0.0"}, nil)
+			_, err := CmdAdd(args, fExec, clientInfo)
+			Expect(err).NotTo(HaveOccurred())
+
+			netconfBytes, _, err := consumeScratchNetConf(containerID, tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			delegates, err := loadCachedDelegates(netconfBytes)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(delegates).To(HaveLen(2))
+			Expect(delegates[0].MacRequest).To(BeEmpty())
+			Expect(CmdDel(args, fExec, clientInfo)).To(Succeed())
+			return delegates[1].MacRequest
+		}
+
+		mac := addPod("123456789", "web-0", "web-0")
+		Expect(mac).To(HavePrefix("0e:00:"))
+		// the pod is recreated with a new container
+		Expect(clientInfo.DeletePod("test", "web-0")).To(Succeed())
+		Expect(addPod("987654321", "web-0", "web-0")).To(Equal(mac))
+		Expect(addPod("123456780", "web-1", "web-1")).NotTo(Equal(mac))
+		// without a stable identity, no MAC address is requested
+		Expect(addPod("123456781", "testpod", "")).To(BeEmpty())
+	})
+
+	It("fails when a deterministic MAC address collides with a requested one", func() {
+		expectedMAC, err := deterministicMAC(&types.DeterministicMACConf{}, "test/web-0", "test/net1", 0)
+		Expect(err).NotTo(HaveOccurred())
+		pod := testhelpers.NewFakePod("web-0", "", "")
+		pod.Labels = map[string]string{types.DefaultDeterministicMACIdentityLabel: "web-0"}
+		delegates := []*types.DelegateNetConf{
+			{Name: "test/net2", MacRequest: expectedMAC.String()},
+			{Name: "test/net1"},
+		}
+		conf := &types.DeterministicMACConf{IdentityLabel: types.DefaultDeterministicMACIdentityLabel}
+		err = assignDeterministicMACs(conf, pod, delegates, tmpDir)
+		Expect(err).To(MatchError(fmt.Sprintf(`the deterministic MAC address %s of network "test/net1" collides with the one of network "test/net2" of the pod`, expectedMAC)))
+
+		delegates[0].MacRequest = ""
+		Expect(assignDeterministicMACs(conf, pod, delegates, tmpDir)).To(Succeed())
+		Expect(delegates[1].MacRequest).To(Equal(expectedMAC.String()))
+		// the address is locally administered and unicast
+		Expect(expectedMAC[0] & 0x03).To(Equal(byte(0x02)))
+	})
+
+	It("assigns deterministic MAC addresses when the cached containers cannot be listed", func() {
+		// the results of cniDir is not a directory
+		Expect(os.WriteFile(filepath.Join(tmpDir, "results"), []byte{}, 0600)).To(Succeed())
+		pod := testhelpers.NewFakePod("web-0", "", "")
+		pod.Labels = map[string]string{types.DefaultDeterministicMACIdentityLabel: "web-0"}
+		delegates := []*types.DelegateNetConf{{Name: "test/net1"}}
+		conf := &types.DeterministicMACConf{IdentityLabel: types.DefaultDeterministicMACIdentityLabel}
+		Expect(assignDeterministicMACs(conf, pod, delegates, tmpDir)).To(Succeed())
+		Expect(delegates[0].MacRequest).NotTo(BeEmpty())
+	})
+
+	It("appends an audit record of each ADD and DEL to the auditLogFile", func() {
+		auditLog := filepath.Join(tmpDir, "audit.log")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        "K8S_POD_NAME=testPod;K8S_POD_NAMESPACE=test;K8S_POD_UID=testUID",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "auditLogFile": "%s",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    },{
+	        "name": "other1",
+	        "cniVersion": "1.0.0",
+	        "type": "other-plugin"
+	    }]
+	}`, tmpDir, auditLog)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		// the interface of net1 is already gone
+		fExec.plugins["net1"].err = errors.New("link net1 not found")
+		Expect(CmdDel(args, fExec, nil)).NotTo(Succeed())
+
+		data, err := os.ReadFile(auditLog)
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		Expect(lines).To(HaveLen(2))
+		var records []auditRecord
+		for _, line := range lines {
+			var record auditRecord
+			Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+			Expect(record.Time).NotTo(BeZero())
+			record.Time = time.Time{}
+			records = append(records, record)
+		}
+		Expect(records).To(Equal([]auditRecord{{
+			Command:     "ADD",
+			Namespace:   "test",
+			Pod:         "testPod",
+			PodUID:      "testUID",
+			ContainerID: "123456789",
+			Delegates:   []string{"weave1", "other1"},
+			Result:      "success",
+		}, {
+			Command:     "DEL",
+			Namespace:   "test",
+			Pod:         "testPod",
+			PodUID:      "testUID",
+			ContainerID: "123456789",
+			Delegates:   []string{"weave1", "other1"},
+			Result:      "failure",
+			Error:       `DelegateDel: error invoking DelegateDel - "other-plugin": error in getting result from DelNetwork: link net1 not found`,
+		}}))
+
+		info, err := os.Stat(auditLog)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("proxies the delegate invocations to the exec proxy of the execProxySocket", func() {
+		socketDir, err := os.MkdirTemp("", "execproxy")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(socketDir)
+		socketPath := filepath.Join(socketDir, "exec.sock")
+
+		// fake exec proxy, which records the invocations instead of
+		// executing the plugins
+		var mu sync.Mutex
+		var executed []string
+		failDel := false
+		mux := http.NewServeMux()
+		mux.HandleFunc(ExecProxyFindEndpoint, func(w http.ResponseWriter, r *http.Request) {
+			req := &ExecProxyFindRequest{}
+			Expect(json.NewDecoder(r.Body).Decode(req)).To(Succeed())
+			Expect(json.NewEncoder(w).Encode(&ExecProxyFindResponse{Path: filepath.Join("/proxied/bin", req.Plugin)})).To(Succeed())
+		})
+		mux.HandleFunc(ExecProxyExecEndpoint, func(w http.ResponseWriter, r *http.Request) {
+			req := &ExecProxyExecRequest{}
+			Expect(json.NewDecoder(r.Body).Decode(req)).To(Succeed())
+			env := ParseEnvironment(req.Env)
+			mu.Lock()
+			defer mu.Unlock()
+			executed = append(executed, env["CNI_COMMAND"]+" "+req.PluginPath+" "+env["CNI_IFNAME"])
+
+			resp := &ExecProxyExecResponse{Stderr: []byte("proxied")}
+			switch {
+			case env["CNI_COMMAND"] == "ADD":
+				resp.Stdout = []byte(`{"cniVersion": "1.0.0", "ips": [{"address": "10.1.1.2/24"}]}`)
+			case failDel:
+				resp.Stdout = []byte(`{"cniVersion": "1.0.0", "code": 11, "msg": "link net1 not found"}`)
+				resp.Error = "exit status 1"
+			}
+			Expect(json.NewEncoder(w).Encode(resp)).To(Succeed())
+		})
+		listener, err := net.Listen("unix", socketPath)
+		Expect(err).NotTo(HaveOccurred())
+		server := &http.Server{Handler: mux}
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		defer server.Close()
+
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "execProxySocket": "%s",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    },{
+	        "name": "other1",
+	        "cniVersion": "1.0.0",
+	        "type": "other-plugin"
+	    }]
+	}`, tmpDir, socketPath)),
+		}
+
+		// the in-process exec is not used
+		fExec := newFakeExec()
+		result, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		r := result.(*cni100.Result)
+		Expect(r.IPs).To(HaveLen(1))
+		Expect(r.IPs[0].Address.String()).To(Equal("10.1.1.2/24"))
+		Expect(fExec.executed).To(BeEmpty())
+
+		mu.Lock()
+		failDel = true
+		mu.Unlock()
+		Expect(CmdDel(args, fExec, nil)).To(MatchError(ContainSubstring("link net1 not found")))
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(executed).To(Equal([]string{
+			"ADD /proxied/bin/weave-net eth0",
+			"ADD /proxied/bin/other-plugin net1",
+			"DEL /proxied/bin/other-plugin net1",
+			"DEL /proxied/bin/weave-net eth0",
+		}))
+	})
+
+	It("dumps the delegate configs at debug log level and removes them on DEL", func() {
+		logging.SetLogLevel("debug")
+		defer logging.SetLogLevel("verbose")
+
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		dumpDir := filepath.Join(tmpDir, "dump")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegateConfigDumpDir": "%s",
+	    "delegates": [%s,%s]
+	}`, tmpDir, dumpDir, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		dumped, err := os.ReadFile(filepath.Join(dumpDir, "123456789", "eth0-0.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dumped).To(MatchJSON(expectedConf1))
+		dumped, err = os.ReadFile(filepath.Join(dumpDir, "123456789", "net1-0.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dumped).To(MatchJSON(expectedConf2))
+
+		err = CmdDel(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(dumpDir, "123456789")).NotTo(BeAnExistingFile())
+	})
+
+	It("does not dump the delegate configs below debug log level", func() {
+		logging.SetLogLevel("verbose")
+
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		dumpDir := filepath.Join(tmpDir, "dump")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegateConfigDumpDir": "%s",
+	    "delegates": [%s]
+	}`, tmpDir, dumpDir, expectedConf1)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dumpDir).NotTo(BeAnExistingFile())
+	})
+
+	It("copies the delegate results to resultCacheDir in the libcni format", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		resultCacheDir := filepath.Join(tmpDir, "cni")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "resultCacheDir": "%s",
+	    "delegates": [%s,%s]
+	}`, filepath.Join(tmpDir, "multus"), resultCacheDir, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the file is the one libcni, and thus cnitool, reads
+		cached, err := os.ReadFile(filepath.Join(resultCacheDir, "results", "other1-123456789-net1"))
+		Expect(err).NotTo(HaveOccurred())
+		cache := map[string]interface{}{}
+		Expect(json.Unmarshal(cached, &cache)).To(Succeed())
+		Expect(cache).To(HaveKeyWithValue("kind", libcni.CNICacheV1))
+		Expect(cache).To(HaveKeyWithValue("containerId", "123456789"))
+		Expect(cache).To(HaveKeyWithValue("ifName", "net1"))
+		Expect(cache).To(HaveKeyWithValue("networkName", "other1"))
+		Expect(cache).To(HaveKeyWithValue("netns", testNS.Path()))
+		Expect(cache).To(HaveKey("cniArgs"))
+
+		cniNet := libcni.NewCNIConfigWithCacheDir(nil, resultCacheDir, nil)
+		rt := &libcni.RuntimeConf{ContainerID: "123456789", IfName: "net1"}
+		netConf, err := libcni.ConfFromBytes([]byte(expectedConf2))
+		Expect(err).NotTo(HaveOccurred())
+		result, err := cniNet.GetNetworkCachedResult(netConf, rt)
+		Expect(err).NotTo(HaveOccurred())
+		res, err := cni100.NewResultFromResult(result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.IPs[0].Address.String()).To(Equal("1.1.1.3/24"))
+		config, _, err := cniNet.GetNetworkCachedConfig(netConf, rt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(MatchJSON(expectedConf2))
+		Expect(filepath.Join(resultCacheDir, "results", "weave1-123456789-eth0")).To(BeAnExistingFile())
+
+		err = CmdDel(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(resultCacheDir, "results", "weave1-123456789-eth0")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(resultCacheDir, "results", "other1-123456789-net1")).NotTo(BeAnExistingFile())
+	})
+
+	It("keeps the delegates cache in cniDir when the pod is unknown with the nested cacheLayout", func() {
+		Expect(nestedCacheLayout{}.dir("/var/lib/cni/multus", &types.K8sArgs{})).To(Equal("/var/lib/cni/multus"))
+		Expect(nestedCacheLayout{}.dir("/var/lib/cni/multus", &types.K8sArgs{
+			K8S_POD_NAMESPACE: "..",
+			K8S_POD_UID:       "testUID",
+		})).To(Equal("/var/lib/cni/multus/testUID"))
+	})
+
+	It("only passes allow-listed variables and CNI_* ones to the delegates", func() {
+		os.Setenv("MULTUS_TEST_ALLOWED", "allowed")
+		os.Setenv("MULTUS_TEST_SECRET", "secret")
+		defer os.Unsetenv("MULTUS_TEST_ALLOWED")
+		defer os.Unsetenv("MULTUS_TEST_SECRET")
+
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegateEnvAllowlist": ["MULTUS_TEST_ALLOWED"],
+	    "delegates": [%s]
+	}`, tmpDir, expectedConf1)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		environ := fExec.environs["eth0"]
+		Expect(environ).To(ContainElement("MULTUS_TEST_ALLOWED=allowed"))
+		Expect(environ).To(ContainElement("CNI_COMMAND=ADD"))
+		Expect(environ).To(ContainElement("CNI_CONTAINERID=123456789"))
+		Expect(environ).NotTo(ContainElement("MULTUS_TEST_SECRET=secret"))
+		for _, env := range environ {
+			Expect(env).To(Or(HavePrefix("CNI_"), HavePrefix("MULTUS_TEST_ALLOWED=")))
+		}
+
+		Expect(CmdDel(args, fExec, nil)).To(Succeed())
+		Expect(fExec.environs["eth0"]).To(ContainElement("CNI_COMMAND=DEL"))
+		Expect(fExec.environs["eth0"]).NotTo(ContainElement("MULTUS_TEST_SECRET=secret"))
+	})
+
+	It("passes the whole environment to the delegates without an allow-list", func() {
+		os.Setenv("MULTUS_TEST_SECRET", "secret")
+		defer os.Unsetenv("MULTUS_TEST_SECRET")
+
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegates": [%s]
+	}`, tmpDir, expectedConf1)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.environs["eth0"]).To(ContainElement("MULTUS_TEST_SECRET=secret"))
+	})
+
+	It("drops a DEL when a newer ADD of the container comes in within delDeferSeconds", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delDeferSeconds": 1,
+	    "delegates": [%s]
+	}`, tmpDir, expectedConf1)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cachePath := filepath.Join(tmpDir, args.ContainerID)
+		cache, err := os.ReadFile(cachePath)
+		Expect(err).NotTo(HaveOccurred())
+
+		// a newer ADD rewrites the cache while the DEL is deferred
+		delDone := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			delDone <- CmdDel(args, fExec, nil)
+		}()
+		time.Sleep(300 * time.Millisecond)
+		Expect(os.WriteFile(cachePath, cache, 0600)).To(Succeed())
+		Eventually(delDone, 2*time.Second).Should(Receive(BeNil()))
+		Expect(fExec.executed).To(Equal([]string{"ADD eth0"}))
+		Expect(cachePath).To(BeAnExistingFile())
+
+		// without a newer ADD, the DEL runs once the grace period is over
+		start := time.Now()
+		Expect(CmdDel(args, fExec, nil)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">", 500*time.Millisecond))
+		Expect(fExec.executed).To(Equal([]string{"ADD eth0", "DEL eth0"}))
+		Expect(cachePath).NotTo(BeAnExistingFile())
+	})
+
+	It("records a span per CNI operation and per delegate", func() {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "tracing": {"traceContextSource": "env"},
+	    "delegates": [%s,%s]
+	}`, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.5/24")}},
+		}, nil)
+
+		ctx := tracing.ContextFromEnv(context.Background(), map[string]string{
+			"TRACEPARENT": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		})
+		_, err := CmdAddContext(ctx, args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(3))
+		operation := spans[2]
+		Expect(operation.Name()).To(Equal("multus ADD"))
+		Expect(operation.Parent().TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(operation.Parent().SpanID().String()).To(Equal("00f067aa0ba902b7"))
+		for i, ifName := range []string{"eth0", "net1"} {
+			Expect(spans[i].Name()).To(Equal("delegate ADD"))
+			Expect(spans[i].Parent().SpanID()).To(Equal(operation.SpanContext().SpanID()))
+			Expect(spans[i].Attributes()).To(ContainElement(tracing.IfNameKey.String(ifName)))
+		}
+	})
+
+	It("surfaces delegate stderr as a warning on successful add", func() {
+		logFile := filepath.Join(tmpDir, "multus.log")
+		fakePod := testhelpers.NewFakePod("testpod", "", "")
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "logFile": "%s",
+	    "logLevel": "verbose",
+	    "delegates": [%s]
+	}`, logFile, expectedConf1)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+		}, nil)
+		fExec.plugins["eth0"].stderr = []byte("deprecated option \"foo\"\n\x00\x01")
+
+		fKubeClient := NewFakeClientInfo()
+		fKubeClient.AddPod(fakePod)
+		_, err := CmdAdd(args, fExec, fKubeClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		logs, err := os.ReadFile(logFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(logs)).To(ContainSubstring(`warning: delegate weave1(weave1) wrote to stderr: deprecated option "foo"`))
+
+		recorder := fKubeClient.EventRecorder.(*record.FakeRecorder)
+		events := collectEvents(recorder.Events)
+		Expect(events).To(ContainElement(`Normal AddedInterface Add eth0 [1.1.1.2/24] from weave1 (stderr: deprecated option "foo")`))
+	})
+
+	DescribeTable("adds the delegates whatever the event recorder", func(recorder record.EventRecorder) {
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		clientInfo.EventRecorder = recorder
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(BeNil())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+	},
+		Entry("without an event recorder", nil),
+		Entry("with a failing event recorder", failingRecorder{}),
+	)
+
+	It("truncates large delegate stderr", func() {
+		stderr := &stderrBuffer{}
+		n, err := stderr.Write(bytes.Repeat([]byte("a"), maxDelegateStderr-1))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(maxDelegateStderr - 1))
+		n, err = stderr.Write([]byte("bcd"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(stderr.Len()).To(Equal(maxDelegateStderr))
+		Expect(stderr.String()).To(Equal(strings.Repeat("a", maxDelegateStderr-1) + "b [truncated]"))
+	})
+
 	It("executes delegates and cleans up on failure with missing name field", func() {
 		expectedConf1 := `{
 		    "name": "weave1",
@@ -510,12 +1888,1910 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 		    "type": "weave-net"
 		}`
 		expectedConf2 := `{
-		    "name": "",
+		    "name": "",
+		    "cniVersion": "1.0.0",
+		    "type": "other-plugin"
+		}`
+		// took out the name in expectedConf2, expecting a new value to be filled in by CmdAdd
+
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+		    "name": "node-cni-network",
+		    "type": "multus",
+		    "readinessindicatorfile": "/tmp/foo.multus.conf",
+		    "defaultnetworkwaitseconds": 3,
+		    "delegates": [%s,%s]
+		}`, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		expectedResult1 := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+		}
+		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
+
+		// This plugin invocation should fail
+		err := fmt.Errorf("missing network name")
+		fExec.addPlugin100(nil, "net1", expectedConf2, nil, err)
+
+		_, err = CmdAdd(args, fExec, nil)
+		Expect(fExec.addIndex).To(Equal(1))
+		Expect(fExec.delIndex).To(Equal(1))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("executes delegates with runtimeConfigs", func() {
+		podNet := `[{"name":"net1",
+                             "mac": "c2:11:22:33:44:66",
+                             "ips": [ "10.0.0.1" ],
+                             "bandwidth": {
+				     "ingressRate": 2048,
+				     "ingressBurst": 1600,
+				     "egressRate": 4096,
+				     "egressBurst": 1600
+			     },
+			     "portMappings": [
+			     {
+				     "hostPort": 8080, "containerPort": 80, "protocol": "tcp"
+			     },
+			     {
+				     "hostPort": 8000, "containerPort": 8001, "protocol": "udp"
+			     }]
+		     }
+	]`
+		fakePod := testhelpers.NewFakePod("testpod", podNet, "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {"mac": true, "ips": true, "bandwidth": true, "portMappings": true},
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		expectedResult1 := &cni100.Result{
+			CNIVersion: resultCNIVersion,
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+		}
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedNet1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {
+			"mac": true,
+			"ips": true,
+			"bandwidth": true,
+			"portMappings": true
+		},
+		"runtimeConfig": {
+			"ips": [ "10.0.0.1" ],
+			"mac": "c2:11:22:33:44:66",
+			"bandwidth": {
+				"ingressRate": 2048,
+				"ingressBurst": 1600,
+				"egressRate": 4096,
+				"egressBurst": 1600
+			},
+			"portMappings": [
+			{
+				"hostPort": 8080,
+				"containerPort": 80,
+				"protocol": "tcp"
+			},
+			{
+				"hostPort": 8000,
+				"containerPort": 8001,
+				"protocol": "udp"
+			}]
+		},
+		"cniVersion": "1.0.0"
+	}`
+		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
+		fExec.addPlugin100(nil, "net1", expectedNet1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.3/24"),
+			},
+			},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+		r := result.(*cni100.Result)
+		// plugin 1 is the masterplugin
+		Expect(reflect.DeepEqual(r, expectedResult1)).To(BeTrue())
+
+	})
+
+	It("injects the ipFromPool of a network into the IPAM ranges of its delegate", func() {
+		fakePod := testhelpers.NewFakePod("testpod", `[{"name": "net1", "ipFromPool": "10.0.5.0/24"}]`, "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {"ipRanges": true},
+		"ipam": {"type": "host-local"},
+		"cniVersion": "1.0.0"
+	}`
+		expectedNet1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {"ipRanges": true},
+		"ipam": {"type": "host-local"},
+		"runtimeConfig": {
+			"ipRanges": [[{"subnet": "10.0.5.0/24"}]]
+		},
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedNet1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("10.0.5.2/24")}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	It("passes the routeTable and routeMetric of a network to the delegates supporting them", func() {
+		fakePod := testhelpers.NewFakePod("testpod", `[
+			{"name": "net1", "routeTable": 100, "routeMetric": 50},
+			{"name": "net2", "routeTable": 200}
+		]`, "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {"routeTable": true, "routeMetric": true},
+		"cniVersion": "1.0.0"
+	}`
+		expectedNet1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"capabilities": {"routeTable": true, "routeMetric": true},
+		"runtimeConfig": {
+			"routeTable": 100,
+			"routeMetric": 50
+		},
+		"cniVersion": "1.0.0"
+	}`
+		// net2 does not advertise the capability
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedNet1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("10.0.5.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net2", net2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("10.0.6.2/24")}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	DescribeTable("passes the bandwidth request to a plugin without the bandwidth capability", func(autoBandwidthCapability bool, expectedNet1 string) {
+		podNet := `[{"name": "net1",
+			"bandwidth": {"ingressRate": 2048, "ingressBurst": 1600, "egressRate": 4096, "egressBurst": 1600}}]`
+		fakePod := testhelpers.NewFakePod("testpod", podNet, "")
+		net1 := `{
+		"name": "net1",
+		"type": "bandwidth",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "cniDir": %q,
+	    "autoBandwidthCapability": %t,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, tmpDir, autoBandwidthCapability)),
+		}
+
+		fExec := newFakeExec()
+		expectedResult1 := &cni100.Result{
+			CNIVersion: resultCNIVersion,
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			}},
+		}
+		fExec.addPlugin100(nil, "eth0", `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`, expectedResult1, nil)
+		fExec.addPlugin100(nil, "net1", expectedNet1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.3/24"),
+			}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+	},
+		Entry("not without autoBandwidthCapability", false, `{
+		"name": "net1",
+		"type": "bandwidth",
+		"cniVersion": "1.0.0"
+	}`),
+		Entry("with autoBandwidthCapability", true, `{
+		"name": "net1",
+		"type": "bandwidth",
+		"capabilities": {"bandwidth": true},
+		"runtimeConfig": {
+			"bandwidth": {"ingressRate": 2048, "ingressBurst": 1600, "egressRate": 4096, "egressBurst": 1600}
+		},
+		"cniVersion": "1.0.0"
+	}`),
+	)
+
+	It("enables the bandwidth capability of the bandwidthPluginTypes of a conflist", func() {
+		delegate, err := types.LoadDelegateNetConf([]byte(`{
+		"name": "net1",
+		"cniVersion": "1.0.0",
+		"plugins": [{"type": "macvlan"}, {"type": "my-bandwidth"}]
+	}`), &types.NetworkSelectionElement{Name: "net1", BandwidthRequest: &types.BandwidthEntry{IngressRate: 2048}}, "", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(enableBandwidthCapability([]*types.DelegateNetConf{delegate}, []string{"my-bandwidth"})).To(Succeed())
+		Expect(delegate.Bytes).To(MatchJSON(`{
+		"name": "net1",
+		"cniVersion": "1.0.0",
+		"plugins": [{"type": "macvlan"}, {"type": "my-bandwidth", "capabilities": {"bandwidth": true}}]
+	}`))
+		Expect(hasCapability(delegate, "bandwidth")).To(BeTrue())
+	})
+
+	It("builds the network status of several delegates from a result", func() {
+		weave, err := types.LoadDelegateNetConf([]byte(`{"name": "weave1", "cniVersion": "1.0.0", "type": "weave-net"}`), nil, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		weave.MasterPlugin = true
+		net1, err := types.LoadDelegateNetConf([]byte(`{"name": "net1", "cniVersion": "1.0.0", "type": "mynet"}`),
+			&types.NetworkSelectionElement{Name: "net1", Namespace: "test"}, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		net2, err := types.LoadDelegateNetConf([]byte(`{"name": "net2", "cniVersion": "1.0.0", "type": "mynet"}`),
+			&types.NetworkSelectionElement{Name: "net2", Namespace: "test", InterfaceRequest: "storage"}, "", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		result := &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{
+				{Name: "eth0", Mac: "c2:11:22:33:44:55", Sandbox: "/var/run/netns/test"},
+				{Name: "veth1234"},
+				{Name: "net1", Mac: "c2:11:22:33:44:66", Sandbox: "/var/run/netns/test"},
+				{Name: "storage", Mac: "c2:11:22:33:44:77", Sandbox: "/var/run/netns/test"},
+			},
+			IPs: []*cni100.IPConfig{
+				{Interface: cni100.Int(0), Address: *testhelpers.EnsureCIDR("10.1.1.2/24"), Gateway: net.ParseIP("10.1.1.1")},
+				{Interface: cni100.Int(2), Address: *testhelpers.EnsureCIDR("10.2.2.2/24")},
+				{Interface: cni100.Int(3), Address: *testhelpers.EnsureCIDR("10.3.3.2/24")},
+			},
+			Routes: []*cnitypes.Route{{Dst: *testhelpers.EnsureCIDR("0.0.0.0/0"), GW: net.ParseIP("10.1.1.1")}},
+		}
+
+		statuses, err := BuildNetworkStatus(result, []*types.DelegateNetConf{weave, net1, net2})
+		Expect(err).NotTo(HaveOccurred())
+		dns := nettypes.DNS{Nameservers: []string{}, Search: []string{}, Options: []string{}}
+		Expect(statuses).To(Equal([]nettypes.NetworkStatus{
+			{Name: "weave1", Interface: "eth0", Mac: "c2:11:22:33:44:55", IPs: []string{"10.1.1.2"}, Default: true, Gateway: []string{"10.1.1.1"}, DNS: dns},
+			{Name: "test/net1", Interface: "net1", Mac: "c2:11:22:33:44:66", IPs: []string{"10.2.2.2"}, DNS: dns},
+			{Name: "test/net2", Interface: "storage", Mac: "c2:11:22:33:44:77", IPs: []string{"10.3.3.2"}, DNS: dns},
+		}))
+	})
+
+	It("executes delegates and kubernetes networks", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1,net2", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		net3 := `{
+		"name": "net3",
+		"type": "mynet3",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		expectedResult1 := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+		}
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
+		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.3/24"),
+			},
+			},
+		}, nil)
+		fExec.addPlugin100(nil, "net2", net2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.4/24"),
+			},
+			},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+		// net3 is not used; make sure it's not accessed
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net3", net3))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+		// plugin 1 is the masterplugin
+		Expect(reflect.DeepEqual(result, expectedResult1)).To(BeTrue())
+	})
+
+	It("sends a summary event or no event depending on interfaceEvents", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1,net2", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		expectedEvents := map[string][]string{
+			types.InterfaceEventsSummary:  {"Normal AddedInterface Add eth0 [1.1.1.2/24] from weave1, net1 [1.1.1.3/24] from test/net1, net2 [1.1.1.4/24] from test/net2"},
+			types.InterfaceEventsDisabled: {},
+		}
+		for mode, expected := range expectedEvents {
+			args := &skel.CmdArgs{
+				ContainerID: "123456789",
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+				StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "interfaceEvents": %q,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, mode)),
+			}
+
+			fExec := newFakeExec()
+			fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+			}, nil)
+			fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+			}, nil)
+			fExec.addPlugin100(nil, "net2", net2, &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.4/24")}},
+			}, nil)
+
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = CmdAdd(args, fExec, clientInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+
+			recorder := clientInfo.EventRecorder.(*record.FakeRecorder)
+			Expect(collectEvents(recorder.Events)).To(Equal(expected), "interfaceEvents %q", mode)
+		}
+	})
+
+	It("adds the default network first or last depending on defaultNetworkLast", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1,net2", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		expectedOrder := map[bool][]string{
+			false: {"ADD eth0", "ADD net1", "ADD net2", "DEL net2", "DEL net1", "DEL eth0"},
+			true:  {"ADD net1", "ADD net2", "ADD eth0", "DEL eth0", "DEL net2", "DEL net1"},
+		}
+		for defaultNetworkLast, expected := range expectedOrder {
+			args := &skel.CmdArgs{
+				ContainerID: "123456789",
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+				StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "defaultNetworkLast": %t,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, defaultNetworkLast)),
+			}
+
+			expectedResult1 := &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+			}
+			fExec := newFakeExec()
+			fExec.addPlugin100(nil, "eth0", "", expectedResult1, nil)
+			fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+			}, nil)
+			fExec.addPlugin100(nil, "net2", net2, &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.4/24")}},
+			}, nil)
+
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := CmdAdd(args, fExec, clientInfo)
+			Expect(err).NotTo(HaveOccurred())
+			// the default network result is returned in both modes
+			Expect(reflect.DeepEqual(result, expectedResult1)).To(BeTrue())
+
+			err = CmdDel(args, fExec, clientInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fExec.executed).To(Equal(expected), "defaultNetworkLast %t", defaultNetworkLast)
+		}
+	})
+
+	It("keeps the cluster network listed after the default networks on the interface of the request", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "multusNamespace": "test",
+	    "clusterNetwork": "net1",
+	    "defaultNetworks": ["net2"],
+	    "defaultNetworksOrder": "before-cluster-network"
+	}`),
+		}
+
+		expectedResult1 := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "net0", net2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "eth0", net1, expectedResult1, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reflect.DeepEqual(result, expectedResult1)).To(BeTrue())
+
+		// the DEL reads the delegates back from the cache
+		err = CmdDel(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.executed).To(Equal([]string{"ADD net0", "ADD eth0", "DEL eth0", "DEL net0"}))
+	})
+
+	It("passes the prevResult of the chain to the cluster network listed after the default networks", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniVersion": "1.0.0",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "multusNamespace": "test",
+	    "clusterNetwork": "net1",
+	    "defaultNetworks": ["net2"],
+	    "defaultNetworksOrder": "before-cluster-network",
+	    "prevResult": {
+	        "cniVersion": "1.0.0",
+	        "ips": [{"address": "10.0.0.5/24"}]
+	    }
+	}`),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "net0", net2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "eth0", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.executed).To(Equal([]string{"ADD net0", "ADD eth0"}))
+		Expect(string(fExec.stdins["eth0"])).To(ContainSubstring("10.0.0.5/24"))
+		Expect(string(fExec.stdins["net0"])).NotTo(ContainSubstring("prevResult"))
+	})
+
+	It("refuses the DEL of delegates cached for another pod UID with cachePodUID", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "", "")
+		cmdArgs := func(podUID string) *skel.CmdArgs {
+			return &skel.CmdArgs{
+				ContainerID: "123456789",
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s;K8S_POD_UID=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace, podUID),
+				StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "cniDir": %q,
+	    "cachePodUID": true,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, tmpDir)),
+			}
+		}
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		_, err = CmdAdd(cmdArgs("testUID"), fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+
+		cache, err := os.ReadFile(filepath.Join(tmpDir, "123456789"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(cache)).To(HavePrefix(`{"podUID":"testUID","delegates":[`))
+
+		err = CmdDel(cmdArgs("otherUID"), fExec, clientInfo)
+		Expect(err).To(MatchError(ContainSubstring("refusing to delete the cached delegates of container 123456789: they belong to pod UID testUID, not otherUID")))
+		Expect(fExec.delIndex).To(Equal(0))
+		Expect(filepath.Join(tmpDir, "123456789")).To(BeAnExistingFile())
+
+		err = CmdDel(cmdArgs("testUID"), fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.delIndex).To(Equal(1))
+		Expect(filepath.Join(tmpDir, "123456789")).NotTo(BeAnExistingFile())
+	})
+
+	Context("with parallelDelegates", func() {
+		var fakePod *kapi.Pod
+		var clientInfo *k8sclient.ClientInfo
+		var args *skel.CmdArgs
+		var fExec *fakeExec
+		netConf := func(name string) string {
+			return fmt.Sprintf(`{
+		"name": %q,
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`, name)
+		}
+		result := func(ifName, ip string) *cni100.Result {
+			return &cni100.Result{
+				CNIVersion: "1.0.0",
+				Interfaces: []*cni100.Interface{{Name: ifName, Sandbox: testNS.Path()}},
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR(ip), Interface: cni100.Int(0)}},
+			}
+		}
+
+		BeforeEach(func() {
+			fakePod = testhelpers.NewFakePod("testpod", "net1,net2,net3", "")
+			args = &skel.CmdArgs{
+				ContainerID: "123456789",
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+				StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "parallelDelegates": true,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+			}
+
+			clientInfo = NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			fExec = newFakeExec()
+			fExec.addPlugin100(nil, "eth0", "", result("eth0", "1.1.1.2/24"), nil)
+			for i, name := range []string{"net1", "net2", "net3"} {
+				_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, name, netConf(name)))
+				Expect(err).NotTo(HaveOccurred())
+				fExec.addPlugin100(nil, name, netConf(name), result(name, fmt.Sprintf("1.1.1.%d/24", i+3)), nil)
+			}
+			// the secondary delegates only complete if they run concurrently
+			barrier := newAddBarrier(3)
+			for _, name := range []string{"net1", "net2", "net3"} {
+				fExec.plugins[name].barrier = barrier
+			}
+		})
+
+		It("adds the secondary delegates concurrently after the default network, in delegate order in the status", func() {
+			addResult, err := CmdAdd(args, fExec, clientInfo)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fExec.executed[0]).To(Equal("ADD eth0"))
+			Expect(fExec.executed[1:]).To(ConsistOf("ADD net1", "ADD net2", "ADD net3"))
+			// the result is the one of the default network
+			res, err := cni100.NewResultFromResult(addResult)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.IPs[0].Address.IP.String()).To(Equal("1.1.1.2"))
+
+			pod, err := clientInfo.GetPod(fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)
+			Expect(err).NotTo(HaveOccurred())
+			var netStatus []netdefv1.NetworkStatus
+			Expect(json.Unmarshal([]byte(pod.Annotations[netdefv1.NetworkStatusAnnot]), &netStatus)).To(Succeed())
+			var statuses []string
+			for _, status := range netStatus {
+				statuses = append(statuses, fmt.Sprintf("%s %s %v", status.Name, status.Interface, status.IPs))
+			}
+			Expect(statuses).To(Equal([]string{
+				"weave1 eth0 [1.1.1.2]",
+				"test/net1 net1 [1.1.1.3]",
+				"test/net2 net2 [1.1.1.4]",
+				"test/net3 net3 [1.1.1.5]",
+			}))
+		})
+
+		It("deletes all the delegates when one of the parallel ADDs fails", func() {
+			fExec.plugins["net2"].err = fmt.Errorf("expected plugin failure")
+			_, err := CmdAdd(args, fExec, clientInfo)
+			Expect(err).To(MatchError(ContainSubstring(`error adding container to network "net2": expected plugin failure`)))
+			Expect(fExec.executed[:4]).To(ConsistOf("ADD eth0", "ADD net1", "ADD net2", "ADD net3"))
+			Expect(fExec.executed[4:]).To(Equal([]string{"DEL net3", "DEL net2", "DEL net1", "DEL eth0"}))
+		})
+	})
+
+	It("deletes the delegates in the teardown order", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "teardownOrder": ["overlay", "eth0"],
+	    "delegates": [
+	        {"name": "weave1", "cniVersion": "1.0.0", "type": "weave-net"},
+	        {"name": "underlay", "cniVersion": "1.0.0", "type": "underlay-plugin"},
+	        {"name": "overlay", "cniVersion": "1.0.0", "type": "overlay-plugin"}
+	    ]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		for i, ifName := range []string{"eth0", "net1", "net2"} {
+			fExec.addPlugin100(nil, ifName, "", &cni100.Result{
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR(fmt.Sprintf("1.1.1.%d/24", i+2))}},
+			}, nil)
+		}
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(CmdDel(args, fExec, nil)).To(Succeed())
+		Expect(fExec.executed).To(Equal([]string{
+			"ADD eth0", "ADD net1", "ADD net2",
+			// the delegates not in the teardown order go last, in reverse ADD order
+			"DEL net2", "DEL eth0", "DEL net1",
+		}))
+	})
+
+	It("takes the teardown order from the pod annotation first", func() {
+		conf := &types.NetConf{TeardownOrder: []string{"net1"}}
+		Expect(teardownOrder(conf, nil)).To(Equal([]string{"net1"}))
+
+		pod := testhelpers.NewFakePod("testpod", "", "")
+		Expect(teardownOrder(conf, pod)).To(Equal([]string{"net1"}))
+		pod.Annotations[teardownOrderAnnot] = "net2, eth0"
+		Expect(teardownOrder(conf, pod)).To(Equal([]string{"net2", "eth0"}))
+	})
+
+	It("orders the IPs of each interface by ipFamilyPreference", func() {
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		dualStackResult := func(ifName, ipv4, ipv6 string) *cni100.Result {
+			return &cni100.Result{
+				CNIVersion: "1.0.0",
+				Interfaces: []*cni100.Interface{{Name: ifName, Sandbox: testNS.Path()}},
+				IPs: []*cni100.IPConfig{
+					{Address: *testhelpers.EnsureCIDR(ipv6), Interface: cni100.Int(0)},
+					{Address: *testhelpers.EnsureCIDR(ipv4), Interface: cni100.Int(0)},
+				},
+			}
+		}
+
+		for preference, expected := range map[string][][]string{
+			"ipv4":  {{"1.1.1.2", "2001:db8::2"}, {"1.1.1.3", "2001:db8::3"}},
+			"ipv6":  {{"2001:db8::2", "1.1.1.2"}, {"2001:db8::3", "1.1.1.3"}},
+			"as-is": {{"2001:db8::2", "1.1.1.2"}, {"2001:db8::3", "1.1.1.3"}},
+		} {
+			fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+			args := &skel.CmdArgs{
+				ContainerID: "123456789",
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+				StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "ipFamilyPreference": %q,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, preference)),
+			}
+
+			fExec := newFakeExec()
+			fExec.addPlugin100(nil, "eth0", "", dualStackResult("eth0", "1.1.1.2/24", "2001:db8::2/64"), nil)
+			fExec.addPlugin100(nil, "net1", net1, dualStackResult("net1", "1.1.1.3/24", "2001:db8::3/64"), nil)
+
+			clientInfo := NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(
+				testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := CmdAdd(args, fExec, clientInfo)
+			Expect(err).NotTo(HaveOccurred())
+			res, err := cni100.NewResultFromResult(result)
+			Expect(err).NotTo(HaveOccurred())
+			var resultIPs []string
+			for _, ip := range res.IPs {
+				resultIPs = append(resultIPs, ip.Address.IP.String())
+			}
+			Expect(resultIPs).To(Equal(expected[0]), "ipFamilyPreference %s", preference)
+
+			pod, err := clientInfo.GetPod(fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)
+			Expect(err).NotTo(HaveOccurred())
+			var netStatus []netdefv1.NetworkStatus
+			Expect(json.Unmarshal([]byte(pod.Annotations[netdefv1.NetworkStatusAnnot]), &netStatus)).To(Succeed())
+			Expect(netStatus).To(HaveLen(2))
+			Expect(netStatus[0].IPs).To(Equal(expected[0]), "ipFamilyPreference %s", preference)
+			Expect(netStatus[1].IPs).To(Equal(expected[1]), "ipFamilyPreference %s", preference)
+		}
+	})
+
+	It("strips the statusFieldRedactions from the network status", func() {
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "statusFieldRedactions": ["mac", "dns.nameservers"],
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+		resultWithMac := func(ifName, mac, ip string) *cni100.Result {
+			return &cni100.Result{
+				CNIVersion: "1.0.0",
+				Interfaces: []*cni100.Interface{{Name: ifName, Mac: mac, Sandbox: testNS.Path()}},
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR(ip), Interface: cni100.Int(0)}},
+				DNS:        cnitypes.DNS{Nameservers: []string{"10.0.0.10"}, Domain: "cluster.local"},
+			}
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", resultWithMac("eth0", "0a:58:0a:00:00:02", "1.1.1.2/24"), nil)
+		fExec.addPlugin100(nil, "net1", net1, resultWithMac("net1", "0a:58:0a:00:00:03", "1.1.1.3/24"), nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod, err := clientInfo.GetPod(fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Annotations[netdefv1.NetworkStatusAnnot]).NotTo(ContainSubstring("0a:58:0a"))
+		var netStatus []netdefv1.NetworkStatus
+		Expect(json.Unmarshal([]byte(pod.Annotations[netdefv1.NetworkStatusAnnot]), &netStatus)).To(Succeed())
+		Expect(netStatus).To(HaveLen(2))
+		for i, ip := range []string{"1.1.1.2", "1.1.1.3"} {
+			Expect(netStatus[i].Mac).To(BeEmpty())
+			Expect(netStatus[i].DNS.Nameservers).To(BeEmpty())
+			Expect(netStatus[i].DNS.Domain).To(Equal("cluster.local"))
+			Expect(netStatus[i].IPs).To(Equal([]string{ip}))
+		}
+		Expect(netStatus[1].Name).To(Equal("test/net1"))
+		Expect(netStatus[1].Interface).To(Equal("net1"))
+	})
+
+	It("strips nested fields of the device info from a network status", func() {
+		status := &netdefv1.NetworkStatus{
+			Name: "test/sriov",
+			Mac:  "0a:58:0a:00:00:03",
+			DeviceInfo: &netdefv1.DeviceInfo{
+				Type:    netdefv1.DeviceInfoTypePCI,
+				Version: "1.1.0",
+				Pci:     &netdefv1.PciDevice{PciAddress: "0000:af:06.0", PfPciAddress: "0000:af:00.0"},
+			},
+		}
+		redacted, err := redactNetworkStatus(status, []string{"device-info.pci.pci-address", "device-info.unknown.key", "gateway"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(redacted.Mac).To(Equal(status.Mac))
+		Expect(redacted.DeviceInfo.Pci.PciAddress).To(BeEmpty())
+		Expect(redacted.DeviceInfo.Pci.PfPciAddress).To(Equal("0000:af:00.0"))
+		Expect(redacted.DeviceInfo.Type).To(Equal(netdefv1.DeviceInfoTypePCI))
+	})
+
+	It("passes the prevResult of the chain to the first delegate and merges it in the result", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniVersion": "1.0.0",
+	    "prevResult": {
+	        "cniVersion": "1.0.0",
+	        "interfaces": [{"name": "veth0"}, {"name": "eth0", "sandbox": "%s"}],
+	        "ips": [{"address": "10.0.0.5/24", "interface": 1}],
+	        "routes": [{"dst": "0.0.0.0/0", "gw": "10.0.0.1"}]
+	    },
+	    "delegates": [%s,%s]
+	}`, testNS.Path(), expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "eth0", Sandbox: testNS.Path()}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24"), Interface: cni100.Int(0)}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		result, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		// only the first delegate gets the prevResult
+		conf := map[string]interface{}{}
+		Expect(json.Unmarshal(fExec.stdins["eth0"], &conf)).To(Succeed())
+		prevResult, err := json.Marshal(conf["prevResult"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(prevResult)).To(ContainSubstring(`"address":"10.0.0.5/24"`))
+		Expect(string(fExec.stdins["net1"])).NotTo(ContainSubstring("prevResult"))
+
+		// the interface of prevResult the delegate did not pass through is kept
+		res, err := cni100.NewResultFromResult(result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Interfaces).To(HaveLen(2))
+		Expect(res.Interfaces[0].Name).To(Equal("veth0"))
+		Expect(res.Interfaces[1].Name).To(Equal("eth0"))
+		Expect(res.IPs).To(HaveLen(2))
+		Expect(res.IPs[0].Address.String()).To(Equal("10.0.0.5/24"))
+		// its interface is the one the delegate passed through
+		Expect(*res.IPs[0].Interface).To(Equal(1))
+		Expect(res.IPs[1].Address.String()).To(Equal("1.1.1.2/24"))
+		Expect(*res.IPs[1].Interface).To(Equal(1))
+		Expect(res.Routes).To(HaveLen(1))
+	})
+
+	DescribeTable("merges the routes of the prevResult and of the delegate", func(policy string, delegateRoutes string, expectedRoutes []string, expectedWarnings []string, expectedErr string) {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniVersion": "1.0.0",
+	    "cniDir": "%s",
+	    "routeConflictPolicy": "%s",
+	    "prevResult": {
+	        "cniVersion": "1.0.0",
+	        "routes": [{"dst": "0.0.0.0/0", "gw": "10.0.0.1"}, {"dst": "10.96.0.0/12", "gw": "10.0.0.1"}]
+	    },
+	    "delegates": [%s]
+	}`, tmpDir, policy, expectedConf1)),
+		}
+
+		var routes []*cnitypes.Route
+		Expect(json.Unmarshal([]byte(delegateRoutes), &routes)).To(Succeed())
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "eth0", Sandbox: testNS.Path()}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24"), Interface: cni100.Int(0)}},
+			Routes:     routes,
+		}, nil)
+
+		ctx, warnings := WithWarnings(context.Background())
+		result, err := CmdAddContext(ctx, args, fExec, nil)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			// the delegate is rolled back
+			Expect(fExec.delIndex).To(Equal(1))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		res, err := cni100.NewResultFromResult(result)
+		Expect(err).NotTo(HaveOccurred())
+		var merged []string
+		for _, route := range res.Routes {
+			merged = append(merged, route.Dst.String()+" via "+route.GW.String())
+		}
+		Expect(merged).To(Equal(expectedRoutes))
+		Expect(warnings.List()).To(Equal(expectedWarnings))
+	},
+		Entry("de-duplicates identical routes", "warn",
+			`[{"dst": "0.0.0.0/0", "gw": "10.0.0.1"}, {"dst": "10.1.0.0/16", "gw": "1.1.1.1"}, {"dst": "10.1.0.0/16", "gw": "1.1.1.1"}]`,
+			[]string{"0.0.0.0/0 via 10.0.0.1", "10.96.0.0/12 via 10.0.0.1", "10.1.0.0/16 via 1.1.1.1"}, nil, ""),
+		Entry("keeps the route of the delegate on conflict with a warning", "warn",
+			`[{"dst": "0.0.0.0/0", "gw": "1.1.1.1"}]`,
+			[]string{"10.96.0.0/12 via 10.0.0.1", "0.0.0.0/0 via 1.1.1.1"},
+			[]string{"dropping the route to 0.0.0.0/0 table main via 10.0.0.1 of the prevResult, which conflicts with the one via 1.1.1.1 of the result"}, ""),
+		Entry("fails on conflict with the error policy", "error",
+			`[{"dst": "0.0.0.0/0", "gw": "1.1.1.1"}]`, nil, nil,
+			"route to 0.0.0.0/0 table main via 10.0.0.1 of the prevResult conflicts with the one via 1.1.1.1 of the result"),
+	)
+
+	It("passes the prevResult of the chain to the first plugin of a conflist", func() {
+		prevResult := &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "veth0"}},
+		}
+		delegate, err := types.LoadDelegateNetConf([]byte(`{
+	    "name": "chain",
+	    "cniVersion": "0.4.0",
+	    "plugins": [{"type": "bridge"}, {"type": "portmap"}]
+	}`), nil, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(injectPrevResult(delegate, prevResult)).To(Succeed())
+
+		conflist := struct {
+			Plugins []map[string]interface{} `json:"plugins"`
+		}{}
+		Expect(json.Unmarshal(delegate.Bytes, &conflist)).To(Succeed())
+		Expect(conflist.Plugins[0]).To(HaveKey("prevResult"))
+		Expect(conflist.Plugins[0]["prevResult"].(map[string]interface{})["cniVersion"]).To(Equal("0.4.0"))
+		Expect(conflist.Plugins[1]).NotTo(HaveKey("prevResult"))
+	})
+
+	It("passes the MTU of the default network to secondary networks with inheritDefaultMTU", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		expectedConf3 := `{
+	    "name": "other2",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin",
+	    "mtu": 1400
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniVersion": "1.0.0",
+	    "inheritDefaultMTU": true,
+	    "delegates": [%s,%s,%s]
+	}`, expectedConf1, expectedConf2, expectedConf3)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "eth0", Sandbox: testNS.Path(), Mtu: 8950}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24"), Interface: cni100.Int(0)}},
+		}, nil)
+		// the secondary network without an mtu inherits the default one
+		fExec.addPlugin100(nil, "net1", `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin",
+	    "mtu": 8950
+	}`, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+		// the one with its own mtu keeps it
+		fExec.addPlugin100(nil, "net2", expectedConf3, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.4/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	It("merges the node CNI args into the CNI args of the delegates", func() {
+		nodeArgsFile := filepath.Join(tmpDir, "node-cni-args")
+		Expect(os.WriteFile(nodeArgsFile, []byte("# node parameters\nrack = r12\n\nvrf=blue\n"), 0600)).To(Succeed())
+
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		// args of the pod end up in the delegate config and take precedence
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin",
+	    "args": {"cni": {"vrf": "red"}}
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniVersion": "1.0.0",
+	    "cniDir": "%s",
+	    "nodeCNIArgsFile": "%s",
+	    "delegates": [%s,%s]
+	}`, tmpDir, nodeArgsFile, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net",
+	    "args": {"cni": {"rack": "r12", "vrf": "blue"}}
+	}`, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin",
+	    "args": {"cni": {"rack": "r12", "vrf": "red"}}
+	}`, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+
+		// the cached delegates keep the node CNI args for the DEL
+		Expect(CmdDel(args, fExec, nil)).To(Succeed())
+		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	It("reloads the node CNI args file once modified", func() {
+		nodeArgsFile := filepath.Join(tmpDir, "node-cni-args")
+		Expect(loadNodeCNIArgs(nodeArgsFile)).To(BeEmpty())
+
+		Expect(os.WriteFile(nodeArgsFile, []byte("rack=r12\n"), 0600)).To(Succeed())
+		Expect(loadNodeCNIArgs(nodeArgsFile)).To(Equal(map[string]string{"rack": "r12"}))
+
+		Expect(os.WriteFile(nodeArgsFile, []byte("rack=r13\n"), 0600)).To(Succeed())
+		// the size is the same, the modification time differs
+		modTime := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(nodeArgsFile, modTime, modTime)).To(Succeed())
+		Expect(loadNodeCNIArgs(nodeArgsFile)).To(Equal(map[string]string{"rack": "r13"}))
+
+		Expect(os.WriteFile(nodeArgsFile, []byte("rack=r13\nvrf\n"), 0600)).To(Succeed())
+		_, err := loadNodeCNIArgs(nodeArgsFile)
+		Expect(err).To(MatchError(fmt.Sprintf("invalid line 2 of %s: must be key=value", nodeArgsFile)))
+	})
+
+	It("leaves the MTU of secondary networks alone without inheritDefaultMTU", func() {
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		expectedConf2 := `{
+	    "name": "other1",
+	    "cniVersion": "1.0.0",
+	    "type": "other-plugin"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniVersion": "1.0.0",
+	    "delegates": [%s,%s]
+	}`, expectedConf1, expectedConf2)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "eth0", Sandbox: testNS.Path(), Mtu: 8950}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", expectedConf2, &cni100.Result{
+			CNIVersion: "1.0.0",
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	It("sets the inherited MTU on the first plugin of a conflist", func() {
+		delegate, err := types.LoadDelegateNetConf([]byte(`{
+	    "name": "chain",
+	    "cniVersion": "0.4.0",
+	    "plugins": [{"type": "bridge"}, {"type": "portmap"}]
+	}`), nil, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inheritMTU(delegate, 9000)).To(Succeed())
+
+		conflist := struct {
+			Plugins []map[string]interface{} `json:"plugins"`
+		}{}
+		Expect(json.Unmarshal(delegate.Bytes, &conflist)).To(Succeed())
+		Expect(conflist.Plugins[0]["mtu"]).To(BeEquivalentTo(9000))
+		Expect(conflist.Plugins[1]).NotTo(HaveKey("mtu"))
+	})
+
+	It("runs the post-ADD probe of a net-attach-def and rolls back on failure", func() {
+		origRunPostAddProbe := runPostAddProbe
+		defer func() { runPostAddProbe = origRunPostAddProbe }()
+
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		nad := testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1)
+		nad.Annotations = map[string]string{"k8s.v1.cni.cncf.io/postAddProbe": `{"protocol": "tcp", "target": "10.1.1.1:80", "timeoutSeconds": 2}`}
+		_, err = clientInfo.AddNetAttachDef(nad)
+		Expect(err).NotTo(HaveOccurred())
+
+		var probed []types.PostAddProbe
+		probeErr := error(nil)
+		runPostAddProbe = func(netnsPath string, probe *types.PostAddProbe) error {
+			Expect(netnsPath).To(Equal(testNS.Path()))
+			probed = append(probed, *probe)
+			return probeErr
+		}
+
+		result := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", result, nil)
+		fExec.addPlugin100(nil, "net1", net1, result, nil)
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		// only the net-attach-def with a probe is probed
+		Expect(probed).To(Equal([]types.PostAddProbe{{Protocol: "tcp", Target: "10.1.1.1:80", TimeoutSeconds: 2}}))
+		Expect(fExec.delIndex).To(Equal(0))
+
+		probeErr = fmt.Errorf("connection refused")
+		fExec = newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", result, nil)
+		fExec.addPlugin100(nil, "net1", net1, result, nil)
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).To(MatchError(ContainSubstring(`post-ADD tcp probe of 10.1.1.1:80 from "net1" failed: connection refused`)))
+		// both delegates are deleted
+		Expect(fExec.addIndex).To(Equal(2))
+		Expect(fExec.delIndex).To(Equal(2))
+	})
+
+	It("quarantines a net-attach-def after consecutive ADD failures until it is updated", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		nad := testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1)
+		nad.ResourceVersion = "1"
+		_, err = clientInfo.AddNetAttachDef(nad)
+		Expect(err).NotTo(HaveOccurred())
+
+		var quarantined []int
+		quarantine := NewNetAttachDefQuarantine(2, time.Minute, func(count int) {
+			quarantined = append(quarantined, count)
+		})
+		ctx := WithNetAttachDefQuarantine(context.Background(), quarantine)
+		result := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}
+		cmdAddContext := func(ctx context.Context, net1Err error) (*fakeExec, error) {
+			fExec := newFakeExec()
+			fExec.addPlugin100(nil, "eth0", "", result, nil)
+			fExec.addPlugin100(nil, "net1", net1, result, net1Err)
+			_, err := CmdAddContext(ctx, args, fExec, clientInfo)
+			return fExec, err
+		}
+		cmdAdd := func(net1Err error) (*fakeExec, error) {
+			return cmdAddContext(ctx, net1Err)
+		}
+
+		// the failures of cancelled ADDs are not the net-attach-def's
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		for i := 0; i < 2; i++ {
+			_, err := cmdAddContext(cancelledCtx, fmt.Errorf("expected plugin failure"))
+			Expect(err).To(MatchError(ContainSubstring("expected plugin failure")))
+		}
+		Expect(quarantine.Quarantined()).To(BeEmpty())
+
+		for i := 0; i < 2; i++ {
+			fExec, err := cmdAdd(fmt.Errorf("expected plugin failure"))
+			Expect(err).To(MatchError(ContainSubstring("expected plugin failure")))
+			Expect(fExec.addIndex).To(Equal(2))
+		}
+		Expect(quarantine.Quarantined()).To(Equal([]string{"test/net1"}))
+		Expect(quarantined).To(Equal([]int{1}))
+
+		// the delegate of the quarantined net-attach-def is not invoked
+		fExec, err := cmdAdd(nil)
+		Expect(err).To(MatchError(ContainSubstring(`net-attach-def "test/net1" is quarantined after 2 consecutive ADD failures, until it is updated`)))
+		Expect(fExec.addIndex).To(Equal(1))
+
+		nad.ResourceVersion = "2"
+		_, err = clientInfo.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(nad.Namespace).Update(context.TODO(), nad, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		fExec, err = cmdAdd(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(2))
+		Expect(quarantine.Quarantined()).To(BeEmpty())
+		Expect(quarantined).To(Equal([]int{1, 0}))
+	})
+
+	It("rejects the ADDs over the quota of secondary interfaces of the namespace", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1,net2", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net2", net2))
+		Expect(err).NotTo(HaveOccurred())
+
+		quota := NewNamespaceInterfaceQuota(3)
+		ctx := WithNamespaceInterfaceQuota(context.Background(), quota)
+		newArgs := func(containerID string) *skel.CmdArgs {
+			return &skel.CmdArgs{
+				ContainerID: containerID,
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.Name, fakePod.Namespace),
+				StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, tmpDir)),
+			}
+		}
+		newExec := func() *fakeExec {
+			fExec := newFakeExec()
+			for _, ifName := range []string{"eth0", "net1", "net2"} {
+				fExec.addPlugin100(nil, ifName, "", &cni100.Result{
+					CNIVersion: "1.0.0",
+					IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+				}, nil)
+			}
+			return fExec
+		}
+
+		// the 2 secondary interfaces of the first container fit in the quota
+		_, err = CmdAddContext(ctx, newArgs("container1"), newExec(), clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quota.Count(fakePod.Namespace)).To(Equal(2))
+		// and are accounted once on a re-ADD
+		_, err = CmdAddContext(ctx, newArgs("container1"), newExec(), clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quota.Count(fakePod.Namespace)).To(Equal(2))
+
+		// those of the second one do not, none of its delegates is invoked
+		fExec := newExec()
+		_, err = CmdAddContext(ctx, newArgs("container2"), fExec, clientInfo)
+		Expect(err).To(MatchError(ContainSubstring(`namespace "test" is over its quota of 3 secondary interfaces: 2 are attached, container container2 requests 2`)))
+		Expect(fExec.addIndex).To(Equal(0))
+		Expect(quota.Count(fakePod.Namespace)).To(Equal(2))
+
+		// the quota is rebuilt from the cache
+		rebuilt := NewNamespaceInterfaceQuota(3)
+		Expect(rebuilt.Rebuild(tmpDir)).To(Succeed())
+		Expect(rebuilt.Count(fakePod.Namespace)).To(Equal(2))
+
+		// the DEL of the first container releases its interfaces
+		Expect(CmdDelContext(ctx, newArgs("container1"), newExec(), clientInfo)).To(Succeed())
+		Expect(quota.Count(fakePod.Namespace)).To(Equal(0))
+		_, err = CmdAddContext(ctx, newArgs("container2"), newExec(), clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quota.Count(fakePod.Namespace)).To(Equal(2))
+	})
+
+	Context("conditional default route", func() {
+		var clientInfo *k8sclient.ClientInfo
+		var fakePod *kapi.Pod
+		var probed []string
+		var reachable map[string]bool
+		var installed []string
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		net2 := `{
+		"name": "net2",
+		"type": "mynet2",
+		"cniVersion": "1.0.0"
+	}`
+
+		var origProbeGateway func(string, net.IP) error
+
+		BeforeEach(func() {
+			var origSetDefaultGateway func(string, *libcni.RuntimeConf, string, string, []net.IP) error
+			origProbeGateway, origSetDefaultGateway = probeGateway, setDefaultGateway
+			DeferCleanup(func() {
+				probeGateway, setDefaultGateway = origProbeGateway, origSetDefaultGateway
+			})
+			probed, installed = nil, nil
+			reachable = map[string]bool{}
+			probeGateway = func(netnsPath string, gw net.IP) error {
+				Expect(netnsPath).To(Equal(testNS.Path()))
+				probed = append(probed, gw.String())
+				if !reachable[gw.String()] {
+					return fmt.Errorf("no ICMP echo reply from %s", gw)
+				}
+				return nil
+			}
+			setDefaultGateway = func(_ string, _ *libcni.RuntimeConf, _, ifName string, gateways []net.IP) error {
+				installed = append(installed, fmt.Sprintf("%s %v", ifName, gateways))
+				return nil
+			}
+
+			fakePod = testhelpers.NewFakePod("testpod", `[
+				{"name": "net1", "default-route": ["10.1.1.1"]},
+				{"name": "net2", "default-route": ["10.2.1.1"]}
+			]`, "")
+			fakePod.Annotations[k8sclient.DefaultRouteSelectionAnnot] = "reachable"
+			clientInfo = NewFakeClientInfo()
+			_, err := clientInfo.AddPod(fakePod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net1", net1))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = clientInfo.AddNetAttachDef(testhelpers.NewFakeNetAttachDef(fakePod.Namespace, "net2", net2))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		cmdAdd := func(conditionalDefaultRoute bool) error {
+			args := &skel.CmdArgs{
+				ContainerID: "123456789",
+				Netns:       testNS.Path(),
+				IfName:      "eth0",
+				Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.Name, fakePod.Namespace),
+				StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "conditionalDefaultRoute": %t,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, conditionalDefaultRoute)),
+			}
+			fExec := newFakeExec()
+			for i, ifName := range []string{"eth0", "net1", "net2"} {
+				fExec.addPlugin100(nil, ifName, "", &cni100.Result{
+					CNIVersion: "1.0.0",
+					Interfaces: []*cni100.Interface{{Name: ifName, Sandbox: testNS.Path()}},
+					IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR(fmt.Sprintf("10.%d.1.2/24", i)), Interface: cni100.Int(0)}},
+				}, nil)
+			}
+			_, err := CmdAdd(args, fExec, clientInfo)
+			return err
+		}
+
+		gateways := func() map[string][]string {
+			pod, err := clientInfo.GetPod(fakePod.Namespace, fakePod.Name)
+			Expect(err).NotTo(HaveOccurred())
+			var netStatus []nettypes.NetworkStatus
+			Expect(json.Unmarshal([]byte(pod.Annotations[nettypes.NetworkStatusAnnot]), &netStatus)).To(Succeed())
+			gateways := map[string][]string{}
+			for _, status := range netStatus {
+				gateways[status.Interface] = status.Gateway
+			}
+			return gateways
+		}
+
+		It("installs the default route through the first reachable gateway", func() {
+			reachable["10.2.1.1"] = true
+			Expect(cmdAdd(true)).To(Succeed())
+			Expect(probed).To(Equal([]string{"10.1.1.1", "10.2.1.1"}))
+			Expect(installed).To(Equal([]string{"net2 [10.2.1.1]"}))
+			Expect(gateways()).To(Equal(map[string][]string{"eth0": nil, "net1": nil, "net2": {"10.2.1.1"}}))
+
+			probed, installed = nil, nil
+			reachable["10.1.1.1"] = true
+			Expect(cmdAdd(true)).To(Succeed())
+			Expect(probed).To(Equal([]string{"10.1.1.1"}))
+			Expect(installed).To(Equal([]string{"net1 [10.1.1.1]"}))
+			Expect(gateways()).To(Equal(map[string][]string{"eth0": nil, "net1": {"10.1.1.1"}, "net2": nil}))
+		})
+
+		It("falls back to the first gateway when none is reachable", func() {
+			Expect(cmdAdd(true)).To(Succeed())
+			Expect(probed).To(Equal([]string{"10.1.1.1", "10.2.1.1"}))
+			Expect(installed).To(Equal([]string{"net1 [10.1.1.1]"}))
+		})
+
+		It("probes the gateways with ICMP echo requests", func() {
+			probeGateway = origProbeGateway
+			// the gateway of net2 is an address of the pod, the one of net1 has no route
+			Expect(testNS.Do(func(_ ns.NetNS) error {
+				lo, err := netlink.LinkByName("lo")
+				if err != nil {
+					return err
+				}
+				if err := netlink.LinkSetUp(lo); err != nil {
+					return err
+				}
+				return netlink.AddrAdd(lo, &netlink.Addr{IPNet: testhelpers.EnsureCIDR("10.2.1.1/32")})
+			})).To(Succeed())
+			Expect(cmdAdd(true)).To(Succeed())
+			Expect(installed).To(Equal([]string{"net2 [10.2.1.1]"}))
+		})
+
+		It("filters the gateways of the candidates which are not chosen", func() {
+			delegates := []*types.DelegateNetConf{{}, {}, {}}
+			candidates := []*gatewayCandidate{
+				{gateways: []net.IP{net.ParseIP("10.1.1.1")}, delegate: delegates[0], idx: 0},
+				{gateways: []net.IP{net.ParseIP("10.2.1.1")}, delegate: delegates[1], idx: 1},
+				{gateways: []net.IP{net.ParseIP("2001:db8::1")}, delegate: delegates[2], idx: 2},
+			}
+			filterUnchosenGateways(candidates, candidates[1])
+			Expect(delegates[0].IsFilterV4Gateway).To(BeTrue())
+			Expect(delegates[0].IsFilterV6Gateway).To(BeFalse())
+			Expect(delegates[1].IsFilterV4Gateway).To(BeFalse())
+			Expect(delegates[2].IsFilterV4Gateway).To(BeFalse())
+			Expect(delegates[2].IsFilterV6Gateway).To(BeTrue())
+		})
+
+		It("keeps the static default routes unless conditionalDefaultRoute is enabled", func() {
+			// both gateways are installed, which is rejected as ECMP
+			Expect(cmdAdd(false)).To(MatchError(ContainSubstring("multus does not support ECMP for default-route")))
+			Expect(probed).To(BeEmpty())
+		})
+	})
+
+	It("fails the post-ADD tcp probe of an unreachable target", func() {
+		err := runPostAddProbe(testNS.Path(), &types.PostAddProbe{Protocol: "tcp", Target: "127.0.0.1:1", TimeoutSeconds: 1})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("gets the ICMP echo reply of the loopback address", func() {
+		Expect(icmpEcho("127.0.0.1", time.Second)).To(Succeed())
+	})
+
+	It("checks static IP requests against host interface addresses", func() {
+		origHostInterfaceAddrs := hostInterfaceAddrs
+		defer func() { hostInterfaceAddrs = origHostInterfaceAddrs }()
+
+		fakePod := testhelpers.NewFakePod("testpod", `[{"name":"net1","ips":["10.1.1.5/24"]}]`, "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "checkHostIPConflicts": true,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		hostInterfaceAddrs = func() ([]hostAddr, error) {
+			return []hostAddr{
+				{ifName: "lo", ip: net.ParseIP("127.0.0.1")},
+				{ifName: "ens3", ip: net.ParseIP("10.1.1.5")},
+			}, nil
+		}
+		fExec := newFakeExec()
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).To(MatchError(`Multus: [test/testpod/]: IP 10.1.1.5 requested for network "test/net1" is already assigned to host interface ens3`))
+		Expect(fExec.addIndex).To(Equal(0))
+
+		hostInterfaceAddrs = func() ([]hostAddr, error) {
+			return []hostAddr{
+				{ifName: "lo", ip: net.ParseIP("127.0.0.1")},
+				{ifName: "ens3", ip: net.ParseIP("10.1.1.6")},
+			}, nil
+		}
+		fExec = newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("10.1.1.5/24")}},
+		}, nil)
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	It("rejects a structurally invalid delegate result and cleans up", func() {
+		expectedConf1 := `{
+		    "name": "weave1",
+		    "cniVersion": "1.0.0",
+		    "type": "weave-net"
+		}`
+		expectedConf2 := `{
+		    "name": "other1",
 		    "cniVersion": "1.0.0",
 		    "type": "other-plugin"
 		}`
-		// took out the name in expectedConf2, expecting a new value to be filled in by CmdAdd
-
 		args := &skel.CmdArgs{
 			ContainerID: "123456789",
 			Netns:       testNS.Path(),
@@ -523,56 +3799,234 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 			StdinData: []byte(fmt.Sprintf(`{
 		    "name": "node-cni-network",
 		    "type": "multus",
-		    "readinessindicatorfile": "/tmp/foo.multus.conf",
-		    "defaultnetworkwaitseconds": 3,
 		    "delegates": [%s,%s]
 		}`, expectedConf1, expectedConf2)),
 		}
 
-		fExec := newFakeExec()
-		expectedResult1 := &cni100.Result{
+		validResult := &cni100.Result{
 			CNIVersion: "1.0.0",
-			IPs: []*cni100.IPConfig{{
-				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			Interfaces: []*cni100.Interface{{Name: "eth0", Sandbox: testNS.Path()}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24"), Interface: cni100.Int(0)}},
+		}
+		invalidResults := map[string]*cni100.Result{
+			"IP 0 refers to interface index 3, but the result has 1 interfaces": {
+				CNIVersion: "1.0.0",
+				Interfaces: []*cni100.Interface{{Name: "net1", Sandbox: testNS.Path()}},
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.2.2/24"), Interface: cni100.Int(3)}},
+			},
+			"IP 0 has gateway 2001:db8::1, which is not of the family of address 1.1.2.2/24": {
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.2.2/24"), Gateway: net.ParseIP("2001:db8::1")}},
 			},
+			"route 0 to 2001:db8::/64 has IPv4 gateway 1.1.2.1": {
+				CNIVersion: "1.0.0",
+				IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("2001:db8::2/64")}},
+				Routes:     []*cnitypes.Route{{Dst: *testhelpers.EnsureCIDR("2001:db8::/64"), GW: net.ParseIP("1.1.2.1")}},
 			},
 		}
-		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
+		for message, invalidResult := range invalidResults {
+			fExec := newFakeExec()
+			fExec.addPlugin100(nil, "eth0", expectedConf1, validResult, nil)
+			fExec.addPlugin100(nil, "net1", expectedConf2, invalidResult, nil)
+
+			_, err := CmdAdd(args, fExec, nil)
+			Expect(err).To(MatchError(ContainSubstring(`delegate "other1" returned an invalid result: ` + message)))
+			Expect(fExec.addIndex).To(Equal(2))
+			Expect(fExec.delIndex).To(Equal(2))
+		}
+	})
 
-		// This plugin invocation should fail
-		err := fmt.Errorf("missing network name")
-		fExec.addPlugin100(nil, "net1", expectedConf2, nil, err)
+	It("fails when the result cannot be converted to resultCNIVersion", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "resultCNIVersion": "0.2.0",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
 
-		_, err = CmdAdd(args, fExec, nil)
-		Expect(fExec.addIndex).To(Equal(1))
-		Expect(fExec.delIndex).To(Equal(1))
-		Expect(err).To(HaveOccurred())
+		// a 0.2.0 result needs an IP address, which this result does not have
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "eth0"}},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).To(MatchError("Multus: [//]: error converting the result from CNI version 1.0.0 to 0.2.0: cannot convert: no valid IP addresses"))
 	})
 
-	It("executes delegates with runtimeConfigs", func() {
-		podNet := `[{"name":"net1",
-                             "mac": "c2:11:22:33:44:66",
-                             "ips": [ "10.0.0.1" ],
-                             "bandwidth": {
-				     "ingressRate": 2048,
-				     "ingressBurst": 1600,
-				     "egressRate": 4096,
-				     "egressBurst": 1600
-			     },
-			     "portMappings": [
-			     {
-				     "hostPort": 8080, "containerPort": 80, "protocol": "tcp"
-			     },
-			     {
-				     "hostPort": 8000, "containerPort": 8001, "protocol": "udp"
-			     }]
-		     }
-	]`
-		fakePod := testhelpers.NewFakePod("testpod", podNet, "")
+	It("merges the secret config of a net-attach-def without caching it", func() {
+		logFile := filepath.Join(tmpDir, "multus.log")
+		defer logging.SetLogLevel("verbose")
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		net1 := `{
+		"name": "net1",
+		"type": "overlay",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "logFile": "%s",
+	    "logLevel": "debug",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, tmpDir, logFile)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		// the delegate gets the config merged with the secret one
+		fExec.addPlugin100(nil, "net1", `{
+		"name": "net1",
+		"type": "overlay",
+		"cniVersion": "1.0.0",
+		"sharedKey": "s3cr3t-k3y"
+	}`, &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "net1", Sandbox: testNS.Path()}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24"), Interface: cni100.Int(0)}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.Client.CoreV1().Secrets(fakePod.ObjectMeta.Namespace).Create(context.TODO(), &kapi.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "overlay-key", Namespace: fakePod.ObjectMeta.Namespace},
+			Data:       map[string][]byte{"config": []byte(`{"sharedKey": "s3cr3t-k3y"}`)},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		nad := testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1)
+		nad.Annotations = map[string]string{"k8s.v1.cni.cncf.io/configSecretRef": "overlay-key/config"}
+		_, err = clientInfo.AddNetAttachDef(nad)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+
+		// neither the scratch cache, the result cache nor the status has it
+		cached, err := os.ReadFile(filepath.Join(tmpDir, args.ContainerID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(cached)).To(ContainSubstring("overlay-key"))
+		Expect(string(cached)).NotTo(ContainSubstring("s3cr3t"))
+		resultCache, err := os.ReadFile(filepath.Join(tmpDir, "results", "net1-"+args.ContainerID+"-net1"))
+		Expect(err).NotTo(HaveOccurred())
+		resultCacheInfo := struct {
+			Config []byte `json:"config"`
+		}{}
+		Expect(json.Unmarshal(resultCache, &resultCacheInfo)).To(Succeed())
+		Expect(string(resultCacheInfo.Config)).To(ContainSubstring("overlay"))
+		Expect(string(resultCacheInfo.Config)).NotTo(ContainSubstring("s3cr3t"))
+		pod, err := clientInfo.GetPod(fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Annotations[nettypes.NetworkStatusAnnot]).To(ContainSubstring("1.1.1.3"))
+		Expect(pod.Annotations[nettypes.NetworkStatusAnnot]).NotTo(ContainSubstring("s3cr3t"))
+
+		// DEL from the cache gets the secret config again
+		err = CmdDel(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
+		Expect(string(fExec.stdins["net1"])).To(ContainSubstring("s3cr3t-k3y"))
+
+		// nor the debug logs
+		logs, err := os.ReadFile(logFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(logs)).To(ContainSubstring("overlay"))
+		Expect(string(logs)).NotTo(ContainSubstring("s3cr3t"))
+	})
+
+	DescribeTable("annotates the pod on an ADD failure matching addFailureAnnotationPatterns", func(pluginErr string, expectAnnotation bool) {
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "addFailureAnnotationPatterns": ["no IP addresses available", "^ipam: range .* exhausted"],
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", net1, nil, errors.New(pluginErr))
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).To(MatchError(ContainSubstring(pluginErr)))
+		Expect(fExec.delIndex).To(Equal(2))
+
+		pod, err := clientInfo.GetPod(fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)
+		Expect(err).NotTo(HaveOccurred())
+		if !expectAnnotation {
+			Expect(pod.Annotations).NotTo(HaveKey(k8sclient.AddFailureAnnot))
+			return
+		}
+		failure := k8sclient.AddFailure{}
+		Expect(json.Unmarshal([]byte(pod.Annotations[k8sclient.AddFailureAnnot]), &failure)).To(Succeed())
+		Expect(failure.Network).To(Equal("test/net1"))
+		Expect(failure.Interface).To(Equal("net1"))
+		Expect(failure.Reason).To(ContainSubstring(pluginErr))
+		Expect(failure.Pattern).To(Equal("no IP addresses available"))
+	},
+		Entry("IP pool exhaustion", "failed to allocate for range 0: no IP addresses available in range set: 10.1.1.0-10.1.1.3", true),
+		Entry("another failure", "failed to create the macvlan interface", false),
+	)
+
+	It("executes kubernetes networks and delete it after pod removal", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
 		net1 := `{
 		"name": "net1",
 		"type": "mynet",
-		"capabilities": {"mac": true, "ips": true, "bandwidth": true, "portMappings": true},
 		"cniVersion": "1.0.0"
 	}`
 		args := &skel.CmdArgs{
@@ -580,176 +4034,281 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 			Netns:       testNS.Path(),
 			IfName:      "eth0",
 			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
-			StdinData: []byte(`{
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		expectedResult1 := &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+		}
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
+		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.3/24"),
+			},
+			},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = clientInfo.AddNetAttachDef(
+			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
+		// plugin 1 is the masterplugin
+		Expect(reflect.DeepEqual(result, expectedResult1)).To(BeTrue())
+
+		// set fKubeClient to nil to emulate no pod info
+		clientInfo.DeletePod(fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)
+		err = CmdDel(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	It("writes the network status to networkStatusFile on ADD and removes it on DEL", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "", "")
+		statusDir := filepath.Join(GinkgoT().TempDir(), "status")
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s;K8S_POD_UID=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.UID),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "networkStatusFile": %q,
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`, statusDir)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			Interfaces: []*cni100.Interface{{Name: "eth0", Sandbox: testNS.Path()}},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24"), Interface: cni100.Int(0)}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+
+		statusFile := filepath.Join(statusDir, "testUID-123456789.json")
+		data, err := os.ReadFile(statusFile)
+		Expect(err).NotTo(HaveOccurred())
+		var netStatus []nettypes.NetworkStatus
+		Expect(json.Unmarshal(data, &netStatus)).To(Succeed())
+		Expect(netStatus).To(HaveLen(1))
+		Expect(netStatus[0].Name).To(Equal("weave1"))
+		Expect(netStatus[0].IPs).To(Equal([]string{"1.1.1.2"}))
+
+		Expect(CmdDel(args, fExec, clientInfo)).To(Succeed())
+		Expect(statusFile).NotTo(BeAnExistingFile())
+	})
+
+	It("does not fail the ADD when the network status file cannot be written", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "", "")
+		// a regular file cannot be the status directory
+		statusDir := filepath.Join(GinkgoT().TempDir(), "status")
+		Expect(os.WriteFile(statusDir, nil, 0644)).To(Succeed())
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
 	    "name": "node-cni-network",
 	    "type": "multus",
 	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "networkStatusFile": %q,
 	    "delegates": [{
 	        "name": "weave1",
 	        "cniVersion": "1.0.0",
 	        "type": "weave-net"
 	    }]
-	}`),
+	}`, statusDir)),
 		}
 
 		fExec := newFakeExec()
-		expectedResult1 := &cni100.Result{
-			CNIVersion: resultCNIVersion,
-			IPs: []*cni100.IPConfig{{
-				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
-			},
-			},
-		}
+		fExec.addPlugin100(nil, "eth0", "", &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+
+		clientInfo := NewFakeClientInfo()
+		_, err := clientInfo.AddPod(fakePod)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reuses the cached delegates of a container when the pod prefers them", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+		fakePod.ObjectMeta.Annotations["v1.multus-cni.io/prefer-cached-delegates"] = "true"
+		net1 := `{
+		"name": "net1",
+		"type": "mynet",
+		"cniVersion": "1.0.0"
+	}`
 		expectedConf1 := `{
 	    "name": "weave1",
 	    "cniVersion": "1.0.0",
 	    "type": "weave-net"
 	}`
-		expectedNet1 := `{
-		"name": "net1",
-		"type": "mynet",
-		"capabilities": {
-			"mac": true,
-			"ips": true,
-			"bandwidth": true,
-			"portMappings": true
-		},
-		"runtimeConfig": {
-			"ips": [ "10.0.0.1" ],
-			"mac": "c2:11:22:33:44:66",
-			"bandwidth": {
-				"ingressRate": 2048,
-				"ingressBurst": 1600,
-				"egressRate": 4096,
-				"egressBurst": 1600
-			},
-			"portMappings": [
-			{
-				"hostPort": 8080,
-				"containerPort": 80,
-				"protocol": "tcp"
-			},
-			{
-				"hostPort": 8000,
-				"containerPort": 8001,
-				"protocol": "udp"
-			}]
-		},
-		"cniVersion": "1.0.0"
-	}`
-		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
-		fExec.addPlugin100(nil, "net1", expectedNet1, &cni100.Result{
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "%s",
+	    "delegates": [%s]
+	}`, tmpDir, expectedConf1)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
 			CNIVersion: "1.0.0",
-			IPs: []*cni100.IPConfig{{
-				Address: *testhelpers.EnsureCIDR("1.1.1.3/24"),
-			},
-			},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
+		}, nil)
+		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
 		}, nil)
 
 		clientInfo := NewFakeClientInfo()
 		_, err := clientInfo.AddPod(fakePod)
 		Expect(err).NotTo(HaveOccurred())
-
 		_, err = clientInfo.AddNetAttachDef(
 			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
 		Expect(err).NotTo(HaveOccurred())
+		netClient := clientInfo.NetClient.(*netfake.Clientset)
 
-		result, err := CmdAdd(args, fExec, clientInfo)
+		// without a cache, the delegates are resolved from the API
+		_, err = CmdAdd(args, fExec, clientInfo)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
-		r := result.(*cni100.Result)
-		// plugin 1 is the masterplugin
-		Expect(reflect.DeepEqual(r, expectedResult1)).To(BeTrue())
-
+		Expect(netClient.Actions()).NotTo(BeEmpty())
+		Expect(filepath.Join(tmpDir, args.ContainerID)).To(BeAnExistingFile())
+
+		// with a cache, the network-attachment-definitions are not looked up
+		Expect(netClient.Tracker().Delete(netdefv1.SchemeGroupVersion.WithResource("network-attachment-definitions"),
+			fakePod.ObjectMeta.Namespace, "net1")).To(Succeed())
+		netClient.ClearActions()
+		fExec.addIndex = 0
+		_, err = CmdAdd(args, fExec, clientInfo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netClient.Actions()).To(BeEmpty())
+		Expect(fExec.executed).To(Equal([]string{"ADD eth0", "ADD net1", "ADD eth0", "ADD net1"}))
 	})
 
-	It("executes delegates and kubernetes networks", func() {
-		fakePod := testhelpers.NewFakePod("testpod", "net1,net2", "")
+	It("reuses the cached delegates of a container without getting the pod", func() {
+		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
 		net1 := `{
 		"name": "net1",
 		"type": "mynet",
 		"cniVersion": "1.0.0"
 	}`
-		net2 := `{
-		"name": "net2",
-		"type": "mynet2",
-		"cniVersion": "1.0.0"
-	}`
-		net3 := `{
-		"name": "net3",
-		"type": "mynet3",
-		"cniVersion": "1.0.0"
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
 	}`
 		args := &skel.CmdArgs{
 			ContainerID: "123456789",
 			Netns:       testNS.Path(),
 			IfName:      "eth0",
 			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
-			StdinData: []byte(`{
+			StdinData: []byte(fmt.Sprintf(`{
 	    "name": "node-cni-network",
 	    "type": "multus",
-	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
-	    "delegates": [{
-	        "name": "weave1",
-	        "cniVersion": "1.0.0",
-	        "type": "weave-net"
-	    }]
-	}`),
+	    "cniDir": "%s",
+	    "preferCachedDelegates": true,
+	    "delegates": [%s]
+	}`, tmpDir, expectedConf1)),
 		}
 
 		fExec := newFakeExec()
-		expectedResult1 := &cni100.Result{
-			CNIVersion: "1.0.0",
-			IPs: []*cni100.IPConfig{{
-				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
-			},
-			},
-		}
-		expectedConf1 := `{
-	    "name": "weave1",
-	    "cniVersion": "1.0.0",
-	    "type": "weave-net"
-	}`
-		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
-		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
 			CNIVersion: "1.0.0",
-			IPs: []*cni100.IPConfig{{
-				Address: *testhelpers.EnsureCIDR("1.1.1.3/24"),
-			},
-			},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.2/24")}},
 		}, nil)
-		fExec.addPlugin100(nil, "net2", net2, &cni100.Result{
+		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
 			CNIVersion: "1.0.0",
-			IPs: []*cni100.IPConfig{{
-				Address: *testhelpers.EnsureCIDR("1.1.1.4/24"),
-			},
-			},
+			IPs:        []*cni100.IPConfig{{Address: *testhelpers.EnsureCIDR("1.1.1.3/24")}},
 		}, nil)
 
 		clientInfo := NewFakeClientInfo()
 		_, err := clientInfo.AddPod(fakePod)
 		Expect(err).NotTo(HaveOccurred())
-
 		_, err = clientInfo.AddNetAttachDef(
 			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net1", net1))
 		Expect(err).NotTo(HaveOccurred())
-		_, err = clientInfo.AddNetAttachDef(
-			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net2", net2))
-		Expect(err).NotTo(HaveOccurred())
-		// net3 is not used; make sure it's not accessed
-		_, err = clientInfo.AddNetAttachDef(
-			testhelpers.NewFakeNetAttachDef(fakePod.ObjectMeta.Namespace, "net3", net3))
+		_, err = CmdAdd(args, fExec, clientInfo)
 		Expect(err).NotTo(HaveOccurred())
 
-		result, err := CmdAdd(args, fExec, clientInfo)
+		// the pod cannot be got anymore
+		client := clientInfo.Client.(*fake.Clientset)
+		Expect(client.Tracker().Delete(kapi.SchemeGroupVersion.WithResource("pods"),
+			fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)).To(Succeed())
+		client.ClearActions()
+		recorder := clientInfo.EventRecorder.(*record.FakeRecorder)
+		Expect(collectEvents(recorder.Events)).To(HaveLen(2))
+		fExec.addIndex = 0
+		_, err = CmdAdd(args, fExec, clientInfo)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
-		// plugin 1 is the masterplugin
-		Expect(reflect.DeepEqual(result, expectedResult1)).To(BeTrue())
+		Expect(fExec.executed).To(Equal([]string{"ADD eth0", "ADD net1", "ADD eth0", "ADD net1"}))
+		// without the pod, no AddedInterface event is sent
+		Expect(collectEvents(recorder.Events)).To(BeEmpty())
+		// the pod is only got, best effort, to set the network status
+		var podGets []string
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "get" && action.GetResource().Resource == "pods" {
+				podGets = append(podGets, action.GetNamespace())
+			}
+		}
+		Expect(podGets).To(HaveLen(1))
 	})
 
-	It("executes kubernetes networks and delete it after pod removal", func() {
-		fakePod := testhelpers.NewFakePod("testpod", "net1", "")
+	It("attaches a kubernetes network into a requested netns", func() {
+		altNS, err := testutils.NewNS()
+		Expect(err).NotTo(HaveOccurred())
+		defer altNS.Close()
+
+		fakePod := testhelpers.NewFakePod("testpod", fmt.Sprintf(`[{"name":"net1","netns":%q}]`, altNS.Path()), "")
 		net1 := `{
 		"name": "net1",
 		"type": "mynet",
@@ -760,16 +4319,18 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 			Netns:       testNS.Path(),
 			IfName:      "eth0",
 			Args:        fmt.Sprintf("K8S_POD_NAME=%s;K8S_POD_NAMESPACE=%s", fakePod.ObjectMeta.Name, fakePod.ObjectMeta.Namespace),
-			StdinData: []byte(`{
+			StdinData: []byte(fmt.Sprintf(`{
 	    "name": "node-cni-network",
 	    "type": "multus",
 	    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+	    "allowNetnsRequest": true,
+	    "allowedNetnsPrefixes": [%q],
 	    "delegates": [{
 	        "name": "weave1",
 	        "cniVersion": "1.0.0",
 	        "type": "weave-net"
 	    }]
-	}`),
+	}`, filepath.Dir(altNS.Path()))),
 		}
 
 		fExec := newFakeExec()
@@ -785,8 +4346,8 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 	    "cniVersion": "1.0.0",
 	    "type": "weave-net"
 	}`
-		fExec.addPlugin100(nil, "eth0", expectedConf1, expectedResult1, nil)
-		fExec.addPlugin100(nil, "net1", net1, &cni100.Result{
+		fExec.addPlugin100([]string{"CNI_NETNS=" + testNS.Path()}, "eth0", expectedConf1, expectedResult1, nil)
+		fExec.addPlugin100([]string{"CNI_NETNS=" + altNS.Path()}, "net1", net1, &cni100.Result{
 			CNIVersion: "1.0.0",
 			IPs: []*cni100.IPConfig{{
 				Address: *testhelpers.EnsureCIDR("1.1.1.3/24"),
@@ -795,7 +4356,7 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 		}, nil)
 
 		clientInfo := NewFakeClientInfo()
-		_, err := clientInfo.AddPod(fakePod)
+		_, err = clientInfo.AddPod(fakePod)
 		Expect(err).NotTo(HaveOccurred())
 
 		_, err = clientInfo.AddNetAttachDef(
@@ -805,10 +4366,9 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 		result, err := CmdAdd(args, fExec, clientInfo)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(fExec.addIndex).To(Equal(len(fExec.plugins)))
-		// plugin 1 is the masterplugin
 		Expect(reflect.DeepEqual(result, expectedResult1)).To(BeTrue())
 
-		// set fKubeClient to nil to emulate no pod info
+		// the requested netns is taken from the cache once the pod is gone
 		clientInfo.DeletePod(fakePod.ObjectMeta.Namespace, fakePod.ObjectMeta.Name)
 		err = CmdDel(args, fExec, clientInfo)
 		Expect(err).NotTo(HaveOccurred())
@@ -858,6 +4418,50 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	DescribeTable("applies the portMappingNamespacePolicy to delegates getting port mappings", func(policy, namespace string, capability bool, expectedErr string) {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			Args:        fmt.Sprintf("K8S_POD_NAME=testpod;K8S_POD_NAMESPACE=%s", namespace),
+			StdinData: []byte(fmt.Sprintf(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "portMappingNamespacePolicy": %s,
+	    "delegates": [{
+	        "cniVersion": "1.0.0",
+	        "name": "mynet-confList",
+	        "plugins": [{"type": "firstPlugin", "capabilities": {"portMappings": %t}}]
+	    }],
+	    "runtimeConfig": {
+	        "portMappings": [{"hostPort": 8080, "containerPort": 80, "protocol": "tcp"}]
+	    }
+	}`, policy, capability)),
+		}
+
+		fExec := newFakeExec()
+		fExec.addPlugin100(nil, "eth0", "", nil, nil)
+		_, err := CmdAdd(args, fExec, nil)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			Expect(fExec.addIndex).To(Equal(0))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.addIndex).To(Equal(1))
+	},
+		Entry("allowed namespace", `{"allowedNamespaces": ["ingress"]}`, "ingress", true, ""),
+		Entry("namespace not allowed", `{"allowedNamespaces": ["ingress"]}`, "tenant", true,
+			`network "mynet-confList" requests port mappings, which the portMappingNamespacePolicy denies to namespace "tenant"`),
+		Entry("denied namespace", `{"deniedNamespaces": ["tenant"]}`, "tenant", true,
+			`network "mynet-confList" requests port mappings, which the portMappingNamespacePolicy denies to namespace "tenant"`),
+		Entry("denied namespace also allowed", `{"allowedNamespaces": ["tenant"], "deniedNamespaces": ["tenant"]}`, "tenant", true,
+			`network "mynet-confList" requests port mappings, which the portMappingNamespacePolicy denies to namespace "tenant"`),
+		Entry("namespace not denied", `{"deniedNamespaces": ["tenant"]}`, "ingress", true, ""),
+		Entry("delegate without the portMappings capability", `{"allowedNamespaces": ["ingress"]}`, "tenant", false, ""),
+		Entry("no policy", `null`, "tenant", true, ""),
+	)
+
 	It("executes clusterNetwork delegate", func() {
 		fakePod := testhelpers.NewFakePod("testpod", "", "kube-system/net1")
 		net1 := `{
@@ -1088,6 +4692,114 @@ var _ = Describe("multus operations cniVersion 1.0.0 config", func() {
 		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
 	})
 
+	It("Verify the cache is created in an env-expanded dataDir", func() {
+		tmpCNIDir := tmpDir + "/nodeLocalCache"
+		os.Setenv("MULTUS_CACHE_DIR", tmpCNIDir)
+		defer os.Unsetenv("MULTUS_CACHE_DIR")
+
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "$MULTUS_CACHE_DIR",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+
+		fExec := newFakeExec()
+		expectedConf1 := `{
+	    "name": "weave1",
+	    "cniVersion": "1.0.0",
+	    "type": "weave-net"
+	}`
+		fExec.addPlugin100(nil, "eth0", expectedConf1, &cni100.Result{
+			CNIVersion: "1.0.0",
+			IPs: []*cni100.IPConfig{{
+				Address: *testhelpers.EnsureCIDR("1.1.1.2/24"),
+			},
+			},
+		}, nil)
+
+		_, err := CmdAdd(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Verify cache file existence")
+		_, err = os.Stat(filepath.Join(tmpCNIDir, "123456789"))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = CmdDel(args, fExec, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fExec.delIndex).To(Equal(len(fExec.plugins)))
+	})
+
+	It("resolves cniDir from literal and env-expanded paths", func() {
+		literal := filepath.Join(tmpDir, "literal")
+		cniDir, err := resolveCNIDir(literal)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cniDir).To(Equal(literal))
+		Expect(literal).To(BeADirectory())
+
+		os.Setenv("MULTUS_TEST_CACHE_ROOT", tmpDir)
+		defer os.Unsetenv("MULTUS_TEST_CACHE_ROOT")
+		cniDir, err = resolveCNIDir("${MULTUS_TEST_CACHE_ROOT}/expanded")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cniDir).To(Equal(filepath.Join(tmpDir, "expanded")))
+		Expect(cniDir).To(BeADirectory())
+
+		// unset variables leave the configured value untouched
+		os.Unsetenv("MULTUS_TEST_UNSET_ROOT")
+		unset := filepath.Join(tmpDir, "$MULTUS_TEST_UNSET_ROOT")
+		cniDir, err = resolveCNIDir(unset)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cniDir).To(Equal(unset))
+	})
+
+	It("lists the cached containers of a missing cniDir without creating it", func() {
+		os.Setenv("MULTUS_TEST_CACHE_ROOT", tmpDir)
+		defer os.Unsetenv("MULTUS_TEST_CACHE_ROOT")
+		containers, err := ListCachedContainers("${MULTUS_TEST_CACHE_ROOT}/missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers).To(BeEmpty())
+		Expect(filepath.Join(tmpDir, "missing")).NotTo(BeAnExistingFile())
+	})
+
+	It("rejects a cniDir that cannot be created", func() {
+		notADir := filepath.Join(tmpDir, "file")
+		Expect(os.WriteFile(notADir, []byte("x"), 0600)).To(Succeed())
+
+		os.Setenv("MULTUS_CACHE_DIR", filepath.Join(notADir, "cache"))
+		defer os.Unsetenv("MULTUS_CACHE_DIR")
+		_, err := resolveCNIDir("$MULTUS_CACHE_DIR")
+		Expect(err).To(HaveOccurred())
+
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+			StdinData: []byte(`{
+	    "name": "node-cni-network",
+	    "type": "multus",
+	    "cniDir": "$MULTUS_CACHE_DIR",
+	    "delegates": [{
+	        "name": "weave1",
+	        "cniVersion": "1.0.0",
+	        "type": "weave-net"
+	    }]
+	}`),
+		}
+		fExec := newFakeExec()
+		_, err = CmdAdd(args, fExec, nil)
+		Expect(err).To(MatchError(ContainSubstring("error resolving cniDir")))
+		Expect(fExec.addIndex).To(Equal(0))
+	})
+
 	It("Delete pod without cache", func() {
 		tmpCNIDir := tmpDir + "/cniData"
 		err := os.Mkdir(tmpCNIDir, 0777)
@@ -21,10 +21,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	cnitypes "github.com/containernetworking/cni/pkg/types"
 	cni020 "github.com/containernetworking/cni/pkg/types/020"
 	cni040 "github.com/containernetworking/cni/pkg/types/040"
@@ -32,6 +36,7 @@ import (
 	cniversion "github.com/containernetworking/cni/pkg/version"
 	netfake "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/fake"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/record"
 
@@ -50,11 +55,50 @@ type fakePlugin struct {
 	expectedIfname string
 	result         cnitypes.Result
 	err            error
+	stderr         []byte
+	// the first transientFailures ADDs fail with transientErr; the DELs
+	// that clean up after them succeed without consuming a DEL
+	transientFailures int
+	transientErr      error
+	transientDels     int
+	// the ADD blocks until the ADDs of all the plugins sharing the barrier
+	// started
+	barrier *addBarrier
+}
+
+// addBarrier holds the ADDs of its plugins until all of them started, i.e.
+// until they run in parallel
+type addBarrier struct {
+	wg sync.WaitGroup
+}
+
+func newAddBarrier(plugins int) *addBarrier {
+	b := &addBarrier{}
+	b.wg.Add(plugins)
+	return b
+}
+
+func (b *addBarrier) wait() error {
+	b.wg.Done()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("the ADDs did not run in parallel")
+	}
 }
 
 type fakeExec struct {
 	cniversion.PluginDecoder
 
+	// the delegates of parallelDelegates are executed concurrently
+	mu sync.Mutex
+
 	addIndex        int
 	delIndex        int
 	chkIndex        int
@@ -62,11 +106,20 @@ type fakeExec struct {
 	gcIndex         int
 	expectedDelSkip int
 	plugins         map[string]*fakePlugin
+	stderr          io.Writer
+	// executed records "<command> <ifname>" of each call, in order
+	executed []string
+	// environs records the environment of the last call per ifname
+	environs map[string][]string
+	// stdins records the config of the last call per ifname
+	stdins map[string][]byte
 }
 
 func newFakeExec() *fakeExec {
 	return &fakeExec{
-		plugins: map[string]*fakePlugin{},
+		plugins:  map[string]*fakePlugin{},
+		environs: map[string][]string{},
+		stdins:   map[string][]byte{},
 	}
 }
 
@@ -109,6 +162,13 @@ func (f *fakeExec) addPlugin020(expectedEnv []string, expectedIfname, expectedCo
 	}
 }
 
+func (p *fakePlugin) getBarrier() *addBarrier {
+	if p == nil {
+		return nil
+	}
+	return p.barrier
+}
+
 func matchArray(a1, a2 []string) {
 	Expect(len(a1)).To(Equal(len(a2)))
 	for _, e1 := range a1 {
@@ -153,10 +213,33 @@ func ParseEnvironment(environ []string) map[string]string {
 func (f *fakeExec) ExecPlugin(_ context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
 	envMap := ParseEnvironment(environ)
 	cmd := envMap["CNI_COMMAND"]
+	f.mu.Lock()
+	barrier := f.plugins[envMap["CNI_IFNAME"]].getBarrier()
+	f.mu.Unlock()
+	if cmd == "ADD" && barrier != nil {
+		if err := barrier.wait(); err != nil {
+			return nil, err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	var index int
 	var err error
 	var resultJSON []byte
 
+	if plugin := f.plugins[envMap["CNI_IFNAME"]]; cmd == "ADD" && plugin != nil && plugin.transientFailures > 0 {
+		plugin.transientFailures--
+		plugin.transientDels++
+		f.executed = append(f.executed, cmd+" "+envMap["CNI_IFNAME"])
+		return nil, plugin.transientErr
+	}
+	if plugin := f.plugins[envMap["CNI_IFNAME"]]; cmd == "DEL" && plugin != nil && plugin.transientDels > 0 {
+		plugin.transientDels--
+		f.executed = append(f.executed, cmd+" "+envMap["CNI_IFNAME"])
+		return nil, nil
+	}
+
 	switch cmd {
 	case "ADD":
 		Expect(len(f.plugins)).To(BeNumerically(">", f.addIndex))
@@ -183,6 +266,9 @@ func (f *fakeExec) ExecPlugin(_ context.Context, pluginPath string, stdinData []
 		Expect(false).To(BeTrue())
 	}
 	plugin := f.plugins[envMap["CNI_IFNAME"]]
+	f.executed = append(f.executed, cmd+" "+envMap["CNI_IFNAME"])
+	f.environs[envMap["CNI_IFNAME"]] = environ
+	f.stdins[envMap["CNI_IFNAME"]] = stdinData
 
 	//GinkgoT().Logf("[%s %d] exec plugin %q found %+v\n", cmd, index, pluginPath, plugin)
 	fmt.Printf("[%s %d] exec plugin %q found %+v\n", cmd, index, pluginPath, plugin)
@@ -222,11 +308,22 @@ func (f *fakeExec) ExecPlugin(_ context.Context, pluginPath string, stdinData []
 		return nil, plugin.err
 	}
 
+	if f.stderr != nil && len(plugin.stderr) > 0 {
+		_, _ = f.stderr.Write(plugin.stderr)
+	}
+
 	resultJSON, err = json.Marshal(plugin.result)
 	Expect(err).NotTo(HaveOccurred())
 	return resultJSON, nil
 }
 
+func (f *fakeExec) WithStderr(stderr io.Writer) invoke.Exec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stderr = stderr
+	return f
+}
+
 func (f *fakeExec) FindInPath(plugin string, paths []string) (string, error) {
 	Expect(len(paths)).To(BeNumerically(">", 0))
 	return filepath.Join(paths[0], plugin), nil
@@ -241,6 +338,23 @@ func NewFakeClientInfo() *k8sclient.ClientInfo {
 	}
 }
 
+// failingRecorder is an event recorder panicking on any event
+type failingRecorder struct{}
+
+var _ record.EventRecorder = failingRecorder{}
+
+func (failingRecorder) Event(_ runtime.Object, _, _, _ string) {
+	panic("failed to record the event")
+}
+
+func (failingRecorder) Eventf(_ runtime.Object, _, _, _ string, _ ...interface{}) {
+	panic("failed to record the event")
+}
+
+func (failingRecorder) AnnotatedEventf(_ runtime.Object, _ map[string]string, _, _, _ string, _ ...interface{}) {
+	panic("failed to record the event")
+}
+
 func collectEvents(source <-chan string) []string {
 	done := false
 	events := make([]string, 0)
@@ -0,0 +1,157 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// NamespaceInterfaceQuota counts the secondary interfaces, i.e. the interfaces
+// of the delegates other than the master plugin, attached to the containers of
+// each namespace, and rejects the ADDs which would exceed quota of them
+type NamespaceInterfaceQuota struct {
+	sync.Mutex
+	quota int
+	// counts are the secondary interfaces by container ID, by namespace
+	counts map[string]map[string]int
+}
+
+type namespaceQuotaKey struct{}
+
+// NewNamespaceInterfaceQuota returns a NamespaceInterfaceQuota allowing quota
+// secondary interfaces per namespace
+func NewNamespaceInterfaceQuota(quota int) *NamespaceInterfaceQuota {
+	return &NamespaceInterfaceQuota{
+		quota:  quota,
+		counts: map[string]map[string]int{},
+	}
+}
+
+// WithNamespaceInterfaceQuota returns a context whose CNI ADD and DEL account
+// the secondary interfaces of the containers with q
+func WithNamespaceInterfaceQuota(ctx context.Context, q *NamespaceInterfaceQuota) context.Context {
+	return context.WithValue(ctx, namespaceQuotaKey{}, q)
+}
+
+// namespaceInterfaceQuota returns the NamespaceInterfaceQuota of the context,
+// if any
+func namespaceInterfaceQuota(ctx context.Context) *NamespaceInterfaceQuota {
+	q, _ := ctx.Value(namespaceQuotaKey{}).(*NamespaceInterfaceQuota)
+	return q
+}
+
+// namespaceQuotaError is the error of an ADD over the quota of its namespace
+type namespaceQuotaError struct {
+	message string
+}
+
+func (e *namespaceQuotaError) Error() string { return e.message }
+
+// Reserve accounts the secondary interfaces of the container, replacing those
+// of a previous ADD of it, or returns an error if the namespace would then
+// exceed its quota
+func (q *NamespaceInterfaceQuota) Reserve(namespace, containerID string, interfaces int) error {
+	q.Lock()
+	defer q.Unlock()
+	containers := q.counts[namespace]
+	attached := 0
+	for id, count := range containers {
+		if id != containerID {
+			attached += count
+		}
+	}
+	if interfaces > 0 && attached+interfaces > q.quota {
+		return &namespaceQuotaError{fmt.Sprintf("namespace %q is over its quota of %d secondary interfaces: %d are attached, container %s requests %d", namespace, q.quota, attached, containerID, interfaces)}
+	}
+	if containers == nil {
+		containers = map[string]int{}
+		q.counts[namespace] = containers
+	}
+	containers[containerID] = interfaces
+	return nil
+}
+
+// Release forgets the secondary interfaces of the container
+func (q *NamespaceInterfaceQuota) Release(namespace, containerID string) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.counts[namespace], containerID)
+	if len(q.counts[namespace]) == 0 {
+		delete(q.counts, namespace)
+	}
+}
+
+// Count returns the number of secondary interfaces attached in the namespace
+func (q *NamespaceInterfaceQuota) Count(namespace string) int {
+	q.Lock()
+	defer q.Unlock()
+	attached := 0
+	for _, count := range q.counts[namespace] {
+		attached += count
+	}
+	return attached
+}
+
+// Rebuild replaces the accounting with the secondary interfaces of the
+// containers cached in cniDir, e.g. once the daemon restarted. Namespaces
+// may then be over their quota, in which case their ADDs fail until enough
+// interfaces are released.
+func (q *NamespaceInterfaceQuota) Rebuild(cniDir string) error {
+	containers, err := ListCachedContainers(cniDir)
+	if err != nil {
+		return err
+	}
+	q.Lock()
+	defer q.Unlock()
+	q.counts = map[string]map[string]int{}
+	for _, container := range containers {
+		namespace := string(container.K8sArgs.K8S_POD_NAMESPACE)
+		if namespace == "" {
+			logging.Debugf("NamespaceInterfaceQuota: no namespace for container %s, skipped", container.ContainerID)
+			continue
+		}
+		if q.counts[namespace] == nil {
+			q.counts[namespace] = map[string]int{}
+		}
+		q.counts[namespace][container.ContainerID] = secondaryInterfaces(container.Delegates)
+	}
+	for namespace := range q.counts {
+		attached := 0
+		for _, count := range q.counts[namespace] {
+			attached += count
+		}
+		if attached > q.quota {
+			logging.Verbosef("warning: namespace %q has %d secondary interfaces, over its quota of %d", namespace, attached, q.quota)
+		}
+	}
+	return nil
+}
+
+// secondaryInterfaces returns the number of delegates other than the master
+// plugin
+func secondaryInterfaces(delegates []*types.DelegateNetConf) int {
+	count := 0
+	for _, delegate := range delegates {
+		if !delegate.MasterPlugin {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"fmt"
+
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	cni100 "github.com/containernetworking/cni/pkg/types/100"
+	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	nadutils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// BuildNetworkStatus computes, without a cluster, the network status multus
+// would write for the delegates from a result holding the interfaces of all
+// of them. The pod interfaces of a delegate are the ones named as multus
+// names them: its requested interface, net<index> for the secondary
+// delegates, and the remaining ones for the default network. The gateways of
+// the default routes only go to the default network.
+func BuildNetworkStatus(result cnitypes.Result, delegates []*types.DelegateNetConf) ([]nettypes.NetworkStatus, error) {
+	res, err := cni100.NewResultFromResult(result)
+	if err != nil {
+		return nil, fmt.Errorf("error converting the result to %s: %v", cni100.ImplementedSpecVersion, err)
+	}
+
+	// the interface names of the delegates; the default network, unless it
+	// requests one, gets the interfaces no other delegate claims
+	ifNames := make([]string, len(delegates))
+	claimed := map[string]bool{}
+	for idx, delegate := range delegates {
+		if delegate.IfnameRequest == "" && delegate.MasterPlugin {
+			continue
+		}
+		ifNames[idx] = getIfname(delegate, "", idx)
+		claimed[ifNames[idx]] = true
+	}
+
+	var netStatuses []nettypes.NetworkStatus
+	for idx, delegate := range delegates {
+		owns := func(iface *cni100.Interface) bool {
+			if ifNames[idx] == "" {
+				return !claimed[iface.Name]
+			}
+			return iface.Name == ifNames[idx]
+		}
+
+		// the interfaces of the other delegates are left out of the pod
+		// interfaces, keeping the indexes of the IPs
+		delegateResult := *res
+		if !delegate.MasterPlugin {
+			delegateResult.Routes = nil
+		}
+		delegateResult.Interfaces = make([]*cni100.Interface, 0, len(res.Interfaces))
+		found := false
+		for _, iface := range res.Interfaces {
+			if iface.Sandbox != "" && !owns(iface) {
+				iface = &cni100.Interface{Name: iface.Name, Mac: iface.Mac, Mtu: iface.Mtu}
+			} else if iface.Sandbox != "" {
+				found = true
+			}
+			delegateResult.Interfaces = append(delegateResult.Interfaces, iface)
+		}
+		if !found {
+			continue
+		}
+
+		statuses, err := nadutils.CreateNetworkStatuses(&delegateResult, delegate.Name, delegate.MasterPlugin, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the network status of delegate %q: %v", delegate.Name, err)
+		}
+		for _, status := range statuses {
+			netStatuses = append(netStatuses, *status)
+		}
+	}
+	return netStatuses, nil
+}
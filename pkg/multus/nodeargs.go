@@ -0,0 +1,147 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// nodeCNIArgsFile is a parsed nodeCNIArgsFile, reused as long as the file is
+// not modified
+type nodeCNIArgsFile struct {
+	modTime time.Time
+	size    int64
+	args    map[string]string
+}
+
+var nodeCNIArgsCache = struct {
+	sync.Mutex
+	files map[string]*nodeCNIArgsFile
+}{files: map[string]*nodeCNIArgsFile{}}
+
+// loadNodeCNIArgs returns the args of the nodeCNIArgsFile at path, which has
+// one key=value per line; empty lines and lines starting with # are skipped.
+// A missing file has no args.
+func loadNodeCNIArgs(path string) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		logging.Debugf("loadNodeCNIArgs: no node CNI args file @ %s", path)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	nodeCNIArgsCache.Lock()
+	defer nodeCNIArgsCache.Unlock()
+	if cached, ok := nodeCNIArgsCache.files[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.args, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid line %d of %s: must be key=value", line, path)
+		}
+		args[key] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	nodeCNIArgsCache.files[path] = &nodeCNIArgsFile{modTime: info.ModTime(), size: info.Size(), args: args}
+	return args, nil
+}
+
+// injectNodeCNIArgs merges the args of the nodeCNIArgsFile into the CNI args
+// of the delegates, or of all the plugins of conflist delegates, keeping the
+// args they already have
+func injectNodeCNIArgs(delegates []*types.DelegateNetConf, path string) error {
+	args, err := loadNodeCNIArgs(path)
+	if err != nil {
+		return fmt.Errorf("error loading the node CNI args: %v", err)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	for _, delegate := range delegates {
+		conf := map[string]interface{}{}
+		if err := json.Unmarshal(delegate.Bytes, &conf); err != nil {
+			return err
+		}
+		targets := []interface{}{conf}
+		if delegate.ConfListPlugin {
+			targets, _ = conf["plugins"].([]interface{})
+		}
+		for _, target := range targets {
+			plugin, ok := target.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid plugin in delegate %q", delegate.Name)
+			}
+			if err := mergeCNIArgs(plugin, args); err != nil {
+				return fmt.Errorf("delegate %q: %v", delegate.Name, err)
+			}
+		}
+		if delegate.Bytes, err = json.Marshal(conf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeCNIArgs adds the args missing from the args.cni of a plugin config
+func mergeCNIArgs(plugin map[string]interface{}, args map[string]string) error {
+	if _, ok := plugin["args"]; !ok {
+		plugin["args"] = map[string]interface{}{}
+	}
+	pluginArgs, ok := plugin["args"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("args must be an object")
+	}
+	if _, ok := pluginArgs["cni"]; !ok {
+		pluginArgs["cni"] = map[string]interface{}{}
+	}
+	cniArgs, ok := pluginArgs["cni"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("args.cni must be an object")
+	}
+	for key, value := range args {
+		if _, ok := cniArgs[key]; !ok {
+			cniArgs[key] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// defaultPostAddProbeTimeout bounds the post-ADD probes without timeoutSeconds
+const defaultPostAddProbeTimeout = time.Second
+
+// runPostAddProbe runs the probe from the network namespace netnsPath; it is
+// a variable so that the tests can stub it
+var runPostAddProbe = func(netnsPath string, probe *types.PostAddProbe) error {
+	timeout := defaultPostAddProbeTimeout
+	if probe.TimeoutSeconds > 0 {
+		timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	return ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		switch probe.Protocol {
+		case types.PostAddProbeTCP:
+			conn, err := net.DialTimeout("tcp", probe.Target, timeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		case types.PostAddProbeICMP:
+			return icmpEcho(probe.Target, timeout)
+		}
+		return fmt.Errorf("unknown probe protocol %q", probe.Protocol)
+	})
+}
+
+// icmpEcho sends an ICMP echo request to target and waits for the reply
+func icmpEcho(target string, timeout time.Duration) error {
+	network, request, reply := "ip4:icmp", byte(8), byte(0)
+	if ip := net.ParseIP(target); ip != nil && ip.To4() == nil {
+		network, request, reply = "ip6:ipv6-icmp", byte(128), byte(129)
+	}
+	conn, err := net.DialTimeout(network, target, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	id := os.Getpid() & 0xffff
+	msg := []byte{request, 0, 0, 0, byte(id >> 8), byte(id), 0, 1, 'm', 'u', 'l', 't', 'u', 's'}
+	if reply == 0 {
+		// the kernel computes the checksum of ICMPv6 only
+		sum := icmpChecksum(msg)
+		msg[2], msg[3] = byte(sum>>8), byte(sum)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+
+	// unlike Read, ReadFrom strips the IPv4 header of the replies
+	ipConn, ok := conn.(*net.IPConn)
+	if !ok {
+		return fmt.Errorf("unexpected connection type %T", conn)
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := ipConn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("no ICMP echo reply from %s: %v", target, err)
+		}
+		// the raw socket gets the replies to the other pings too
+		if n >= 8 && buf[0] == reply && int(buf[4])<<8|int(buf[5]) == id {
+			return nil
+		}
+	}
+}
+
+// icmpChecksum is the internet checksum (RFC 1071) of msg
+func icmpChecksum(msg []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	if len(msg)%2 == 1 {
+		sum += uint32(msg[len(msg)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
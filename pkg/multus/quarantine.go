@@ -0,0 +1,173 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+)
+
+// NetAttachDefQuarantine counts the consecutive ADD failures of the delegates
+// of each net-attach-def and, once threshold of them happened within window,
+// quarantines it: its ADDs fail fast until its resourceVersion changes
+type NetAttachDefQuarantine struct {
+	sync.Mutex
+	threshold int
+	window    time.Duration
+	now       func() time.Time
+	entries   map[string]*quarantineEntry
+	// onChange, if set, is called with the number of quarantined
+	// net-attach-defs whenever it changes
+	onChange func(int)
+}
+
+type quarantineEntry struct {
+	resourceVersion string
+	failures        int
+	firstFailure    time.Time
+	quarantined     bool
+}
+
+type quarantineKey struct{}
+
+// NewNetAttachDefQuarantine returns a NetAttachDefQuarantine quarantining the
+// net-attach-defs after threshold consecutive ADD failures within window
+func NewNetAttachDefQuarantine(threshold int, window time.Duration, onChange func(int)) *NetAttachDefQuarantine {
+	return &NetAttachDefQuarantine{
+		threshold: threshold,
+		window:    window,
+		now:       time.Now,
+		entries:   map[string]*quarantineEntry{},
+		onChange:  onChange,
+	}
+}
+
+// WithNetAttachDefQuarantine returns a context whose CNI ADD checks and
+// records the ADDs of the net-attach-def delegates with q
+func WithNetAttachDefQuarantine(ctx context.Context, q *NetAttachDefQuarantine) context.Context {
+	return context.WithValue(ctx, quarantineKey{}, q)
+}
+
+// netAttachDefQuarantine returns the NetAttachDefQuarantine of the context, if
+// any
+func netAttachDefQuarantine(ctx context.Context) *NetAttachDefQuarantine {
+	q, _ := ctx.Value(quarantineKey{}).(*NetAttachDefQuarantine)
+	return q
+}
+
+// Check returns an error if the net-attach-def is quarantined at the given
+// resourceVersion; a new resourceVersion clears its quarantine and failures
+func (q *NetAttachDefQuarantine) Check(netAttachDef, resourceVersion string) error {
+	q.Lock()
+	defer q.Unlock()
+	e, ok := q.entries[netAttachDef]
+	if !ok {
+		return nil
+	}
+	if e.resourceVersion != resourceVersion {
+		if e.quarantined {
+			logging.Verbosef("net-attach-def %q was updated, clearing its quarantine", netAttachDef)
+		}
+		q.forget(netAttachDef)
+		return nil
+	}
+	if e.quarantined {
+		return fmt.Errorf("net-attach-def %q is quarantined after %d consecutive ADD failures, until it is updated", netAttachDef, e.failures)
+	}
+	return nil
+}
+
+// RecordFailure counts a failed ADD of a delegate of the net-attach-def and
+// quarantines it once threshold failures happened within window
+func (q *NetAttachDefQuarantine) RecordFailure(netAttachDef, resourceVersion string) {
+	q.Lock()
+	defer q.Unlock()
+	now := q.now()
+	e, ok := q.entries[netAttachDef]
+	if !ok || e.resourceVersion != resourceVersion || now.Sub(e.firstFailure) > q.window {
+		if ok && e.quarantined {
+			q.forget(netAttachDef)
+		}
+		e = &quarantineEntry{resourceVersion: resourceVersion, firstFailure: now}
+		q.entries[netAttachDef] = e
+	}
+	e.failures++
+	if !e.quarantined && e.failures >= q.threshold {
+		e.quarantined = true
+		_ = logging.Errorf("net-attach-def %q is quarantined after %d consecutive ADD failures within %v", netAttachDef, e.failures, q.window)
+		q.changed()
+	}
+}
+
+// RecordSuccess resets the failures of the net-attach-def
+func (q *NetAttachDefQuarantine) RecordSuccess(netAttachDef string) {
+	q.Lock()
+	defer q.Unlock()
+	q.forget(netAttachDef)
+}
+
+// Forget clears the quarantine and failures of the net-attach-def, e.g. once
+// it is updated or deleted
+func (q *NetAttachDefQuarantine) Forget(netAttachDef string) {
+	q.Lock()
+	defer q.Unlock()
+	q.forget(netAttachDef)
+}
+
+// Quarantined returns the sorted namespace/name of the quarantined
+// net-attach-defs
+func (q *NetAttachDefQuarantine) Quarantined() []string {
+	q.Lock()
+	defer q.Unlock()
+	var quarantined []string
+	for name, e := range q.entries {
+		if e.quarantined {
+			quarantined = append(quarantined, name)
+		}
+	}
+	sort.Strings(quarantined)
+	return quarantined
+}
+
+func (q *NetAttachDefQuarantine) forget(netAttachDef string) {
+	e, ok := q.entries[netAttachDef]
+	if !ok {
+		return
+	}
+	delete(q.entries, netAttachDef)
+	if e.quarantined {
+		q.changed()
+	}
+}
+
+// changed reports the number of quarantined net-attach-defs to onChange; the
+// lock must be held
+func (q *NetAttachDefQuarantine) changed() {
+	if q.onChange == nil {
+		return
+	}
+	count := 0
+	for _, e := range q.entries {
+		if e.quarantined {
+			count++
+		}
+	}
+	q.onChange(count)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+type delegateSummaryKey struct{}
+
+// WithDelegateSummary returns a context whose CNI ADD writes to w, for
+// debugging, the delegates in the order they are added and the result of
+// each of them
+func WithDelegateSummary(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, delegateSummaryKey{}, w)
+}
+
+// summarizeDelegates writes the delegates, in ADD order, to the summary
+// writer of the context, if any
+func summarizeDelegates(ctx context.Context, containerID string, delegates []*types.DelegateNetConf, addOrder []int, argIfName string) {
+	w, ok := ctx.Value(delegateSummaryKey{}).(io.Writer)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(w, "multus: ADD of container %s, delegates in order:\n", containerID)
+	for pos, idx := range addOrder {
+		delegate := delegates[idx]
+		fmt.Fprintf(w, "  %d. %s on %s\n", pos+1, delegateNetName(delegate), getIfname(delegate, argIfName, idx))
+	}
+}
+
+// summarizeDelegateResult writes the result of a delegate to the summary
+// writer of the context, if any
+func summarizeDelegateResult(ctx context.Context, netName, ifName string, result cnitypes.Result) {
+	w, ok := ctx.Value(delegateSummaryKey{}).(io.Writer)
+	if !ok {
+		return
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintf(w, "multus: result of %s on %s: cannot be encoded: %v\n", netName, ifName, err)
+		return
+	}
+	fmt.Fprintf(w, "multus: result of %s on %s: %s\n", netName, ifName, b)
+}
+
+// delegateNetName returns the name of the CNI config, or config list, of the
+// delegate
+func delegateNetName(delegate *types.DelegateNetConf) string {
+	if delegate.Conf.Name != "" {
+		return delegate.Conf.Name
+	}
+	return delegate.ConfList.Name
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+)
+
+// Warnings collects the issues of a CNI operation which did not fail it, such
+// as the stderr output of a successful delegate
+type Warnings struct {
+	sync.Mutex
+	list []string
+}
+
+type warningsKey struct{}
+
+// WithWarnings returns a context whose CNI operation reports its warnings to
+// the returned Warnings
+func WithWarnings(ctx context.Context) (context.Context, *Warnings) {
+	w := &Warnings{}
+	return context.WithValue(ctx, warningsKey{}, w), w
+}
+
+// List returns the warnings collected so far
+func (w *Warnings) List() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.list...)
+}
+
+// warnf logs a warning and reports it to the Warnings of the context, if any
+func warnf(ctx context.Context, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	logging.Verbosef("warning: %s", msg)
+	if w, ok := ctx.Value(warningsKey{}).(*Warnings); ok {
+		w.Lock()
+		w.list = append(w.list, msg)
+		w.Unlock()
+	}
+}
@@ -41,6 +41,30 @@ const (
 
 	// MultusHealthAPIEndpoint is an endpoint API clients can query to know if they can communicate w/ multus server
 	MultusHealthAPIEndpoint = "/healthz"
+
+	// MultusInterfaceOwnerAPIEndpoint is an endpoint to find the delegate which
+	// created an interface, given the containerID and ifName query parameters
+	MultusInterfaceOwnerAPIEndpoint = "/interface-owner"
+
+	// MultusNetAttachDefResyncAPIEndpoint is an endpoint to relist the
+	// net-attach-defs into the informer cache of multus-daemon
+	MultusNetAttachDefResyncAPIEndpoint = "/resync-net-attach-defs"
+
+	// MultusConfigRegenerateAPIEndpoint is an endpoint to regenerate the
+	// multus configuration from the primary CNI configuration on demand
+	MultusConfigRegenerateAPIEndpoint = "/regenerate-config"
+
+	// MultusVersionAPIEndpoint is an endpoint returning the version of
+	// multus-daemon
+	MultusVersionAPIEndpoint = "/version"
+
+	// MultusDebugBundleAPIEndpoint is an endpoint returning the diagnostics
+	// of multus-daemon: its version, configuration, attachments, recent
+	// errors and metrics
+	MultusDebugBundleAPIEndpoint = "/debug/bundle"
+
+	// versionRequestTimeout is the timeout of the version requests
+	versionRequestTimeout = 5 * time.Second
 )
 
 // DoCNI sends a CNI request to the CNI server via JSON + HTTP over a root-owned unix socket,
@@ -113,3 +137,51 @@ func CheckAPIReadyNow(socketPath string) error {
 	}
 	return nil
 }
+
+// GetVersion returns the version of multus-daemon over HTTP
+func GetVersion(socketPath string) (string, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(_, _ string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+		Timeout: versionRequestTimeout,
+	}
+
+	resp, err := client.Get(GetAPIEndpoint(MultusVersionAPIEndpoint))
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %v", socketPath, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the version response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("version request failed with status %v: '%s'", resp.StatusCode, string(body))
+	}
+
+	version := &VersionResponse{}
+	if err := json.Unmarshal(body, version); err != nil {
+		return "", fmt.Errorf("failed to unmarshal the version response '%s': %v", string(body), err)
+	}
+	return version.Version, nil
+}
+
+// CheckDaemon returns the version of multus-daemon, asked over the socket of
+// the transport in socketDir, to check that the shim can reach it without
+// sending a CNI request
+func CheckDaemon(socketDir, transport string) (string, error) {
+	if socketDir == "" {
+		socketDir = defaultMultusRunDir
+	}
+	switch transport {
+	case "", TransportHTTP:
+		return GetVersion(SocketPath(socketDir))
+	case TransportGRPC:
+		return GetVersionGRPC(GRPCSocketPath(socketDir))
+	}
+	return "", fmt.Errorf("unknown daemonTransport %q, must be %q or %q", transport, TransportHTTP, TransportGRPC)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative multus.proto
+
+const (
+	grpcSocketName = "multus-grpc.sock"
+
+	// TransportHTTP selects the HTTP API of multus-daemon (default)
+	TransportHTTP = "http"
+	// TransportGRPC selects the gRPC API of multus-daemon
+	TransportGRPC = "grpc"
+)
+
+// GRPCSocketPath returns the path of the gRPC unix socket in rundir
+func GRPCSocketPath(rundir string) string {
+	return filepath.Join(rundir, grpcSocketName)
+}
+
+// NewGRPCServer returns a gRPC server which serves srv as the multus.v1.CNI service
+func NewGRPCServer(srv CNIServer) *grpc.Server {
+	s := grpc.NewServer()
+	RegisterCNIServer(s, srv)
+	return s
+}
+
+// GRPCMethod returns the gRPC method serving the given CNI command, or an
+// empty string if the command is only served over HTTP
+func GRPCMethod(cniCommand string) string {
+	switch strings.ToUpper(cniCommand) {
+	case "ADD":
+		return "Add"
+	case "CHECK":
+		return "Check"
+	case "DEL":
+		return "Del"
+	}
+	return ""
+}
+
+func dialGRPC(socketPath string) (*grpc.ClientConn, error) {
+	return grpc.Dial("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+// DoCNIGRPC sends a CNI request to the gRPC service of the CNI server over a
+// root-owned unix socket, and returns the result
+func DoCNIGRPC(req *Request, socketPath string) ([]byte, error) {
+	method := GRPCMethod(req.Env["CNI_COMMAND"])
+	if method == "" {
+		return nil, fmt.Errorf("CNI command %q is not served over gRPC", req.Env["CNI_COMMAND"])
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CNI request %v: %v", req, err)
+	}
+
+	conn, err := dialGRPC(socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", socketPath, err)
+	}
+	defer conn.Close()
+
+	resp := &CNIResponse{}
+	if err := conn.Invoke(context.Background(), "/"+CNI_ServiceDesc.ServiceName+"/"+method, &CNIRequest{Request: data}, resp); err != nil {
+		return nil, fmt.Errorf("CNI request failed with status %v: '%s'", status.Code(err), status.Convert(err).Message())
+	}
+	return resp.GetResponse(), nil
+}
+
+// GetVersionGRPC returns the version of multus-daemon over gRPC
+func GetVersionGRPC(socketPath string) (string, error) {
+	conn, err := dialGRPC(socketPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %v", socketPath, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionRequestTimeout)
+	defer cancel()
+	resp, err := NewCNIClient(conn).Version(ctx, &VersionRequest{})
+	if err != nil {
+		return "", fmt.Errorf("version request failed with status %v: '%s'", status.Code(err), status.Convert(err).Message())
+	}
+	return resp.GetVersion(), nil
+}
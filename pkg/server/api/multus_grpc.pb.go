@@ -0,0 +1,237 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gRPC alternative to the HTTP API of multus-daemon. multus.pb.go and
+// multus_grpc.pb.go are generated from this file by go generate.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: multus.proto
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CNI_Add_FullMethodName     = "/multus.v1.CNI/Add"
+	CNI_Check_FullMethodName   = "/multus.v1.CNI/Check"
+	CNI_Del_FullMethodName     = "/multus.v1.CNI/Del"
+	CNI_Version_FullMethodName = "/multus.v1.CNI/Version"
+)
+
+// CNIClient is the client API for CNI service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CNIClient interface {
+	Add(ctx context.Context, in *CNIRequest, opts ...grpc.CallOption) (*CNIResponse, error)
+	Check(ctx context.Context, in *CNIRequest, opts ...grpc.CallOption) (*CNIResponse, error)
+	Del(ctx context.Context, in *CNIRequest, opts ...grpc.CallOption) (*CNIResponse, error)
+	Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error)
+}
+
+type cNIClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCNIClient(cc grpc.ClientConnInterface) CNIClient {
+	return &cNIClient{cc}
+}
+
+func (c *cNIClient) Add(ctx context.Context, in *CNIRequest, opts ...grpc.CallOption) (*CNIResponse, error) {
+	out := new(CNIResponse)
+	err := c.cc.Invoke(ctx, CNI_Add_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) Check(ctx context.Context, in *CNIRequest, opts ...grpc.CallOption) (*CNIResponse, error) {
+	out := new(CNIResponse)
+	err := c.cc.Invoke(ctx, CNI_Check_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) Del(ctx context.Context, in *CNIRequest, opts ...grpc.CallOption) (*CNIResponse, error) {
+	out := new(CNIResponse)
+	err := c.cc.Invoke(ctx, CNI_Del_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNIClient) Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error) {
+	out := new(VersionResponse)
+	err := c.cc.Invoke(ctx, CNI_Version_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CNIServer is the server API for CNI service.
+// All implementations must embed UnimplementedCNIServer
+// for forward compatibility
+type CNIServer interface {
+	Add(context.Context, *CNIRequest) (*CNIResponse, error)
+	Check(context.Context, *CNIRequest) (*CNIResponse, error)
+	Del(context.Context, *CNIRequest) (*CNIResponse, error)
+	Version(context.Context, *VersionRequest) (*VersionResponse, error)
+	mustEmbedUnimplementedCNIServer()
+}
+
+// UnimplementedCNIServer must be embedded to have forward compatible implementations.
+type UnimplementedCNIServer struct {
+}
+
+func (UnimplementedCNIServer) Add(context.Context, *CNIRequest) (*CNIResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Add not implemented")
+}
+func (UnimplementedCNIServer) Check(context.Context, *CNIRequest) (*CNIResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedCNIServer) Del(context.Context, *CNIRequest) (*CNIResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Del not implemented")
+}
+func (UnimplementedCNIServer) Version(context.Context, *VersionRequest) (*VersionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (UnimplementedCNIServer) mustEmbedUnimplementedCNIServer() {}
+
+// UnsafeCNIServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CNIServer will
+// result in compilation errors.
+type UnsafeCNIServer interface {
+	mustEmbedUnimplementedCNIServer()
+}
+
+func RegisterCNIServer(s grpc.ServiceRegistrar, srv CNIServer) {
+	s.RegisterService(&CNI_ServiceDesc, srv)
+}
+
+func _CNI_Add_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CNIRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Add(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNI_Add_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Add(ctx, req.(*CNIRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CNIRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNI_Check_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Check(ctx, req.(*CNIRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_Del_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CNIRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Del(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNI_Del_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Del(ctx, req.(*CNIRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNI_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNI_Version_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIServer).Version(ctx, req.(*VersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CNI_ServiceDesc is the grpc.ServiceDesc for CNI service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CNI_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "multus.v1.CNI",
+	HandlerType: (*CNIServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Add",
+			Handler:    _CNI_Add_Handler,
+		},
+		{
+			MethodName: "Check",
+			Handler:    _CNI_Check_Handler,
+		},
+		{
+			MethodName: "Del",
+			Handler:    _CNI_Del_Handler,
+		},
+		{
+			MethodName: "Version",
+			Handler:    _CNI_Version_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "multus.proto",
+}
@@ -35,6 +35,8 @@ type ShimNetConf struct {
 
 	CNIVersion      string `json:"cniVersion,omitempty"`
 	MultusSocketDir string `json:"daemonSocketDir"`
+	// DaemonTransport is the API used to reach multus-daemon: http or grpc
+	DaemonTransport string `json:"daemonTransport,omitempty"`
 	LogFile         string `json:"logFile,omitempty"`
 	LogLevel        string `json:"logLevel,omitempty"`
 	LogToStderr     bool   `json:"logToStderr,omitempty"`
@@ -50,6 +52,9 @@ func CmdAdd(args *skel.CmdArgs) error {
 		return logging.Errorf("CmdAdd (shim): %v", err)
 	}
 
+	for _, warning := range response.Warnings {
+		logging.Verbosef("warning: CmdAdd (shim): %s", warning)
+	}
 	logging.Verbosef("CmdAdd (shim): %v", *response.Result)
 	return cnitypes.PrintResult(response.Result, cniVersion)
 }
@@ -109,7 +114,12 @@ func postRequest(args *skel.CmdArgs, readinessCheck readyCheckFunc) (*Response,
 	}
 
 	var body []byte
-	body, err = DoCNI("http://dummy/cni", cniRequest, SocketPath(multusShimConfig.MultusSocketDir))
+	// CNI commands without a gRPC method are still served over HTTP
+	if multusShimConfig.DaemonTransport == TransportGRPC && GRPCMethod(cniRequest.Env["CNI_COMMAND"]) != "" {
+		body, err = DoCNIGRPC(cniRequest, GRPCSocketPath(multusShimConfig.MultusSocketDir))
+	} else {
+		body, err = DoCNI("http://dummy/cni", cniRequest, SocketPath(multusShimConfig.MultusSocketDir))
+	}
 	if err != nil {
 		return nil, multusShimConfig.CNIVersion, fmt.Errorf("%s: StdinData: %s", err.Error(), string(args.StdinData))
 	}
@@ -149,6 +159,13 @@ func shimConfig(cniConfig []byte) (*ShimNetConf, error) {
 	if multusConfig.MultusSocketDir == "" {
 		multusConfig.MultusSocketDir = defaultMultusRunDir
 	}
+	switch multusConfig.DaemonTransport {
+	case "":
+		multusConfig.DaemonTransport = TransportHTTP
+	case TransportHTTP, TransportGRPC:
+	default:
+		return nil, fmt.Errorf("unknown daemonTransport %q, must be %q or %q", multusConfig.DaemonTransport, TransportHTTP, TransportGRPC)
+	}
 	// Logging
 	logging.SetLogStderr(multusConfig.LogToStderr)
 	if multusConfig.LogFile != "" {
@@ -15,6 +15,9 @@
 package api
 
 import (
+	"encoding/json"
+	"time"
+
 	cni100 "github.com/containernetworking/cni/pkg/types/100"
 )
 
@@ -44,4 +47,44 @@ type DelegateInterfaceAttributes struct {
 // ADD / DEL / CHECK for a Pod.
 type Response struct {
 	Result *cni100.Result
+	// Warnings are the issues which did not fail the request, e.g. the
+	// stderr output of a successful delegate; older daemons do not send them
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// RegenerateConfigResponse represents the response of the daemon to a
+// regeneration of the multus configuration
+type RegenerateConfigResponse struct {
+	// Path is the file the configuration was persisted to
+	Path string `json:"path"`
+	// Config is the generated multus configuration
+	Config json.RawMessage `json:"config"`
+}
+
+// DebugBundleResponse represents the diagnostics of the daemon, gathered in a
+// single response to attach to bug reports
+type DebugBundleResponse struct {
+	// Version is the version of multus-daemon
+	Version string `json:"version"`
+	// Config is the effective configuration of the daemon, with the values
+	// of the sensitive keys redacted
+	Config map[string]interface{} `json:"config"`
+	// Attachments counts the containers and their delegates in the CNI cache
+	Attachments DebugBundleAttachments `json:"attachments"`
+	// RecentErrors are the last errors logged by the daemon, oldest first
+	RecentErrors []DebugBundleError `json:"recentErrors"`
+	// Metrics are the daemon metrics, in the Prometheus text format
+	Metrics string `json:"metrics"`
+}
+
+// DebugBundleAttachments counts the attachments of the daemon
+type DebugBundleAttachments struct {
+	Containers int `json:"containers"`
+	Interfaces int `json:"interfaces"`
+}
+
+// DebugBundleError is an error logged by the daemon
+type DebugBundleError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
 }
@@ -0,0 +1,104 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/api"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
+)
+
+// debugBundle gathers the diagnostics of the daemon. The parts which cannot
+// be gathered are left empty rather than failing the whole bundle.
+func (s *Server) debugBundle() *api.DebugBundleResponse {
+	bundle := &api.DebugBundleResponse{
+		Version:      multus.PrintVersionString(),
+		RecentErrors: []api.DebugBundleError{},
+	}
+
+	effectiveConfig, err := s.effectiveConfig()
+	if err != nil {
+		logging.Verbosef("debugBundle: failed to get the configuration: %v", err)
+	}
+	bundle.Config = effectiveConfig
+
+	if multusConfig, err := s.multusNetConf(); err == nil {
+		containers, err := multus.ListCachedContainers(multusConfig.CNIDir)
+		if err != nil {
+			logging.Verbosef("debugBundle: failed to list the cached containers: %v", err)
+		}
+		bundle.Attachments.Containers = len(containers)
+		for _, container := range containers {
+			bundle.Attachments.Interfaces += len(container.Delegates)
+		}
+	}
+
+	for _, record := range logging.RecentErrors() {
+		bundle.RecentErrors = append(bundle.RecentErrors, api.DebugBundleError{Time: record.Time, Message: record.Message})
+	}
+
+	metrics, err := gatherMetrics(prometheus.DefaultGatherer)
+	if err != nil {
+		logging.Verbosef("debugBundle: failed to gather the metrics: %v", err)
+	}
+	bundle.Metrics = metrics
+	return bundle
+}
+
+// effectiveConfig returns the configuration of the daemon, as printed by
+// multus-daemon --print-config
+func (s *Server) effectiveConfig() (map[string]interface{}, error) {
+	daemonConf := s.daemonConfig
+	if daemonConf == nil {
+		daemonConf = &ControllerNetConf{ConfigFileContents: s.serverConfig}
+	}
+	contents := daemonConf.ConfigFileContents
+	if len(contents) == 0 {
+		contents = []byte("{}")
+	}
+	multusConf, err := config.ParseMultusConfigContents(contents)
+	if err != nil {
+		return nil, err
+	}
+	data, err := EffectiveDaemonConfig(daemonConf, multusConf)
+	if err != nil {
+		return nil, err
+	}
+	effective := map[string]interface{}{}
+	if err := json.Unmarshal(data, &effective); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the effective configuration: %v", err)
+	}
+	return effective, nil
+}
+
+// gatherMetrics returns the metrics of gatherer in the Prometheus text format
+func gatherMetrics(gatherer prometheus.Gatherer) (string, error) {
+	families, err := gatherer.Gather()
+	var buf bytes.Buffer
+	for _, family := range families {
+		if _, encodeErr := expfmt.MetricFamilyToText(&buf, family); encodeErr != nil {
+			return buf.String(), encodeErr
+		}
+	}
+	return buf.String(), err
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+// disable dot-imports only for testing
+//revive:disable:dot-imports
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/api"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// stubCNIService is a gRPC CNI service only serving its version
+type stubCNIService struct {
+	api.UnimplementedCNIServer
+}
+
+func (stubCNIService) Add(context.Context, *api.CNIRequest) (*api.CNIResponse, error) {
+	return nil, nil
+}
+
+func (stubCNIService) Check(context.Context, *api.CNIRequest) (*api.CNIResponse, error) {
+	return nil, nil
+}
+
+func (stubCNIService) Del(context.Context, *api.CNIRequest) (*api.CNIResponse, error) {
+	return nil, nil
+}
+
+func (stubCNIService) Version(context.Context, *api.VersionRequest) (*api.VersionResponse, error) {
+	return &api.VersionResponse{Version: "stub-grpc"}, nil
+}
+
+var _ = Describe("daemon check", func() {
+	var socketDir string
+
+	// listenStale leaves a socket file nothing listens on
+	listenStale := func(socketPath string) {
+		l, err := net.Listen("unix", socketPath)
+		Expect(err).NotTo(HaveOccurred())
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		Expect(l.Close()).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		socketDir = GinkgoT().TempDir()
+	})
+
+	It("returns the version of the daemon over HTTP", func() {
+		l, err := GetListener(api.SocketPath(socketDir))
+		Expect(err).NotTo(HaveOccurred())
+		router := http.NewServeMux()
+		router.HandleFunc(api.MultusVersionAPIEndpoint, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`{"version": "stub-http"}`))
+		})
+		server := &http.Server{Handler: router}
+		go func() {
+			defer GinkgoRecover()
+			Expect(server.Serve(l)).To(MatchError(http.ErrServerClosed))
+		}()
+		defer server.Close()
+
+		version, err := api.CheckDaemon(socketDir, api.TransportHTTP)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("stub-http"))
+	})
+
+	It("returns the version of the daemon over gRPC", func() {
+		l, err := GetListener(api.GRPCSocketPath(socketDir))
+		Expect(err).NotTo(HaveOccurred())
+		grpcServer := api.NewGRPCServer(stubCNIService{})
+		go func() {
+			_ = grpcServer.Serve(l)
+		}()
+		defer grpcServer.Stop()
+
+		version, err := api.CheckDaemon(socketDir, api.TransportGRPC)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("stub-grpc"))
+	})
+
+	It("reports the connection refused by the socket of a stopped daemon", func() {
+		listenStale(api.SocketPath(socketDir))
+		_, err := api.CheckDaemon(socketDir, api.TransportHTTP)
+		Expect(err).To(MatchError(ContainSubstring("failed to connect to " + api.SocketPath(socketDir))))
+		Expect(err).To(MatchError(ContainSubstring("connect: connection refused")))
+
+		listenStale(api.GRPCSocketPath(socketDir))
+		_, err = api.CheckDaemon(socketDir, api.TransportGRPC)
+		Expect(err).To(MatchError(ContainSubstring("connect: connection refused")))
+	})
+
+	It("reports a missing socket", func() {
+		_, err := api.CheckDaemon(socketDir, api.TransportHTTP)
+		Expect(err).To(MatchError(ContainSubstring("connect: no such file or directory")))
+	})
+
+	It("rejects an unknown transport", func() {
+		version, err := api.CheckDaemon(socketDir, "sctp")
+		Expect(err).To(MatchError(`unknown daemonTransport "sctp", must be "http" or "grpc"`))
+		Expect(version).To(BeEmpty())
+	})
+})
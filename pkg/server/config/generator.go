@@ -26,6 +26,7 @@ import (
 
 	"github.com/blang/semver"
 
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/cmdutils"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
 )
 
@@ -61,6 +62,7 @@ type MultusConf struct {
 	MultusAutoconfigDir      string              `json:"multusAutoconfigDir,omitempty"`
 	ForceCNIVersion          bool                `json:"forceCNIVersion,omitempty"`
 	OverrideNetworkName      bool                `json:"overrideNetworkName,omitempty"`
+	ConfigFormat             string              `json:"configFormat,omitempty"`
 }
 
 // ParseMultusConfig parses multus config from configPath and create MultusConf.
@@ -69,7 +71,12 @@ func ParseMultusConfig(configPath string) (*MultusConf, error) {
 	if err != nil {
 		return nil, fmt.Errorf("ParseMultusConfig failed to read the config file's contents: %w", err)
 	}
+	return ParseMultusConfigContents(config)
+}
 
+// ParseMultusConfigContents parses the contents of a multus config file and
+// creates MultusConf.
+func ParseMultusConfigContents(config []byte) (*MultusConf, error) {
 	multusconf := MultusConf{
 		MultusConfigFile: "auto",
 		Type:             multusPluginName,
@@ -81,6 +88,9 @@ func ParseMultusConfig(configPath string) (*MultusConf, error) {
 		return nil, fmt.Errorf("failed to unmarshall the daemon configuration: %w", err)
 	}
 	multusconf.Name = MultusDefaultNetworkName // change name
+	if err := cmdutils.ValidateConfigFormat(multusconf.ConfigFormat); err != nil {
+		return nil, fmt.Errorf("invalid configFormat: %w", err)
+	}
 
 	return &multusconf, nil
 }
@@ -131,8 +141,16 @@ func (mc *MultusConf) Generate() (string, error) {
 	// Readiness indicator file existence is already handled by the
 	// ConfigManager via an fsnotify watch, so CmdAdd/CmdDel don't need to.
 	mc.ReadinessIndicatorFile = ""
+	// the format is kept for the next generations
+	configFormat := mc.ConfigFormat
+	mc.ConfigFormat = ""
 
 	data, err := json.Marshal(mc)
+	mc.ConfigFormat = configFormat
+	if err != nil {
+		return "", err
+	}
+	data, err = cmdutils.FormatConfig(data, configFormat)
 	return string(data), err
 }
 
@@ -142,7 +160,10 @@ func (mc *MultusConf) setCapabilities(cniData interface{}) error {
 	cniDataMap, ok := cniData.(map[string]interface{})
 	if ok {
 		if pluginsListEntry, ok := cniDataMap[configListCapabilityKey]; ok {
-			pluginsList = pluginsListEntry.([]interface{})
+			pluginsList, ok = pluginsListEntry.([]interface{})
+			if !ok || len(pluginsList) == 0 {
+				return errors.New("the 'plugins' field of the primary CNI config must be a non-empty list")
+			}
 		}
 	} else {
 		return errors.New("couldn't get cni config from delegate")
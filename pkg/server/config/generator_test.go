@@ -85,6 +85,54 @@ var _ = Describe("Configuration Generator", func() {
 		Expect(multusConfig.Generate()).Should(MatchJSON(expectedResult))
 	})
 
+	It("multus config with configFormat is byte-stable", func() {
+		multusConfFile := fmt.Sprintf(`{
+			"name": %q,
+			"cniVersion": %q,
+			"clusterNetwork": %q,
+			"configFormat": "pretty"
+		}`, primaryCNIName, cniVersion, primaryCNIFile)
+		multusConfFileName := fmt.Sprintf("%s/10-testcni.conf", tmpDir)
+		Expect(os.WriteFile(multusConfFileName, []byte(multusConfFile), 0755)).To(Succeed())
+
+		multusConfig, err := ParseMultusConfig(multusConfFileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(multusConfig.setCapabilities(map[string]interface{}{
+			"capabilities": map[string]interface{}{"portMappings": true, "bandwidth": true},
+		})).To(Succeed())
+		expectedResult := fmt.Sprintf(`{
+    "capabilities": {
+        "bandwidth": true,
+        "portMappings": true
+    },
+    "clusterNetwork": "%s",
+    "cniVersion": "0.4.0",
+    "name": "multus-cni-network",
+    "type": "multus-shim"
+}
+`, primaryCNIFile)
+		Expect(multusConfig.Generate()).To(Equal(expectedResult))
+		// the next generations keep the format
+		Expect(multusConfig.Generate()).To(Equal(expectedResult))
+
+		multusConfig.ConfigFormat = "compact"
+		Expect(multusConfig.Generate()).To(Equal(fmt.Sprintf(
+			`{"capabilities":{"bandwidth":true,"portMappings":true},"clusterNetwork":"%s","cniVersion":"0.4.0","name":"multus-cni-network","type":"multus-shim"}`+"\n", primaryCNIFile)))
+	})
+
+	It("multus config with an unknown configFormat is rejected", func() {
+		multusConfFile := fmt.Sprintf(`{
+			"name": %q,
+			"cniVersion": %q,
+			"configFormat": "yaml"
+		}`, primaryCNIName, cniVersion)
+		multusConfFileName := fmt.Sprintf("%s/10-testcni.conf", tmpDir)
+		Expect(os.WriteFile(multusConfFileName, []byte(multusConfFile), 0755)).To(Succeed())
+
+		_, err := ParseMultusConfig(multusConfFileName)
+		Expect(err).To(MatchError(`invalid configFormat: unknown config format "yaml", must be "pretty" or "compact"`))
+	})
+
 	It("multus config with capabilities", func() {
 		multusConfFile := fmt.Sprintf(`{
 			"name": %q,
@@ -217,6 +265,21 @@ var _ = Describe("Configuration Generator", func() {
 		Expect(multusConfig.Generate()).Should(MatchJSON(expectedResult))
 	})
 
+	It("multus config with an empty plugins list is rejected", func() {
+		multusConfFile := fmt.Sprintf(`{
+			"name": %q,
+			"cniVersion": %q,
+			"clusterNetwork": %q
+		}`, primaryCNIName, cniVersion, primaryCNIFile)
+		multusConfFileName := fmt.Sprintf("%s/10-testcni.conf", tmpDir)
+		Expect(os.WriteFile(multusConfFileName, []byte(multusConfFile), 0755)).To(Succeed())
+
+		multusConfig, err := ParseMultusConfig(multusConfFileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(multusConfig.setCapabilities(documentHelper(`{"plugins": []}`))).To(
+			MatchError(ContainSubstring("must be a non-empty list")))
+	})
+
 	It("multus config with multiple capabilities defined on multiple plugins filter only enabled", func() {
 		multusConfFile := fmt.Sprintf(`{
 			"name": %q,
@@ -44,6 +44,9 @@ type Manager struct {
 	multusConfigFilePath       string
 	readinessIndicatorFilePath string
 	primaryCNIConfigPath       string
+	metrics                    *generationMetrics
+	// generateLock serializes the generations of the multus configuration
+	generateLock sync.Mutex
 }
 
 // NewManager returns a config manager object, configured to read the
@@ -64,6 +67,52 @@ func NewManager(config MultusConf) (*Manager, error) {
 	return newManager(config, defaultPluginName)
 }
 
+// ValidateConfig generates the multus configuration NewManager and
+// GenerateConfig would, without waiting for the primary CNI configuration,
+// changing it on disk, persisting the result nor watching for changes
+func ValidateConfig(config MultusConf) (string, error) {
+	defaultPluginName := config.MultusMasterCni
+	if defaultPluginName == "" {
+		var err error
+		if defaultPluginName, err = findMasterPlugin(config.MultusAutoconfigDir, 1); err != nil {
+			return "", fmt.Errorf("failed to find the primary CNI plugin: %w", err)
+		}
+	}
+	if defaultPluginName == fmt.Sprintf("%s/%s", config.MultusAutoconfigDir, multusConfigFileName) {
+		return "", fmt.Errorf("cannot specify %s/%s to prevent recursive config load", config.MultusAutoconfigDir, multusConfigFileName)
+	}
+
+	m := &Manager{
+		multusConfig:         &config,
+		primaryCNIConfigPath: filepath.Join(config.MultusAutoconfigDir, defaultPluginName),
+		metrics:              newGenerationMetrics(),
+	}
+	primaryCNIConfigData, err := primaryCNIData(m.primaryCNIConfigPath)
+	if err != nil {
+		return "", err
+	}
+	cniConfigData, ok := primaryCNIConfigData.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("the primary CNI configuration %s is not a JSON object", m.primaryCNIConfigPath)
+	}
+	// forceCNIVersion overrides the version in memory only
+	if config.ForceCNIVersion {
+		cniConfigData["cniVersion"] = config.CNIVersion
+	}
+	if err := CheckVersionCompatibility(m.multusConfig, cniConfigData); err != nil {
+		return "", err
+	}
+	if err := m.loadPrimaryCNIConfigurationData(cniConfigData); err != nil {
+		return "", err
+	}
+	if config.OverrideNetworkName {
+		if err := m.overrideNetworkName(); err != nil {
+			return "", fmt.Errorf("could not override the network name: %v", err)
+		}
+	}
+	return m.multusConfig.Generate()
+}
+
 // overrideCNIVersion overrides cniVersion in cniConfigFile, it should be used only in kind case
 func overrideCNIVersion(cniConfigFile string, multusCNIVersion string) error {
 	path, err := filepath.Abs(cniConfigFile)
@@ -123,6 +172,7 @@ func newManager(config MultusConf, defaultCNIPluginName string) (*Manager, error
 		multusConfigFilePath:       filepath.Join(config.CniConfigDir, multusConfigFileName),
 		primaryCNIConfigPath:       filepath.Join(config.MultusAutoconfigDir, defaultCNIPluginName),
 		readinessIndicatorFilePath: config.ReadinessIndicatorFile,
+		metrics:                    newGenerationMetrics(),
 	}
 
 	if err := configManager.loadPrimaryCNIConfigFromFile(); err != nil {
@@ -141,13 +191,16 @@ func newManager(config MultusConf, defaultCNIPluginName string) (*Manager, error
 // Start generates an updated Multus config, writes it, and begins watching
 // the config directory and readiness indicator files for changes
 func (m *Manager) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	m.generateLock.Lock()
 	generatedMultusConfig, err := m.GenerateConfig()
 	if err != nil {
+		m.generateLock.Unlock()
 		return logging.Errorf("failed to generated the multus configuration: %v", err)
 	}
 	logging.Verbosef("Generated MultusCNI config: %s", generatedMultusConfig)
 
 	multusConfigFile, err := m.PersistMultusConfig(generatedMultusConfig)
+	m.generateLock.Unlock()
 	if err != nil {
 		return logging.Errorf("failed to persist the multus configuration: %v", err)
 	}
@@ -207,9 +260,37 @@ func (m *Manager) loadPrimaryCNIConfigurationData(primaryCNIConfigData interface
 func (m *Manager) GenerateConfig() (string, error) {
 	if err := m.loadPrimaryCNIConfigFromFile(); err != nil {
 		_ = logging.Errorf("failed to read the primary CNI plugin config from %s", m.primaryCNIConfigPath)
+		m.metrics.observe(err)
 		return "", nil
 	}
-	return m.multusConfig.Generate()
+	config, err := m.multusConfig.Generate()
+	m.metrics.observe(err)
+	return config, err
+}
+
+// Regenerate generates the multus configuration from the primary CNI
+// configuration on disk and persists it, e.g. after the primary CNI
+// configuration was fixed by hand. It returns the generated configuration and
+// the path it was persisted to. Regenerations, including the ones of the
+// watcher, never run concurrently.
+func (m *Manager) Regenerate() (string, string, error) {
+	m.generateLock.Lock()
+	defer m.generateLock.Unlock()
+
+	config, err := m.GenerateConfig()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate the multus configuration: %w", err)
+	}
+	// GenerateConfig returns no configuration when it cannot read the primary one
+	if config == "" {
+		return "", "", fmt.Errorf("failed to read the primary CNI configuration %s", m.primaryCNIConfigPath)
+	}
+	multusConfigFile, err := m.PersistMultusConfig(config)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to persist the multus configuration: %w", err)
+	}
+	logging.Verbosef("Regenerated MultusCNI config @ %s: %s", multusConfigFile, config)
+	return config, multusConfigFile, nil
 }
 
 // monitorPluginConfiguration monitors the configuration file pointed
@@ -233,6 +314,7 @@ func (m *Manager) monitorPluginConfiguration(ctx context.Context) error {
 				os.Exit(2)
 			}
 
+			m.generateLock.Lock()
 			updatedConfig, err := m.GenerateConfig()
 			if err != nil {
 				_ = logging.Errorf("failed to regenerate the multus configuration: %v", err)
@@ -245,6 +327,7 @@ func (m *Manager) monitorPluginConfiguration(ctx context.Context) error {
 			if err := m.loadPrimaryCNIConfigFromFile(); err != nil {
 				_ = logging.Errorf("failed to reload the updated config: %v", err)
 			}
+			m.generateLock.Unlock()
 
 		case err := <-m.configWatcher.Errors:
 			if err == nil {
@@ -20,9 +20,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -86,6 +91,26 @@ var _ = Describe("Configuration Manager", func() {
 		Expect(config).To(Equal(expectedResult))
 	})
 
+	It("Counts the successful and failed generations in its metrics", func() {
+		registry := prometheus.NewRegistry()
+		Expect(configManager.RegisterMetrics(registry)).To(Succeed())
+
+		_, err := configManager.GenerateConfig()
+		Expect(err).NotTo(HaveOccurred())
+
+		// an unreadable primary CNI configuration fails the generation
+		Expect(os.WriteFile(defaultCniConfig, []byte("{"), UserRWPermission)).To(Succeed())
+		_, _ = configManager.GenerateConfig()
+
+		recorder := httptest.NewRecorder()
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		metrics := recorder.Body.String()
+		Expect(metrics).To(ContainSubstring(`multus_config_generation_total{result="success"} 1`))
+		Expect(metrics).To(ContainSubstring(`multus_config_generation_total{result="failure"} 1`))
+		Expect(metrics).To(ContainSubstring("multus_config_seconds_since_last_successful_generation "))
+	})
+
 	It("Check overrideCNIVersion is worked", func() {
 		err := overrideCNIVersion(defaultCniConfig, "1.1.1")
 		Expect(err).NotTo(HaveOccurred())
@@ -187,6 +212,29 @@ var _ = Describe("Configuration Manager with mismatched cniVersion", func() {
 		Expect(err).To(MatchError("failed to load the primary CNI configuration as a multus delegate with error 'delegate cni version is 0.3.1 while top level cni version is 0.4.0'"))
 	})
 
+	It("validates with forceCNIVersion without changing the primary CNI config", func() {
+		var err error
+		multusConfigDir, err = os.MkdirTemp("", "multus-config")
+		Expect(err).ToNot(HaveOccurred())
+		defaultCniConfig = fmt.Sprintf("%s/%s", multusConfigDir, primaryCNIPluginName)
+		Expect(os.WriteFile(defaultCniConfig, []byte(primaryCNIPluginTemplate), UserRWPermission)).To(Succeed())
+
+		multusConf := MultusConf{
+			CNIVersion:          cniVersion,
+			MultusAutoconfigDir: multusConfigDir,
+			MultusMasterCni:     primaryCNIPluginName,
+			Type:                "multus-shim",
+		}
+		_, err = ValidateConfig(multusConf)
+		Expect(err).To(MatchError("delegate cni version is 0.3.1 while top level cni version is 0.4.0"))
+
+		multusConf.ForceCNIVersion = true
+		config, err := ValidateConfig(multusConf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(ContainSubstring(fmt.Sprintf(`"clusterNetwork":%q`, defaultCniConfig)))
+		Expect(os.ReadFile(defaultCniConfig)).To(BeEquivalentTo(primaryCNIPluginTemplate))
+	})
+
 	AfterEach(func() {
 		Expect(os.RemoveAll(multusConfigDir)).To(Succeed())
 	})
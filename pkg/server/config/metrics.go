@@ -0,0 +1,80 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// generationMetrics counts the generations of the multus configuration
+type generationMetrics struct {
+	generations      *prometheus.CounterVec
+	sinceLastSuccess prometheus.GaugeFunc
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+}
+
+func newGenerationMetrics() *generationMetrics {
+	m := &generationMetrics{
+		generations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "multus_config_generation_total",
+				Help: "Counter of the generations of the multus configuration",
+			},
+			[]string{"result"},
+		),
+		// until the first success, the time is counted from the start
+		lastSuccess: time.Now(),
+	}
+	m.sinceLastSuccess = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "multus_config_seconds_since_last_successful_generation",
+			Help: "Seconds since the multus configuration was last generated successfully",
+		},
+		func() float64 {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			return time.Since(m.lastSuccess).Seconds()
+		},
+	)
+	// expose both results from the start, so that rate() works on them
+	m.generations.WithLabelValues("success")
+	m.generations.WithLabelValues("failure")
+	return m
+}
+
+// observe records the result of a generation
+func (m *generationMetrics) observe(err error) {
+	if err != nil {
+		m.generations.WithLabelValues("failure").Inc()
+		return
+	}
+	m.generations.WithLabelValues("success").Inc()
+	m.mu.Lock()
+	m.lastSuccess = time.Now()
+	m.mu.Unlock()
+}
+
+// RegisterMetrics registers the config generation metrics of the manager
+func (m *Manager) RegisterMetrics(registerer prometheus.Registerer) error {
+	if err := registerer.Register(m.metrics.generations); err != nil {
+		return err
+	}
+	return registerer.Register(m.metrics.sinceLastSuccess)
+}
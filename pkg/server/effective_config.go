@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// redactedValue replaces the value of sensitive configuration keys
+const redactedValue = "<redacted>"
+
+// sensitiveKeyParts are the (lower case) parts of the configuration keys
+// whose values are never printed
+var sensitiveKeyParts = []string{"token", "secret", "password", "credential"}
+
+// EffectiveDaemonConfig returns the configuration multus-daemon runs with, as
+// indented JSON: the configuration file, with the defaults filled in by
+// LoadDaemonNetConf and config.ParseMultusConfig applied on top of it. The
+// values of token, secret, password and credential keys are redacted.
+func EffectiveDaemonConfig(daemonConf *ControllerNetConf, multusConf *config.MultusConf) ([]byte, error) {
+	effective := map[string]interface{}{}
+	if len(daemonConf.ConfigFileContents) > 0 {
+		if err := json.Unmarshal(daemonConf.ConfigFileContents, &effective); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the daemon configuration: %v", err)
+		}
+	}
+
+	mc := *multusConf
+	if mc.CniDir == "" {
+		mc.CniDir = types.GetDefaultNetConf().CNIDir
+	}
+	for _, conf := range []interface{}{&mc, daemonConf} {
+		if err := mergeJSONObject(effective, conf); err != nil {
+			return nil, err
+		}
+	}
+
+	redactSensitiveValues(effective)
+	return json.MarshalIndent(effective, "", "  ")
+}
+
+// mergeJSONObject sets the JSON fields of conf in dst
+func mergeJSONObject(dst map[string]interface{}, conf interface{}) error {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %T: %v", conf, err)
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("failed to unmarshal %T: %v", conf, err)
+	}
+	for k, v := range fields {
+		dst[k] = v
+	}
+	return nil
+}
+
+func redactSensitiveValues(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if isSensitiveKey(k) {
+				v[k] = redactedValue
+				continue
+			}
+			redactSensitiveValues(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactSensitiveValues(item)
+		}
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+// disable dot-imports only for testing
+//revive:disable:dot-imports
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
+)
+
+var _ = Describe("effective daemon configuration", func() {
+	It("fills in the defaults and redacts the secrets", func() {
+		configPath := filepath.Join(GinkgoT().TempDir(), "daemon-config.json")
+		Expect(os.WriteFile(configPath, []byte(`{
+			"cniVersion": "0.4.0",
+			"logLevel": "debug",
+			"kubeconfig": "/etc/kubernetes/kubeconfig",
+			"apiToken": "s3cr3t",
+			"auth": {"password": "hunter2", "user": "multus"}
+		}`), 0600)).To(Succeed())
+
+		contents, err := os.ReadFile(configPath)
+		Expect(err).NotTo(HaveOccurred())
+		daemonConf, err := LoadDaemonNetConf(contents)
+		Expect(err).NotTo(HaveOccurred())
+		multusConf, err := config.ParseMultusConfig(configPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := EffectiveDaemonConfig(daemonConf, multusConf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).NotTo(ContainSubstring("s3cr3t"))
+		Expect(string(out)).NotTo(ContainSubstring("hunter2"))
+
+		effective := map[string]interface{}{}
+		Expect(json.Unmarshal(out, &effective)).To(Succeed())
+		Expect(effective).To(HaveKeyWithValue("socketDir", DefaultMultusRunDir))
+		Expect(effective).To(HaveKeyWithValue("cniConfigDir", "/etc/cni/net.d"))
+		Expect(effective).To(HaveKeyWithValue("multusConfigFile", "auto"))
+		Expect(effective).To(HaveKeyWithValue("type", "multus-shim"))
+		Expect(effective).To(HaveKeyWithValue("cniDir", "/var/lib/cni/multus"))
+		Expect(effective).To(HaveKeyWithValue("logLevel", "debug"))
+		Expect(effective).To(HaveKeyWithValue("kubeconfig", "/etc/kubernetes/kubeconfig"))
+		Expect(effective).To(HaveKeyWithValue("apiToken", "<redacted>"))
+		Expect(effective).To(HaveKeyWithValue("auth", map[string]interface{}{"password": "<redacted>", "user": "multus"}))
+	})
+})
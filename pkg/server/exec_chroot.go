@@ -84,6 +84,17 @@ func (e *ChrootExec) ExecPlugin(ctx context.Context, pluginPath string, stdinDat
 	return stdout.Bytes(), nil
 }
 
+// WithStderr returns a copy of the exec which also writes plugin stderr to w
+func (e *ChrootExec) WithStderr(w io.Writer) invoke.Exec {
+	c := *e
+	if e.Stderr != nil {
+		c.Stderr = io.MultiWriter(e.Stderr, w)
+	} else {
+		c.Stderr = w
+	}
+	return &c
+}
+
 func (e *ChrootExec) pluginErr(err error, stdout, stderr []byte) error {
 	emsg := types.Error{}
 	if len(stdout) == 0 {
@@ -17,6 +17,7 @@ package server
 // disable dot-imports only for testing
 //revive:disable:dot-imports
 import (
+	"bytes"
 	"context"
 	"os"
 
@@ -45,4 +46,15 @@ var _ = Describe("exec_chroot", func() {
 		_, err := chrootExec.ExecPlugin(context.Background(), "/bin/true", nil, nil)
 		Expect(err).To(HaveOccurred())
 	})
+
+	It("Call ChrootExec.ExecPlugin with stderr captured", func() {
+		chrootExec := &ChrootExec{
+			chrootDir: "/",
+		}
+		stderr := &bytes.Buffer{}
+
+		_, err := chrootExec.WithStderr(stderr).ExecPlugin(context.Background(), "/bin/sh", []byte("echo warning >&2"), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stderr.String()).To(Equal("warning\n"))
+	})
 })
@@ -0,0 +1,93 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	utilwait "k8s.io/apimachinery/pkg/util/wait"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/api"
+)
+
+// grpcService serves the gRPC API of the server
+type grpcService struct {
+	api.UnimplementedCNIServer
+	s *Server
+}
+
+// StartGRPC serves the gRPC API on the given listener until ctx is done. The
+// requests are handled the same way as the ones of the HTTP API.
+func (s *Server) StartGRPC(ctx context.Context, l net.Listener) *grpc.Server {
+	grpcServer := api.NewGRPCServer(&grpcService{s: s})
+	go func() {
+		utilwait.UntilWithContext(ctx, func(_ context.Context) {
+			logging.Debugf("open for business over gRPC")
+			if err := grpcServer.Serve(l); err != nil {
+				_ = logging.Errorf("CNI gRPC server Serve() failed: %v", err)
+			}
+		}, 0)
+	}()
+	go func() {
+		<-ctx.Done()
+		grpcServer.Stop()
+	}()
+	return grpcServer
+}
+
+// Add handles a CNI ADD request
+func (g *grpcService) Add(_ context.Context, req *api.CNIRequest) (*api.CNIResponse, error) {
+	return g.handle("ADD", req)
+}
+
+// Check handles a CNI CHECK request
+func (g *grpcService) Check(_ context.Context, req *api.CNIRequest) (*api.CNIResponse, error) {
+	return g.handle("CHECK", req)
+}
+
+// Del handles a CNI DEL request
+func (g *grpcService) Del(_ context.Context, req *api.CNIRequest) (*api.CNIResponse, error) {
+	return g.handle("DEL", req)
+}
+
+// Version returns the version of multus
+func (g *grpcService) Version(_ context.Context, _ *api.VersionRequest) (*api.VersionResponse, error) {
+	return &api.VersionResponse{Version: multus.PrintVersionString()}, nil
+}
+
+func (g *grpcService) handle(cmd string, req *api.CNIRequest) (*api.CNIResponse, error) {
+	var cr api.Request
+	if err := json.Unmarshal(req.Request, &cr); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid CNI request: %v", err)
+	}
+	if cr.Env == nil {
+		cr.Env = map[string]string{}
+	}
+	// the called method decides the command
+	cr.Env["CNI_COMMAND"] = cmd
+
+	result, err := g.s.processCNIRequest(&cr)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &api.CNIResponse{Response: result}, nil
+}
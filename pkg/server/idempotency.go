@@ -0,0 +1,129 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containernetworking/cni/pkg/skel"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// addResultsDir is the directory of cniDir where the results of the
+// completed ADDs are kept, per container ID and interface name
+const addResultsDir = "add-results"
+
+// addOperation is an ADD of a container interface run by the daemon
+type addOperation struct {
+	done   chan struct{}
+	result []byte
+	err    error
+}
+
+// addOperations tracks the ADDs in flight, keyed by their idempotency key
+type addOperations struct {
+	sync.Mutex
+	inFlight map[string]*addOperation
+}
+
+// addIdempotencyKey identifies the ADDs which are retries of each other
+func addIdempotencyKey(cmdArgs *skel.CmdArgs) string {
+	return cmdArgs.ContainerID + "/" + cmdArgs.IfName
+}
+
+// addResultPath returns the file keeping the result of the completed ADD
+func addResultPath(cniDir string, cmdArgs *skel.CmdArgs) string {
+	return filepath.Join(cniDir, addResultsDir, cmdArgs.ContainerID, cmdArgs.IfName)
+}
+
+// cmdAddOnce runs the ADD unless an identical one, for the same container ID
+// and interface name, is in flight or completed: the retries get the result
+// of that ADD instead of running the delegates again. A completed ADD is only
+// reused while its multus scratch cache exists.
+func (s *Server) cmdAddOnce(ctx context.Context, cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) ([]byte, error) {
+	key := addIdempotencyKey(cmdArgs)
+
+	s.addOperations.Lock()
+	if op, ok := s.addOperations.inFlight[key]; ok {
+		s.addOperations.Unlock()
+		logging.Verbosef("ADD of %s is already in flight, waiting for its result", key)
+		select {
+		case <-op.done:
+			return op.result, op.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	op := &addOperation{done: make(chan struct{})}
+	s.addOperations.inFlight[key] = op
+	s.addOperations.Unlock()
+
+	defer func() {
+		s.addOperations.Lock()
+		delete(s.addOperations.inFlight, key)
+		s.addOperations.Unlock()
+		close(op.done)
+	}()
+
+	conf := types.GetDefaultNetConf()
+	if err := json.Unmarshal(cmdArgs.StdinData, conf); err != nil {
+		// multus reports the invalid config
+		op.result, op.err = s.cmdAdd(ctx, cmdArgs, k8sArgs)
+		return op.result, op.err
+	}
+	path := addResultPath(conf.CNIDir, cmdArgs)
+	if result, err := os.ReadFile(path); err == nil && multus.ScratchCacheExists(conf, k8sArgs, cmdArgs.ContainerID) {
+		logging.Verbosef("ADD of %s already completed, returning its cached result", key)
+		op.result = result
+		return op.result, nil
+	}
+
+	op.result, op.err = s.cmdAdd(ctx, cmdArgs, k8sArgs)
+	if op.err == nil {
+		saveAddResult(path, op.result)
+	}
+	return op.result, op.err
+}
+
+// saveAddResult keeps the result of a completed ADD; on failure, its retries
+// just run again
+func saveAddResult(path string, result []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		_ = logging.Errorf("saveAddResult: failed to create the directory of %q: %v", path, err)
+		return
+	}
+	if err := os.WriteFile(path, result, 0600); err != nil {
+		_ = logging.Errorf("saveAddResult: failed to write %q: %v", path, err)
+	}
+}
+
+// removeAddResults forgets the completed ADDs of the container, so that the
+// next ones run again
+func removeAddResults(cmdArgs *skel.CmdArgs) {
+	conf := types.GetDefaultNetConf()
+	if err := json.Unmarshal(cmdArgs.StdinData, conf); err != nil {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(conf.CNIDir, addResultsDir, cmdArgs.ContainerID)); err != nil {
+		_ = logging.Errorf("removeAddResults: failed to remove the ADD results of container %s: %v", cmdArgs.ContainerID, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	netdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+
+	k8s "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
+)
+
+// checkNetAttachDefs sets the invalidNetAttachDefs gauge to the number of
+// net-attach-defs whose CNI config is invalid
+func (s *Server) checkNetAttachDefs() {
+	invalid, err := s.invalidNetAttachDefs()
+	if err != nil {
+		_ = logging.Errorf("failed to validate the net-attach-defs: %v", err)
+		return
+	}
+	s.metrics.invalidNetAttachDefs.Set(float64(len(invalid)))
+}
+
+// invalidNetAttachDefs returns the namespace/name of the net-attach-defs, of
+// the netAttachDefValidationNamespaces or of all namespaces, whose CNI config
+// is invalid; each of them is logged with the reason
+func (s *Server) invalidNetAttachDefs() ([]string, error) {
+	multusConfig, err := s.multusNetConf()
+	if err != nil {
+		return nil, err
+	}
+	namespaces := s.netAttachDefValidationNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var invalid []string
+	for _, namespace := range namespaces {
+		nads, err := s.kubeclient.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the net-attach-defs of namespace %q: %v", namespace, err)
+		}
+		for i := range nads.Items {
+			nad := &nads.Items[i]
+			if err := k8s.ValidateNetAttachDef(nad, multusConfig); err != nil {
+				logging.Verbosef("warning: network-attachment-definition %s/%s is invalid: %v", nad.Namespace, nad.Name, err)
+				invalid = append(invalid, nad.Namespace+"/"+nad.Name)
+			}
+		}
+	}
+	sort.Strings(invalid)
+	return invalid, nil
+}
+
+// enableNetAttachDefQuarantine quarantines the net-attach-defs after threshold
+// consecutive ADD failures within window, and clears their quarantine once
+// they are updated or deleted
+func (s *Server) enableNetAttachDefQuarantine(threshold int, window time.Duration) {
+	s.quarantine = multus.NewNetAttachDefQuarantine(threshold, window, func(quarantined int) {
+		s.metrics.quarantinedNetAttachDefs.Set(float64(quarantined))
+	})
+	forget := func(obj interface{}) {
+		if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+			s.quarantine.Forget(key)
+		}
+	}
+	_, err := s.netdefInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNAD, oldOK := oldObj.(*netdefv1.NetworkAttachmentDefinition)
+			newNAD, newOK := newObj.(*netdefv1.NetworkAttachmentDefinition)
+			if oldOK && newOK && oldNAD.ResourceVersion != newNAD.ResourceVersion {
+				forget(newObj)
+			}
+		},
+		DeleteFunc: forget,
+	})
+	if err != nil {
+		_ = logging.Errorf("failed to watch the net-attach-defs for the quarantine: %v", err)
+	}
+}
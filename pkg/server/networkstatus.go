@@ -0,0 +1,118 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sort"
+
+	nettypes "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	k8s "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// checkNetworkStatuses sets the staleNetworkStatusPods gauge to the number of
+// pods whose network-status annotation disagrees with the multus cache
+func (s *Server) checkNetworkStatuses() {
+	stale, err := s.staleNetworkStatusPods()
+	if err != nil {
+		_ = logging.Errorf("failed to check the network statuses: %v", err)
+		return
+	}
+	s.metrics.staleNetworkStatusPods.Set(float64(len(stale)))
+}
+
+// staleNetworkStatusPods returns the namespace/name of the pods none of whose
+// cached containers has the networks and interfaces of its network-status
+// annotation. Pods which are gone, or were recreated, are skipped.
+func (s *Server) staleNetworkStatusPods() ([]string, error) {
+	multusConfig, err := s.multusNetConf()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := multus.ListCachedContainers(multusConfig.CNIDir)
+	if err != nil {
+		return nil, err
+	}
+
+	upToDate := map[string]bool{}
+	for _, container := range containers {
+		namespace, name := string(container.K8sArgs.K8S_POD_NAMESPACE), string(container.K8sArgs.K8S_POD_NAME)
+		if namespace == "" || name == "" {
+			continue
+		}
+		pod, err := s.kubeclient.GetPod(namespace, name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				logging.Debugf("staleNetworkStatusPods: cannot get pod %s/%s: %v", namespace, name, err)
+			}
+			continue
+		}
+		if uid := string(container.K8sArgs.K8S_POD_UID); uid != "" && uid != string(pod.UID) {
+			continue
+		}
+		key := namespace + "/" + name
+		upToDate[key] = upToDate[key] || networkStatusMatches(pod, multusConfig.AnnotationKey(types.NetworkStatusAnnotation), container.NetworkStatus)
+	}
+
+	var stale []string
+	for key, ok := range upToDate {
+		if !ok {
+			logging.Verbosef("warning: the network-status annotation of pod %s disagrees with the multus cache", key)
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// networkStatusMatches reports whether the network-status annotation of the
+// pod, of key annotationKey, has the networks and interfaces of the cached
+// network statuses
+func networkStatusMatches(pod *v1.Pod, annotationKey string, cached []nettypes.NetworkStatus) bool {
+	var annotated []nettypes.NetworkStatus
+	if raw, ok := pod.Annotations[annotationKey]; ok {
+		var err error
+		if annotated, err = k8s.DecodeNetworkStatusAnnotation(raw); err != nil {
+			return false
+		}
+	}
+	return equalStrings(networkStatusKeys(annotated), networkStatusKeys(cached))
+}
+
+func networkStatusKeys(statuses []nettypes.NetworkStatus) []string {
+	keys := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		keys = append(keys, status.Name+"@"+status.Interface)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+)
+
+// cachedAttachment is the part of a libcni result cache file used to find out
+// whether its container still exists
+type cachedAttachment struct {
+	ContainerID string `json:"containerId"`
+	NetNS       string `json:"netns,omitempty"`
+}
+
+// ReconcileOrphans lists the containers that have a multus scratch cache entry
+// in cniDir and finds the ones which are gone. If remove is set, the scratch
+// cache, result cache and completed ADD results of those containers are
+// deleted.
+// A container is only considered gone when the result cache records its
+// network namespace and none of the recorded paths exist anymore; anything
+// else is kept. It returns the IDs of the containers found to be gone.
+func ReconcileOrphans(cniDir string, remove bool) ([]string, error) {
+	scratchFiles, err := readScratchCache(cniDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, logging.Errorf("ReconcileOrphans: failed to read the cache directory %q: %v", cniDir, err)
+	}
+
+	netnsPaths, resultFiles := readResultCache(filepath.Join(cniDir, "results"))
+
+	var orphans []string
+	for containerID, scratchFile := range scratchFiles {
+		if !containerGone(netnsPaths[containerID]) {
+			logging.Debugf("ReconcileOrphans: keeping cache of container %s", containerID)
+			continue
+		}
+		orphans = append(orphans, containerID)
+
+		if !remove {
+			logging.Verbosef("ReconcileOrphans: container %s is gone, but orphan removal is disabled", containerID)
+			continue
+		}
+		for _, path := range append([]string{scratchFile}, resultFiles[containerID]...) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				_ = logging.Errorf("ReconcileOrphans: failed to remove %q of container %s: %v", path, containerID, err)
+				continue
+			}
+			logging.Verbosef("ReconcileOrphans: removed %q of gone container %s", path, containerID)
+		}
+		// the directories of the nested layout left empty, if any
+		for dir := filepath.Dir(scratchFile); dir != filepath.Clean(cniDir); dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(cniDir, addResultsDir, containerID)); err != nil {
+			_ = logging.Errorf("ReconcileOrphans: failed to remove the ADD results of container %s: %v", containerID, err)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// readScratchCache returns the scratch cache files in cniDir by container ID,
+// in both the flat layout, cniDir/<id>, and the nested one,
+// cniDir/<namespace>/<pod UID>/<id>, whose pod UID may be missing. The libcni
+// result cache and the ADD results directories are skipped, even though a
+// namespace could have their name.
+func readScratchCache(cniDir string) (map[string]string, error) {
+	files := map[string]string{}
+	var walk func(dir string, depth int) error
+	walk = func(dir string, depth int) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			switch {
+			case entry.Type().IsRegular():
+				files[entry.Name()] = path
+			case entry.IsDir() && depth < 2:
+				if depth == 0 && (entry.Name() == "results" || entry.Name() == addResultsDir) {
+					continue
+				}
+				if err := walk(path, depth+1); err != nil {
+					logging.Debugf("readScratchCache: cannot read %q, skipped: %v", path, err)
+				}
+			}
+		}
+		return nil
+	}
+	return files, walk(cniDir, 0)
+}
+
+// readResultCache returns, per container ID, the network namespaces recorded
+// in the result cache and the result cache files themselves
+func readResultCache(resultsDir string) (map[string][]string, map[string][]string) {
+	netnsPaths := map[string][]string{}
+	resultFiles := map[string][]string{}
+
+	entries, err := os.ReadDir(resultsDir)
+	if err != nil {
+		return netnsPaths, resultFiles
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(resultsDir, entry.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			logging.Debugf("readResultCache: cannot read %q, skipped: %v", path, err)
+			continue
+		}
+		cached := &cachedAttachment{}
+		if err := json.Unmarshal(b, cached); err != nil || cached.ContainerID == "" {
+			logging.Debugf("readResultCache: cannot parse %q, skipped: %v", path, err)
+			continue
+		}
+		resultFiles[cached.ContainerID] = append(resultFiles[cached.ContainerID], path)
+		if cached.NetNS != "" {
+			netnsPaths[cached.ContainerID] = append(netnsPaths[cached.ContainerID], cached.NetNS)
+		}
+	}
+	return netnsPaths, resultFiles
+}
+
+// containerGone reports whether all the given network namespaces positively do
+// not exist. Without any namespace to look at, the container is not known to
+// be gone.
+func containerGone(netnsPaths []string) bool {
+	if len(netnsPaths) == 0 {
+		return false
+	}
+	for _, path := range netnsPaths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+// disable dot-imports only for testing
+//revive:disable:dot-imports
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("orphan reconciliation", func() {
+	var cniDir string
+	var liveNetns string
+
+	writeCache := func(containerID, netns string) {
+		Expect(os.WriteFile(filepath.Join(cniDir, containerID), []byte(`[]`), 0600)).To(Succeed())
+		if netns == "" {
+			return
+		}
+		result := fmt.Sprintf(`{"kind":"cniCacheV1","containerId":%q,"ifName":"eth0","networkName":"net1","netns":%q}`, containerID, netns)
+		Expect(os.WriteFile(filepath.Join(cniDir, "results", "net1-"+containerID+"-eth0"), []byte(result), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		cniDir = GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(cniDir, "results"), 0700)).To(Succeed())
+
+		liveNetns = filepath.Join(GinkgoT().TempDir(), "cni-live")
+		Expect(os.WriteFile(liveNetns, nil, 0600)).To(Succeed())
+
+		writeCache("stale", filepath.Join(cniDir, "no-such-netns"))
+		writeCache("live", liveNetns)
+		writeCache("unknown", "")
+	})
+
+	It("only reports containers whose netns is gone when removal is disabled", func() {
+		orphans, err := ReconcileOrphans(cniDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(ConsistOf("stale"))
+
+		Expect(filepath.Join(cniDir, "stale")).To(BeAnExistingFile())
+		Expect(filepath.Join(cniDir, "results", "net1-stale-eth0")).To(BeAnExistingFile())
+	})
+
+	It("removes the cache of gone containers and keeps the others", func() {
+		orphans, err := ReconcileOrphans(cniDir, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(ConsistOf("stale"))
+
+		Expect(filepath.Join(cniDir, "stale")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(cniDir, "results", "net1-stale-eth0")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(cniDir, "live")).To(BeAnExistingFile())
+		Expect(filepath.Join(cniDir, "results", "net1-live-eth0")).To(BeAnExistingFile())
+		Expect(filepath.Join(cniDir, "unknown")).To(BeAnExistingFile())
+	})
+
+	It("reconciles the nested cache layout too", func() {
+		nestedDir := filepath.Join(cniDir, "ns1", "uid1")
+		Expect(os.MkdirAll(nestedDir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(nestedDir, "nested-stale"), []byte(`[]`), 0600)).To(Succeed())
+		result := fmt.Sprintf(`{"kind":"cniCacheV1","containerId":"nested-stale","ifName":"eth0","networkName":"net1","netns":%q}`, filepath.Join(cniDir, "no-such-netns"))
+		Expect(os.WriteFile(filepath.Join(cniDir, "results", "net1-nested-stale-eth0"), []byte(result), 0600)).To(Succeed())
+		// the libcni result cache is not taken for a namespace
+		Expect(os.MkdirAll(filepath.Join(cniDir, "results", "uid2"), 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cniDir, "results", "uid2", "gone"), []byte(`[]`), 0600)).To(Succeed())
+
+		orphans, err := ReconcileOrphans(cniDir, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(Equal([]string{"nested-stale", "stale"}))
+
+		Expect(filepath.Join(nestedDir, "nested-stale")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(cniDir, "ns1")).NotTo(BeADirectory())
+		Expect(filepath.Join(cniDir, "results", "net1-nested-stale-eth0")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(cniDir, "results", "uid2", "gone")).To(BeAnExistingFile())
+	})
+
+	It("ignores a missing cache directory", func() {
+		orphans, err := ReconcileOrphans(filepath.Join(cniDir, "missing"), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(BeEmpty())
+	})
+})
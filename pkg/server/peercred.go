@@ -0,0 +1,61 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/sys/unix"
+)
+
+type peerCredKey struct{}
+
+// peerCredContext adds the credentials of the process at the other end of a
+// unix socket connection to the context of its requests
+func peerCredContext(ctx context.Context, c net.Conn) context.Context {
+	unixConn, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, peerCredKey{}, cred)
+}
+
+// authorizeRoot fails unless the request was sent over the daemon socket by a
+// process running as root
+func authorizeRoot(r *http.Request) error {
+	cred, ok := r.Context().Value(peerCredKey{}).(*unix.Ucred)
+	if !ok {
+		return fmt.Errorf("cannot authenticate the request: no peer credentials")
+	}
+	if cred.Uid != 0 {
+		return fmt.Errorf("cannot authorize the request of uid %d: only root is allowed", cred.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
+)
+
+// podLock serializes the CNI operations of the containers of a pod
+type podLock struct {
+	// holds a token while an operation runs
+	sem chan struct{}
+	// number of operations holding or waiting for the lock
+	refs int
+}
+
+// podLocks tracks the locks of the pods with operations in flight, keyed by
+// pod UID
+type podLocks struct {
+	sync.Mutex
+	locks map[string]*podLock
+}
+
+func newPodLocks() *podLocks {
+	return &podLocks{locks: map[string]*podLock{}}
+}
+
+// lock waits until no other operation of the pod runs, or ctx is done. The
+// returned function releases the lock.
+func (l *podLocks) lock(ctx context.Context, podUID string) (func(), error) {
+	l.Lock()
+	pl, ok := l.locks[podUID]
+	if !ok {
+		pl = &podLock{sem: make(chan struct{}, 1)}
+		l.locks[podUID] = pl
+	}
+	pl.refs++
+	l.Unlock()
+
+	release := func() {
+		l.Lock()
+		pl.refs--
+		if pl.refs == 0 {
+			delete(l.locks, podUID)
+		}
+		l.Unlock()
+	}
+
+	select {
+	case pl.sem <- struct{}{}:
+		return func() {
+			<-pl.sem
+			release()
+		}, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// lockPod serializes the operation with the other ones of its pod when
+// serializePodOperations is enabled. The returned function releases the lock.
+func (s *Server) lockPod(ctx context.Context, k8sArgs *types.K8sArgs) (func(), error) {
+	if s.podLocks == nil || k8sArgs == nil || k8sArgs.K8S_POD_UID == "" {
+		return func() {}, nil
+	}
+	podUID := string(k8sArgs.K8S_POD_UID)
+	logging.Debugf("lockPod: waiting for the operations of pod %s/%s (%s)", k8sArgs.K8S_POD_NAMESPACE, k8sArgs.K8S_POD_NAME, podUID)
+	return s.podLocks.lock(ctx, podUID)
+}
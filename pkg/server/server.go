@@ -38,20 +38,22 @@ import (
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/api"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/tracing"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
 
 	netdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	netdefclient "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned"
 	netdefinformer "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/informers/externalversions"
-	netdefinformerv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/informers/externalversions/k8s.cni.cncf.io/v1"
 
 	kapi "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	informerfactory "k8s.io/client-go/informers"
 	v1coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/informers/internalinterfaces"
@@ -81,20 +83,51 @@ func printCmdArgs(args *skel.CmdArgs) string {
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
 }
 
+// checkDraining returns an error when the node is draining, i.e. when the
+// draining indicator file exists. New pod attachments are refused meanwhile.
+func (s *Server) checkDraining() error {
+	if s.drainingIndicatorFile == "" {
+		return nil
+	}
+	if _, err := os.Stat(s.drainingIndicatorFile); err != nil {
+		return nil
+	}
+	return fmt.Errorf("node draining: rejecting pod network setup while %s exists", s.drainingIndicatorFile)
+}
+
 // HandleCNIRequest is the CNI server handler function; it is invoked whenever
 // a CNI request is processed.
 func (s *Server) HandleCNIRequest(cmd string, k8sArgs *types.K8sArgs, cniCmdArgs *skel.CmdArgs) ([]byte, error) {
+	return s.HandleCNIRequestContext(context.Background(), cmd, k8sArgs, cniCmdArgs)
+}
+
+// HandleCNIRequestContext is HandleCNIRequest, tracing the CNI operation as a
+// child of the span in ctx, if any
+func (s *Server) HandleCNIRequestContext(ctx context.Context, cmd string, k8sArgs *types.K8sArgs, cniCmdArgs *skel.CmdArgs) ([]byte, error) {
 	var result []byte
 	var err error
 
 	logging.Verbosef("%s starting CNI request %s", cmd, printCmdArgs(cniCmdArgs))
+	switch cmd {
+	case "ADD", "DEL", "CHECK":
+		unlock, err := s.lockPod(ctx, k8sArgs)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
 	switch cmd {
 	case "ADD":
-		result, err = s.cmdAdd(cniCmdArgs, k8sArgs)
+		if err = s.checkDraining(); err != nil {
+			break
+		}
+		result, err = s.cmdAddOnce(ctx, cniCmdArgs, k8sArgs)
 	case "DEL":
-		err = s.cmdDel(cniCmdArgs, k8sArgs)
+		removeAddResults(cniCmdArgs)
+		err = s.cmdDel(ctx, cniCmdArgs, k8sArgs)
 	case "CHECK":
-		err = s.cmdCheck(cniCmdArgs, k8sArgs)
+		err = s.cmdCheck(ctx, cniCmdArgs, k8sArgs)
 	case "GC":
 		err = s.cmdGC(cniCmdArgs, k8sArgs)
 	case "STATUS":
@@ -118,8 +151,16 @@ func (s *Server) HandleDelegateRequest(cmd string, k8sArgs *types.K8sArgs, cniCm
 	}
 
 	logging.Verbosef("%s starting delegate request %s", cmd, printCmdArgs(cniCmdArgs))
+	unlock, err := s.lockPod(context.Background(), k8sArgs)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 	switch cmd {
 	case "ADD":
+		if err = s.checkDraining(); err != nil {
+			break
+		}
 		result, err = s.cmdDelegateAdd(cniCmdArgs, k8sArgs, multusConfig, interfaceAttributes)
 	case "DEL":
 		err = s.cmdDelegateDel(cniCmdArgs, k8sArgs, multusConfig)
@@ -132,6 +173,61 @@ func (s *Server) HandleDelegateRequest(cmd string, k8sArgs *types.K8sArgs, cniCm
 	return result, err
 }
 
+// badRequestError indicates a request with missing or invalid parameters
+type badRequestError struct {
+	message string
+}
+
+func (e *badRequestError) Error() string { return e.message }
+
+// multusNetConf returns the defaults of the multus configuration, overridden
+// by the server configuration
+func (s *Server) multusNetConf() (*types.NetConf, error) {
+	multusConfig := types.GetDefaultNetConf()
+	if len(s.serverConfig) > 0 {
+		if err := json.Unmarshal(s.serverConfig, multusConfig); err != nil {
+			return nil, err
+		}
+	}
+	return multusConfig, nil
+}
+
+func (s *Server) handleInterfaceOwnerRequest(r *http.Request) ([]byte, error) {
+	containerID := r.URL.Query().Get("containerID")
+	ifName := r.URL.Query().Get("ifName")
+	if containerID == "" || ifName == "" {
+		return nil, &badRequestError{"containerID and ifName are required"}
+	}
+
+	multusConfig, err := s.multusNetConf()
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := multus.GetInterfaceOwner(multusConfig.CNIDir, containerID, ifName)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(owner)
+}
+
+// SetConfigManager sets the manager of the multus configuration, which the
+// daemon regenerates on demand; without one, regeneration requests fail
+func (s *Server) SetConfigManager(configManager *config.Manager) {
+	s.configManager = configManager
+}
+
+func (s *Server) handleConfigRegenerateRequest() ([]byte, error) {
+	if s.configManager == nil {
+		return nil, &badRequestError{"the multus configuration is only generated with multusConfigFile=auto"}
+	}
+	multusConfig, path, err := s.configManager.Regenerate()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(api.RegenerateConfigResponse{Path: path, Config: json.RawMessage(multusConfig)})
+}
+
 // GetListener creates a listener to a unix socket located in `socketPath`
 func GetListener(socketPath string) (net.Listener, error) {
 	l, err := net.Listen("unix", socketPath)
@@ -167,9 +263,17 @@ func newNetDefInformer(netdefClient netdefclient.Interface) (netdefinformer.Shar
 
 	informerFactory := netdefinformer.NewSharedInformerFactoryWithOptions(netdefClient, resyncInterval)
 	netdefInformer := informerFactory.InformerFor(&netdefv1.NetworkAttachmentDefinition{}, func(client netdefclient.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
-		return netdefinformerv1.NewNetworkAttachmentDefinitionInformer(
-			client,
-			kapi.NamespaceAll,
+		// relistable, for the /resync-net-attach-defs endpoint
+		return k8s.NewRelistableInformer(
+			&cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return client.K8sCniCncfIoV1().NetworkAttachmentDefinitions(kapi.NamespaceAll).List(context.TODO(), options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return client.K8sCniCncfIoV1().NetworkAttachmentDefinitions(kapi.NamespaceAll).Watch(context.TODO(), options)
+				},
+			},
+			&netdefv1.NetworkAttachmentDefinition{},
 			resyncPeriod,
 			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
 	})
@@ -255,7 +359,78 @@ func NewCNIServer(daemonConfig *ControllerNetConf, serverConfig []byte, ignoreRe
 		logging.Verbosef("server configured with chroot: %s", daemonConfig.ChrootDir)
 	}
 
-	return newCNIServer(daemonConfig.SocketDir, kubeClient, exec, serverConfig, ignoreReadinessIndicator)
+	var networkStatusCheckPeriod time.Duration
+	if daemonConfig.NetworkStatusCheckPeriod != "" {
+		networkStatusCheckPeriod, err = time.ParseDuration(daemonConfig.NetworkStatusCheckPeriod)
+		if err != nil || networkStatusCheckPeriod <= 0 {
+			return nil, logging.Errorf("invalid networkStatusCheckPeriod %q, must be a positive duration", daemonConfig.NetworkStatusCheckPeriod)
+		}
+	}
+
+	quarantineWindow := DefaultNetAttachDefQuarantineWindow
+	if daemonConfig.NetAttachDefQuarantineThreshold < 0 {
+		return nil, logging.Errorf("invalid netAttachDefQuarantineThreshold %d, must not be negative", daemonConfig.NetAttachDefQuarantineThreshold)
+	}
+	if daemonConfig.NetAttachDefQuarantineWindow != "" {
+		quarantineWindow, err = time.ParseDuration(daemonConfig.NetAttachDefQuarantineWindow)
+		if err != nil || quarantineWindow <= 0 {
+			return nil, logging.Errorf("invalid netAttachDefQuarantineWindow %q, must be a positive duration", daemonConfig.NetAttachDefQuarantineWindow)
+		}
+	}
+
+	if daemonConfig.NamespaceInterfaceQuota < 0 {
+		return nil, logging.Errorf("invalid namespaceInterfaceQuota %d, must not be negative", daemonConfig.NamespaceInterfaceQuota)
+	}
+
+	s, err := newCNIServer(daemonConfig.SocketDir, kubeClient, exec, serverConfig, ignoreReadinessIndicator)
+	if err != nil {
+		return nil, err
+	}
+	s.daemonConfig = daemonConfig
+	s.drainingIndicatorFile = daemonConfig.DrainingIndicatorFile
+	if daemonConfig.SerializePodOperations {
+		s.podLocks = newPodLocks()
+	}
+	s.tracing = daemonConfig.Tracing
+	if networkStatusCheckPeriod > 0 {
+		s.networkStatusCheckPeriod = networkStatusCheckPeriod
+		if err := prometheus.Register(s.metrics.staleNetworkStatusPods); err != nil {
+			return nil, logging.Errorf("failed to register the network status metrics: %v", err)
+		}
+	}
+	if daemonConfig.ValidateNetAttachDefs {
+		s.netAttachDefValidationNamespaces = append([]string{}, daemonConfig.NetAttachDefValidationNamespaces...)
+		if err := prometheus.Register(s.metrics.invalidNetAttachDefs); err != nil {
+			return nil, logging.Errorf("failed to register the net-attach-def validation metrics: %v", err)
+		}
+	}
+	if daemonConfig.NetAttachDefQuarantineThreshold > 0 {
+		s.enableNetAttachDefQuarantine(daemonConfig.NetAttachDefQuarantineThreshold, quarantineWindow)
+		if err := prometheus.Register(s.metrics.quarantinedNetAttachDefs); err != nil {
+			return nil, logging.Errorf("failed to register the net-attach-def quarantine metrics: %v", err)
+		}
+	}
+	if daemonConfig.NamespaceInterfaceQuota > 0 {
+		if err := s.enableNamespaceInterfaceQuota(daemonConfig.NamespaceInterfaceQuota); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// enableNamespaceInterfaceQuota rejects the ADDs which would attach more than
+// quota secondary interfaces in a namespace, accounting those of the
+// containers already in the multus cache
+func (s *Server) enableNamespaceInterfaceQuota(quota int) error {
+	multusConfig, err := s.multusNetConf()
+	if err != nil {
+		return logging.Errorf("failed to load the multus configuration for the namespace interface quota: %v", err)
+	}
+	s.namespaceQuota = multus.NewNamespaceInterfaceQuota(quota)
+	if err := s.namespaceQuota.Rebuild(multusConfig.CNIDir); err != nil {
+		return logging.Errorf("failed to account the secondary interfaces cached in %s: %v", multusConfig.CNIDir, err)
+	}
+	return nil
 }
 
 func newCNIServer(rundir string, kubeClient *k8s.ClientInfo, exec invoke.Exec, servConfig []byte, ignoreReadinessIndicator bool) (*Server, error) {
@@ -280,14 +455,34 @@ func newCNIServer(rundir string, kubeClient *k8s.ClientInfo, exec invoke.Exec, s
 				},
 				[]string{"handler", "code", "method"},
 			),
+			staleNetworkStatusPods: prometheus.NewGauge(
+				prometheus.GaugeOpts{
+					Name: "multus_stale_network_status_pods",
+					Help: "Number of pods whose network-status annotation disagrees with the multus cache",
+				},
+			),
+			invalidNetAttachDefs: prometheus.NewGauge(
+				prometheus.GaugeOpts{
+					Name: "multus_invalid_net_attach_defs",
+					Help: "Number of net-attach-defs whose CNI config was found invalid on start",
+				},
+			),
+			quarantinedNetAttachDefs: prometheus.NewGauge(
+				prometheus.GaugeOpts{
+					Name: "multus_quarantined_net_attach_defs",
+					Help: "Number of net-attach-defs quarantined after consecutive ADD failures",
+				},
+			),
 		},
 		informerFactory:          informerFactory,
 		podInformer:              podInformer,
 		netdefInformerFactory:    netdefInformerFactory,
 		netdefInformer:           netdefInformer,
 		ignoreReadinessIndicator: ignoreReadinessIndicator,
+		addOperations:            addOperations{inFlight: map[string]*addOperation{}},
 	}
 	s.SetKeepAlivesEnabled(false)
+	s.ConnContext = peerCredContext
 
 	// register metrics
 	prometheus.MustRegister(s.metrics.requestCounter)
@@ -348,6 +543,127 @@ func newCNIServer(rundir string, kubeClient *k8s.ClientInfo, exec invoke.Exec, s
 			w.Header().Set("Content-Type", "application/json")
 		})))
 
+	// handle for '/version'
+	router.HandleFunc(api.MultusVersionAPIEndpoint, promhttp.InstrumentHandlerCounter(s.metrics.requestCounter.MustCurryWith(prometheus.Labels{"handler": api.MultusVersionAPIEndpoint}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, fmt.Sprintf("Method not allowed"), http.StatusMethodNotAllowed)
+				return
+			}
+
+			result, err := json.Marshal(&api.VersionResponse{Version: multus.PrintVersionString()})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(result); err != nil {
+				_ = logging.Errorf("Error writing HTTP response: %v", err)
+			}
+		})))
+
+	// handle for '/debug/bundle'
+	router.HandleFunc(api.MultusDebugBundleAPIEndpoint, promhttp.InstrumentHandlerCounter(s.metrics.requestCounter.MustCurryWith(prometheus.Labels{"handler": api.MultusDebugBundleAPIEndpoint}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, fmt.Sprintf("Method not allowed"), http.StatusMethodNotAllowed)
+				return
+			}
+
+			result, err := json.Marshal(s.debugBundle())
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(result); err != nil {
+				_ = logging.Errorf("Error writing HTTP response: %v", err)
+			}
+		})))
+
+	// handle for '/interface-owner'
+	router.HandleFunc(api.MultusInterfaceOwnerAPIEndpoint, promhttp.InstrumentHandlerCounter(s.metrics.requestCounter.MustCurryWith(prometheus.Labels{"handler": api.MultusInterfaceOwnerAPIEndpoint}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, fmt.Sprintf("Method not allowed"), http.StatusMethodNotAllowed)
+				return
+			}
+
+			result, err := s.handleInterfaceOwnerRequest(r)
+			if err != nil {
+				status := http.StatusInternalServerError
+				if _, ok := err.(*multus.InterfaceNotFoundError); ok {
+					status = http.StatusNotFound
+				} else if _, ok := err.(*badRequestError); ok {
+					status = http.StatusBadRequest
+				} else if _, ok := err.(*multus.InvalidContainerIDError); ok {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, fmt.Sprintf("%v", err), status)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(result); err != nil {
+				_ = logging.Errorf("Error writing HTTP response: %v", err)
+			}
+		})))
+
+	// handle for '/resync-net-attach-defs'
+	router.HandleFunc(api.MultusNetAttachDefResyncAPIEndpoint, promhttp.InstrumentHandlerCounter(s.metrics.requestCounter.MustCurryWith(prometheus.Labels{"handler": api.MultusNetAttachDefResyncAPIEndpoint}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, fmt.Sprintf("Method not allowed"), http.StatusMethodNotAllowed)
+				return
+			}
+
+			count, err := s.kubeclient.ResyncNetAttachDefs(r.Context())
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write([]byte(fmt.Sprintf(`{"netAttachDefs":%d}`, count))); err != nil {
+				_ = logging.Errorf("Error writing HTTP response: %v", err)
+			}
+		})))
+
+	// handle for '/regenerate-config'
+	router.HandleFunc(api.MultusConfigRegenerateAPIEndpoint, promhttp.InstrumentHandlerCounter(s.metrics.requestCounter.MustCurryWith(prometheus.Labels{"handler": api.MultusConfigRegenerateAPIEndpoint}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, fmt.Sprintf("Method not allowed"), http.StatusMethodNotAllowed)
+				return
+			}
+			if err := authorizeRoot(r); err != nil {
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusForbidden)
+				return
+			}
+
+			result, err := s.handleConfigRegenerateRequest()
+			if err != nil {
+				status := http.StatusInternalServerError
+				if _, ok := err.(*badRequestError); ok {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, fmt.Sprintf("%v", err), status)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(result); err != nil {
+				_ = logging.Errorf("Error writing HTTP response: %v", err)
+			}
+		})))
+
 	// this handle for the rest of above
 	router.HandleFunc("/", promhttp.InstrumentHandlerCounter(s.metrics.requestCounter.MustCurryWith(prometheus.Labels{"handler": "NotFound"}),
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -379,6 +695,18 @@ func (s *Server) Start(ctx context.Context, l net.Listener) {
 	}
 	waitCancel()
 
+	// the net-attach-defs are validated in the background, never delaying
+	// the CNI requests
+	if s.netAttachDefValidationNamespaces != nil {
+		go s.checkNetAttachDefs()
+	}
+
+	if s.networkStatusCheckPeriod > 0 {
+		go utilwait.UntilWithContext(ctx, func(_ context.Context) {
+			s.checkNetworkStatuses()
+		}, s.networkStatusCheckPeriod)
+	}
+
 	go func() {
 		utilwait.UntilWithContext(ctx, func(_ context.Context) {
 			logging.Debugf("open for business")
@@ -398,7 +726,13 @@ func (s *Server) handleCNIRequest(r *http.Request) ([]byte, error) {
 	if err := json.Unmarshal(b, &cr); err != nil {
 		return nil, err
 	}
-	cmdType, cniCmdArgs, err := s.extractCniData(&cr, s.serverConfig)
+	return s.processCNIRequest(&cr)
+}
+
+// processCNIRequest runs a decoded CNI request of the shim, whichever API it
+// was received on
+func (s *Server) processCNIRequest(cr *api.Request) ([]byte, error) {
+	cmdType, cniCmdArgs, err := s.extractCniData(cr, s.serverConfig)
 	if err != nil {
 		return nil, fmt.Errorf("could not extract the CNI command args: %w", err)
 	}
@@ -408,7 +742,12 @@ func (s *Server) handleCNIRequest(r *http.Request) ([]byte, error) {
 		return nil, fmt.Errorf("could not extract the kubernetes runtime args: %w", err)
 	}
 
-	result, err := s.HandleCNIRequest(cmdType, k8sArgs, cniCmdArgs)
+	ctx := context.Background()
+	if s.tracing != nil && s.tracing.TraceContextSource == tracing.SourceEnv {
+		ctx = tracing.ContextFromEnv(ctx, cr.Env)
+	}
+
+	result, err := s.HandleCNIRequestContext(ctx, cmdType, k8sArgs, cniCmdArgs)
 	if err != nil {
 		// Prefix error with request information for easier debugging
 		return nil, fmt.Errorf("%s ERRORED: %v", printCmdArgs(cniCmdArgs), err)
@@ -581,7 +920,7 @@ func podUID(kubeclient *k8s.ClientInfo, cniArgs map[string]string, podNamespace,
 	return uid, nil
 }
 
-func (s *Server) cmdAdd(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) ([]byte, error) {
+func (s *Server) cmdAdd(ctx context.Context, cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) ([]byte, error) {
 	namespace := string(k8sArgs.K8S_POD_NAMESPACE)
 	podName := string(k8sArgs.K8S_POD_NAME)
 	if namespace == "" || podName == "" {
@@ -589,14 +928,21 @@ func (s *Server) cmdAdd(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) ([]byte,
 	}
 
 	logging.Debugf("CmdAdd for [%s/%s]. CNI conf: %+v", namespace, podName, *cmdArgs)
-	result, err := multus.CmdAdd(cmdArgs, s.exec, s.kubeclient)
+	ctx, warnings := multus.WithWarnings(ctx)
+	if s.quarantine != nil {
+		ctx = multus.WithNetAttachDefQuarantine(ctx, s.quarantine)
+	}
+	if s.namespaceQuota != nil {
+		ctx = multus.WithNamespaceInterfaceQuota(ctx, s.namespaceQuota)
+	}
+	result, err := multus.CmdAddContext(ctx, cmdArgs, s.exec, s.kubeclient)
 	if err != nil {
 		return nil, fmt.Errorf("error configuring pod [%s/%s] networking: %v", namespace, podName, err)
 	}
-	return serializeResult(result)
+	return serializeResult(result, warnings.List())
 }
 
-func (s *Server) cmdDel(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error {
+func (s *Server) cmdDel(ctx context.Context, cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error {
 	namespace := string(k8sArgs.K8S_POD_NAMESPACE)
 	podName := string(k8sArgs.K8S_POD_NAME)
 	if namespace == "" || podName == "" {
@@ -604,10 +950,13 @@ func (s *Server) cmdDel(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error {
 	}
 
 	logging.Debugf("CmdDel for [%s/%s]. CNI conf: %+v", namespace, podName, *cmdArgs)
-	return multus.CmdDel(cmdArgs, s.exec, s.kubeclient)
+	if s.namespaceQuota != nil {
+		ctx = multus.WithNamespaceInterfaceQuota(ctx, s.namespaceQuota)
+	}
+	return multus.CmdDelContext(ctx, cmdArgs, s.exec, s.kubeclient)
 }
 
-func (s *Server) cmdCheck(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error {
+func (s *Server) cmdCheck(ctx context.Context, cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error {
 	namespace := string(k8sArgs.K8S_POD_NAMESPACE)
 	podName := string(k8sArgs.K8S_POD_NAME)
 	if namespace == "" || podName == "" {
@@ -615,7 +964,7 @@ func (s *Server) cmdCheck(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error {
 	}
 
 	logging.Debugf("CmdCheck for [%s/%s]. CNI conf: %+v", namespace, podName, *cmdArgs)
-	return multus.CmdCheck(cmdArgs, s.exec, s.kubeclient)
+	return multus.CmdCheckContext(ctx, cmdArgs, s.exec, s.kubeclient)
 }
 
 func (s *Server) cmdGC(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error {
@@ -640,14 +989,14 @@ func (s *Server) cmdStatus(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs) error
 	return multus.CmdStatus(cmdArgs, s.exec, s.kubeclient)
 }
 
-func serializeResult(result cnitypes.Result) ([]byte, error) {
+func serializeResult(result cnitypes.Result, warnings []string) ([]byte, error) {
 	// cni result is converted to latest here and decoded to specific cni version at multus-shim
 	realResult, err := cni100.NewResultFromResult(result)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate the CNI result: %w", err)
 	}
 
-	responseBytes, err := json.Marshal(&api.Response{Result: realResult})
+	responseBytes, err := json.Marshal(&api.Response{Result: realResult, Warnings: warnings})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal pod request response: %v", err)
 	}
@@ -687,12 +1036,13 @@ func (s *Server) cmdDelegateAdd(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs, m
 
 	logging.Debugf("CmdDelegateAdd for [%s/%s]. CNI conf: %+v", namespace, podName, *cmdArgs)
 	rt, _ := types.CreateCNIRuntimeConf(cmdArgs, k8sArgs, cmdArgs.IfName, nil, delegateCNIConf)
-	result, err := multus.DelegateAdd(s.exec, s.kubeclient, pod, delegateCNIConf, rt, multusConfig)
+	ctx, warnings := multus.WithWarnings(context.Background())
+	result, err := multus.DelegateAddContext(ctx, s.exec, s.kubeclient, pod, delegateCNIConf, rt, multusConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error configuring pod [%s/%s] networking: %v", namespace, podName, err)
 	}
 
-	return serializeResult(result)
+	return serializeResult(result, warnings.List())
 }
 
 func (s *Server) cmdDelegateCheck(cmdArgs *skel.CmdArgs, k8sArgs *types.K8sArgs, multusConfig *types.NetConf) error {
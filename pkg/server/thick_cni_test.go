@@ -18,27 +18,44 @@ package server
 //revive:disable:dot-imports
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/skel"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/containernetworking/plugins/pkg/testutils"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/record"
 
+	netdefv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	netfake "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/fake"
 	k8s "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/api"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
 	testhelpers "gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/testing"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
 )
 
 const suiteName = "Thick CNI architecture"
@@ -60,6 +77,43 @@ func (fe *fakeExec) Decode(_ []byte) (version.PluginInfo, error) {
 	return nil, nil
 }
 
+// countingExec counts the ADDs of the delegates, which wait for release
+type countingExec struct {
+	fakeExec
+	adds    int32
+	release chan struct{}
+}
+
+// ExecPlugin executes the plugin
+func (ce *countingExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	for _, env := range environ {
+		if env == "CNI_COMMAND=ADD" {
+			atomic.AddInt32(&ce.adds, 1)
+			<-ce.release
+		}
+	}
+	return ce.fakeExec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+// stderrExec writes a warning to the stderr of the delegates
+type stderrExec struct {
+	fakeExec
+	stderr io.Writer
+}
+
+// WithStderr returns the exec writing to stderr
+func (se *stderrExec) WithStderr(stderr io.Writer) invoke.Exec {
+	return &stderrExec{stderr: stderr}
+}
+
+// ExecPlugin executes the plugin
+func (se *stderrExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	if se.stderr != nil {
+		fmt.Fprint(se.stderr, "deprecated config key")
+	}
+	return se.fakeExec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
 var _ = Describe(suiteName, func() {
 	const thickCNISocketDirPath = "multus-cni-thick-arch-socket-path"
 
@@ -151,6 +205,354 @@ var _ = Describe(suiteName, func() {
 			Expect(os.Setenv("CNI_COMMAND", "DEL")).NotTo(HaveOccurred())
 			Expect(api.CmdDel(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
 		})
+
+		It("finds the delegate which created an interface", func() {
+			Expect(os.Setenv("CNI_COMMAND", "ADD")).NotTo(HaveOccurred())
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+
+			rec := httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+				fmt.Sprintf("%s?containerID=%s&ifName=%s", api.MultusInterfaceOwnerAPIEndpoint, containerID, ifaceName), nil))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			owner := &multus.InterfaceOwner{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), owner)).To(Succeed())
+			Expect(owner.Name).To(Equal("weave1"))
+			Expect(owner.Type).To(Equal("weave-net"))
+			Expect(owner.IfName).To(Equal(ifaceName))
+
+			rec = httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+				fmt.Sprintf("%s?containerID=%s&ifName=net9", api.MultusInterfaceOwnerAPIEndpoint, containerID), nil))
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+			for _, invalidID := range []string{"..", "../" + containerID, "results/" + containerID} {
+				rec = httptest.NewRecorder()
+				cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+					fmt.Sprintf("%s?containerID=%s&ifName=%s", api.MultusInterfaceOwnerAPIEndpoint, url.QueryEscape(invalidID), ifaceName), nil))
+				Expect(rec.Code).To(Equal(http.StatusBadRequest), invalidID)
+			}
+
+			rec = httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, api.MultusInterfaceOwnerAPIEndpoint, nil))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+			Expect(os.Setenv("CNI_COMMAND", "DEL")).NotTo(HaveOccurred())
+			Expect(api.CmdDel(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+		})
+
+		It("returns the diagnostics bundle of the daemon", func() {
+			Expect(os.Setenv("CNI_COMMAND", "ADD")).NotTo(HaveOccurred())
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+			_ = logging.Errorf("a recent error")
+
+			rec := httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, api.MultusDebugBundleAPIEndpoint, nil))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			bundle := map[string]json.RawMessage{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &bundle)).To(Succeed())
+			Expect(bundle).To(HaveLen(5))
+			Expect(bundle).To(HaveKey("version"))
+			Expect(bundle).To(HaveKey("config"))
+			Expect(bundle).To(HaveKey("attachments"))
+			Expect(bundle).To(HaveKey("recentErrors"))
+			Expect(bundle).To(HaveKey("metrics"))
+
+			response := api.DebugBundleResponse{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Version).To(Equal(multus.PrintVersionString()))
+			multusConf, err := config.ParseMultusConfigContents([]byte("{}"))
+			Expect(err).NotTo(HaveOccurred())
+			printedConfig, err := EffectiveDaemonConfig(&ControllerNetConf{}, multusConf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Marshal(response.Config)).To(MatchJSON(printedConfig))
+			Expect(response.Attachments).To(Equal(api.DebugBundleAttachments{Containers: 1, Interfaces: 1}))
+			Expect(response.RecentErrors[len(response.RecentErrors)-1].Message).To(Equal("a recent error"))
+			Expect(response.Metrics).To(ContainSubstring("multus_server_request_total"))
+
+			rec = httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, api.MultusDebugBundleAPIEndpoint, nil))
+			Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+
+			Expect(os.Setenv("CNI_COMMAND", "DEL")).NotTo(HaveOccurred())
+			Expect(api.CmdDel(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+		})
+
+		It("relists the net-attach-defs into the informer cache", func() {
+			_, err := K8sClient.AddNetAttachDef(testhelpers.NewFakeNetAttachDef("test", "net1", "{}"))
+			Expect(err).NotTo(HaveOccurred())
+
+			rec := httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, api.MultusNetAttachDefResyncAPIEndpoint, nil))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"netAttachDefs":1}`))
+			Eventually(cniServer.netdefInformer.GetStore().ListKeys).Should(ConsistOf("test/net1"))
+
+			rec = httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, api.MultusNetAttachDefResyncAPIEndpoint, nil))
+			Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+
+		It("regenerates the multus configuration on demand", func() {
+			regenerateURL := api.GetAPIEndpoint(api.MultusConfigRegenerateAPIEndpoint)
+			_, err := api.DoCNI(regenerateURL, nil, api.SocketPath(thickPluginRunDir))
+			Expect(err).To(MatchError(ContainSubstring("status 400")))
+
+			configDir, err := os.MkdirTemp("", "multus-config")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(configDir)
+			primaryConfig := filepath.Join(configDir, "10-primary.conf")
+			Expect(os.WriteFile(primaryConfig, []byte(`{"cniVersion": "0.4.0", "name": "primary", "type": "mycni"}`), 0600)).To(Succeed())
+			configManager, err := config.NewManager(config.MultusConf{
+				Name:                "multus-cni-network",
+				Type:                "multus-shim",
+				CNIVersion:          "0.4.0",
+				CniConfigDir:        configDir,
+				MultusAutoconfigDir: configDir,
+				MultusMasterCni:     "10-primary.conf",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			cniServer.SetConfigManager(configManager)
+
+			body, err := api.DoCNI(regenerateURL, nil, api.SocketPath(thickPluginRunDir))
+			Expect(err).NotTo(HaveOccurred())
+			response := api.RegenerateConfigResponse{}
+			Expect(json.Unmarshal(body, &response)).To(Succeed())
+			Expect(response.Path).To(Equal(filepath.Join(configDir, "00-multus.conf")))
+			persisted, err := os.ReadFile(response.Path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(persisted).To(MatchJSON(response.Config))
+			Expect(string(persisted)).To(ContainSubstring(primaryConfig))
+
+			// the file is regenerated, e.g. after a fix of the primary CNI configuration
+			Expect(os.WriteFile(response.Path, []byte("{}"), 0600)).To(Succeed())
+			_, err = api.DoCNI(regenerateURL, nil, api.SocketPath(thickPluginRunDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.ReadFile(response.Path)).To(MatchJSON(persisted))
+
+			// requests not coming over the daemon socket cannot be authenticated
+			rec := httptest.NewRecorder()
+			cniServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, api.MultusConfigRegenerateAPIEndpoint, nil))
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("rejects ADD but serves CHECK/DEL while the node is draining", func() {
+			drainingFile := thickPluginRunDir + "/draining"
+			cniServer.drainingIndicatorFile = drainingFile
+
+			Expect(os.Setenv("CNI_COMMAND", "ADD")).NotTo(HaveOccurred())
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+
+			Expect(os.WriteFile(drainingFile, []byte{}, 0600)).To(Succeed())
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(MatchError(ContainSubstring("node draining")))
+
+			Expect(os.Setenv("CNI_COMMAND", "CHECK")).NotTo(HaveOccurred())
+			Expect(api.CmdCheck(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+
+			Expect(os.Setenv("CNI_COMMAND", "DEL")).NotTo(HaveOccurred())
+			Expect(api.CmdDel(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+
+			Expect(os.Remove(drainingFile)).To(Succeed())
+			Expect(os.Setenv("CNI_COMMAND", "ADD")).NotTo(HaveOccurred())
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+		})
+
+		It("ADD/CHECK/DEL works over gRPC", func() {
+			grpcConfig := strings.Replace(referenceConfig(thickPluginRunDir), `"type": "multus",`, `"type": "multus", "daemonTransport": "grpc",`, 1)
+
+			// the shim does not fall back to HTTP for ADD
+			Expect(os.Setenv("CNI_COMMAND", "ADD")).NotTo(HaveOccurred())
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, grpcConfig))).NotTo(Succeed())
+
+			l, err := GetListener(api.GRPCSocketPath(thickPluginRunDir))
+			Expect(err).NotTo(HaveOccurred())
+			grpcServer := cniServer.StartGRPC(ctx, l)
+			defer grpcServer.Stop()
+
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, grpcConfig))).To(Succeed())
+
+			Expect(os.Setenv("CNI_COMMAND", "CHECK")).NotTo(HaveOccurred())
+			Expect(api.CmdCheck(cniCmdArgs(containerID, netns.Path(), ifaceName, grpcConfig))).To(Succeed())
+
+			Expect(os.Setenv("CNI_COMMAND", "DEL")).NotTo(HaveOccurred())
+			Expect(api.CmdDel(cniCmdArgs(containerID, netns.Path(), ifaceName, grpcConfig))).To(Succeed())
+
+			version, err := api.GetVersionGRPC(api.GRPCSocketPath(thickPluginRunDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(multus.PrintVersionString()))
+
+			version, err = api.CheckDaemon(thickPluginRunDir, api.TransportHTTP)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(multus.PrintVersionString()))
+		})
+
+		It("returns the warnings of the ADD to the shim", func() {
+			cniServer.exec = &stderrExec{}
+
+			Expect(os.Setenv("CNI_COMMAND", "ADD")).NotTo(HaveOccurred())
+			env := map[string]string{"CNI_IFNAME": ifaceName}
+			for _, name := range []string{"CNI_COMMAND", "CNI_CONTAINERID", "CNI_NETNS", "CNI_ARGS"} {
+				env[name] = os.Getenv(name)
+			}
+			body, err := api.DoCNI("http://dummy/cni", &api.Request{Env: env, Config: []byte(referenceConfig(thickPluginRunDir))}, api.SocketPath(thickPluginRunDir))
+			Expect(err).NotTo(HaveOccurred())
+
+			response := &api.Response{}
+			Expect(json.Unmarshal(body, response)).To(Succeed())
+			Expect(response.Result).NotTo(BeNil())
+			Expect(response.Warnings).To(ConsistOf("delegate weave1(weave1) wrote to stderr: deprecated config key"))
+
+			// the shim does not fail on warnings
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+
+			Expect(os.Setenv("CNI_COMMAND", "DEL")).NotTo(HaveOccurred())
+			Expect(api.CmdDel(cniCmdArgs(containerID, netns.Path(), ifaceName, referenceConfig(thickPluginRunDir)))).To(Succeed())
+		})
+
+		It("decodes the response of a daemon sending no warnings", func() {
+			response := &api.Response{}
+			Expect(json.Unmarshal([]byte(`{"Result": {"cniVersion": "1.0.0"}}`), response)).To(Succeed())
+			Expect(response.Result.CNIVersion).To(Equal("1.0.0"))
+			Expect(response.Warnings).To(BeEmpty())
+		})
+
+		It("rejects an unknown daemon transport in the shim", func() {
+			badConfig := strings.Replace(referenceConfig(thickPluginRunDir), `"type": "multus",`, `"type": "multus", "daemonTransport": "carrier-pigeon",`, 1)
+			Expect(os.Setenv("CNI_COMMAND", "ADD")).NotTo(HaveOccurred())
+			Expect(api.CmdAdd(cniCmdArgs(containerID, netns.Path(), ifaceName, badConfig))).To(MatchError(ContainSubstring(`unknown daemonTransport "carrier-pigeon"`)))
+		})
+	})
+
+	Context("retried ADDs", func() {
+		const (
+			containerID = "123456789"
+			ifaceName   = "eth0"
+			podName     = "my-little-pod"
+			cniArgs     = "K8S_POD_NAMESPACE=test;K8S_POD_NAME=my-little-pod;K8S_POD_INFRA_CONTAINER_ID=;K8S_POD_UID=testUID"
+		)
+
+		var (
+			cniServer *Server
+			K8sClient *k8s.ClientInfo
+			exec      *countingExec
+			netns     ns.NetNS
+			ctx       context.Context
+			cancel    context.CancelFunc
+			k8sArgs   *types.K8sArgs
+			conf      string
+		)
+
+		BeforeEach(func() {
+			var err error
+			K8sClient = fakeK8sClient()
+			Expect(createFakePod(K8sClient, podName)).To(Succeed())
+
+			exec = &countingExec{release: make(chan struct{})}
+			cniServer, err = newCNIServer(thickPluginRunDir, K8sClient, exec, nil, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(FilesystemPreRequirements(thickPluginRunDir)).To(Succeed())
+			l, err := GetListener(api.SocketPath(thickPluginRunDir))
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel = context.WithCancel(context.TODO())
+			cniServer.Start(ctx, l)
+
+			netns, err = testutils.NewNS()
+			Expect(err).NotTo(HaveOccurred())
+
+			k8sArgs = &types.K8sArgs{}
+			Expect(cnitypes.LoadArgs(cniArgs, k8sArgs)).To(Succeed())
+			// without readiness indicator, as the requests do not go through the shim
+			conf = strings.Replace(referenceConfig(thickPluginRunDir), `"readinessindicatorfile": "/tmp/foo.multus.conf",`,
+				fmt.Sprintf(`"cniDir": "%s/cache",`, thickPluginRunDir), 1)
+		})
+
+		AfterEach(func() {
+			cancel()
+			unregisterMetrics(cniServer)
+			Expect(cniServer.Close()).To(Succeed())
+		})
+
+		request := func(cmd string) ([]byte, error) {
+			args := cniCmdArgs(containerID, netns.Path(), ifaceName, conf)
+			args.Args = cniArgs
+			return cniServer.HandleCNIRequestContext(ctx, cmd, k8sArgs, args)
+		}
+
+		It("runs the delegates of identical ADDs once", func() {
+			results := make(chan []byte, 2)
+			add := func() {
+				defer GinkgoRecover()
+				result, err := request("ADD")
+				Expect(err).NotTo(HaveOccurred())
+				results <- result
+			}
+			adds := func() int32 { return atomic.LoadInt32(&exec.adds) }
+
+			// the second ADD comes while the delegate of the first one runs
+			go add()
+			Eventually(adds).Should(Equal(int32(1)))
+			go add()
+			Consistently(adds, "200ms").Should(Equal(int32(1)))
+			close(exec.release)
+
+			first, second := <-results, <-results
+			Expect(second).To(Equal(first))
+			Expect(adds()).To(Equal(int32(1)))
+
+			// a retry of the completed ADD gets its result
+			result, err := request("ADD")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(first))
+			Expect(adds()).To(Equal(int32(1)))
+
+			// after DEL, the ADD runs again
+			_, err = request("DEL")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = request("ADD")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(adds()).To(Equal(int32(2)))
+		})
+
+		Context("with two containers of the same pod", func() {
+			const sidecarContainerID = "987654321"
+
+			addContainer := func(id string, done chan<- struct{}) {
+				defer GinkgoRecover()
+				args := cniCmdArgs(id, netns.Path(), ifaceName, conf)
+				args.Args = cniArgs
+				_, err := cniServer.HandleCNIRequestContext(ctx, "ADD", k8sArgs, args)
+				Expect(err).NotTo(HaveOccurred())
+				done <- struct{}{}
+			}
+			adds := func() int32 { return atomic.LoadInt32(&exec.adds) }
+
+			It("serializes their ADDs with serializePodOperations", func() {
+				cniServer.podLocks = newPodLocks()
+				done := make(chan struct{}, 2)
+
+				go addContainer(containerID, done)
+				Eventually(adds).Should(Equal(int32(1)))
+				go addContainer(sidecarContainerID, done)
+				Consistently(adds, "200ms").Should(Equal(int32(1)))
+
+				close(exec.release)
+				Eventually(done).Should(Receive())
+				Eventually(done).Should(Receive())
+				Expect(adds()).To(Equal(int32(2)))
+				Expect(cniServer.podLocks.locks).To(BeEmpty())
+			})
+
+			It("runs their ADDs concurrently by default", func() {
+				done := make(chan struct{}, 2)
+
+				go addContainer(containerID, done)
+				go addContainer(sidecarContainerID, done)
+				Eventually(adds).Should(Equal(int32(2)))
+
+				close(exec.release)
+				Eventually(done).Should(Receive())
+				Eventually(done).Should(Receive())
+			})
+		})
 	})
 
 	Context("CNI operations started from the shim with CNI config override with server config", func() {
@@ -220,6 +622,165 @@ var _ = Describe(suiteName, func() {
 
 		})
 	})
+	Context("network status check", func() {
+		const (
+			containerID = "123456789"
+			podName     = "my-little-pod"
+		)
+
+		var (
+			cniServer *Server
+			K8sClient *k8s.ClientInfo
+			cniDir    string
+			ctx       context.Context
+			cancel    context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			var err error
+			K8sClient = fakeK8sClient()
+			Expect(createFakePod(K8sClient, podName)).To(Succeed())
+
+			Expect(FilesystemPreRequirements(thickPluginRunDir)).To(Succeed())
+			cniDir = filepath.Join(thickPluginRunDir, "cache")
+			Expect(os.MkdirAll(filepath.Join(cniDir, "results"), 0700)).To(Succeed())
+			delegate, err := types.LoadDelegateNetConf([]byte(`{"cniVersion": "0.4.0", "name": "weave1", "type": "weave-net"}`), nil, "", "")
+			Expect(err).NotTo(HaveOccurred())
+			delegate.MasterPlugin = true
+			delegates, err := json.Marshal([]*types.DelegateNetConf{delegate})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(cniDir, containerID), delegates, 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(cniDir, "results", "weave1-"+containerID+"-eth0"), []byte(`{
+				"kind": "cniCacheV1",
+				"containerId": "`+containerID+`",
+				"ifName": "eth0",
+				"networkName": "weave1",
+				"cniArgs": [["K8S_POD_NAMESPACE", "test"], ["K8S_POD_NAME", "`+podName+`"], ["K8S_POD_UID", "testUID"]],
+				"result": {
+					"cniVersion": "0.4.0",
+					"interfaces": [{"name": "eth0", "sandbox": "/var/run/netns/test"}],
+					"ips": [{"version": "4", "address": "10.1.1.2/24", "interface": 0}]
+				}
+			}`), 0600)).To(Succeed())
+
+			ctx, cancel = context.WithCancel(context.TODO())
+			cniServer, err = startCNIServer(ctx, thickPluginRunDir, K8sClient, []byte(fmt.Sprintf(`{"cniDir": %q}`, cniDir)))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			cancel()
+			unregisterMetrics(cniServer)
+			Expect(cniServer.Close()).To(Succeed())
+			Expect(os.RemoveAll(cniDir)).To(Succeed())
+		})
+
+		It("counts the pods whose network-status annotation disagrees with the cache", func() {
+			registry := prometheus.NewRegistry()
+			Expect(registry.Register(cniServer.metrics.staleNetworkStatusPods)).To(Succeed())
+			staleNetworkStatusPods := func() string {
+				cniServer.checkNetworkStatuses()
+				recorder := httptest.NewRecorder()
+				promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+				return recorder.Body.String()
+			}
+			setNetworkStatus := func(status string) {
+				pod, err := K8sClient.Client.CoreV1().Pods("test").Get(context.TODO(), podName, metav1.GetOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				pod.Annotations = map[string]string{netdefv1.NetworkStatusAnnot: status}
+				_, err = K8sClient.Client.CoreV1().Pods("test").Update(context.TODO(), pod, metav1.UpdateOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			// the pod has no network-status annotation yet
+			Eventually(staleNetworkStatusPods).Should(ContainSubstring("multus_stale_network_status_pods 1"))
+
+			setNetworkStatus(`[{"name": "weave1", "interface": "eth0", "ips": ["10.1.1.2"], "default": true}]`)
+			Eventually(staleNetworkStatusPods).Should(ContainSubstring("multus_stale_network_status_pods 0"))
+
+			setNetworkStatus(`[{"name": "weave1", "interface": "net1"}]`)
+			Eventually(staleNetworkStatusPods).Should(ContainSubstring("multus_stale_network_status_pods 1"))
+			Expect(cniServer.staleNetworkStatusPods()).To(Equal([]string{"test/" + podName}))
+
+			// pods which are gone are skipped
+			Expect(K8sClient.Client.CoreV1().Pods("test").Delete(context.TODO(), podName, metav1.DeleteOptions{})).To(Succeed())
+			Eventually(staleNetworkStatusPods).Should(ContainSubstring("multus_stale_network_status_pods 0"))
+		})
+	})
+	Context("net-attach-def validation", func() {
+		var (
+			cniServer *Server
+			K8sClient *k8s.ClientInfo
+			ctx       context.Context
+			cancel    context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			var err error
+			K8sClient = fakeK8sClient()
+			for _, nad := range []*netdefv1.NetworkAttachmentDefinition{
+				testhelpers.NewFakeNetAttachDef("test", "valid", `{"cniVersion": "0.4.0", "type": "macvlan"}`),
+				testhelpers.NewFakeNetAttachDef("test", "broken-json", `{"cniVersion": "0.4.0", "type": `),
+				testhelpers.NewFakeNetAttachDef("other", "valid-list", `{"cniVersion": "0.4.0", "plugins": [{"type": "macvlan"}]}`),
+				testhelpers.NewFakeNetAttachDef("other", "no-type", `{"cniVersion": "0.4.0"}`),
+			} {
+				_, err = K8sClient.AddNetAttachDef(nad)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Expect(FilesystemPreRequirements(thickPluginRunDir)).To(Succeed())
+			ctx, cancel = context.WithCancel(context.TODO())
+			cniServer, err = startCNIServer(ctx, thickPluginRunDir, K8sClient, nil)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			cancel()
+			unregisterMetrics(cniServer)
+			Expect(cniServer.Close()).To(Succeed())
+		})
+
+		It("reports the net-attach-defs whose CNI config is invalid", func() {
+			registry := prometheus.NewRegistry()
+			Expect(registry.Register(cniServer.metrics.invalidNetAttachDefs)).To(Succeed())
+
+			cniServer.netAttachDefValidationNamespaces = []string{}
+			Expect(cniServer.invalidNetAttachDefs()).To(Equal([]string{"other/no-type", "test/broken-json"}))
+			cniServer.checkNetAttachDefs()
+			recorder := httptest.NewRecorder()
+			promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			Expect(recorder.Body.String()).To(ContainSubstring("multus_invalid_net_attach_defs 2"))
+
+			// only the configured namespaces are validated
+			cniServer.netAttachDefValidationNamespaces = []string{"test"}
+			Expect(cniServer.invalidNetAttachDefs()).To(Equal([]string{"test/broken-json"}))
+		})
+
+		It("clears the quarantine of a net-attach-def once it is updated", func() {
+			registry := prometheus.NewRegistry()
+			Expect(registry.Register(cniServer.metrics.quarantinedNetAttachDefs)).To(Succeed())
+			quarantinedNetAttachDefs := func() string {
+				recorder := httptest.NewRecorder()
+				promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+				return recorder.Body.String()
+			}
+
+			cniServer.enableNetAttachDefQuarantine(2, time.Minute)
+			cniServer.quarantine.RecordFailure("test/valid", "")
+			Expect(cniServer.quarantine.Check("test/valid", "")).To(Succeed())
+			cniServer.quarantine.RecordFailure("test/valid", "")
+			Expect(cniServer.quarantine.Check("test/valid", "")).To(MatchError(ContainSubstring("is quarantined")))
+			Expect(quarantinedNetAttachDefs()).To(ContainSubstring("multus_quarantined_net_attach_defs 1"))
+
+			nad, err := K8sClient.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions("test").Get(context.TODO(), "valid", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			nad.ResourceVersion = "2"
+			_, err = K8sClient.NetClient.K8sCniCncfIoV1().NetworkAttachmentDefinitions("test").Update(context.TODO(), nad, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(quarantinedNetAttachDefs).Should(ContainSubstring("multus_quarantined_net_attach_defs 0"))
+			Expect(cniServer.quarantine.Quarantined()).To(BeEmpty())
+		})
+	})
 })
 
 func fakeK8sClient() *k8s.ClientInfo {
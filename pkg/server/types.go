@@ -23,6 +23,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/k8sclient"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/multus"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/server/config"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/types"
 
 	netdefinformer "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/informers/externalversions"
 	"k8s.io/client-go/informers/internalinterfaces"
@@ -38,11 +41,20 @@ const (
 	DefaultMultusRunDir = "/run/multus/"
 	// DefaultCertDuration specifies default duration for certs in per-node-certs config
 	DefaultCertDuration = 10 * time.Minute
+	// DefaultNetAttachDefQuarantineWindow is the default window of the
+	// consecutive ADD failures quarantining a net-attach-def
+	DefaultNetAttachDefQuarantineWindow = 10 * time.Minute
 )
 
 // Metrics represents server's metrics.
 type Metrics struct {
 	requestCounter *prometheus.CounterVec
+	// registered only when the network statuses are checked
+	staleNetworkStatusPods prometheus.Gauge
+	// registered only when the net-attach-defs are validated
+	invalidNetAttachDefs prometheus.Gauge
+	// registered only when the net-attach-defs are quarantined
+	quarantinedNetAttachDefs prometheus.Gauge
 }
 
 // Server represents an HTTP server listening to a unix socket. It will handle
@@ -60,6 +72,21 @@ type Server struct {
 	netdefInformer        cache.SharedIndexInformer
 
 	ignoreReadinessIndicator bool
+	drainingIndicatorFile    string
+	tracing                  *types.TracingConf
+	addOperations            addOperations
+	configManager            *config.Manager
+	networkStatusCheckPeriod time.Duration
+	// nil unless serializePodOperations is enabled
+	podLocks *podLocks
+	// nil unless validateNetAttachDefs is enabled; empty for all namespaces
+	netAttachDefValidationNamespaces []string
+	// nil unless netAttachDefQuarantineThreshold is set
+	quarantine *multus.NetAttachDefQuarantine
+	// nil unless namespaceInterfaceQuota is set
+	namespaceQuota *multus.NamespaceInterfaceQuota
+	// nil unless created by NewCNIServer
+	daemonConfig *ControllerNetConf
 }
 
 // PerNodeCertificate for auto certificate generation for per node
@@ -80,9 +107,47 @@ type ControllerNetConf struct {
 
 	MetricsPort *int `json:"metricsPort,omitempty"`
 
+	// Address (host:port) of the metric exporter; takes precedence over
+	// MetricsPort
+	MetricsAddress string `json:"metricsAddress,omitempty"`
+
 	// Option to point to the path of the unix domain socket through which the
 	// multus client / server communicate.
 	SocketDir string `json:"socketDir"`
 
+	// Path to a sentinel file; while it exists the daemon is draining and
+	// rejects CNI ADD requests, while still serving DEL and CHECK.
+	DrainingIndicatorFile string `json:"drainingIndicatorFile,omitempty"`
+
+	// Also serve the gRPC API on multus-grpc.sock in SocketDir
+	EnableGRPC bool `json:"enableGRPC,omitempty"`
+
+	// OpenTelemetry tracing of the CNI operations, exported to its endpoint
+	Tracing *types.TracingConf `json:"tracing,omitempty"`
+
+	// Period (e.g. "5m") of the comparison of the network-status annotations
+	// of the pods with the multus cache; unset disables it
+	NetworkStatusCheckPeriod string `json:"networkStatusCheckPeriod,omitempty"`
+
+	// Serialize the CNI operations of the containers of a pod, keyed by pod UID
+	SerializePodOperations bool `json:"serializePodOperations,omitempty"`
+
+	// Validate, once started, the CNI configs of the net-attach-defs of the
+	// NetAttachDefValidationNamespaces, or of all namespaces if empty
+	ValidateNetAttachDefs            bool     `json:"validateNetAttachDefs,omitempty"`
+	NetAttachDefValidationNamespaces []string `json:"netAttachDefValidationNamespaces,omitempty"`
+
+	// Quarantine the net-attach-defs whose delegates failed
+	// NetAttachDefQuarantineThreshold consecutive ADDs within
+	// NetAttachDefQuarantineWindow (e.g. "10m"), until they are updated;
+	// unset or 0 disables it
+	NetAttachDefQuarantineThreshold int    `json:"netAttachDefQuarantineThreshold,omitempty"`
+	NetAttachDefQuarantineWindow    string `json:"netAttachDefQuarantineWindow,omitempty"`
+
+	// Reject the ADDs which would attach more than NamespaceInterfaceQuota
+	// secondary interfaces to the containers of a namespace, as accounted
+	// from the multus cache; unset or 0 disables it
+	NamespaceInterfaceQuota int `json:"namespaceInterfaceQuota,omitempty"`
+
 	ConfigFileContents []byte `json:"-"`
 }
@@ -0,0 +1,118 @@
+// Copyright (c) 2026 Multus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// SourceEnv takes the parent trace context from the TRACEPARENT and
+	// TRACESTATE variables of the CNI request environment
+	SourceEnv = "env"
+	// SourceAnnotation takes the parent trace context from the
+	// v1.multus-cni.io/traceparent and v1.multus-cni.io/tracestate pod annotations
+	SourceAnnotation = "annotation"
+
+	traceParentEnv   = "TRACEPARENT"
+	traceStateEnv    = "TRACESTATE"
+	traceParentAnnot = "v1.multus-cni.io/traceparent"
+	traceStateAnnot  = "v1.multus-cni.io/tracestate"
+
+	instrumentationName = "gopkg.in/k8snetworkplumbingwg/multus-cni.v4"
+)
+
+// Tracer returns the tracer of multus. Until Setup is called, its spans are
+// not recorded.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup exports the spans of multus to the OTLP/HTTP endpoint (host:port).
+// The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, endpoint string, insecure bool) (func(context.Context) error, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter for %s: %v", endpoint, err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("multus"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// ValidSource reports whether source is a known trace context source; an
+// empty source means that no parent trace context is looked up
+func ValidSource(source string) bool {
+	return source == "" || source == SourceEnv || source == SourceAnnotation
+}
+
+// ContextFromEnv returns ctx with the remote parent span described by the
+// TRACEPARENT and TRACESTATE variables of env, if any
+func ContextFromEnv(ctx context.Context, env map[string]string) context.Context {
+	return extract(ctx, env[traceParentEnv], env[traceStateEnv])
+}
+
+// ContextFromAnnotations returns ctx with the remote parent span described by
+// the traceparent and tracestate annotations, if any
+func ContextFromAnnotations(ctx context.Context, annotations map[string]string) context.Context {
+	return extract(ctx, annotations[traceParentAnnot], annotations[traceStateAnnot])
+}
+
+func extract(ctx context.Context, traceParent, traceState string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{"traceparent": traceParent}
+	if traceState != "" {
+		carrier["tracestate"] = traceState
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// EndSpan records err, if any, on span and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Attribute keys of the multus spans
+var (
+	PodNamespaceKey = attribute.Key("k8s.pod.namespace")
+	PodNameKey      = attribute.Key("k8s.pod.name")
+	ContainerIDKey  = attribute.Key("container.id")
+	NetworkKey      = attribute.Key("cni.network")
+	IfNameKey       = attribute.Key("cni.ifname")
+)
@@ -16,12 +16,16 @@
 package types
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/containernetworking/cni/libcni"
@@ -30,6 +34,9 @@ import (
 	"github.com/containernetworking/cni/pkg/version"
 	nadutils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
+	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/tracing"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -40,8 +47,24 @@ const (
 	defaultReadinessIndicatorFile = ""
 	defaultMultusNamespace        = "kube-system"
 	defaultNonIsolatedNamespace   = "default"
+	defaultBandwidthPluginType    = "bandwidth"
+	// in seconds
+	defaultWaitForDefaultNetworkTimeout = 30
+	defaultAPIRequestTimeout            = 10
+	defaultAPIRequestRetries            = 2
+	defaultRetryMaxRetries              = 3
+	// in bytes, well over the size of any sane CNI config
+	defaultMaxDelegateConfigBytes = 1 << 20
+	// in milliseconds
+	defaultRetryInterval = 500
+	// the routing tables from defaultRouteTable to localRouteTable are the
+	// default, main and local ones of the kernel
+	defaultRouteTable = 253
+	localRouteTable   = 255
 )
 
+var defaultAllowedNetnsPrefixes = []string{"/var/run/netns", "/run/netns"}
+
 // LoadDelegateNetConfList reads DelegateNetConf from bytes
 func LoadDelegateNetConfList(bytes []byte, delegateConf *DelegateNetConf) error {
 	logging.Debugf("LoadDelegateNetConfList: %s, %v", string(bytes), delegateConf)
@@ -64,9 +87,21 @@ func LoadDelegateNetConfList(bytes []byte, delegateConf *DelegateNetConf) error
 
 // LoadDelegateNetConf converts raw CNI JSON into a DelegateNetConf structure
 func LoadDelegateNetConf(bytes []byte, netElement *NetworkSelectionElement, deviceID string, resourceName string) (*DelegateNetConf, error) {
-	var err error
 	logging.Debugf("LoadDelegateNetConf: %s, %v, %s", string(bytes), netElement, deviceID)
 
+	delegateConf, err := ParseDelegateNetConf(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyNetworkSelectionElement(delegateConf, netElement, deviceID, resourceName); err != nil {
+		return nil, err
+	}
+	return delegateConf, nil
+}
+
+// ParseDelegateNetConf converts raw CNI JSON into a DelegateNetConf structure
+// which no network selection element applies to yet
+func ParseDelegateNetConf(bytes []byte) (*DelegateNetConf, error) {
 	delegateConf := &DelegateNetConf{}
 	if err := json.Unmarshal(bytes, &delegateConf.Conf); err != nil {
 		return nil, logging.Errorf("LoadDelegateNetConf: error unmarshalling delegate config: %v", err)
@@ -78,10 +113,24 @@ func LoadDelegateNetConf(bytes []byte, netElement *NetworkSelectionElement, devi
 		if err := LoadDelegateNetConfList(bytes, delegateConf); err != nil {
 			return nil, logging.Errorf("LoadDelegateNetConf: failed with: %v", err)
 		}
+	}
+
+	delegateConf.Bytes = bytes
+
+	return delegateConf, nil
+}
+
+// ApplyNetworkSelectionElement applies the network selection element, if
+// any, and the device allocated to the attachment to a delegate returned by
+// ParseDelegateNetConf
+func ApplyNetworkSelectionElement(delegateConf *DelegateNetConf, netElement *NetworkSelectionElement, deviceID string, resourceName string) error {
+	var err error
+	bytes := delegateConf.Bytes
+	if delegateConf.ConfListPlugin {
 		if deviceID != "" {
 			bytes, err = addDeviceIDInConfList(bytes, deviceID)
 			if err != nil {
-				return nil, logging.Errorf("LoadDelegateNetConf: failed to add deviceID in NetConfList bytes: %v", err)
+				return logging.Errorf("LoadDelegateNetConf: failed to add deviceID in NetConfList bytes: %v", err)
 			}
 			delegateConf.ResourceName = resourceName
 			delegateConf.DeviceID = deviceID
@@ -89,14 +138,14 @@ func LoadDelegateNetConf(bytes []byte, netElement *NetworkSelectionElement, devi
 		if netElement != nil && netElement.CNIArgs != nil {
 			bytes, err = addCNIArgsInConfList(bytes, netElement.CNIArgs)
 			if err != nil {
-				return nil, logging.Errorf("LoadDelegateNetConf(): failed to add cni-args in NetConfList bytes: %v", err)
+				return logging.Errorf("LoadDelegateNetConf(): failed to add cni-args in NetConfList bytes: %v", err)
 			}
 		}
 	} else {
 		if deviceID != "" {
 			bytes, err = delegateAddDeviceID(bytes, deviceID)
 			if err != nil {
-				return nil, logging.Errorf("LoadDelegateNetConf: failed to add deviceID in NetConf bytes: %v", err)
+				return logging.Errorf("LoadDelegateNetConf: failed to add deviceID in NetConf bytes: %v", err)
 			}
 			// Save them for housekeeping
 			delegateConf.ResourceName = resourceName
@@ -105,7 +154,7 @@ func LoadDelegateNetConf(bytes []byte, netElement *NetworkSelectionElement, devi
 		if netElement != nil && netElement.CNIArgs != nil {
 			bytes, err = addCNIArgsInConfig(bytes, netElement.CNIArgs)
 			if err != nil {
-				return nil, logging.Errorf("LoadDelegateNetConf(): failed to add cni-args in NetConfList bytes: %v", err)
+				return logging.Errorf("LoadDelegateNetConf(): failed to add cni-args in NetConfList bytes: %v", err)
 			}
 		}
 	}
@@ -124,6 +173,15 @@ func LoadDelegateNetConf(bytes []byte, netElement *NetworkSelectionElement, devi
 		if netElement.IPRequest != nil {
 			delegateConf.IPRequest = netElement.IPRequest
 		}
+		if netElement.IPFromPool != "" {
+			delegateConf.IPFromPool = netElement.IPFromPool
+		}
+		if netElement.RouteTable != nil {
+			delegateConf.RouteTable = netElement.RouteTable
+		}
+		if netElement.RouteMetric != nil {
+			delegateConf.RouteMetric = netElement.RouteMetric
+		}
 		if netElement.BandwidthRequest != nil {
 			delegateConf.BandwidthRequest = netElement.BandwidthRequest
 		}
@@ -142,6 +200,13 @@ func LoadDelegateNetConf(bytes []byte, netElement *NetworkSelectionElement, devi
 		if netElement.InfinibandGUIDRequest != "" {
 			delegateConf.InfinibandGUIDRequest = netElement.InfinibandGUIDRequest
 		}
+		if netElement.NetnsRequest != "" {
+			delegateConf.NetnsRequest = netElement.NetnsRequest
+		}
+		if netElement.Description != "" {
+			delegateConf.Description = netElement.Description
+		}
+		delegateConf.PrimaryIPRequest = netElement.PrimaryIPRequest
 		if netElement.DeviceID != "" {
 			if deviceID != "" {
 				logging.Debugf("Warning: Both RuntimeConfig and ResourceMap provide deviceID. Ignoring RuntimeConfig")
@@ -153,12 +218,12 @@ func LoadDelegateNetConf(bytes []byte, netElement *NetworkSelectionElement, devi
 
 	delegateConf.Bytes = bytes
 
-	return delegateConf, nil
+	return nil
 }
 
 // mergeCNIRuntimeConfig creates CNI runtimeconfig from delegate
 func mergeCNIRuntimeConfig(runtimeConfig *RuntimeConfig, delegate *DelegateNetConf) *RuntimeConfig {
-	logging.Debugf("mergeCNIRuntimeConfig: %v %v", runtimeConfig, delegate)
+	logging.Debugf("mergeCNIRuntimeConfig: %v %s", runtimeConfig, delegate.Name)
 	var mergedRuntimeConfig RuntimeConfig
 
 	if runtimeConfig == nil {
@@ -179,6 +244,18 @@ func mergeCNIRuntimeConfig(runtimeConfig *RuntimeConfig, delegate *DelegateNetCo
 		if delegate.IPRequest != nil {
 			mergedRuntimeConfig.IPs = delegate.IPRequest
 		}
+		// the ipRanges of the runtime are those of the cluster network, a
+		// secondary network gets its ipFromPool only
+		mergedRuntimeConfig.IPRanges = nil
+		if delegate.IPFromPool != "" {
+			mergedRuntimeConfig.IPRanges = [][]IPRange{{{Subnet: delegate.IPFromPool}}}
+		}
+		if delegate.RouteTable != nil {
+			mergedRuntimeConfig.RouteTable = delegate.RouteTable
+		}
+		if delegate.RouteMetric != nil {
+			mergedRuntimeConfig.RouteMetric = delegate.RouteMetric
+		}
 		if delegate.MacRequest != "" {
 			mergedRuntimeConfig.Mac = delegate.MacRequest
 		}
@@ -188,6 +265,9 @@ func mergeCNIRuntimeConfig(runtimeConfig *RuntimeConfig, delegate *DelegateNetCo
 		if delegate.DeviceID != "" {
 			mergedRuntimeConfig.DeviceID = delegate.DeviceID
 		}
+		if delegate.NUMANode != nil {
+			mergedRuntimeConfig.NUMANode = delegate.NUMANode
+		}
 		logging.Debugf("mergeCNIRuntimeConfig: add runtimeConfig for net-attach-def: %v", mergedRuntimeConfig)
 	}
 	return &mergedRuntimeConfig
@@ -205,9 +285,12 @@ func CreateCNIRuntimeConf(args *skel.CmdArgs, k8sArgs *K8sArgs, ifName string, r
 
 // newCNIRuntimeConf creates the CNI `RuntimeConf` for the given ADD / DEL request.
 func newCNIRuntimeConf(containerID, sandboxID, podName, podNamespace, podUID, netNs, ifName string, rc *RuntimeConfig, delegate *DelegateNetConf) (*libcni.RuntimeConf, string) {
-	logging.Debugf("LoadCNIRuntimeConf: %s, %v %v", ifName, rc, delegate)
+	logging.Debugf("LoadCNIRuntimeConf: %s, %v", ifName, rc)
 
 	delegateRc := delegateRuntimeConfig(containerID, delegate, rc, ifName)
+	if delegate != nil && delegate.NetnsRequest != "" {
+		netNs = delegate.NetnsRequest
+	}
 	// In part, adapted from K8s pkg/kubelet/dockershim/network/cni/cni.go#buildCNIRuntimeConf
 	rt := createRuntimeConf(netNs, podNamespace, podName, containerID, sandboxID, podUID, ifName)
 
@@ -256,6 +339,15 @@ func newCNIRuntimeConf(containerID, sandboxID, podName, podNamespace, podUID, ne
 		if len(delegateRc.IPs) != 0 {
 			capabilityArgs["ips"] = delegateRc.IPs
 		}
+		if len(delegateRc.IPRanges) != 0 {
+			capabilityArgs["ipRanges"] = delegateRc.IPRanges
+		}
+		if delegateRc.RouteTable != nil {
+			capabilityArgs["routeTable"] = *delegateRc.RouteTable
+		}
+		if delegateRc.RouteMetric != nil {
+			capabilityArgs["routeMetric"] = *delegateRc.RouteMetric
+		}
 		if len(delegateRc.Mac) != 0 {
 			capabilityArgs["mac"] = delegateRc.Mac
 		}
@@ -264,10 +356,14 @@ func newCNIRuntimeConf(containerID, sandboxID, podName, podNamespace, podUID, ne
 		}
 		if delegateRc.DeviceID != "" {
 			capabilityArgs["deviceID"] = delegateRc.DeviceID
+			capabilityArgs["pciBusID"] = delegateRc.DeviceID
 		}
 		if delegateRc.CNIDeviceInfoFile != "" {
 			capabilityArgs["CNIDeviceInfoFile"] = delegateRc.CNIDeviceInfoFile
 		}
+		if delegateRc.NUMANode != nil {
+			capabilityArgs["numaNode"] = *delegateRc.NUMANode
+		}
 		rt.CapabilityArgs = capabilityArgs
 	}
 	return rt, cniDeviceInfoFile
@@ -322,6 +418,51 @@ func GetGatewayFromResult(result *cni100.Result) []net.IP {
 	return gateways
 }
 
+// LoadRetryPolicy reads, checks and defaults a retry policy, e.g. of the
+// annotation of a net-attach-def
+func LoadRetryPolicy(data []byte) (*RetryPolicy, error) {
+	policy := &RetryPolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	if err := checkRetryPolicy("retry policy", policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// checkRetryPolicy checks the retry policy named name, if any, and sets the
+// defaults of its unset fields
+func checkRetryPolicy(name string, policy *RetryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if len(policy.ErrorPatterns) == 0 {
+		return fmt.Errorf("%s must have errorPatterns", name)
+	}
+	for _, pattern := range policy.ErrorPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %v", name, pattern, err)
+		}
+	}
+	if policy.MaxRetries < 0 || policy.IntervalMilliseconds < 0 {
+		return fmt.Errorf("%s maxRetries and intervalMilliseconds must not be negative", name)
+	}
+	if policy.BackoffFactor != 0 && policy.BackoffFactor < 1 {
+		return fmt.Errorf("%s backoffFactor must be at least 1", name)
+	}
+	if policy.MaxRetries == 0 {
+		policy.MaxRetries = defaultRetryMaxRetries
+	}
+	if policy.IntervalMilliseconds == 0 {
+		policy.IntervalMilliseconds = defaultRetryInterval
+	}
+	if policy.BackoffFactor == 0 {
+		policy.BackoffFactor = 1
+	}
+	return nil
+}
+
 // GetDefaultNetConf returns NetConf with default variables
 func GetDefaultNetConf() *NetConf {
 	// LogToStderr's default value set to true
@@ -334,10 +475,39 @@ func GetDefaultNetConf() *NetConf {
 		NonIsolatedNamespaces:  []string{defaultNonIsolatedNamespace},
 		ReadinessIndicatorFile: defaultReadinessIndicatorFile,
 		SystemNamespaces:       []string{"kube-system"},
+
+		WaitForDefaultNetworkTimeout: defaultWaitForDefaultNetworkTimeout,
+		APIRequestTimeoutSeconds:     defaultAPIRequestTimeout,
+		APIRequestRetries:            defaultAPIRequestRetries,
+		MaxDelegateConfigBytes:       defaultMaxDelegateConfigBytes,
+		AllowedNetnsPrefixes:         defaultAllowedNetnsPrefixes,
+		InterfaceEvents:              InterfaceEventsPerInterface,
+		IPFamilyPreference:           IPFamilyPreferenceAsIs,
+		DefaultNetworksOrder:         DefaultNetworksAfterClusterNetwork,
+		CacheLayout:                  CacheLayoutFlat,
+		RouteConflictPolicy:          RouteConflictPolicyWarn,
+		ResultCNIVersionTarget:       ResultCNIVersionTargetMaster,
+		NetworkStatusFormat:          NetworkStatusFormatIndented,
+		BandwidthPluginTypes:         []string{defaultBandwidthPluginType},
 	}
 
 }
 
+// AnnotationKey returns the key of a network annotation, e.g.
+// NetworksAnnotation, under prefix, or DefaultAnnotationPrefix if empty
+func AnnotationKey(prefix, name string) string {
+	if prefix == "" {
+		prefix = DefaultAnnotationPrefix
+	}
+	return prefix + "/" + name
+}
+
+// AnnotationKey returns the key of a network annotation, e.g.
+// NetworksAnnotation, under the annotationPrefix of the configuration
+func (n *NetConf) AnnotationKey(name string) string {
+	return AnnotationKey(n.AnnotationPrefix, name)
+}
+
 // LoadNetConf converts inputs (i.e. stdin) to NetConf
 func LoadNetConf(bytes []byte) (*NetConf, error) {
 	netconf := GetDefaultNetConf()
@@ -380,7 +550,7 @@ func LoadNetConf(bytes []byte) (*NetConf, error) {
 	// the master plugin. Kubernetes CRD delegates are then appended to
 	// the existing delegate list and all delegates executed in-order.
 
-	if len(netconf.RawDelegates) == 0 && netconf.ClusterNetwork == "" {
+	if len(netconf.RawDelegates) == 0 && netconf.ClusterNetwork == "" && !netconf.AllowNoDefaultNetwork {
 		return nil, logging.Errorf("LoadNetConf: at least one delegate/clusterNetwork must be specified")
 	}
 
@@ -395,8 +565,138 @@ func LoadNetConf(bytes []byte) (*NetConf, error) {
 		netconf.NonIsolatedNamespaces = nonisolated
 	}
 
+	if netconf.Tracing != nil && !tracing.ValidSource(netconf.Tracing.TraceContextSource) {
+		return nil, logging.Errorf("LoadNetConf: unknown tracing traceContextSource %q, must be %q or %q",
+			netconf.Tracing.TraceContextSource, tracing.SourceEnv, tracing.SourceAnnotation)
+	}
+
+	if netconf.DeterministicMACs != nil {
+		if netconf.DeterministicMACs.IdentityLabel == "" {
+			netconf.DeterministicMACs.IdentityLabel = DefaultDeterministicMACIdentityLabel
+		}
+		if _, err := ParseMACPrefix(netconf.DeterministicMACs.Prefix); err != nil {
+			return nil, logging.Errorf("LoadNetConf: invalid deterministicMACs prefix %q: %v", netconf.DeterministicMACs.Prefix, err)
+		}
+	}
+
+	switch netconf.InterfaceEvents {
+	case InterfaceEventsPerInterface, InterfaceEventsSummary, InterfaceEventsDisabled:
+	default:
+		return nil, logging.Errorf("LoadNetConf: unknown interfaceEvents %q, must be one of %q, %q or %q",
+			netconf.InterfaceEvents, InterfaceEventsPerInterface, InterfaceEventsSummary, InterfaceEventsDisabled)
+	}
+
+	switch netconf.IPFamilyPreference {
+	case IPFamilyPreferenceIPv4, IPFamilyPreferenceIPv6, IPFamilyPreferenceAsIs:
+	default:
+		return nil, logging.Errorf("LoadNetConf: unknown ipFamilyPreference %q, must be one of %q, %q or %q",
+			netconf.IPFamilyPreference, IPFamilyPreferenceIPv4, IPFamilyPreferenceIPv6, IPFamilyPreferenceAsIs)
+	}
+
+	if netconf.APIRequestTimeoutSeconds <= 0 {
+		return nil, logging.Errorf("LoadNetConf: invalid apiRequestTimeoutSeconds %d, must be positive", netconf.APIRequestTimeoutSeconds)
+	}
+	if netconf.APIRequestRetries < 0 {
+		return nil, logging.Errorf("LoadNetConf: invalid apiRequestRetries %d, must not be negative", netconf.APIRequestRetries)
+	}
+	if netconf.MaxDelegateConfigBytes <= 0 {
+		return nil, logging.Errorf("LoadNetConf: invalid maxDelegateConfigBytes %d, must be positive", netconf.MaxDelegateConfigBytes)
+	}
+
+	switch netconf.DefaultNetworksOrder {
+	case DefaultNetworksAfterClusterNetwork, DefaultNetworksBeforeClusterNetwork:
+	default:
+		return nil, logging.Errorf("LoadNetConf: unknown defaultNetworksOrder %q, must be one of %q or %q",
+			netconf.DefaultNetworksOrder, DefaultNetworksAfterClusterNetwork, DefaultNetworksBeforeClusterNetwork)
+	}
+
+	for _, path := range netconf.StatusFieldRedactions {
+		for _, key := range strings.Split(path, ".") {
+			if key == "" {
+				return nil, logging.Errorf("LoadNetConf: invalid statusFieldRedactions path %q", path)
+			}
+		}
+	}
+
+	for _, pattern := range netconf.AddFailureAnnotationPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, logging.Errorf("LoadNetConf: invalid addFailureAnnotationPatterns pattern %q: %v", pattern, err)
+		}
+	}
+
+	for _, pattern := range netconf.AllowedMasterInterfaces {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, logging.Errorf("LoadNetConf: invalid allowedMasterInterfaces pattern %q: %v", pattern, err)
+		}
+	}
+
+	for _, rule := range netconf.NetworkInjectionRules {
+		if _, err := labels.Parse(rule.PodSelector); err != nil {
+			return nil, logging.Errorf("LoadNetConf: invalid networkInjectionRules podSelector %q: %v", rule.PodSelector, err)
+		}
+		if _, name, _, err := parseNetworkObjectName(rule.Network); err != nil {
+			return nil, logging.Errorf("LoadNetConf: invalid networkInjectionRules network %q: %v", rule.Network, err)
+		} else if name == "" {
+			return nil, logging.Errorf("LoadNetConf: invalid networkInjectionRules network %q: no network name", rule.Network)
+		}
+	}
+
+	switch netconf.CacheLayout {
+	case CacheLayoutFlat, CacheLayoutNested:
+	default:
+		return nil, logging.Errorf("LoadNetConf: unknown cacheLayout %q, must be one of %q or %q",
+			netconf.CacheLayout, CacheLayoutFlat, CacheLayoutNested)
+	}
+
+	if netconf.DisableDelegateCache {
+		if netconf.PreferCachedDelegates {
+			return nil, logging.Errorf("LoadNetConf: preferCachedDelegates needs the delegate cache, which disableDelegateCache disables")
+		}
+		if netconf.DelDeferSeconds > 0 {
+			return nil, logging.Errorf("LoadNetConf: delDeferSeconds needs the delegate cache, which disableDelegateCache disables")
+		}
+	}
+
+	switch netconf.RouteConflictPolicy {
+	case RouteConflictPolicyWarn, RouteConflictPolicyError:
+	default:
+		return nil, logging.Errorf("LoadNetConf: unknown routeConflictPolicy %q, must be one of %q or %q",
+			netconf.RouteConflictPolicy, RouteConflictPolicyWarn, RouteConflictPolicyError)
+	}
+
+	switch netconf.NetworkStatusFormat {
+	case NetworkStatusFormatIndented, NetworkStatusFormatCompact, NetworkStatusFormatGzip:
+	default:
+		return nil, logging.Errorf("LoadNetConf: unknown networkStatusFormat %q, must be one of %q, %q or %q",
+			netconf.NetworkStatusFormat, NetworkStatusFormatIndented, NetworkStatusFormatCompact, NetworkStatusFormatGzip)
+	}
+
+	switch netconf.ResultCNIVersionTarget {
+	case ResultCNIVersionTargetMaster:
+	case ResultCNIVersionTargetHighest:
+		if netconf.ResultCNIVersion != "" {
+			return nil, logging.Errorf("LoadNetConf: resultCNIVersionTarget %q cannot be set with resultCNIVersion", netconf.ResultCNIVersionTarget)
+		}
+	default:
+		return nil, logging.Errorf("LoadNetConf: unknown resultCNIVersionTarget %q, must be one of %q or %q",
+			netconf.ResultCNIVersionTarget, ResultCNIVersionTargetMaster, ResultCNIVersionTargetHighest)
+	}
+
+	if netconf.AnnotationPrefix != "" {
+		if errs := validation.IsDNS1123Subdomain(netconf.AnnotationPrefix); len(errs) > 0 {
+			return nil, logging.Errorf("LoadNetConf: invalid annotationPrefix %q: %s", netconf.AnnotationPrefix, strings.Join(errs, ", "))
+		}
+	}
+
+	if err := checkRetryPolicy("defaultNetworkRetry", netconf.DefaultNetworkRetry); err != nil {
+		return nil, logging.Errorf("LoadNetConf: %v", err)
+	}
+	if err := checkRetryPolicy("delegateRetryPolicy", netconf.DelegateRetryPolicy); err != nil {
+		return nil, logging.Errorf("LoadNetConf: %v", err)
+	}
+
 	// get RawDelegates and put delegates field
-	if netconf.ClusterNetwork == "" {
+	if netconf.ClusterNetwork == "" && (len(netconf.RawDelegates) > 0 || !netconf.AllowNoDefaultNetwork) {
 		// for Delegates
 		if len(netconf.RawDelegates) == 0 {
 			return nil, logging.Errorf("LoadNetConf: at least one delegate must be specified")
@@ -582,7 +882,41 @@ func CheckGatewayConfig(delegates []*DelegateNetConf) error {
 		return fmt.Errorf("multus does not support ECMP for default-route")
 	}
 
-	// set filter flag for each delegate
+	markGatewayFilters(delegates)
+	return nil
+}
+
+// CheckConditionalGatewayConfig checks the gatewayRequests of the delegates
+// which are candidate default routes, i.e. only the first reachable of them
+// is installed, marks them as ConditionalGateway and marks the
+// IsFilter{V4,V6}Gateway flags as CheckGatewayConfig does
+func CheckConditionalGatewayConfig(delegates []*DelegateNetConf) error {
+	for _, delegate := range delegates {
+		if delegate.GatewayRequest == nil || len(*delegate.GatewayRequest) == 0 {
+			continue
+		}
+		v4Gateways := 0
+		v6Gateways := 0
+		for _, gw := range *delegate.GatewayRequest {
+			if gw.To4() != nil {
+				v4Gateways++
+			} else {
+				v6Gateways++
+			}
+		}
+		if v4Gateways > 1 || v6Gateways > 1 {
+			return fmt.Errorf("multus does not support ECMP for default-route")
+		}
+		delegate.ConditionalGateway = true
+	}
+
+	markGatewayFilters(delegates)
+	return nil
+}
+
+// markGatewayFilters marks the IsFilter{V4,V6}Gateway flag of the delegates
+// without a gatewayRequest of the family
+func markGatewayFilters(delegates []*DelegateNetConf) {
 	for i, delegate := range delegates {
 		delegates[i].IsFilterV4Gateway = true
 		delegates[i].IsFilterV6Gateway = true
@@ -596,7 +930,35 @@ func CheckGatewayConfig(delegates []*DelegateNetConf) error {
 			}
 		}
 	}
-	return nil
+}
+
+// maxMACPrefixLen is the number of bytes of a MAC prefix, leaving at least 3
+// bytes to derive
+const maxMACPrefixLen = 3
+
+// ParseMACPrefix parses the colon-separated leading bytes of MAC addresses,
+// e.g. "0e:00", whose first byte must be locally administered and unicast.
+// An empty prefix is valid.
+func ParseMACPrefix(prefix string) (net.HardwareAddr, error) {
+	if prefix == "" {
+		return net.HardwareAddr{}, nil
+	}
+	parts := strings.Split(prefix, ":")
+	if len(parts) > maxMACPrefixLen {
+		return nil, fmt.Errorf("at most %d bytes", maxMACPrefixLen)
+	}
+	mac := make(net.HardwareAddr, 0, len(parts))
+	for _, part := range parts {
+		b, err := hex.DecodeString(part)
+		if err != nil || len(b) != 1 {
+			return nil, fmt.Errorf("%q is not a hexadecimal byte", part)
+		}
+		mac = append(mac, b[0])
+	}
+	if mac[0]&0x02 == 0 || mac[0]&0x01 != 0 {
+		return nil, fmt.Errorf("the first byte must be locally administered and unicast, e.g. 0e")
+	}
+	return mac, nil
 }
 
 // CheckSystemNamespaces checks whether given namespace is in systemNamespaces or not.
@@ -642,3 +1004,207 @@ func ReadinessIndicatorExistsNow(readinessIndicatorFileRaw string) (bool, error)
 	}
 	return true, nil
 }
+
+// networkNameExpr matches the DNS-1123 label format of attachment names
+var networkNameExpr = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+// parseNetworkObjectName splits one item of the comma-delimited networks
+// annotation (<namespace>/<network name>@<ifname>) into its parts
+func parseNetworkObjectName(podnetwork string) (string, string, string, error) {
+	var netNsName string
+	var netIfName string
+	var networkName string
+
+	slashItems := strings.Split(podnetwork, "/")
+	if len(slashItems) == 2 {
+		netNsName = strings.TrimSpace(slashItems[0])
+		networkName = slashItems[1]
+	} else if len(slashItems) == 1 {
+		networkName = slashItems[0]
+	} else {
+		return "", "", "", fmt.Errorf("invalid network object (failed at '/')")
+	}
+
+	atItems := strings.Split(networkName, "@")
+	networkName = strings.TrimSpace(atItems[0])
+	if len(atItems) == 2 {
+		netIfName = strings.TrimSpace(atItems[1])
+	} else if len(atItems) != 1 {
+		return "", "", "", fmt.Errorf("invalid network object (failed at '@')")
+	}
+
+	// Check and see if each item matches the specification for valid attachment name.
+	// "Valid attachment names must be comprised of units of the DNS-1123 label format"
+	// [a-z0-9]([-a-z0-9]*[a-z0-9])?
+	// It must start and end alphanumerically.
+	for _, item := range []string{netNsName, networkName} {
+		if !networkNameExpr.MatchString(item) && len([]rune(item)) > 0 {
+			return "", "", "", fmt.Errorf("failed to parse: one or more items did not match comma-delimited format (must consist of lower case alphanumeric characters). Must start and end with an alphanumeric character), mismatch @ '%v'", item)
+		}
+	}
+
+	if len(netIfName) > 0 {
+		if len(netIfName) > (syscall.IFNAMSIZ-1) || strings.ContainsAny(netIfName, " \t\n\v\f\r/") {
+			return "", "", "", fmt.Errorf("failed to parse interface name: must be less than 15 chars and not contain '/' or spaces. interface name '%s'", netIfName)
+		}
+	}
+
+	return netNsName, networkName, netIfName, nil
+}
+
+// ParseNetworkSelectionElements parses and validates the value of the networks
+// annotation of a pod, either in its comma-delimited or in its JSON form.
+// Elements without a namespace get podNamespace.
+func ParseNetworkSelectionElements(annotation, podNamespace string) ([]*NetworkSelectionElement, error) {
+	var networks []*NetworkSelectionElement
+
+	if annotation == "" {
+		return nil, fmt.Errorf("pod annotation does not have \"network\" as key")
+	}
+
+	if strings.ContainsAny(annotation, "[{\"") {
+		if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+			return nil, fmt.Errorf("failed to parse pod Network Attachment Selection Annotation JSON format: %v", err)
+		}
+	} else {
+		// Comma-delimited list of network attachment object names
+		for _, item := range strings.Split(annotation, ",") {
+			// Remove leading and trailing whitespace.
+			item = strings.TrimSpace(item)
+
+			// Parse network name (i.e. <namespace>/<network name>@<ifname>)
+			netNsName, networkName, netIfName, err := parseNetworkObjectName(item)
+			if err != nil {
+				return nil, err
+			}
+
+			networks = append(networks, &NetworkSelectionElement{
+				Name:             networkName,
+				Namespace:        netNsName,
+				InterfaceRequest: netIfName,
+			})
+		}
+	}
+
+	primaryIPRequested := false
+	for _, n := range networks {
+		if n == nil {
+			return nil, fmt.Errorf("network selection element must not be null")
+		}
+		if n.PrimaryIPRequest {
+			if primaryIPRequested {
+				return nil, fmt.Errorf("network selection element %q must not set primary-ip, another element already does", n.Name)
+			}
+			primaryIPRequested = true
+		}
+		if n.Namespace == "" {
+			n.Namespace = podNamespace
+		}
+		if n.Name != "" && len(n.Capabilities) > 0 {
+			return nil, fmt.Errorf("network selection element %q must not have both a name and capabilities", n.Name)
+		}
+		if len(n.InlineDelegate) > 0 && (n.Name != "" || len(n.Capabilities) > 0) {
+			return nil, fmt.Errorf("network selection element %q must not have a delegate besides a name or capabilities", n.Name)
+		}
+		if n.FallbackName != "" && n.Name == "" {
+			return nil, fmt.Errorf("network selection element with fallbackName %q must have a name", n.FallbackName)
+		}
+		if n.MacRequest != "" {
+			// validate MAC address
+			if _, err := net.ParseMAC(n.MacRequest); err != nil {
+				return nil, fmt.Errorf("failed to mac: %v", err)
+			}
+		}
+		if n.InfinibandGUIDRequest != "" {
+			// validate GUID address
+			if _, err := net.ParseMAC(n.InfinibandGUIDRequest); err != nil {
+				return nil, fmt.Errorf("failed to validate infiniband GUID: %v", err)
+			}
+		}
+		for _, ip := range n.IPRequest {
+			// validate IP address
+			if strings.Contains(ip, "/") {
+				if _, _, err := net.ParseCIDR(ip); err != nil {
+					return nil, fmt.Errorf("failed to parse CIDR %q: %v", ip, err)
+				}
+			} else if net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("failed to parse IP address %q", ip)
+			}
+		}
+		if n.IPFromPool != "" {
+			ip, ipNet, err := net.ParseCIDR(n.IPFromPool)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse ipFromPool %q: %v", n.IPFromPool, err)
+			}
+			if !ip.Equal(ipNet.IP) {
+				return nil, fmt.Errorf("ipFromPool %q is not a network CIDR, did you mean %q?", n.IPFromPool, ipNet.String())
+			}
+		}
+		if n.RouteTable != nil {
+			if table := *n.RouteTable; table < 1 || table > math.MaxUint32 {
+				return nil, fmt.Errorf("routeTable %d of network %q is out of range [1, %d]", table, n.Name, uint32(math.MaxUint32))
+			} else if table >= defaultRouteTable && table <= localRouteTable {
+				return nil, fmt.Errorf("routeTable %d of network %q is reserved for the default, main and local tables", table, n.Name)
+			}
+		}
+		if n.RouteMetric != nil {
+			if metric := *n.RouteMetric; metric < 0 || metric > math.MaxUint32 {
+				return nil, fmt.Errorf("routeMetric %d of network %q is out of range [0, %d]", metric, n.Name, uint32(math.MaxUint32))
+			}
+		}
+		// compatibility pre v3.2, will be removed in v4.0
+		if n.DeprecatedInterfaceRequest != "" && n.InterfaceRequest == "" {
+			n.InterfaceRequest = n.DeprecatedInterfaceRequest
+		}
+	}
+
+	return networks, nil
+}
+
+// NormalizeNetworkSelectionElements rewrites the legacy forms of a networks
+// annotation, i.e. the single string "ips" and "default-route" accepted by
+// multus 3.x, to lists. The other fields are kept as they are. It returns
+// whether the annotation changed; comma-delimited annotations never do.
+func NormalizeNetworkSelectionElements(annotation string) (string, bool, error) {
+	// the annotation must be valid in the first place
+	if _, err := ParseNetworkSelectionElements(annotation, ""); err != nil {
+		return "", false, err
+	}
+	if !strings.ContainsAny(annotation, "[{\"") {
+		return annotation, false, nil
+	}
+
+	var elements []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(annotation), &elements); err != nil {
+		return "", false, fmt.Errorf("failed to parse pod Network Attachment Selection Annotation JSON format: %v", err)
+	}
+	changed := false
+	for _, element := range elements {
+		for _, key := range []string{"ips", "default-route"} {
+			raw, ok := element[key]
+			if !ok {
+				continue
+			}
+			var single string
+			if err := json.Unmarshal(raw, &single); err != nil {
+				// already a list
+				continue
+			}
+			list, err := json.Marshal([]string{single})
+			if err != nil {
+				return "", false, err
+			}
+			element[key] = list
+			changed = true
+		}
+	}
+	if !changed {
+		return annotation, false, nil
+	}
+
+	normalized, err := json.Marshal(elements)
+	if err != nil {
+		return "", false, err
+	}
+	return string(normalized), true, nil
+}
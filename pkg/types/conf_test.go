@@ -20,7 +20,9 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/containernetworking/cni/pkg/skel"
@@ -330,6 +332,429 @@ var _ = Describe("config operations", func() {
 		Expect(netConf.ReadinessIndicatorFile).To(Equal("/etc/cni/net.d/foo"))
 	})
 
+	It("defaults interfaceEvents and rejects unknown values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "kubeconfig": "/etc/kubernetes/kubelet.conf",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel",
+      "isDefaultGateway": true
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.InterfaceEvents).To(Equal(InterfaceEventsPerInterface))
+
+		conf = `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "interfaceEvents": "sometimes",
+    "kubeconfig": "/etc/kubernetes/kubelet.conf",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel",
+      "isDefaultGateway": true
+    }]
+}`
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: unknown interfaceEvents "sometimes", must be one of "perInterface", "summary" or "disabled"`))
+	})
+
+	It("defaults ipFamilyPreference and rejects unknown values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.IPFamilyPreference).To(Equal(IPFamilyPreferenceAsIs))
+
+		conf = strings.Replace(conf, `"type": "multus",`, `"type": "multus", "ipFamilyPreference": "ipv5",`, 1)
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: unknown ipFamilyPreference "ipv5", must be one of "ipv4", "ipv6" or "as-is"`))
+	})
+
+	It("defaults the API request policy and rejects invalid values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.APIRequestTimeoutSeconds).To(Equal(10))
+		Expect(netConf.APIRequestRetries).To(Equal(2))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"type": "multus",`, `"type": "multus", "apiRequestTimeoutSeconds": 0,`, 1)))
+		Expect(err).To(MatchError("LoadNetConf: invalid apiRequestTimeoutSeconds 0, must be positive"))
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"type": "multus",`, `"type": "multus", "apiRequestRetries": -1,`, 1)))
+		Expect(err).To(MatchError("LoadNetConf: invalid apiRequestRetries -1, must not be negative"))
+	})
+
+	It("defaults defaultNetworksOrder and rejects unknown values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.DefaultNetworksOrder).To(Equal(DefaultNetworksAfterClusterNetwork))
+
+		conf = strings.Replace(conf, `"type": "multus",`, `"type": "multus", "defaultNetworksOrder": "first",`, 1)
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: unknown defaultNetworksOrder "first", must be one of "after-cluster-network" or "before-cluster-network"`))
+	})
+
+	It("defaults cacheLayout and rejects unknown values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.CacheLayout).To(Equal(CacheLayoutFlat))
+
+		conf = strings.Replace(conf, `"type": "multus",`, `"type": "multus", "cacheLayout": "deep",`, 1)
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: unknown cacheLayout "deep", must be one of "flat" or "nested"`))
+	})
+
+	It("requires a delegate or clusterNetwork unless allowNoDefaultNetwork is set", func() {
+		conf := `{
+    "name": "node-cni-network",
+    "type": "multus",
+    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml"
+}`
+		_, err := LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError("LoadNetConf: at least one delegate/clusterNetwork must be specified"))
+
+		netConf, err := LoadNetConf([]byte(strings.Replace(conf, `"type": "multus",`, `"type": "multus", "allowNoDefaultNetwork": true,`, 1)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.Delegates).To(BeEmpty())
+	})
+
+	It("rejects the options needing the delegate cache with disableDelegateCache", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus", "disableDelegateCache": true,
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.DisableDelegateCache).To(BeTrue())
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"type": "multus",`, `"type": "multus", "preferCachedDelegates": true,`, 1)))
+		Expect(err).To(MatchError(`LoadNetConf: preferCachedDelegates needs the delegate cache, which disableDelegateCache disables`))
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"type": "multus",`, `"type": "multus", "delDeferSeconds": 5,`, 1)))
+		Expect(err).To(MatchError(`LoadNetConf: delDeferSeconds needs the delegate cache, which disableDelegateCache disables`))
+	})
+
+	It("defaults routeConflictPolicy and rejects unknown values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.RouteConflictPolicy).To(Equal(RouteConflictPolicyWarn))
+
+		conf = strings.Replace(conf, `"type": "multus",`, `"type": "multus", "routeConflictPolicy": "ignore",`, 1)
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: unknown routeConflictPolicy "ignore", must be one of "warn" or "error"`))
+	})
+
+	It("defaults resultCNIVersionTarget and rejects unknown values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.ResultCNIVersionTarget).To(Equal(ResultCNIVersionTargetMaster))
+
+		conf = strings.Replace(conf, `"type": "multus",`, `"type": "multus", "resultCNIVersionTarget": "lowest",`, 1)
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: unknown resultCNIVersionTarget "lowest", must be one of "master" or "highest"`))
+	})
+
+	It("defaults the identityLabel of deterministicMACs and validates its prefix", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "deterministicMACs": {"prefix": "0e:00"},
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.DeterministicMACs.IdentityLabel).To(Equal(DefaultDeterministicMACIdentityLabel))
+
+		for prefix, expectedErr := range map[string]string{
+			"01":          "the first byte must be locally administered and unicast, e.g. 0e",
+			"0c":          "the first byte must be locally administered and unicast, e.g. 0e",
+			"0e:zz":       `"zz" is not a hexadecimal byte`,
+			"0e:0":        `"0" is not a hexadecimal byte`,
+			"0e:00:00:00": "at most 3 bytes",
+		} {
+			_, err = LoadNetConf([]byte(strings.Replace(conf, `"0e:00"`, fmt.Sprintf("%q", prefix), 1)))
+			Expect(err).To(MatchError(fmt.Sprintf("LoadNetConf: invalid deterministicMACs prefix %q: %s", prefix, expectedErr)))
+		}
+	})
+
+	It("defaults maxDelegateConfigBytes and rejects non-positive values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.MaxDelegateConfigBytes).To(Equal(1 << 20))
+
+		conf = strings.Replace(conf, `"type": "multus",`, `"type": "multus", "maxDelegateConfigBytes": 0,`, 1)
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: invalid maxDelegateConfigBytes 0, must be positive`))
+	})
+
+	It("defaults networkStatusFormat and rejects unknown values", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.NetworkStatusFormat).To(Equal(NetworkStatusFormatIndented))
+
+		conf = strings.Replace(conf, `"type": "multus",`, `"type": "multus", "networkStatusFormat": "zstd",`, 1)
+		_, err = LoadNetConf([]byte(conf))
+		Expect(err).To(MatchError(`LoadNetConf: unknown networkStatusFormat "zstd", must be one of "indented", "compact" or "gzip"`))
+	})
+
+	It("rejects the statusFieldRedactions with an empty key", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "statusFieldRedactions": ["mac", "device-info.pci.pci-address"],
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.StatusFieldRedactions).To(Equal([]string{"mac", "device-info.pci.pci-address"}))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"device-info.pci.pci-address"`, `"device-info..pci-address"`, 1)))
+		Expect(err).To(MatchError(`LoadNetConf: invalid statusFieldRedactions path "device-info..pci-address"`))
+	})
+
+	It("rejects the addFailureAnnotationPatterns which are not regular expressions", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "addFailureAnnotationPatterns": ["no IP addresses available"],
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.AddFailureAnnotationPatterns).To(Equal([]string{"no IP addresses available"}))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"no IP addresses available"`, `"no IP (addresses"`, 1)))
+		Expect(err).To(MatchError(ContainSubstring(`LoadNetConf: invalid addFailureAnnotationPatterns pattern "no IP (addresses"`)))
+	})
+
+	It("rejects the invalid allowedMasterInterfaces patterns", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "allowedMasterInterfaces": ["eth1", "ens1f*"],
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.AllowedMasterInterfaces).To(Equal([]string{"eth1", "ens1f*"}))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"ens1f*"`, `"ens1f["`, 1)))
+		Expect(err).To(MatchError(`LoadNetConf: invalid allowedMasterInterfaces pattern "ens1f[": syntax error in pattern`))
+	})
+
+	It("defaults and validates the defaultNetworkRetry", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "defaultNetworkRetry": {"errorPatterns": ["connection refused"]},
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.DefaultNetworkRetry).To(Equal(&RetryPolicy{
+			ErrorPatterns:        []string{"connection refused"},
+			MaxRetries:           3,
+			IntervalMilliseconds: 500,
+			BackoffFactor:        1,
+		}))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `["connection refused"]`, `["(refused"]`, 1)))
+		Expect(err).To(MatchError(ContainSubstring(`LoadNetConf: invalid defaultNetworkRetry pattern "(refused"`)))
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `["connection refused"]`, `[]`, 1)))
+		Expect(err).To(MatchError("LoadNetConf: defaultNetworkRetry must have errorPatterns"))
+	})
+
+	It("loads the delegateRetryPolicy", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "delegateRetryPolicy": {"errorPatterns": ["device or resource busy"], "maxRetries": 2, "backoffFactor": 2.5},
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.DelegateRetryPolicy).To(Equal(&RetryPolicy{
+			ErrorPatterns:        []string{"device or resource busy"},
+			MaxRetries:           2,
+			IntervalMilliseconds: 500,
+			BackoffFactor:        2.5,
+		}))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `2.5`, `0.5`, 1)))
+		Expect(err).To(MatchError(ContainSubstring("backoffFactor must be at least 1")))
+	})
+
+	It("builds the annotation keys from the annotationPrefix", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "annotationPrefix": "example.com",
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.AnnotationKey(NetworksAnnotation)).To(Equal("example.com/networks"))
+		Expect(AnnotationKey("", NetworkStatusAnnotation)).To(Equal("k8s.v1.cni.cncf.io/network-status"))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"example.com"`, `"Bad_Prefix"`, 1)))
+		Expect(err).To(MatchError(ContainSubstring(`LoadNetConf: invalid annotationPrefix "Bad_Prefix"`)))
+	})
+
+	DescribeTable("validates the networkInjectionRules", func(rule, expectedErr string) {
+		// expectedErr is the start of the error, as the label selector
+		// parser has its own messages
+		conf := fmt.Sprintf(`{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "networkInjectionRules": [%s],
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`, rule)
+		netConf, err := LoadNetConf([]byte(conf))
+		if expectedErr != "" {
+			Expect(err).To(MatchError(HavePrefix(expectedErr)))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.NetworkInjectionRules).To(HaveLen(1))
+	},
+		Entry("valid rule", `{"podSelector": "net=storage", "network": "infra/storage@stor0"}`, ""),
+		Entry("invalid podSelector", `{"podSelector": "net in storage", "network": "storage"}`,
+			`LoadNetConf: invalid networkInjectionRules podSelector "net in storage": `),
+		Entry("invalid network", `{"podSelector": "net=storage", "network": "a/b/c"}`,
+			`LoadNetConf: invalid networkInjectionRules network "a/b/c": invalid network object (failed at '/')`),
+		Entry("no network name", `{"podSelector": "net=storage", "network": "infra/"}`,
+			`LoadNetConf: invalid networkInjectionRules network "infra/": no network name`),
+	)
+
+	It("rejects an unknown tracing traceContextSource", func() {
+		conf := `{
+    "name": "defaultnetwork",
+    "type": "multus",
+    "tracing": {"endpoint": "otel-collector:4318", "traceContextSource": "annotation"},
+    "delegates": [{
+      "cniVersion": "0.3.0",
+      "name": "defaultnetwork",
+      "type": "flannel"
+    }]
+}`
+		netConf, err := LoadNetConf([]byte(conf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netConf.Tracing.TraceContextSource).To(Equal("annotation"))
+
+		_, err = LoadNetConf([]byte(strings.Replace(conf, `"annotation"`, `"header"`, 1)))
+		Expect(err).To(MatchError(`LoadNetConf: unknown tracing traceContextSource "header", must be "env" or "annotation"`))
+	})
+
 	It("check CheckSystemNamespaces() works fine", func() {
 		b1 := CheckSystemNamespaces("foobar", []string{"barfoo", "bafoo", "foobar"})
 		Expect(b1).To(BeTrue())
@@ -641,6 +1066,128 @@ var _ = Describe("config operations", func() {
 		Expect(rt.CapabilityArgs["portMappings"]).To(Equal(rc.PortMaps))
 	})
 
+	It("passes the NUMA node of the delegate as the numaNode capability", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+		}
+		k8sArgs := &K8sArgs{K8S_POD_NAME: "dummy", K8S_POD_NAMESPACE: "namespacedummy", K8S_POD_INFRA_CONTAINER_ID: "123456789"}
+		delegate, err := LoadDelegateNetConf([]byte(`{
+    "name": "net1",
+    "cniVersion": "0.3.1",
+    "type": "sriov",
+    "capabilities": {"numaNode": true}
+}`), nil, "0000:af:06.0", "intel.com/sriov")
+		Expect(err).NotTo(HaveOccurred())
+
+		rt, _ := CreateCNIRuntimeConf(args, k8sArgs, "net1", &RuntimeConfig{}, delegate)
+		Expect(rt.CapabilityArgs).NotTo(HaveKey("numaNode"))
+
+		numaNode := int64(1)
+		delegate.NUMANode = &numaNode
+		rt, _ = CreateCNIRuntimeConf(args, k8sArgs, "net1", &RuntimeConfig{}, delegate)
+		Expect(rt.CapabilityArgs["numaNode"]).To(BeEquivalentTo(1))
+		Expect(rt.CapabilityArgs["deviceID"]).To(Equal("0000:af:06.0"))
+	})
+
+	It("passes the ipFromPool of the delegate as the ipRanges capability", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+		}
+		k8sArgs := &K8sArgs{K8S_POD_NAME: "dummy", K8S_POD_NAMESPACE: "namespacedummy", K8S_POD_INFRA_CONTAINER_ID: "123456789"}
+		delegate, err := LoadDelegateNetConf([]byte(`{
+    "name": "net1",
+    "cniVersion": "0.3.1",
+    "type": "macvlan",
+    "capabilities": {"ipRanges": true},
+    "ipam": {"type": "host-local"}
+}`), &NetworkSelectionElement{Name: "net1", Namespace: "namespacedummy", IPFromPool: "10.0.5.0/24"}, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delegate.IPFromPool).To(Equal("10.0.5.0/24"))
+
+		rt, _ := CreateCNIRuntimeConf(args, k8sArgs, "net1", &RuntimeConfig{}, delegate)
+		Expect(rt.CapabilityArgs["ipRanges"]).To(Equal([][]IPRange{{{Subnet: "10.0.5.0/24"}}}))
+
+		delegate.IPFromPool = ""
+		rt, _ = CreateCNIRuntimeConf(args, k8sArgs, "net1", &RuntimeConfig{}, delegate)
+		Expect(rt.CapabilityArgs).NotTo(HaveKey("ipRanges"))
+	})
+
+	It("passes the ipRanges of the runtime to the master plugin only", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+		}
+		k8sArgs := &K8sArgs{K8S_POD_NAME: "dummy", K8S_POD_NAMESPACE: "namespacedummy", K8S_POD_INFRA_CONTAINER_ID: "123456789"}
+		netConf, err := LoadNetConf([]byte(`{
+    "name": "node-cni-network",
+    "type": "multus",
+    "kubeconfig": "/etc/kubernetes/node-kubeconfig.yaml",
+    "delegates": [{
+        "name": "weave1",
+        "cniVersion": "0.3.1",
+        "type": "weave-net",
+        "capabilities": {"ipRanges": true}
+    }],
+    "runtimeConfig": {"ipRanges": [[{"subnet": "10.244.0.0/24"}]]}
+}`))
+		Expect(err).NotTo(HaveOccurred())
+		podCIDR := [][]IPRange{{{Subnet: "10.244.0.0/24"}}}
+		Expect(netConf.RuntimeConfig.IPRanges).To(Equal(podCIDR))
+
+		rt, _ := CreateCNIRuntimeConf(args, k8sArgs, "eth0", netConf.RuntimeConfig, netConf.Delegates[0])
+		Expect(rt.CapabilityArgs["ipRanges"]).To(Equal(podCIDR))
+
+		delegate, err := LoadDelegateNetConf([]byte(`{
+    "name": "net1",
+    "cniVersion": "0.3.1",
+    "type": "macvlan",
+    "capabilities": {"ipRanges": true},
+    "ipam": {"type": "host-local"}
+}`), &NetworkSelectionElement{Name: "net1", Namespace: "namespacedummy"}, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		rt, _ = CreateCNIRuntimeConf(args, k8sArgs, "net1", netConf.RuntimeConfig, delegate)
+		Expect(rt.CapabilityArgs).NotTo(HaveKey("ipRanges"))
+
+		delegate.IPFromPool = "10.0.5.0/24"
+		rt, _ = CreateCNIRuntimeConf(args, k8sArgs, "net1", netConf.RuntimeConfig, delegate)
+		Expect(rt.CapabilityArgs["ipRanges"]).To(Equal([][]IPRange{{{Subnet: "10.0.5.0/24"}}}))
+		// the runtimeConfig of multus is left untouched
+		Expect(netConf.RuntimeConfig.IPRanges).To(Equal(podCIDR))
+	})
+
+	It("passes the routeTable and routeMetric of the delegate as capabilities", func() {
+		args := &skel.CmdArgs{
+			ContainerID: "123456789",
+			Netns:       testNS.Path(),
+			IfName:      "eth0",
+		}
+		k8sArgs := &K8sArgs{K8S_POD_NAME: "dummy", K8S_POD_NAMESPACE: "namespacedummy", K8S_POD_INFRA_CONTAINER_ID: "123456789"}
+		table, metric := int64(100), int64(50)
+		delegate, err := LoadDelegateNetConf([]byte(`{
+    "name": "net1",
+    "cniVersion": "0.3.1",
+    "type": "macvlan",
+    "capabilities": {"routeTable": true, "routeMetric": true}
+}`), &NetworkSelectionElement{Name: "net1", Namespace: "namespacedummy", RouteTable: &table, RouteMetric: &metric}, "", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*delegate.RouteTable).To(BeEquivalentTo(100))
+		Expect(*delegate.RouteMetric).To(BeEquivalentTo(50))
+
+		rt, _ := CreateCNIRuntimeConf(args, k8sArgs, "net1", &RuntimeConfig{}, delegate)
+		Expect(rt.CapabilityArgs).To(HaveKeyWithValue("routeTable", int64(100)))
+		Expect(rt.CapabilityArgs).To(HaveKeyWithValue("routeMetric", int64(50)))
+
+		delegate.RouteTable, delegate.RouteMetric = nil, nil
+		rt, _ = CreateCNIRuntimeConf(args, k8sArgs, "net1", &RuntimeConfig{}, delegate)
+		Expect(rt.CapabilityArgs).NotTo(HaveKey("routeTable"))
+		Expect(rt.CapabilityArgs).NotTo(HaveKey("routeMetric"))
+	})
+
 	It("creates a valid CNI runtime config with K8s args passed via CNI_ARGS environment variable", func() {
 		args := &skel.CmdArgs{
 			ContainerID: "123456789",
@@ -1021,4 +1568,152 @@ var _ = Describe("config operations", func() {
 		Expect(netconf.IsFilterV6Gateway).To(BeFalse())
 	})
 
+	It("accepts a default-route per delegate when it is conditional", func() {
+		gateways := func(ips ...string) *[]net.IP {
+			var list []net.IP
+			for _, ip := range ips {
+				list = append(list, net.ParseIP(ip))
+			}
+			return &list
+		}
+		delegates := []*DelegateNetConf{
+			{Name: "default"},
+			{Name: "net1", GatewayRequest: gateways("10.1.1.1")},
+			{Name: "net2", GatewayRequest: gateways("10.2.1.1", "fc00::1")},
+		}
+		Expect(CheckGatewayConfig(delegates)).To(MatchError("multus does not support ECMP for default-route"))
+
+		Expect(CheckConditionalGatewayConfig(delegates)).To(Succeed())
+		Expect(delegates[0].ConditionalGateway).To(BeFalse())
+		Expect(delegates[0].IsFilterV4Gateway).To(BeTrue())
+		Expect(delegates[1].ConditionalGateway).To(BeTrue())
+		Expect(delegates[1].IsFilterV4Gateway).To(BeFalse())
+		Expect(delegates[1].IsFilterV6Gateway).To(BeTrue())
+		Expect(delegates[2].ConditionalGateway).To(BeTrue())
+		Expect(delegates[2].IsFilterV6Gateway).To(BeFalse())
+
+		delegates[1].GatewayRequest = gateways("10.1.1.1", "10.1.1.254")
+		Expect(CheckConditionalGatewayConfig(delegates)).To(MatchError("multus does not support ECMP for default-route"))
+	})
+
+	Context("ParseNetworkSelectionElements", func() {
+		It("parses the comma-delimited form", func() {
+			networks, err := ParseNetworkSelectionElements("net1, other/net2@eth1", "test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(networks).To(Equal([]*NetworkSelectionElement{
+				{Name: "net1", Namespace: "test"},
+				{Name: "net2", Namespace: "other", InterfaceRequest: "eth1"},
+			}))
+		})
+
+		It("parses the JSON form", func() {
+			networks, err := ParseNetworkSelectionElements(`[
+				{"name": "net1", "ips": ["10.1.1.5/24", "2001:db8::5"], "mac": "c2:11:22:33:44:66"},
+				{"name": "net2", "namespace": "other", "interfaceRequest": "eth1"}
+			]`, "test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(networks).To(Equal([]*NetworkSelectionElement{
+				{Name: "net1", Namespace: "test", IPRequest: []string{"10.1.1.5/24", "2001:db8::5"}, MacRequest: "c2:11:22:33:44:66"},
+				{Name: "net2", Namespace: "other", InterfaceRequest: "eth1", DeprecatedInterfaceRequest: "eth1"},
+			}))
+		})
+
+		It("accepts a legacy string ips", func() {
+			networks, err := ParseNetworkSelectionElements(`[{"name": "net1", "ips": "1.1.0.4"}]`, "test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0].IPRequest).To(Equal([]string{"1.1.0.4"}))
+		})
+
+		DescribeTable("normalizes the legacy string ips and default-route", func(annotation, expected string, expectedChanged bool) {
+			normalized, changed, err := NormalizeNetworkSelectionElements(annotation)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(Equal(expectedChanged))
+			if expectedChanged {
+				Expect(normalized).To(MatchJSON(expected))
+			} else {
+				Expect(normalized).To(Equal(annotation))
+			}
+			// the normalized annotation selects the same networks
+			networks, err := ParseNetworkSelectionElements(annotation, "test")
+			Expect(err).NotTo(HaveOccurred())
+			normalizedNetworks, err := ParseNetworkSelectionElements(normalized, "test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(normalizedNetworks).To(Equal(networks))
+		},
+			Entry("string ips", `[{"name": "net1", "ips": "10.1.1.4/24"}]`,
+				`[{"name": "net1", "ips": ["10.1.1.4/24"]}]`, true),
+			Entry("string default-route", `[{"name": "net1", "default-route": "10.1.1.1"}]`,
+				`[{"name": "net1", "default-route": ["10.1.1.1"]}]`, true),
+			Entry("only the legacy elements", `[{"name": "net1", "namespace": "other", "interface": "net9", "ips": "10.1.1.4"}, {"name": "net2", "ips": ["10.2.1.4", "2001:db8::4"], "mac": "c2:b0:57:49:47:f1"}]`,
+				`[{"name": "net1", "namespace": "other", "interface": "net9", "ips": ["10.1.1.4"]}, {"name": "net2", "ips": ["10.2.1.4", "2001:db8::4"], "mac": "c2:b0:57:49:47:f1"}]`, true),
+			Entry("lists", `[{"name": "net1", "ips": ["10.1.1.4"], "default-route": ["10.1.1.1"]}]`, "", false),
+			Entry("comma-delimited", "net1,other/net2@net9", "", false),
+		)
+
+		It("does not normalize an invalid annotation", func() {
+			_, _, err := NormalizeNetworkSelectionElements(`[{"name": "net1", "ips": "10.1.1.400"}]`)
+			Expect(err).To(MatchError(`failed to parse IP address "10.1.1.400"`))
+		})
+
+		DescribeTable("rejects malformed annotations", func(annotation, expectedErr string) {
+			_, err := ParseNetworkSelectionElements(annotation, "test")
+			Expect(err).To(MatchError(expectedErr))
+		},
+			Entry("empty", "", `pod annotation does not have "network" as key`),
+			Entry("bad JSON", `[{"name": "net1"`, "failed to parse pod Network Attachment Selection Annotation JSON format: unexpected end of JSON input"),
+			Entry("null element", `[null]`, "network selection element must not be null"),
+			Entry("too many slashes", "a/b/c", "invalid network object (failed at '/')"),
+			Entry("upper case name", "Net1", "failed to parse: one or more items did not match comma-delimited format (must consist of lower case alphanumeric characters). Must start and end with an alphanumeric character), mismatch @ 'Net1'"),
+			Entry("bad MAC", `[{"name": "net1", "mac": "nope"}]`, "failed to mac: address nope: invalid MAC address"),
+			Entry("bad IP", `[{"name": "net1", "ips": "1.1.0.400"}]`, `failed to parse IP address "1.1.0.400"`),
+			Entry("ips of the wrong type", `[{"name": "net1", "ips": 4}]`, `failed to parse pod Network Attachment Selection Annotation JSON format: invalid "ips": must be a string or a list of strings, got 4`),
+			Entry("delegate besides a name", `[{"name": "net1", "delegate": {"type": "bridge"}}]`, `network selection element "net1" must not have a delegate besides a name or capabilities`),
+			Entry("two primary IPs", `[{"name": "net1", "primary-ip": true}, {"name": "net2", "primary-ip": true}]`, `network selection element "net2" must not set primary-ip, another element already does`),
+			Entry("route table 0", `[{"name": "net1", "routeTable": 0}]`, `routeTable 0 of network "net1" is out of range [1, 4294967295]`),
+			Entry("route table over 32 bits", `[{"name": "net1", "routeTable": 4294967296}]`, `routeTable 4294967296 of network "net1" is out of range [1, 4294967295]`),
+			Entry("main route table", `[{"name": "net1", "routeTable": 254}]`, `routeTable 254 of network "net1" is reserved for the default, main and local tables`),
+			Entry("negative route metric", `[{"name": "net1", "routeMetric": -1}]`, `routeMetric -1 of network "net1" is out of range [0, 4294967295]`),
+		)
+
+		It("parses the routeTable and routeMetric", func() {
+			networks, err := ParseNetworkSelectionElements(`[{"name": "net1", "routeTable": 100, "routeMetric": 0}]`, "test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(networks).To(HaveLen(1))
+			Expect(*networks[0].RouteTable).To(BeEquivalentTo(100))
+			Expect(*networks[0].RouteMetric).To(BeEquivalentTo(0))
+		})
+	})
+
+	Context("NetworkSelectionElement JSON decoding", func() {
+		DescribeTable("decodes ips and default-route as a string or a list", func(value string, expectedIPs []string, expectedGateways []net.IP) {
+			element := &NetworkSelectionElement{}
+			err := json.Unmarshal([]byte(fmt.Sprintf(`{"name": "net1", "ips": %s, "default-route": %s}`, value, value)), element)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(element.IPRequest).To(Equal(expectedIPs))
+			Expect(element.GatewayRequest).NotTo(BeNil())
+			Expect(*element.GatewayRequest).To(Equal(expectedGateways))
+		},
+			Entry("string", `"10.1.1.1"`, []string{"10.1.1.1"}, []net.IP{net.ParseIP("10.1.1.1")}),
+			Entry("single-element list", `["10.1.1.1"]`, []string{"10.1.1.1"}, []net.IP{net.ParseIP("10.1.1.1")}),
+			Entry("multi-element list", `["10.1.1.1", "2001:db8::1"]`, []string{"10.1.1.1", "2001:db8::1"}, []net.IP{net.ParseIP("10.1.1.1"), net.ParseIP("2001:db8::1")}),
+		)
+
+		It("leaves absent ips and default-route unset", func() {
+			element := &NetworkSelectionElement{}
+			Expect(json.Unmarshal([]byte(`{"name": "net1"}`), element)).To(Succeed())
+			Expect(element.IPRequest).To(BeNil())
+			Expect(element.GatewayRequest).To(BeNil())
+		})
+
+		DescribeTable("rejects invalid ips and default-route values", func(element, expectedErr string) {
+			err := json.Unmarshal([]byte(element), &NetworkSelectionElement{})
+			Expect(err).To(MatchError(expectedErr))
+		},
+			Entry("number ips", `{"name": "net1", "ips": 4}`, `invalid "ips": must be a string or a list of strings, got 4`),
+			Entry("object ips", `{"name": "net1", "ips": {"ip": "10.1.1.1"}}`, `invalid "ips": must be a string or a list of strings, got {"ip": "10.1.1.1"}`),
+			Entry("mixed list default-route", `{"name": "net1", "default-route": ["10.1.1.1", 4]}`, `invalid "default-route": must be a string or a list of strings, got ["10.1.1.1", 4]`),
+			Entry("bad default-route address", `{"name": "net1", "default-route": "10.1.1"}`, `invalid "default-route": invalid IP address "10.1.1"`),
+		)
+	})
 })
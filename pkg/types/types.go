@@ -16,6 +16,8 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
 	"net"
 
 	"gopkg.in/k8snetworkplumbingwg/multus-cni.v4/pkg/logging"
@@ -23,6 +25,99 @@ import (
 	"github.com/containernetworking/cni/pkg/types"
 	cni100 "github.com/containernetworking/cni/pkg/types/100"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Values of NetConf.InterfaceEvents
+const (
+	// InterfaceEventsPerInterface sends one AddedInterface event per interface
+	InterfaceEventsPerInterface = "perInterface"
+	// InterfaceEventsSummary sends a single AddedInterface event per pod ADD
+	InterfaceEventsSummary = "summary"
+	// InterfaceEventsDisabled sends no AddedInterface events
+	InterfaceEventsDisabled = "disabled"
+)
+
+// Values of NetConf.IPFamilyPreference
+const (
+	// IPFamilyPreferenceIPv4 lists the IPv4 addresses of an interface first
+	IPFamilyPreferenceIPv4 = "ipv4"
+	// IPFamilyPreferenceIPv6 lists the IPv6 addresses of an interface first
+	IPFamilyPreferenceIPv6 = "ipv6"
+	// IPFamilyPreferenceAsIs keeps the addresses in the delegate order
+	IPFamilyPreferenceAsIs = "as-is"
+)
+
+// Values of NetConf.DefaultNetworksOrder
+const (
+	// DefaultNetworksAfterClusterNetwork lists the defaultNetworks after the
+	// clusterNetwork
+	DefaultNetworksAfterClusterNetwork = "after-cluster-network"
+	// DefaultNetworksBeforeClusterNetwork lists the defaultNetworks before
+	// the clusterNetwork
+	DefaultNetworksBeforeClusterNetwork = "before-cluster-network"
+)
+
+// Values of NetConf.CacheLayout
+const (
+	// CacheLayoutFlat saves the delegates of a container in <cniDir>/<containerID>
+	CacheLayoutFlat = "flat"
+	// CacheLayoutNested saves the delegates of a container in
+	// <cniDir>/<pod namespace>/<pod UID>/<containerID>
+	CacheLayoutNested = "nested"
+)
+
+// Values of NetConf.NetworkStatusFormat
+const (
+	// NetworkStatusFormatIndented writes the network-status annotation as
+	// indented JSON
+	NetworkStatusFormatIndented = "indented"
+	// NetworkStatusFormatCompact writes the network-status annotation as
+	// single-line JSON with sorted keys
+	NetworkStatusFormatCompact = "compact"
+	// NetworkStatusFormatGzip writes the network-status annotation as the
+	// compact JSON, gzipped and base64-encoded after NetworkStatusGzipPrefix
+	NetworkStatusFormatGzip = "gzip"
+)
+
+// NetworkStatusGzipPrefix marks, and versions, a network-status annotation of
+// the NetworkStatusFormatGzip format
+const NetworkStatusGzipPrefix = "gzip+base64:v1:"
+
+// Values of NetConf.RouteConflictPolicy
+const (
+	// RouteConflictPolicyWarn keeps the route of the delegate and logs a warning
+	RouteConflictPolicyWarn = "warn"
+	// RouteConflictPolicyError fails the ADD
+	RouteConflictPolicyError = "error"
+)
+
+// Values of NetConf.ResultCNIVersionTarget
+const (
+	// ResultCNIVersionTargetMaster returns the result of the master plugin in
+	// its own CNI version
+	ResultCNIVersionTargetMaster = "master"
+	// ResultCNIVersionTargetHighest converts the result of the master plugin
+	// up to the highest CNI version of the delegate results; only its version
+	// changes
+	ResultCNIVersionTargetHighest = "highest"
+)
+
+// DefaultAnnotationPrefix is the prefix of the network annotation keys, unless
+// NetConf.AnnotationPrefix overrides it
+const DefaultAnnotationPrefix = "k8s.v1.cni.cncf.io"
+
+// Names of the network annotations, under the annotation prefix
+const (
+	// NetworksAnnotation selects the networks attached to the pod
+	NetworksAnnotation = "networks"
+	// NetworkStatusAnnotation is the network status written by multus
+	NetworkStatusAnnotation = "network-status"
+	// DefaultNetworkAnnotation overrides the default network of the pod
+	DefaultNetworkAnnotation = "default-network"
+	// PrimaryIPAnnotation is the primary IP of the pod, written by multus
+	// along with the network status
+	PrimaryIPAnnotation = "primary-ip"
 )
 
 // NetConf for cni config file written in json
@@ -65,6 +160,270 @@ type NetConf struct {
 
 	// Retry delegate DEL message to next when some error
 	RetryDeleteOnError bool `json:"retryDeleteOnError"`
+
+	// Log the errors of the delegate DELs and succeed anyway, so that they
+	// cannot block the deletion of the pod
+	IgnoreDelErrors bool `json:"ignoreDelErrors,omitempty"`
+
+	// Fail the attachment when a net-attach-def requests a device plugin
+	// resource but no device is allocated to the pod for it
+	NetworkResourceInjection bool `json:"networkResourceInjection"`
+
+	// Wait for the default network to have an IP address and a default route
+	// before attaching secondary networks
+	WaitForDefaultNetwork        bool `json:"waitForDefaultNetwork"`
+	WaitForDefaultNetworkTimeout int  `json:"waitForDefaultNetworkTimeout"`
+
+	// Timeout, in seconds, of each pod, net-attach-def and pod status
+	// request to the API server, and number of retries of the requests
+	// failing with a transient error
+	APIRequestTimeoutSeconds int `json:"apiRequestTimeoutSeconds"`
+	APIRequestRetries        int `json:"apiRequestRetries"`
+
+	// Maximum size, in bytes, of the CNI config of a delegate, checked before
+	// the config of a net-attach-def, CNI config file or inline delegate is
+	// parsed
+	MaxDelegateConfigBytes int `json:"maxDelegateConfigBytes"`
+
+	// Kubeconfig of the cluster to read net-attach-defs from, when they are
+	// not kept in the local cluster
+	ExternalNADKubeconfig string `json:"externalNADKubeconfig"`
+
+	// Allow network selection elements to place their interface into another
+	// network namespace, as long as its path is under one of the prefixes
+	AllowNetnsRequest    bool     `json:"allowNetnsRequest"`
+	AllowedNetnsPrefixes []string `json:"allowedNetnsPrefixes"`
+
+	// How AddedInterface events are sent: perInterface, summary or disabled
+	InterfaceEvents string `json:"interfaceEvents"`
+
+	// Add the cluster default network after the other networks instead of
+	// first; DEL runs in reverse order
+	DefaultNetworkLast bool `json:"defaultNetworkLast"`
+
+	// Whether the defaultNetworks come after or before the clusterNetwork in
+	// the delegate list
+	DefaultNetworksOrder string `json:"defaultNetworksOrder"`
+
+	// Add the consecutive secondary delegates concurrently, once the cluster
+	// default network is added
+	ParallelDelegates bool `json:"parallelDelegates"`
+
+	// Fail the attachment when a requested static IP is already assigned to
+	// a host interface
+	CheckHostIPConflicts bool `json:"checkHostIPConflicts"`
+
+	// CNI version of the result returned to the runtime, regardless of the
+	// version of the master plugin
+	ResultCNIVersion string `json:"resultCNIVersion"`
+
+	// CNI version the result returned to the runtime is converted to when
+	// resultCNIVersion is not set, see ResultCNIVersionTargetMaster and
+	// ResultCNIVersionTargetHighest
+	ResultCNIVersionTarget string `json:"resultCNIVersionTarget"`
+
+	// Allow neither delegates nor ClusterNetwork, for pods having only the
+	// networks of their annotations; the ADD still needs one delegate
+	AllowNoDefaultNetwork bool `json:"allowNoDefaultNetwork,omitempty"`
+
+	// Read the networks annotation from the controlling workload (e.g. the
+	// Deployment of a ReplicaSet) when the pod does not have one
+	InheritNetworksFromOwner bool `json:"inheritNetworksFromOwner"`
+
+	// Grace period in seconds during which a DEL following a recent ADD of the
+	// same container waits, and is dropped if another ADD comes in
+	DelDeferSeconds int `json:"delDeferSeconds"`
+
+	// OpenTelemetry tracing of the CNI operations
+	Tracing *TracingConf `json:"tracing,omitempty"`
+
+	// Derive a stable MAC address for the secondary attachments, requesting
+	// none, of the pods with a stable identity
+	DeterministicMACs *DeterministicMACConf `json:"deterministicMACs,omitempty"`
+
+	// Reuse the delegates cached by a previous ADD of the container instead
+	// of resolving them again from the API server
+	PreferCachedDelegates bool `json:"preferCachedDelegates"`
+
+	// If set, the delegates only get the CNI_* variables and these ones of
+	// the multus environment
+	DelegateEnvAllowlist []string `json:"delegateEnvAllowlist,omitempty"`
+
+	// Order of the IPv4 and IPv6 addresses of each interface in the results
+	// and network status: "ipv4", "ipv6" or "as-is"
+	IPFamilyPreference string `json:"ipFamilyPreference"`
+
+	// Add the default networks set by the annotations of the namespace of
+	// the pod to (or instead of) DefaultNetworks
+	NamespaceDefaultNetworks bool `json:"namespaceDefaultNetworks"`
+
+	// Directory where the network status of each container is also written,
+	// for node-local agents not reading the API server
+	NetworkStatusFile string `json:"networkStatusFile,omitempty"`
+
+	// Interface or network names of the delegates deleted first, in this
+	// order; the others are deleted in reverse ADD order
+	TeardownOrder []string `json:"teardownOrder,omitempty"`
+
+	// Layout of the files caching the delegates of each container in
+	// CNIDir: "flat" or "nested"
+	CacheLayout string `json:"cacheLayout"`
+
+	// Save the pod UID along with the delegates of each container, so that
+	// a DEL of another pod reusing the container ID leaves them alone
+	CachePodUID bool `json:"cachePodUID"`
+
+	// Do not cache the delegates of each container in CNIDir; the DEL
+	// resolves them again from the pod and its net-attach-defs
+	DisableDelegateCache bool `json:"disableDelegateCache,omitempty"`
+
+	// CNI cache directory (e.g. /var/lib/cni) where the result libcni
+	// cached for each delegate is also written, so that cnitool can CHECK
+	// and DEL the interfaces added by multus
+	ResultCacheDir string `json:"resultCacheDir,omitempty"`
+
+	// Directory where, at debug log level, the config received by each
+	// delegate on ADD is written
+	DelegateConfigDumpDir string `json:"delegateConfigDumpDir,omitempty"`
+
+	// Fields removed from the network status of each delegate, as dot
+	// separated JSON keys (e.g. "device-info.pci.pci-address")
+	StatusFieldRedactions []string `json:"statusFieldRedactions,omitempty"`
+
+	// Format of the network-status annotation: indented, compact or gzip
+	NetworkStatusFormat string `json:"networkStatusFormat"`
+
+	// Regular expressions matched against the error of a failed delegate
+	// ADD; on a match, the failure is recorded in a pod annotation (e.g. on
+	// IP pool exhaustion, so that a controller can reschedule the pod)
+	AddFailureAnnotationPatterns []string `json:"addFailureAnnotationPatterns,omitempty"`
+
+	// Uplink interfaces (shell patterns) a network selection element may
+	// set as the master of its delegate; none are allowed when empty
+	AllowedMasterInterfaces []string `json:"allowedMasterInterfaces,omitempty"`
+
+	// Allow network selection elements of pods in the inlineDelegateNamespaces
+	// to embed their own CNI config instead of naming a net-attach-def
+	AllowInlineDelegates     bool     `json:"allowInlineDelegates,omitempty"`
+	InlineDelegateNamespaces []string `json:"inlineDelegateNamespaces,omitempty"`
+
+	// Pass the MTU of the default network interface, from its result, to
+	// the secondary delegates added after it which set no MTU of their own
+	InheritDefaultMTU bool `json:"inheritDefaultMTU,omitempty"`
+
+	// Namespaces whose pods may pass portMappings, i.e. host ports, to the
+	// delegates; all may when unset
+	PortMappingNamespacePolicy *PortMappingNamespacePolicy `json:"portMappingNamespacePolicy,omitempty"`
+
+	// Networks attached to the pods whose labels match, besides the ones of
+	// their annotation
+	NetworkInjectionRules []NetworkInjectionRule `json:"networkInjectionRules,omitempty"`
+
+	// What to do when a route of the prevResult and one of the result of the
+	// delegate have the same destination but different gateways: "warn" or
+	// "error"
+	RouteConflictPolicy string `json:"routeConflictPolicy"`
+
+	// Node-local file of key=value lines, merged into the CNI args of every
+	// delegate; the args of the delegate and of the pod take precedence
+	NodeCNIArgsFile string `json:"nodeCNIArgsFile,omitempty"`
+
+	// Enable the bandwidth capability of the plugins of BandwidthPluginTypes
+	// which do not advertise it, so that the bandwidth requests of the pods
+	// reach them
+	AutoBandwidthCapability bool `json:"autoBandwidthCapability,omitempty"`
+	// Plugin types which get the bandwidth capability with
+	// AutoBandwidthCapability
+	BandwidthPluginTypes []string `json:"bandwidthPluginTypes,omitempty"`
+
+	// Prefix of the networks, network-status and default-network annotation
+	// keys, instead of DefaultAnnotationPrefix
+	AnnotationPrefix string `json:"annotationPrefix,omitempty"`
+
+	// Retries of the ADD of the default network when it fails with a
+	// transient error, e.g. while the primary CNI restarts
+	DefaultNetworkRetry *RetryPolicy `json:"defaultNetworkRetry,omitempty"`
+
+	// Retries of the ADD of every delegate, unless its net-attach-def has a
+	// retry policy of its own, when it fails with a transient error
+	DelegateRetryPolicy *RetryPolicy `json:"delegateRetryPolicy,omitempty"`
+
+	// File the JSON record of each completed ADD and DEL is appended to
+	AuditLogFile string `json:"auditLogFile,omitempty"`
+
+	// Name of the network, as in the network status, whose first IP is the
+	// primary IP of the pod, unless a network selection element sets
+	// "primary-ip"; the default network otherwise
+	PrimaryIPNetwork string `json:"primaryIPNetwork,omitempty"`
+
+	// Unix socket of the exec proxy executing the delegate plugins instead
+	// of multus
+	ExecProxySocket string `json:"execProxySocket,omitempty"`
+
+	// Let the pods with the default-route-selection annotation set to
+	// "reachable" get the default route of the first of their default-route
+	// requests whose gateway is reachable
+	ConditionalDefaultRoute bool `json:"conditionalDefaultRoute,omitempty"`
+}
+
+// RetryPolicy retries the ADD of a delegate while it fails with an error
+// matching one of the patterns
+type RetryPolicy struct {
+	// Regular expressions matched against the error of the ADD
+	ErrorPatterns []string `json:"errorPatterns"`
+	// Number of retries after the first ADD
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// Delay before the first retry, in milliseconds
+	IntervalMilliseconds int `json:"intervalMilliseconds,omitempty"`
+	// Factor the delay is multiplied by after each retry; 1, i.e. a
+	// constant delay, when unset
+	BackoffFactor float64 `json:"backoffFactor,omitempty"`
+}
+
+// NetworkInjectionRule attaches a network to the pods matching a label selector
+type NetworkInjectionRule struct {
+	// PodSelector is a label selector, e.g. "net=storage"
+	PodSelector string `json:"podSelector"`
+	// Network is given as in the networks annotation,
+	// i.e. [<namespace>/]<name>[@<ifname>]
+	Network string `json:"network"`
+}
+
+// PortMappingNamespacePolicy allows or denies the portMappings of the pods of
+// a namespace
+type PortMappingNamespacePolicy struct {
+	// Namespaces allowed; all but the denied ones when empty
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// Namespaces denied, even when also allowed
+	DeniedNamespaces []string `json:"deniedNamespaces,omitempty"`
+}
+
+// TracingConf specifies the OpenTelemetry tracing of the CNI operations
+type TracingConf struct {
+	// OTLP/HTTP endpoint (host:port) the spans are exported to by multus-daemon
+	Endpoint string `json:"endpoint"`
+	// Export over plain HTTP instead of HTTPS
+	Insecure bool `json:"insecure,omitempty"`
+	// Where the parent trace context is read from: env or annotation
+	TraceContextSource string `json:"traceContextSource,omitempty"`
+}
+
+// DefaultDeterministicMACIdentityLabel is the pod label identifying the pods
+// of a StatefulSet across their restarts
+const DefaultDeterministicMACIdentityLabel = "statefulset.kubernetes.io/pod-name"
+
+// DeterministicMACConf specifies how the MAC addresses of the attachments of
+// the pods with a stable identity are derived
+type DeterministicMACConf struct {
+	// Pod label whose value, in the namespace of the pod, is its identity;
+	// DefaultDeterministicMACIdentityLabel if unset
+	IdentityLabel string `json:"identityLabel,omitempty"`
+	// Leading bytes of the MAC addresses, e.g. "0e:00"; the first one must
+	// be a locally administered unicast address byte
+	Prefix string `json:"prefix,omitempty"`
+	// Mixed into the derivation, so that clusters sharing an L2 network get
+	// different MAC addresses
+	Seed string `json:"seed,omitempty"`
 }
 
 // RuntimeConfig specifies CNI RuntimeConfig
@@ -76,6 +435,15 @@ type RuntimeConfig struct {
 	InfinibandGUID    string          `json:"infinibandGUID,omitempty"`
 	DeviceID          string          `json:"deviceID,omitempty"`
 	CNIDeviceInfoFile string          `json:"CNIDeviceInfoFile,omitempty"`
+	NUMANode          *int64          `json:"numaNode,omitempty"`
+	IPRanges          [][]IPRange     `json:"ipRanges,omitempty"`
+	RouteTable        *int64          `json:"routeTable,omitempty"`
+	RouteMetric       *int64          `json:"routeMetric,omitempty"`
+}
+
+// IPRange is a range of the ipRanges capability, e.g. of host-local IPAM
+type IPRange struct {
+	Subnet string `json:"subnet"`
 }
 
 // PortMapEntry for CNI PortMapEntry
@@ -109,19 +477,174 @@ type DelegateNetConf struct {
 	GatewayRequest        *[]net.IP       `json:"default-route,omitempty"`
 	IsFilterV4Gateway     bool
 	IsFilterV6Gateway     bool
-	// MasterPlugin is only used internal housekeeping
-	MasterPlugin bool `json:"-"`
+	// MasterPlugin is only used internal housekeeping; it is cached as the
+	// cluster network is not always the first delegate
+	MasterPlugin bool `json:"masterPlugin,omitempty"`
 	// Conflist plugin is only used internal housekeeping
 	ConfListPlugin bool `json:"-"`
 	// DeviceID is only used internal housekeeping
 	DeviceID string `json:"deviceID,omitempty"`
 	// ResourceName is only used internal housekeeping
 	ResourceName string `json:"resourceName,omitempty"`
+	// NetnsRequest overrides the container netns for this delegate only
+	NetnsRequest string `json:"netnsRequest,omitempty"`
+	// IPFromPool is the CIDR passed as the only range of the ipRanges
+	// capability, for the IPAM of the delegate to allocate the IP from
+	IPFromPool string `json:"ipFromPool,omitempty"`
+	// RouteTable and RouteMetric are the routing table and metric of the
+	// routes of the interface, passed to the delegates advertising the
+	// routeTable and routeMetric capabilities
+	RouteTable  *int64 `json:"routeTable,omitempty"`
+	RouteMetric *int64 `json:"routeMetric,omitempty"`
+	// NUMANode is the NUMA node of the device, passed to the delegates
+	// advertising the numaNode capability
+	NUMANode *int64 `json:"numaNode,omitempty"`
+	// PostAddProbe is the connectivity check of the interface after ADD
+	PostAddProbe *PostAddProbe `json:"postAddProbe,omitempty"`
+	// ConfigSecretRef is the Secret key whose config is merged into the
+	// delegate config when the delegate is invoked
+	ConfigSecretRef *SecretKeyRef `json:"configSecretRef,omitempty"`
+	// SecretConfig is the config loaded from ConfigSecretRef; it is kept out
+	// of Bytes so that it is never cached
+	SecretConfig map[string]interface{} `json:"-"`
+	// Description is the human readable label of the network status of the
+	// delegate
+	Description string `json:"description,omitempty"`
+	// RetryPolicy retries the ADD of the delegate on transient errors
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+	// PrimaryIPRequest makes the first IP of the delegate the primary IP of
+	// the pod
+	PrimaryIPRequest bool `json:"primaryIPRequest,omitempty"`
+	// ConditionalGateway makes the GatewayRequest a candidate default route,
+	// installed only if it is the first reachable one
+	ConditionalGateway bool `json:"conditionalGateway,omitempty"`
+	// NetAttachDef is the namespace/name of the net-attach-def of the
+	// delegate and NetAttachDefResourceVersion its resourceVersion; they are
+	// only used internal housekeeping
+	NetAttachDef                string `json:"-"`
+	NetAttachDefResourceVersion string `json:"-"`
 
 	// Raw JSON
 	Bytes []byte
 }
 
+// DeepCopy returns a copy of the delegate which shares no memory with it,
+// except for the PrevResult of its configs
+func (d *DelegateNetConf) DeepCopy() *DelegateNetConf {
+	if d == nil {
+		return nil
+	}
+	out := *d
+	out.Conf = copyNetConf(d.Conf)
+	if d.ConfList.Plugins != nil {
+		out.ConfList.Plugins = make([]*types.NetConf, len(d.ConfList.Plugins))
+		for i, plugin := range d.ConfList.Plugins {
+			if plugin != nil {
+				conf := copyNetConf(*plugin)
+				out.ConfList.Plugins[i] = &conf
+			}
+		}
+	}
+	if d.IPRequest != nil {
+		out.IPRequest = append([]string{}, d.IPRequest...)
+	}
+	if d.PortMappingsRequest != nil {
+		out.PortMappingsRequest = make([]*PortMapEntry, len(d.PortMappingsRequest))
+		for i, entry := range d.PortMappingsRequest {
+			if entry != nil {
+				e := *entry
+				out.PortMappingsRequest[i] = &e
+			}
+		}
+	}
+	if d.BandwidthRequest != nil {
+		bandwidth := *d.BandwidthRequest
+		out.BandwidthRequest = &bandwidth
+	}
+	if d.GatewayRequest != nil {
+		gateways := make([]net.IP, len(*d.GatewayRequest))
+		for i, gw := range *d.GatewayRequest {
+			gateways[i] = append(net.IP(nil), gw...)
+		}
+		out.GatewayRequest = &gateways
+	}
+	out.RouteTable = copyInt64(d.RouteTable)
+	out.RouteMetric = copyInt64(d.RouteMetric)
+	out.NUMANode = copyInt64(d.NUMANode)
+	if d.PostAddProbe != nil {
+		probe := *d.PostAddProbe
+		out.PostAddProbe = &probe
+	}
+	if d.ConfigSecretRef != nil {
+		ref := *d.ConfigSecretRef
+		out.ConfigSecretRef = &ref
+	}
+	if d.SecretConfig != nil {
+		out.SecretConfig = runtime.DeepCopyJSON(d.SecretConfig)
+	}
+	if d.RetryPolicy != nil {
+		policy := *d.RetryPolicy
+		policy.ErrorPatterns = append([]string(nil), d.RetryPolicy.ErrorPatterns...)
+		out.RetryPolicy = &policy
+	}
+	if d.Bytes != nil {
+		out.Bytes = append([]byte{}, d.Bytes...)
+	}
+	return &out
+}
+
+func copyNetConf(conf types.NetConf) types.NetConf {
+	if conf.Capabilities != nil {
+		capabilities := make(map[string]bool, len(conf.Capabilities))
+		for capability, enabled := range conf.Capabilities {
+			capabilities[capability] = enabled
+		}
+		conf.Capabilities = capabilities
+	}
+	conf.DNS = *conf.DNS.Copy()
+	if conf.RawPrevResult != nil {
+		conf.RawPrevResult = runtime.DeepCopyJSON(conf.RawPrevResult)
+	}
+	if conf.ValidAttachments != nil {
+		conf.ValidAttachments = append([]types.GCAttachment(nil), conf.ValidAttachments...)
+	}
+	return conf
+}
+
+func copyInt64(i *int64) *int64 {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+// Values of PostAddProbe.Protocol
+const (
+	// PostAddProbeICMP sends an ICMP echo request to the target IP
+	PostAddProbeICMP = "icmp"
+	// PostAddProbeTCP connects to the target host:port
+	PostAddProbeTCP = "tcp"
+)
+
+// PostAddProbe is a connectivity check run from the pod network namespace
+// after the ADD of a delegate; the ADD fails if it does not succeed
+type PostAddProbe struct {
+	// Protocol is "icmp" or "tcp"
+	Protocol string `json:"protocol"`
+	// Target is an IP for icmp, or host:port for tcp
+	Target string `json:"target"`
+	// TimeoutSeconds bounds the probe, 1 second by default
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// SecretKeyRef refers to a key of a Secret
+type SecretKeyRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Key       string `json:"key"`
+}
+
 // NetworkSelectionElement represents one element of the JSON format
 // Network Attachment Selection Annotation as described in section 4.1.2
 // of the CRD specification.
@@ -131,6 +654,9 @@ type NetworkSelectionElement struct {
 	// Namespace contains the optional namespace that the network referenced
 	// by Name exists in
 	Namespace string `json:"namespace,omitempty"`
+	// FallbackName contains the optional name of the Network object, in the
+	// same namespace, selected when the one referenced by Name is not found
+	FallbackName string `json:"fallbackName,omitempty"`
 	// IPRequest contains an optional requested IP address for this network
 	// attachment
 	IPRequest []string `json:"ips,omitempty"`
@@ -158,6 +684,89 @@ type NetworkSelectionElement struct {
 	CNIArgs *map[string]interface{} `json:"cni-args"`
 	// GatewayRequest contains default route IP address for the pod
 	GatewayRequest *[]net.IP `json:"default-route,omitempty"`
+	// NetnsRequest contains an optional network namespace path that the
+	// interface of this attachment is created in instead of the pod's one
+	NetnsRequest string `json:"netns,omitempty"`
+	// Capabilities selects, instead of Name, the only net-attach-def of the
+	// namespace whose CNI config advertises all these capabilities
+	Capabilities map[string]bool `json:"capabilities,omitempty"`
+	// MasterRequest overrides the master uplink interface of the CNI config,
+	// e.g. for macvlan or ipvlan
+	MasterRequest string `json:"master,omitempty"`
+	// InlineDelegate contains, instead of Name, the CNI config (or conflist)
+	// of an anonymous network
+	InlineDelegate json.RawMessage `json:"delegate,omitempty"`
+	// Description contains an optional human readable label of the network
+	// attachment, written into its network status
+	Description string `json:"description,omitempty"`
+	// PrimaryIPRequest makes the first IP of the attachment the primary IP
+	// of the pod
+	PrimaryIPRequest bool `json:"primary-ip,omitempty"`
+	// IPFromPool contains an optional CIDR the IP of the attachment is
+	// allocated from, by an IPAM supporting the ipRanges capability
+	IPFromPool string `json:"ipFromPool,omitempty"`
+	// RouteTable contains an optional routing table the routes of the
+	// attachment are added to, by a plugin supporting the routeTable
+	// capability
+	RouteTable *int64 `json:"routeTable,omitempty"`
+	// RouteMetric contains an optional metric of the routes of the
+	// attachment, for a plugin supporting the routeMetric capability
+	RouteMetric *int64 `json:"routeMetric,omitempty"`
+}
+
+// UnmarshalJSON decodes a NetworkSelectionElement. Besides a list, "ips" and
+// "default-route" may be a single string, as accepted by multus 3.x, so that
+// annotations written for it keep working.
+func (n *NetworkSelectionElement) UnmarshalJSON(data []byte) error {
+	type element NetworkSelectionElement
+	aux := &struct {
+		IPRequest      json.RawMessage `json:"ips,omitempty"`
+		GatewayRequest json.RawMessage `json:"default-route,omitempty"`
+		*element
+	}{element: (*element)(n)}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	ips, err := stringOrStringSlice(aux.IPRequest)
+	if err != nil {
+		return fmt.Errorf("invalid \"ips\": %v", err)
+	}
+	n.IPRequest = ips
+
+	gateways, err := stringOrStringSlice(aux.GatewayRequest)
+	if err != nil {
+		return fmt.Errorf("invalid \"default-route\": %v", err)
+	}
+	n.GatewayRequest = nil
+	if gateways != nil {
+		gatewayIPs := make([]net.IP, 0, len(gateways))
+		for _, gateway := range gateways {
+			ip := net.ParseIP(gateway)
+			if ip == nil {
+				return fmt.Errorf("invalid \"default-route\": invalid IP address %q", gateway)
+			}
+			gatewayIPs = append(gatewayIPs, ip)
+		}
+		n.GatewayRequest = &gatewayIPs
+	}
+	return nil
+}
+
+// stringOrStringSlice decodes a JSON string or list of strings into a slice
+func stringOrStringSlice(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err != nil {
+		return nil, fmt.Errorf("must be a string or a list of strings, got %s", string(raw))
+	}
+	return []string{single}, nil
 }
 
 // K8sArgs is the valid CNI_ARGS used for Kubernetes
@@ -174,6 +783,8 @@ type K8sArgs struct {
 type ResourceInfo struct {
 	Index     int
 	DeviceIDs []string
+	// NUMA node of the devices, when known
+	NUMANodes map[string]int64
 }
 
 // ResourceClient provides a kubelet Pod resource handle